@@ -0,0 +1,169 @@
+// Command migrate-media copies uploads and their thumbnails from local storage (MEDIA_DIR) to the S3-compatible
+// bucket configured with the S3_* variables, so that a server can switch MEDIA_STORAGE from
+// local to s3. It reads the same environment (or .env file) as the server.
+//
+//	go run ./cmd/migrate-media [-delete-local] [-dry-run]
+//
+// Objects already in the bucket with the right size are skipped, so it can be re-run; with
+// -delete-local their local copies are removed too.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/Emmanuel326/chatserver/internal/config"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/Emmanuel326/chatserver/internal/ports/media"
+	"github.com/Emmanuel326/chatserver/internal/ports/sqlite"
+	"github.com/Emmanuel326/chatserver/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// pageSize is how many uploads are loaded at a time.
+const pageSize = 100
+
+func main() {
+	deleteLocal := flag.Bool("delete-local", false, "delete each local file once it is in the bucket")
+	dryRun := flag.Bool("dry-run", false, "only report what would be copied")
+	flag.Parse()
+
+	logger.InitGlobalLogger()
+	defer logger.Sync()
+	log := logger.Log()
+
+	cfg := config.Load()
+	db := sqlite.InitDB(cfg)
+	defer db.Close()
+	sqlite.Migrate(db)
+
+	source, err := media.NewLocalStore(cfg.MEDIA_DIR)
+	if err != nil {
+		log.Fatal("Failed to open local media storage", zap.Error(err))
+	}
+	// The S3 store stages files in MEDIA_DIR before sending them; keep that away from the source.
+	stagingDir, err := os.MkdirTemp("", "migrate-media-")
+	if err != nil {
+		log.Fatal("Failed to create staging directory", zap.Error(err))
+	}
+	defer os.RemoveAll(stagingDir)
+	cfg.MEDIA_STORAGE = "s3"
+	cfg.MEDIA_DIR = stagingDir
+	target, err := media.NewStore(cfg)
+	if err != nil {
+		log.Fatal("Failed to open S3 media storage", zap.Error(err))
+	}
+
+	ctx := context.Background()
+	mediaRepo := sqlite.NewMediaRepository(db)
+
+	counts := map[outcome]int{}
+	afterID := ""
+	for {
+		page, err := mediaRepo.ListReady(ctx, afterID, pageSize)
+		if err != nil {
+			log.Fatal("Failed to list uploads", zap.Error(err))
+		}
+		for _, m := range page {
+			afterID = m.ID
+
+			keys := []string{m.StorageKey()}
+			if m.Image != nil {
+				for _, thumbnail := range m.Image.Thumbnails {
+					keys = append(keys, domain.ThumbnailKey(m.ID, thumbnail.Size))
+				}
+			}
+			for _, key := range keys {
+				counts[migrateObject(ctx, source, target, key, *dryRun, *deleteLocal)]++
+			}
+		}
+		if len(page) < pageSize {
+			break
+		}
+	}
+
+	log.Info("Media migration finished",
+		zap.Int("copied", counts[copied]),
+		zap.Int("skipped", counts[skipped]),
+		zap.Int("missing", counts[missing]),
+		zap.Int("failed", counts[failed]),
+		zap.Bool("dry_run", *dryRun))
+	if counts[failed] > 0 {
+		os.Exit(1)
+	}
+}
+
+// outcome is what happened to one stored object.
+type outcome int
+
+const (
+	copied  outcome = iota
+	skipped         // already in the bucket
+	missing         // neither local nor in the bucket
+	failed
+)
+
+// migrateObject copies the object stored under key unless the bucket already has it.
+func migrateObject(ctx context.Context, source *media.LocalStore, target domain.MediaStore, key string, dryRun, deleteLocal bool) outcome {
+	log := logger.Log().With(zap.String("key", key))
+
+	sourceSize, sourceErr := source.Stat(ctx, key)
+	if sourceErr != nil && !errors.Is(sourceErr, domain.ErrMediaNotStored) {
+		log.Error("Failed to read local file", zap.Error(sourceErr))
+		return failed
+	}
+	targetSize, targetErr := target.Stat(ctx, key)
+	if targetErr == nil && (sourceErr != nil || targetSize == sourceSize) {
+		if deleteLocal && !dryRun && sourceErr == nil {
+			deleteLocalFile(ctx, source, key)
+		}
+		return skipped
+	}
+	if sourceErr != nil {
+		log.Warn("Object has no local file")
+		return missing
+	}
+	if dryRun {
+		log.Info("Would copy object", zap.Int64("size", sourceSize))
+		return copied
+	}
+
+	if err := copyObject(ctx, source, target, key, sourceSize); err != nil {
+		log.Error("Failed to copy object", zap.Error(err))
+		return failed
+	}
+	if deleteLocal {
+		deleteLocalFile(ctx, source, key)
+	}
+	return copied
+}
+
+// deleteLocalFile removes a local file that is safely in the bucket.
+func deleteLocalFile(ctx context.Context, source *media.LocalStore, key string) {
+	if err := source.Delete(ctx, key); err != nil {
+		logger.Log().Warn("Failed to delete local file", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// copyObject streams one object to the target and checks the stored size.
+func copyObject(ctx context.Context, source *media.LocalStore, target domain.MediaStore, key string, size int64) error {
+	content, err := source.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	if _, err := target.Put(ctx, key, content); err != nil {
+		return err
+	}
+	stored, err := target.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	if stored != size {
+		return errors.New("stored size does not match the local file")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/Emmanuel326/chatserver/internal/ws"
+	"github.com/gin-gonic/gin"
+)
+
+// AccountHandler contains the dependencies required by the password reset and email verification endpoints.
+type AccountHandler struct {
+	AccountService domain.AccountService
+	Hub            *ws.Hub
+}
+
+// NewAccountHandler creates a new handler instance.
+func NewAccountHandler(accountService domain.AccountService, hub *ws.Hub) *AccountHandler {
+	return &AccountHandler{
+		AccountService: accountService,
+		Hub:            hub,
+	}
+}
+
+// ForgotPassword handles POST /v1/auth/password/forgot. The response is the same whether or
+// not the address is registered.
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	if err := h.AccountService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		log.Printf("Failed to start password reset for %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start password reset"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address is registered, a reset link has been sent"})
+}
+
+// ResetPassword handles POST /v1/auth/password/reset. All of the user's sessions are revoked
+// and their live WebSocket connections closed.
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	userID, err := h.AccountService.ResetPassword(c.Request.Context(), req.Token, req.Password)
+	if err != nil {
+		if e, ok := err.(*domain.ValidationError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+			return
+		}
+		log.Printf("Failed to reset password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	h.Hub.DisconnectUser(userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset. Please log in again."})
+}
+
+// VerifyEmail handles POST /v1/auth/email/verify with the token from the verification email.
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req TokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	if err := h.AccountService.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		if e, ok := err.(*domain.ValidationError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+			return
+		}
+		log.Printf("Failed to verify email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+}
+
+// ResendVerification handles POST /v1/auth/email/resend. It works without a token so users
+// blocked by REQUIRE_EMAIL_VERIFICATION can get a new link; like ForgotPassword it never
+// reveals whether the address is registered.
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	if err := h.AccountService.ResendVerificationEmail(c.Request.Context(), req.Email); err != nil {
+		log.Printf("Failed to resend verification email to %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address is registered and unverified, a verification link has been sent"})
+}
@@ -0,0 +1,312 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Emmanuel326/chatserver/internal/api/middleware"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/Emmanuel326/chatserver/internal/ws"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAdminPageLimit = 50
+	maxAdminPageLimit     = 200
+)
+
+// AdminHandler contains the dependencies required by the server administrator endpoints.
+type AdminHandler struct {
+	AdminService domain.AdminService
+	Hub          *ws.Hub // Used to close the sockets of users who were signed out and of deleted groups
+}
+
+// NewAdminHandler creates a new handler instance.
+func NewAdminHandler(adminService domain.AdminService, hub *ws.Hub) *AdminHandler {
+	return &AdminHandler{
+		AdminService: adminService,
+		Hub:          hub,
+	}
+}
+
+// ListUsers handles GET /v1/admin/users?q=&cursor=&limit=, searching usernames and emails.
+// Disabled and deleted accounts are included.
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+	afterID, limit, ok := parseAdminPage(c)
+	if !ok {
+		return
+	}
+
+	users, err := h.AdminService.SearchUsers(c.Request.Context(), adminID, c.Query("q"), afterID, limit)
+	if err != nil {
+		respondAdminError(c, err, "Failed to search users")
+		return
+	}
+
+	nextCursor := ""
+	if len(users) == limit {
+		nextCursor = strconv.FormatInt(users[len(users)-1].ID, 10)
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "next_cursor": nextCursor})
+}
+
+// DisableUser handles POST /v1/admin/users/:userID/disable. The user is signed out everywhere,
+// their API tokens are revoked and their live sockets are closed.
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+// EnableUser handles POST /v1/admin/users/:userID/enable.
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+func (h *AdminHandler) setDisabled(c *gin.Context, disabled bool) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+	userID, ok := parseIDParam(c, "userID")
+	if !ok {
+		return
+	}
+	req, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.AdminService.SetUserDisabled(c.Request.Context(), adminID, userID, disabled, req.Reason)
+	if err != nil {
+		respondAdminError(c, err, "Failed to update user")
+		return
+	}
+	if disabled {
+		h.Hub.DisconnectUser(userID)
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// SetAdmin handles PUT /v1/admin/users/:userID/admin, granting or revoking server administrator rights.
+func (h *AdminHandler) SetAdmin(c *gin.Context) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+	userID, ok := parseIDParam(c, "userID")
+	if !ok {
+		return
+	}
+	var req SetAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	user, err := h.AdminService.SetUserAdmin(c.Request.Context(), adminID, userID, *req.IsAdmin)
+	if err != nil {
+		respondAdminError(c, err, "Failed to update user")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser handles DELETE /v1/admin/users/:userID. The account is anonymized and signed out;
+// its messages are kept.
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+	userID, ok := parseIDParam(c, "userID")
+	if !ok {
+		return
+	}
+	req, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	if err := h.AdminService.DeleteUser(c.Request.Context(), adminID, userID, req.Reason); err != nil {
+		respondAdminError(c, err, "Failed to delete user")
+		return
+	}
+	h.Hub.DisconnectUser(userID)
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted", "user_id": userID})
+}
+
+// ForceLogout handles POST /v1/admin/users/:userID/logout, revoking every session of the user
+// and closing their live sockets.
+func (h *AdminHandler) ForceLogout(c *gin.Context) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+	userID, ok := parseIDParam(c, "userID")
+	if !ok {
+		return
+	}
+
+	if err := h.AdminService.ForceLogout(c.Request.Context(), adminID, userID); err != nil {
+		respondAdminError(c, err, "Failed to sign out user")
+		return
+	}
+	h.Hub.DisconnectUser(userID)
+	c.JSON(http.StatusOK, gin.H{"message": "User signed out everywhere", "user_id": userID})
+}
+
+// ListGroups handles GET /v1/admin/groups?q=&cursor=&limit=, searching every group including private ones.
+func (h *AdminHandler) ListGroups(c *gin.Context) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+	afterID, limit, ok := parseAdminPage(c)
+	if !ok {
+		return
+	}
+
+	groups, err := h.AdminService.SearchGroups(c.Request.Context(), adminID, c.Query("q"), afterID, limit)
+	if err != nil {
+		respondAdminError(c, err, "Failed to search groups")
+		return
+	}
+
+	nextCursor := ""
+	if len(groups) == limit {
+		nextCursor = strconv.FormatInt(groups[len(groups)-1].ID, 10)
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": groups, "next_cursor": nextCursor})
+}
+
+// GetGroup handles GET /v1/admin/groups/:groupID, returning the group and its members.
+func (h *AdminHandler) GetGroup(c *gin.Context) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+	groupID, ok := parseIDParam(c, "groupID")
+	if !ok {
+		return
+	}
+
+	group, err := h.AdminService.GetGroup(c.Request.Context(), adminID, groupID)
+	if err != nil {
+		respondAdminError(c, err, "Failed to load group")
+		return
+	}
+	for _, member := range group.Members {
+		member.Online = h.Hub.IsUserOnline(member.UserID)
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteGroup handles DELETE /v1/admin/groups/:groupID for any group.
+func (h *AdminHandler) DeleteGroup(c *gin.Context) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+	groupID, ok := parseIDParam(c, "groupID")
+	if !ok {
+		return
+	}
+	req, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	memberIDs, err := h.AdminService.DeleteGroup(c.Request.Context(), adminID, groupID, req.Reason)
+	if err != nil {
+		respondAdminError(c, err, "Failed to delete group")
+		return
+	}
+	h.Hub.DisconnectGroup(groupID, memberIDs)
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully", "group_id": groupID})
+}
+
+// Connections handles GET /v1/admin/connections with the hub's live connection counts.
+func (h *AdminHandler) Connections(c *gin.Context) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+
+	stats, err := h.AdminService.ConnectionStats(c.Request.Context(), adminID)
+	if err != nil {
+		respondAdminError(c, err, "Failed to load connection stats")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// ListAuditLog handles GET /v1/admin/audit?actor_id=&action=&target_type=&target_id=&cursor=&limit=,
+// newest entries first. The cursor is the ID of the last entry on the previous page.
+func (h *AdminHandler) ListAuditLog(c *gin.Context) {
+	adminID, _ := middleware.GetUserIDFromContext(c)
+	beforeID, limit, ok := parseAdminPage(c)
+	if !ok {
+		return
+	}
+
+	filter := domain.AuditFilter{
+		Action:     domain.AuditAction(c.Query("action")),
+		TargetType: c.Query("target_type"),
+	}
+	for param, dst := range map[string]*int64{"actor_id": &filter.ActorID, "target_id": &filter.TargetID} {
+		if value := c.Query(param); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			*dst = parsed
+		}
+	}
+
+	entries, err := h.AdminService.ListAuditLog(c.Request.Context(), adminID, filter, beforeID, limit)
+	if err != nil {
+		respondAdminError(c, err, "Failed to load audit log")
+		return
+	}
+
+	nextCursor := ""
+	if len(entries) == limit {
+		nextCursor = strconv.FormatInt(entries[len(entries)-1].ID, 10)
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "next_cursor": nextCursor})
+}
+
+// parseAdminPage reads the cursor and limit query parameters shared by the admin listings.
+func parseAdminPage(c *gin.Context) (int64, int, bool) {
+	var cursor int64
+	if value := c.Query("cursor"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return 0, 0, false
+		}
+		cursor = parsed
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAdminPageLimit)))
+	if err != nil || limit <= 0 || limit > maxAdminPageLimit {
+		limit = defaultAdminPageLimit
+	}
+	return cursor, limit, true
+}
+
+// parseIDParam parses a positive numeric path parameter.
+func parseIDParam(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return id, true
+}
+
+// bindAdminAction reads the optional reason of an administrator action; an empty body is fine.
+func bindAdminAction(c *gin.Context) (AdminActionRequest, bool) {
+	var req AdminActionRequest
+	if c.Request.ContentLength == 0 {
+		return req, true
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return req, false
+	}
+	return req, true
+}
+
+// respondAdminError maps domain errors from the admin service to HTTP responses.
+func respondAdminError(c *gin.Context, err error, fallback string) {
+	switch e := err.(type) {
+	case *domain.ValidationError:
+		c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+	case *domain.NotFoundError:
+		c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+	case *domain.ForbiddenError:
+		c.JSON(http.StatusForbidden, gin.H{"error": e.Error()})
+	default:
+		log.Printf("%s: %v", fallback, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/api/middleware"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// APITokenHandler contains the dependencies required by the bot and API token endpoints.
+type APITokenHandler struct {
+	APITokenService domain.APITokenService
+}
+
+// NewAPITokenHandler creates a new handler instance.
+func NewAPITokenHandler(apiTokenService domain.APITokenService) *APITokenHandler {
+	return &APITokenHandler{APITokenService: apiTokenService}
+}
+
+// CreateBot handles POST /v1/bots, creating a bot account owned by the caller.
+func (h *APITokenHandler) CreateBot(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	var req CreateBotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	bot, err := h.APITokenService.CreateBot(c.Request.Context(), userID, req.Username)
+	if err != nil {
+		respondAPITokenError(c, err, "Failed to create bot")
+		return
+	}
+
+	c.JSON(http.StatusCreated, bot)
+}
+
+// ListBots handles GET /v1/bots, listing the caller's bots.
+func (h *APITokenHandler) ListBots(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	bots, err := h.APITokenService.ListBots(c.Request.Context(), userID)
+	if err != nil {
+		respondAPITokenError(c, err, "Failed to list bots")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bots": bots})
+}
+
+// CreateToken handles POST /v1/tokens. The plaintext token is returned once and cannot be retrieved later.
+func (h *APITokenHandler) CreateToken(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must not be negative"})
+		return
+	}
+
+	params := domain.CreateAPITokenParams{Name: req.Name, Scopes: req.Scopes, BotID: req.BotID}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		params.ExpiresAt = &expiresAt
+	}
+
+	token, plaintext, err := h.APITokenService.CreateToken(c.Request.Context(), userID, params)
+	if err != nil {
+		respondAPITokenError(c, err, "Failed to create API token")
+		return
+	}
+
+	c.JSON(http.StatusCreated, APITokenResponse{APIToken: token, Token: plaintext})
+}
+
+// ListTokens handles GET /v1/tokens, listing the tokens the caller created (values are never shown again).
+func (h *APITokenHandler) ListTokens(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	tokens, err := h.APITokenService.ListTokens(c.Request.Context(), userID)
+	if err != nil {
+		respondAPITokenError(c, err, "Failed to list API tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// RevokeToken handles DELETE /v1/tokens/:tokenID.
+func (h *APITokenHandler) RevokeToken(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(c.Param("tokenID"), 10, 64)
+	if err != nil || tokenID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.APITokenService.RevokeToken(c.Request.Context(), userID, tokenID); err != nil {
+		respondAPITokenError(c, err, "Failed to revoke API token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API token revoked"})
+}
+
+// respondAPITokenError maps domain errors from the APITokenService to HTTP responses.
+func respondAPITokenError(c *gin.Context, err error, fallback string) {
+	switch e := err.(type) {
+	case *domain.ValidationError:
+		c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+	case *domain.NotFoundError:
+		c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+	case *domain.ForbiddenError:
+		c.JSON(http.StatusForbidden, gin.H{"error": e.Error()})
+	case *domain.ConflictError:
+		c.JSON(http.StatusConflict, gin.H{"error": e.Error()})
+	default:
+		log.Printf("%s: %v", fallback, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
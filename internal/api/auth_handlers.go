@@ -0,0 +1,144 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Emmanuel326/chatserver/internal/api/middleware"
+	"github.com/Emmanuel326/chatserver/internal/auth"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/Emmanuel326/chatserver/internal/ws"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthHandler contains the dependencies required by the session (refresh/logout) endpoints.
+type AuthHandler struct {
+	SessionService domain.SessionService
+	JWTManager     *auth.JWTManager
+	Hub            *ws.Hub
+}
+
+// NewAuthHandler creates a new handler instance.
+func NewAuthHandler(sessionService domain.SessionService, jwtManager *auth.JWTManager, hub *ws.Hub) *AuthHandler {
+	return &AuthHandler{
+		SessionService: sessionService,
+		JWTManager:     jwtManager,
+		Hub:            hub,
+	}
+}
+
+// Refresh handles POST /v1/auth/refresh. The refresh token is rotated: the one presented
+// stops working and a new access/refresh token pair is returned.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	session, refreshToken, err := h.SessionService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if e, ok := err.(*domain.UnauthorizedError); ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": e.Error()})
+			return
+		}
+		log.Printf("Failed to refresh session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	token, err := h.JWTManager.GenerateToken(session.UserID, session.ID)
+	if err != nil {
+		log.Printf("Failed to generate JWT for user %d: %v", session.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.JWTManager.Expiry.Seconds()),
+	})
+}
+
+// Logout handles POST /v1/auth/logout. It revokes the caller's session (and with it every
+// token issued for it), denylists the presented access token and closes the session's sockets.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, ok := middleware.GetClaimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.SessionService.RevokeSession(ctx, claims.SessionID); err != nil {
+		log.Printf("Failed to revoke session %s for user %d: %v", claims.SessionID, claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	if claims.ExpiresAt != nil {
+		if err := h.SessionService.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			log.Printf("Failed to denylist token %s for user %d: %v", claims.ID, claims.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	h.Hub.DisconnectSession(claims.SessionID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// ListSessions handles GET /v1/sessions, listing where the user is logged in.
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	claims, ok := middleware.GetClaimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	sessions, err := h.SessionService.ListSessions(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Failed to list sessions for user %d: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	response := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = SessionResponse{Session: session, Current: session.ID == claims.SessionID}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession handles DELETE /v1/sessions/:sessionID. The session's tokens stop working
+// and its live WebSocket connections are closed.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+	sessionID := c.Param("sessionID")
+
+	if err := h.SessionService.RevokeUserSession(c.Request.Context(), userID, sessionID); err != nil {
+		if _, ok := err.(*domain.NotFoundError); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		log.Printf("Failed to revoke session %s for user %d: %v", sessionID, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	h.Hub.DisconnectSession(sessionID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// JWKS handles GET /.well-known/jwks.json, publishing the public keys other services can use
+// to verify our access tokens. The set is empty when tokens are signed with a shared secret.
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.JWTManager.JWKS())
+}
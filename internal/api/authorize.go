@@ -0,0 +1,96 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Emmanuel326/chatserver/internal/api/middleware"
+	"github.com/Emmanuel326/chatserver/internal/authz"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// authorizeRoute enforces the Action that authz.Routes declares for each secured route before
+// its handler runs. It must come after middleware.AuthMiddleware. The resource comes from the
+// route's path parameters; routes whose resource is not in the path (e.g. GET /v1/users), or
+// whose parameter does not parse, are left to the handler, which validates and checks them itself.
+func authorizeRoute(authorizer domain.Authorizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, ok := authz.RouteFor(c.Request.Method, c.FullPath())
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No authorization policy for this endpoint"})
+			c.Abort()
+			return
+		}
+		userID, exists := middleware.GetUserIDFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+			c.Abort()
+			return
+		}
+
+		action, resource, ok := routeResource(c, policy.Action)
+		if !ok {
+			c.Next()
+			return
+		}
+		if err := authorizer.Can(c.Request.Context(), domain.UserSubject(userID), action, resource); err != nil {
+			log.Printf("Refused %s %s for user %d: %v", c.Request.Method, c.FullPath(), userID, err)
+			if restricted, ok := err.(*domain.PostingRestrictedError); ok {
+				respondPostingRestricted(c, restricted)
+			} else {
+				respondGroupError(c, err, "Failed to authorize request")
+			}
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// routeResource returns the decision to make for a route declaring action, with the resource
+// taken from its path, and false when the path does not name the resource.
+func routeResource(c *gin.Context, action domain.Action) (domain.Action, domain.Resource, bool) {
+	switch action {
+	case domain.ActionOwnAccount, domain.ActionServerAdmin, domain.ActionGroupCreate, domain.ActionGroupDiscover, domain.ActionMediaUpload:
+		return action, domain.NoResource, true
+
+	case domain.ActionUserView:
+		id, ok := pathID(c, "userID")
+		return action, domain.UserResource(id), ok
+
+	case domain.ActionUserMessage:
+		id, ok := pathID(c, "recipientID")
+		return action, domain.UserResource(id), ok
+
+	case domain.ActionMediaView:
+		mediaID := c.Param("mediaID")
+		return action, domain.MediaResource(mediaID), mediaID != ""
+
+	case domain.ActionMessageView, domain.ActionMessagePin:
+		id, ok := pathID(c, "messageID")
+		return action, domain.MessageResource(id), ok
+	}
+
+	// Group actions. Conversations (group_<id> or user_<id>) declare the group action; the
+	// conversation with a user needs ActionUserMessage instead.
+	if value := c.Param("conversationID"); value != "" {
+		conversation, err := domain.ParseConversation(value)
+		if err != nil {
+			return action, domain.NoResource, false
+		}
+		if conversation.GroupID == 0 {
+			return domain.ActionUserMessage, domain.UserResource(conversation.PeerID), true
+		}
+		return action, domain.GroupResource(conversation.GroupID), true
+	}
+	id, ok := pathID(c, "groupID")
+	return action, domain.GroupResource(id), ok
+}
+
+// pathID parses a positive ID path parameter.
+func pathID(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	return id, err == nil && id > 0
+}
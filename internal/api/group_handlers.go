@@ -4,20 +4,30 @@ import (
 	"log" 
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Emmanuel326/chatserver/internal/api/middleware"
 	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/Emmanuel326/chatserver/internal/ws"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultDirectoryLimit = 20
+	maxDirectoryLimit     = 100
+	defaultMemberLimit    = 50
+	maxMemberLimit        = 200
+)
+
 // GroupHandler handles HTTP requests related to chat groups.
 type GroupHandler struct {
 	GroupService domain.GroupService
+	Hub          *ws.Hub // Used for member presence and to detach live clients from deleted groups
 }
 
 // NewGroupHandler creates a new GroupHandler.
-func NewGroupHandler(groupService domain.GroupService) *GroupHandler {
-	return &GroupHandler{GroupService: groupService}
+func NewGroupHandler(groupService domain.GroupService, hub *ws.Hub) *GroupHandler {
+	return &GroupHandler{GroupService: groupService, Hub: hub}
 }
 
 // ListUserGroups handles retrieving all groups a user is a member of.
@@ -58,7 +68,9 @@ func (h *GroupHandler) CreateGroup(c *gin.Context) {
 
 	// 2. Parse request body
 	var req struct {
-		Name string `json:"name" binding:"required"`
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+		IsPublic    bool   `json:"is_public"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: group name is required"})
@@ -66,7 +78,7 @@ func (h *GroupHandler) CreateGroup(c *gin.Context) {
 	}
 
 	// 3. Call GroupService to create the group
-	group, err := h.GroupService.CreateGroup(c.Request.Context(), req.Name, ownerID)
+	group, err := h.GroupService.CreateGroup(c.Request.Context(), req.Name, req.Description, req.IsPublic, ownerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group", "details": err.Error()})
 		return
@@ -77,6 +89,8 @@ func (h *GroupHandler) CreateGroup(c *gin.Context) {
 		"group_id": group.ID,
 		"name": group.Name,
 		"owner_id": group.OwnerID,
+		"description": group.Description,
+		"is_public": group.IsPublic,
 	})
 }
 
@@ -116,18 +130,26 @@ func (h *GroupHandler) AddMember(c *gin.Context) {
 	// 4. Call GroupService to add the member
 	err = h.GroupService.AddMember(c.Request.Context(), groupID, req.UserID, inviterID)
 	if err != nil {
-		// Note: GroupService will handle checks like user existence or group existence
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member", "details": err.Error()})
+		// Note: GroupService will handle checks like user existence, group existence and bans
+		respondGroupError(c, err, "Failed to add member")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Member added successfully"})
 }
 
-// GetMembers handles the retrieval of members for a specific group.
-// GET /v1/groups/:groupID/members
+// GetMembers handles the retrieval of member profiles for a specific group.
+// Only members of the group may list its members.
+// GET /v1/groups/:groupID/members?q=&cursor=&limit=
 func (h *GroupHandler) GetMembers(c *gin.Context) {
-	// 1. Get Group ID from URL parameter
+	// 1. Get authenticated UserID (must be a member of the group)
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	// 2. Get Group ID from URL parameter
 	groupIDStr := c.Param("groupID")
 	groupID, err := strconv.ParseInt(groupIDStr, 10, 64)
 	if err != nil || groupID == 0 {
@@ -135,12 +157,362 @@ func (h *GroupHandler) GetMembers(c *gin.Context) {
 		return
 	}
 
-	// 2. Call GroupService to get members
-	members, err := h.GroupService.GetMembers(c.Request.Context(), groupID)
+	// 3. Parse pagination and search parameters. The cursor is the last user ID of the previous page.
+	var afterUserID int64
+	if cursor := c.Query("cursor"); cursor != "" {
+		afterUserID, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || afterUserID < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultMemberLimit)))
+	if err != nil || limit <= 0 || limit > maxMemberLimit {
+		limit = defaultMemberLimit
+	}
+
+	// 4. Call GroupService to get members
+	members, err := h.GroupService.ListMembers(c.Request.Context(), groupID, userID, c.Query("q"), afterUserID, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group members", "details": err.Error()})
+		respondGroupError(c, err, "Failed to retrieve group members")
+		return
+	}
+
+	// 5. Attach live presence from the Hub
+	if h.Hub != nil {
+		for _, m := range members {
+			m.Online = h.Hub.IsUserOnline(m.UserID)
+		}
+	}
+
+	nextCursor := ""
+	if len(members) == limit {
+		nextCursor = strconv.FormatInt(members[len(members)-1].UserID, 10)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"group_id": groupID, "members": members, "next_cursor": nextCursor})
+}
+
+// SetPostingPolicy handles changing who may post in a group (everyone, admins only, or slow mode).
+// PUT /v1/groups/:groupID/posting-policy
+func (h *GroupHandler) SetPostingPolicy(c *gin.Context) {
+	// 1. Get authenticated UserID (must be a group admin)
+	actorID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	// 2. Get Group ID from URL parameter
+	groupID, err := strconv.ParseInt(c.Param("groupID"), 10, 64)
+	if err != nil || groupID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	// 3. Parse request body
+	var req PostingPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: policy is required"})
+		return
+	}
+
+	// 4. Call GroupService to update the policy
+	group, err := h.GroupService.SetPostingPolicy(c.Request.Context(), groupID, actorID, req.Policy, req.SlowModeSeconds)
+	if err != nil {
+		respondGroupError(c, err, "Failed to update posting policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// UpdateGroup handles changing a group's description and directory visibility.
+// PATCH /v1/groups/:groupID
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	actorID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	groupID, err := strconv.ParseInt(c.Param("groupID"), 10, 64)
+	if err != nil || groupID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"group_id": groupID, "members": members})
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	group, err := h.GroupService.UpdateGroup(c.Request.Context(), groupID, actorID, req.Description, req.IsPublic)
+	if err != nil {
+		respondGroupError(c, err, "Failed to update group")
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// SearchDirectory handles listing and searching public groups.
+// GET /v1/groups/directory?q=&cursor=&limit=
+func (h *GroupHandler) SearchDirectory(c *gin.Context) {
+	// The cursor is the ID of the last group on the previous page.
+	var afterID int64
+	if cursor := c.Query("cursor"); cursor != "" {
+		parsed, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		afterID = parsed
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultDirectoryLimit)))
+	if err != nil || limit <= 0 || limit > maxDirectoryLimit {
+		limit = defaultDirectoryLimit
+	}
+
+	groups, err := h.GroupService.SearchDirectory(c.Request.Context(), c.Query("q"), afterID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search group directory", "details": err.Error()})
+		return
+	}
+
+	// A full page means there may be more results after the last group returned.
+	nextCursor := ""
+	if len(groups) == limit {
+		nextCursor = strconv.FormatInt(groups[len(groups)-1].ID, 10)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"groups": groups, "next_cursor": nextCursor})
+}
+
+// JoinGroup handles a user adding themselves to a public group.
+// POST /v1/groups/:groupID/join
+func (h *GroupHandler) JoinGroup(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	groupID, err := strconv.ParseInt(c.Param("groupID"), 10, 64)
+	if err != nil || groupID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	if err := h.GroupService.JoinPublicGroup(c.Request.Context(), groupID, userID); err != nil {
+		respondGroupError(c, err, "Failed to join group")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Joined group successfully", "group_id": groupID})
+}
+
+// ArchiveGroup handles archiving a group: it becomes read-only and is hidden from recent chats.
+// POST /v1/groups/:groupID/archive
+func (h *GroupHandler) ArchiveGroup(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+// UnarchiveGroup handles restoring an archived group.
+// POST /v1/groups/:groupID/unarchive
+func (h *GroupHandler) UnarchiveGroup(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+// setArchived is the shared implementation of ArchiveGroup and UnarchiveGroup.
+func (h *GroupHandler) setArchived(c *gin.Context, archived bool) {
+	actorID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	groupID, err := strconv.ParseInt(c.Param("groupID"), 10, 64)
+	if err != nil || groupID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	group, err := h.GroupService.SetArchived(c.Request.Context(), groupID, actorID, archived)
+	if err != nil {
+		respondGroupError(c, err, "Failed to update group archive state")
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteGroup handles deleting a group (owner only). Memberships are removed, messages are
+// deleted or tombstoned per GROUP_MESSAGE_RETENTION, and live clients are detached from the group.
+// DELETE /v1/groups/:groupID
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	actorID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	groupID, err := strconv.ParseInt(c.Param("groupID"), 10, 64)
+	if err != nil || groupID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	memberIDs, err := h.GroupService.DeleteGroup(c.Request.Context(), groupID, actorID)
+	if err != nil {
+		respondGroupError(c, err, "Failed to delete group")
+		return
+	}
+
+	if h.Hub != nil {
+		h.Hub.DisconnectGroup(groupID, memberIDs)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully", "group_id": groupID})
+}
+
+// MuteMember handles muting a group member: they can still read but their posts are refused.
+// POST /v1/groups/:groupID/mutes
+func (h *GroupHandler) MuteMember(c *gin.Context) {
+	h.sanctionMember(c, domain.SanctionMute)
+}
+
+// BanMember handles banning a user: they are removed and cannot re-join via invites or the directory.
+// POST /v1/groups/:groupID/bans
+func (h *GroupHandler) BanMember(c *gin.Context) {
+	h.sanctionMember(c, domain.SanctionBan)
+}
+
+// UnmuteMember handles lifting a mute.
+// DELETE /v1/groups/:groupID/mutes/:userID
+func (h *GroupHandler) UnmuteMember(c *gin.Context) {
+	h.liftSanction(c, domain.SanctionMute)
+}
+
+// UnbanMember handles lifting a ban.
+// DELETE /v1/groups/:groupID/bans/:userID
+func (h *GroupHandler) UnbanMember(c *gin.Context) {
+	h.liftSanction(c, domain.SanctionBan)
+}
+
+// ListMutes handles listing the active mutes of a group (admins only).
+// GET /v1/groups/:groupID/mutes
+func (h *GroupHandler) ListMutes(c *gin.Context) {
+	h.listSanctions(c, domain.SanctionMute)
+}
+
+// ListBans handles listing the active bans of a group (admins only).
+// GET /v1/groups/:groupID/bans
+func (h *GroupHandler) ListBans(c *gin.Context) {
+	h.listSanctions(c, domain.SanctionBan)
+}
+
+// sanctionMember is the shared implementation of MuteMember and BanMember.
+func (h *GroupHandler) sanctionMember(c *gin.Context, kind domain.SanctionKind) {
+	actorID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	groupID, err := strconv.ParseInt(c.Param("groupID"), 10, 64)
+	if err != nil || groupID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	var req SanctionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: user_id is required"})
+		return
+	}
+
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	sanction, err := h.GroupService.SanctionMember(c.Request.Context(), groupID, actorID, req.UserID, kind, duration, req.Reason)
+	if err != nil {
+		respondGroupError(c, err, "Failed to "+string(kind)+" member")
+		return
+	}
+
+	// Banned users lose their live subscription to the group immediately.
+	if kind == domain.SanctionBan && h.Hub != nil {
+		h.Hub.RemoveFromGroup(groupID, req.UserID)
+	}
+
+	c.JSON(http.StatusCreated, sanction)
+}
+
+// liftSanction is the shared implementation of UnmuteMember and UnbanMember.
+func (h *GroupHandler) liftSanction(c *gin.Context, kind domain.SanctionKind) {
+	actorID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	groupID, err := strconv.ParseInt(c.Param("groupID"), 10, 64)
+	if err != nil || groupID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+	userID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	if err := h.GroupService.LiftSanction(c.Request.Context(), groupID, actorID, userID, kind); err != nil {
+		respondGroupError(c, err, "Failed to lift "+string(kind))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lifted " + string(kind) + " successfully"})
+}
+
+// listSanctions is the shared implementation of ListMutes and ListBans.
+func (h *GroupHandler) listSanctions(c *gin.Context, kind domain.SanctionKind) {
+	actorID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	groupID, err := strconv.ParseInt(c.Param("groupID"), 10, 64)
+	if err != nil || groupID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	sanctions, err := h.GroupService.ListSanctions(c.Request.Context(), groupID, actorID, kind)
+	if err != nil {
+		respondGroupError(c, err, "Failed to list "+string(kind)+"s")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"group_id": groupID, string(kind) + "s": sanctions})
+}
+
+// respondGroupError maps domain errors from the GroupService to HTTP status codes.
+func respondGroupError(c *gin.Context, err error, fallback string) {
+	switch e := err.(type) {
+	case *domain.ValidationError:
+		c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+	case *domain.NotFoundError:
+		c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+	case *domain.ForbiddenError:
+		c.JSON(http.StatusForbidden, gin.H{"error": e.Error()})
+	case *domain.ConflictError:
+		c.JSON(http.StatusConflict, gin.H{"error": e.Error()})
+	case *domain.QuotaExceededError:
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": e.Error(), "quota": e.Scope, "limit_bytes": e.Limit})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback, "details": err.Error()})
+	}
 }
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/api/middleware"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead is the room left for multipart boundaries and headers on top of the upload limit.
+const multipartOverhead = 1 << 20
+
+// uploadOffsetHeader carries the byte offset of a chunk, and the bytes received so far in responses.
+const uploadOffsetHeader = "Upload-Offset"
+
+// MediaHandler contains the dependencies required by the upload endpoints.
+type MediaHandler struct {
+	MediaService   domain.MediaService
+	MaxUploadBytes int64
+}
+
+// NewMediaHandler creates a new handler instance.
+func NewMediaHandler(mediaService domain.MediaService, maxUploadBytes int64) *MediaHandler {
+	return &MediaHandler{
+		MediaService:   mediaService,
+		MaxUploadBytes: maxUploadBytes,
+	}
+}
+
+// Upload handles POST /v1/media with a multipart body whose "file" part is streamed to the store.
+func (h *MediaHandler) Upload(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.MaxUploadBytes+multipartOverhead)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a multipart/form-data body with a file field"})
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			respondMediaError(c, err, "Failed to read upload")
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		media, err := h.MediaService.Upload(c.Request.Context(), userID, part.FileName(), part)
+		part.Close()
+		if err != nil {
+			respondMediaError(c, err, "Failed to store upload")
+			return
+		}
+		c.JSON(http.StatusCreated, media)
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a multipart/form-data body with a file field"})
+}
+
+// CreateUpload handles POST /v1/media/uploads, starting a resumable upload of a declared size.
+// The chunks are then sent with PATCH /v1/media/uploads/:mediaID. With "direct": true the
+// response carries a pre-signed upload_url instead, when the media storage supports it.
+func (h *MediaHandler) CreateUpload(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+
+	var req CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	if req.Direct {
+		media, uploadURL, err := h.MediaService.CreateDirectUpload(c.Request.Context(), userID, req.Filename, req.Size)
+		if err != nil {
+			respondMediaError(c, err, "Failed to start upload")
+			return
+		}
+		c.JSON(http.StatusCreated, DirectUploadResponse{Media: media, UploadURL: uploadURL})
+		return
+	}
+
+	media, err := h.MediaService.CreateUpload(c.Request.Context(), userID, req.Filename, req.Size)
+	if err != nil {
+		respondMediaError(c, err, "Failed to start upload")
+		return
+	}
+	c.Header(uploadOffsetHeader, "0")
+	c.JSON(http.StatusCreated, media)
+}
+
+// UploadChunk handles PATCH /v1/media/uploads/:mediaID. The raw body is the chunk and the
+// Upload-Offset header says where it starts; it must equal the bytes received so far.
+func (h *MediaHandler) UploadChunk(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+
+	offset, err := strconv.ParseInt(c.GetHeader(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing or invalid " + uploadOffsetHeader + " header"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.MaxUploadBytes)
+	media, err := h.MediaService.AppendChunk(c.Request.Context(), userID, c.Param("mediaID"), offset, c.Request.Body)
+	if err != nil {
+		if _, ok := err.(*domain.ConflictError); ok {
+			// Tell the client where to resume from.
+			if current, getErr := h.MediaService.GetUpload(c.Request.Context(), userID, c.Param("mediaID")); getErr == nil {
+				c.Header(uploadOffsetHeader, strconv.FormatInt(current.ReceivedBytes, 10))
+			}
+		}
+		respondMediaError(c, err, "Failed to store chunk")
+		return
+	}
+
+	c.Header(uploadOffsetHeader, strconv.FormatInt(media.ReceivedBytes, 10))
+	c.JSON(http.StatusOK, media)
+}
+
+// CompleteUpload handles POST /v1/media/uploads/:mediaID/complete, called once the client has
+// PUT a direct upload to its pre-signed URL.
+func (h *MediaHandler) CompleteUpload(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+
+	media, err := h.MediaService.CompleteDirectUpload(c.Request.Context(), userID, c.Param("mediaID"))
+	if err != nil {
+		respondMediaError(c, err, "Failed to complete upload")
+		return
+	}
+	c.JSON(http.StatusOK, media)
+}
+
+// GetUpload handles GET /v1/media/uploads/:mediaID, reporting a resumable upload's progress to its owner.
+func (h *MediaHandler) GetUpload(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+
+	media, err := h.MediaService.GetUpload(c.Request.Context(), userID, c.Param("mediaID"))
+	if err != nil {
+		respondMediaError(c, err, "Failed to load upload")
+		return
+	}
+	c.Header(uploadOffsetHeader, strconv.FormatInt(media.ReceivedBytes, 10))
+	c.JSON(http.StatusOK, media)
+}
+
+// Storage handles GET /v1/me/storage: the size and number of the caller's uploads and their quota.
+func (h *MediaHandler) Storage(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+
+	usage, err := h.MediaService.Usage(c.Request.Context(), userID)
+	if err != nil {
+		respondMediaError(c, err, "Failed to load storage usage")
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// Download handles GET /v1/media/:mediaID for the uploader and members of conversations the
+// file was sent to. Range requests are supported. Only images, audio and video are shown inline.
+// When the media storage can presign, the client is redirected to a short-lived URL instead.
+func (h *MediaHandler) Download(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+
+	downloadURL, err := h.MediaService.DownloadURL(c.Request.Context(), userID, c.Param("mediaID"))
+	if err != nil {
+		respondMediaError(c, err, "Failed to load media")
+		return
+	}
+	if downloadURL != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, downloadURL)
+		return
+	}
+
+	media, content, err := h.MediaService.Open(c.Request.Context(), userID, c.Param("mediaID"))
+	if err != nil {
+		respondMediaError(c, err, "Failed to load media")
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", media.ContentType)
+	c.Header("Content-Disposition", media.ContentDisposition())
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=86400")
+
+	modified := media.CreatedAt
+	if media.CompletedAt != nil {
+		modified = *media.CompletedAt
+	}
+	http.ServeContent(c.Writer, c.Request, "", modified.Truncate(time.Second), content)
+}
+
+// Thumbnail handles GET /v1/media/:mediaID/thumbnails/:size for the thumbnails listed in an
+// image message's metadata, with the same access rules as Download.
+func (h *MediaHandler) Thumbnail(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+
+	size, err := strconv.Atoi(c.Param("size"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "thumbnail not found"})
+		return
+	}
+
+	downloadURL, err := h.MediaService.ThumbnailURL(c.Request.Context(), userID, c.Param("mediaID"), size)
+	if err != nil {
+		respondMediaError(c, err, "Failed to load thumbnail")
+		return
+	}
+	if downloadURL != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, downloadURL)
+		return
+	}
+
+	thumbnail, content, err := h.MediaService.OpenThumbnail(c.Request.Context(), userID, c.Param("mediaID"), size)
+	if err != nil {
+		respondMediaError(c, err, "Failed to load thumbnail")
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", thumbnail.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=86400")
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, content)
+}
+
+// respondMediaError maps upload errors to HTTP responses.
+func respondMediaError(c *gin.Context, err error, fallback string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "upload is too large"})
+		return
+	}
+
+	switch e := err.(type) {
+	case *domain.MediaTooLargeError:
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": e.Error(), "limit_bytes": e.Limit})
+	case *domain.QuotaExceededError:
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": e.Error(), "quota": e.Scope, "limit_bytes": e.Limit})
+	case *domain.ValidationError:
+		c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+	case *domain.NotFoundError:
+		c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+	case *domain.ForbiddenError:
+		c.JSON(http.StatusForbidden, gin.H{"error": e.Error()})
+	case *domain.ConflictError:
+		c.JSON(http.StatusConflict, gin.H{"error": e.Error()})
+	default:
+		log.Printf("%s: %v", fallback, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Emmanuel326/chatserver/internal/api/middleware"
 	"github.com/Emmanuel326/chatserver/internal/domain"
@@ -65,7 +66,7 @@ func (h *MessageHandler) GetConversationHistory(c *gin.Context) {
 	// FIX: Use request context instead of context.Background()
 	messages, err := h.MessageService.GetConversationHistory(c.Request.Context(), senderID, recipientID, limit, beforeID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve message history"})
+		respondGroupError(c, err, "Failed to retrieve message history")
 		return
 	}
 
@@ -77,6 +78,7 @@ func (h *MessageHandler) GetConversationHistory(c *gin.Context) {
 }
 
 // GetRecentConversations retrieves the latest message from each of the user's conversations.
+// Archived groups are omitted unless include_archived=true.
 // GET /v1/chats
 func (h *MessageHandler) GetRecentConversations(c *gin.Context) {
 	// 1. Get Authenticated User ID
@@ -87,7 +89,8 @@ func (h *MessageHandler) GetRecentConversations(c *gin.Context) {
 	}
 
 	// 2. Call Domain Service to retrieve recent conversations
-	messages, err := h.MessageService.GetRecentConversations(c.Request.Context(), userID)
+	includeArchived, _ := strconv.ParseBool(c.DefaultQuery("include_archived", "false"))
+	messages, err := h.MessageService.GetRecentConversations(c.Request.Context(), userID, includeArchived)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve recent conversations"})
 		return
@@ -127,14 +130,14 @@ func (h *MessageHandler) SendGroupMessage(c *gin.Context) {
 		return
 	}
     
-    // VALIDATION: Ensure at least Content or MediaURL is present
-    if req.Content == "" && req.MediaURL == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Message must contain either text content or a media URL"})
+    // VALIDATION: Ensure at least Content, MediaURL or MediaID is present
+    if req.Content == "" && req.MediaURL == "" && req.MediaID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Message must contain either text content or media"})
         return
     }
 
 	// 4. Call MessageService to send the message (now includes MediaURL and Type)
-	_, err = h.MessageService.SendGroupMessage(c.Request.Context(), senderID, groupID, req.Content, req.MediaURL, req.Type)
+	_, err = h.MessageService.SendGroupMessage(c.Request.Context(), senderID, groupID, req.Content, req.MediaURL, req.MediaID, req.Attachment, req.Type)
 	
 	if err != nil {
 		// Differentiate between domain errors (e.g., membership) and server errors
@@ -142,6 +145,18 @@ func (h *MessageHandler) SendGroupMessage(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Failed to send group message", "details": err.Error()})
 			return
 		}
+		if restricted, ok := err.(*domain.PostingRestrictedError); ok {
+			respondPostingRestricted(c, restricted)
+			return
+		}
+		if _, ok := err.(*domain.ValidationError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to send group message", "details": err.Error()})
+			return
+		}
+		if quota, ok := err.(*domain.QuotaExceededError); ok {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": quota.Error(), "quota": quota.Scope, "limit_bytes": quota.Limit})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send group message", "details": err.Error()})
 		return
 	}
@@ -180,28 +195,78 @@ func (h *MessageHandler) SendP2PMessage(c *gin.Context) {
 		return
 	}
 
-	// VALIDATION: Ensure at least Content or MediaURL is present
-	if req.Content == "" && req.MediaURL == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Message must contain either text content or a media URL"})
+	// VALIDATION: Ensure at least Content, MediaURL or MediaID is present
+	if req.Content == "" && req.MediaURL == "" && req.MediaID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message must contain either text content or media"})
 		return
 	}
 
 	// 4. Call MessageService to send the message (includes MediaURL and Type)
-	_, err = h.MessageService.SendP2PMessage(c.Request.Context(), senderID, recipientID, req.Content, req.MediaURL, req.Type)
+	_, err = h.MessageService.SendP2PMessage(c.Request.Context(), senderID, recipientID, req.Content, req.MediaURL, req.MediaID, req.Attachment, req.Type)
 	
 	if err != nil {
 		// Differentiate between domain errors (e.g., user not found) and server errors
-		if err.Error() == "recipient user not found" {
+		if _, ok := err.(*domain.NotFoundError); ok {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Recipient user not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send P2P message", "details": err.Error()})
+		respondGroupError(c, err, "Failed to send P2P message")
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "P2P message sent successfully"})
 }
 
+// ForwardMessage forwards a message the caller can see to users and groups.
+// POST /v1/messages/:messageID/forward
+// Nothing is sent unless the caller may post to every target.
+func (h *MessageHandler) ForwardMessage(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("messageID"), 10, 64)
+	if err != nil || messageID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req ForwardMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	targets := make([]domain.Conversation, 0, len(req.UserIDs)+len(req.GroupIDs))
+	for _, id := range req.UserIDs {
+		if id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		targets = append(targets, domain.Conversation{PeerID: id})
+	}
+	for _, id := range req.GroupIDs {
+		if id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+			return
+		}
+		targets = append(targets, domain.Conversation{GroupID: id})
+	}
+
+	messages, err := h.MessageService.ForwardMessage(c.Request.Context(), userID, messageID, targets)
+	if err != nil {
+		if restricted, ok := err.(*domain.PostingRestrictedError); ok {
+			respondPostingRestricted(c, restricted)
+			return
+		}
+		respondGroupError(c, err, "Failed to forward message")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"messages": messages, "count": len(messages)})
+}
+
 // GetGroupConversationHistory retrieves the message history for a specific group.
 // GET /v1/groups/:groupID/messages
 func (h *MessageHandler) GetGroupConversationHistory(c *gin.Context) {
@@ -220,27 +285,7 @@ func (h *MessageHandler) GetGroupConversationHistory(c *gin.Context) {
 		return
 	}
 
-	// 3. Authorization Check: Ensure user is a member of the group
-	members, err := h.GroupService.GetMembers(c.Request.Context(), groupID)
-	if err != nil {
-		// This could be because the group doesn't exist, or a DB error.
-		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found or error checking membership"})
-		return
-	}
-
-	isMember := false
-	for _, memberID := range members {
-		if memberID == userID {
-			isMember = true
-			break
-		}
-	}
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
-		return
-	}
-
-	// 4. Get Optional Limit and BeforeID Query Parameters
+	// 3. Get Optional Limit and BeforeID Query Parameters
 	limit := defaultHistoryLimit
 	limitStr := c.DefaultQuery("limit", strconv.Itoa(defaultHistoryLimit))
 	if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
@@ -250,16 +295,120 @@ func (h *MessageHandler) GetGroupConversationHistory(c *gin.Context) {
 	beforeIDStr := c.DefaultQuery("before_id", "0")
 	beforeID, _ := strconv.ParseInt(beforeIDStr, 10, 64)
 
-	// 5. Call Domain Service to retrieve history
-	messages, err := h.MessageService.GetGroupConversationHistory(c.Request.Context(), groupID, limit, beforeID)
+	// 4. Call Domain Service to retrieve history (members only)
+	messages, err := h.MessageService.GetGroupConversationHistory(c.Request.Context(), userID, groupID, limit, beforeID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group message history"})
+		respondGroupError(c, err, "Failed to retrieve group message history")
 		return
 	}
 
-	// 6. Success Response
+	// 5. Success Response
 	c.JSON(http.StatusOK, gin.H{
 		"messages": messages,
 		"count":    len(messages),
 	})
 }
+
+// SearchMessages searches the messages of the caller's conversations.
+// GET /v1/search/messages?q=&conversation=&from=&before=&after=&has=media&cursor=&limit=
+// conversation is group_<id> or user_<id>, from a sender's user ID, and before/after RFC 3339
+// timestamps or dates. Results are newest first; the cursor is the ID of the last result.
+func (h *MessageHandler) SearchMessages(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	search := domain.MessageSearch{Query: c.Query("q")}
+	if value := c.Query("conversation"); value != "" {
+		conversation, err := domain.ParseConversation(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		search.Conversation = &conversation
+	}
+	if value := c.Query("from"); value != "" {
+		senderID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || senderID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from user ID"})
+			return
+		}
+		search.SenderID = senderID
+	}
+	var ok bool
+	if search.Before, ok = parseSearchTime(c, "before"); !ok {
+		return
+	}
+	if search.After, ok = parseSearchTime(c, "after"); !ok {
+		return
+	}
+	switch c.Query("has") {
+	case "":
+	case "media":
+		search.HasMedia = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "has must be media"})
+		return
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || cursor <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		search.BeforeID = cursor
+	}
+	search.Limit, _ = strconv.Atoi(c.Query("limit"))
+	if search.Limit <= 0 || search.Limit > domain.MaxSearchLimit {
+		search.Limit = domain.DefaultSearchLimit
+	}
+
+	results, err := h.MessageService.SearchMessages(c.Request.Context(), userID, search)
+	if err != nil {
+		respondGroupError(c, err, "Failed to search messages")
+		return
+	}
+
+	nextCursor := ""
+	if len(results) > 0 && len(results) == search.Limit {
+		nextCursor = strconv.FormatInt(results[len(results)-1].ID, 10)
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results, "next_cursor": nextCursor})
+}
+
+// parseSearchTime reads an optional RFC 3339 timestamp or YYYY-MM-DD date (midnight UTC) query parameter.
+func parseSearchTime(c *gin.Context, name string) (time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, true
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + ": use an RFC 3339 timestamp or YYYY-MM-DD date"})
+	return time.Time{}, false
+}
+
+// respondPostingRestricted reports a refused group post with a machine-readable code.
+// When the restriction expires (slow mode, timed mutes) the response says when to retry;
+// slow mode refusals are sent as 429 with a Retry-After header.
+func respondPostingRestricted(c *gin.Context, err *domain.PostingRestrictedError) {
+	body := gin.H{"error": "Failed to send group message", "code": err.Code, "details": err.Msg}
+
+	if !err.RetryAt.IsZero() {
+		retryAfter := int(err.RetryAfter().Seconds())
+		body["retry_after"] = retryAfter
+		body["retry_at"] = err.RetryAt
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	if err.Code == domain.CodeSlowMode {
+		c.JSON(http.StatusTooManyRequests, body)
+		return
+	}
+	c.JSON(http.StatusForbidden, body)
+}
@@ -6,16 +6,36 @@ import (
 	"strings"
 
 	"github.com/Emmanuel326/chatserver/internal/auth"
-	
+	"github.com/Emmanuel326/chatserver/internal/authz"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+
 	"github.com/gin-gonic/gin"
 )
 
 // Gin Context Key for storing UserID
 const ContextUserIDKey = "userID"
 
-// AuthMiddleware is a Gin middleware that validates the JWT from the Authorization header.
-func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
+// Gin Context Key for storing the validated token claims (needed e.g. by logout)
+const ContextClaimsKey = "claims"
+
+// Gin Context Key for storing the API token when the request was authenticated with one
+const ContextAPITokenKey = "apiToken"
+
+// AuthMiddleware is a Gin middleware that validates the JWT from the Authorization header
+// and rejects tokens that were revoked (denylisted jti or logged-out session).
+// Routes without an entry in authz.Routes are refused outright. Personal API tokens (prefixed
+// with domain.APITokenPrefix) are accepted too, but only with the scope the route's policy requires.
+func AuthMiddleware(jwtManager *auth.JWTManager, sessionService domain.SessionService, apiTokenService domain.APITokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 0. Every secured route must have an authorization policy
+		policy, ok := authz.RouteFor(c.Request.Method, c.FullPath())
+		if !ok {
+			log.Printf("No authorization policy for route %s %s", c.Request.Method, c.FullPath())
+			c.JSON(http.StatusForbidden, gin.H{"error": "No authorization policy for this endpoint"})
+			c.Abort()
+			return
+		}
+
 		// 1. Extract Token from Header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -34,6 +54,11 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 		
 		tokenString := parts[1]
 
+		if strings.HasPrefix(tokenString, domain.APITokenPrefix) {
+			authenticateAPIToken(c, apiTokenService, policy, tokenString)
+			return
+		}
+
 		// 2. Validate Token
 		claims, err := jwtManager.ValidateToken(tokenString)
 		if err != nil {
@@ -43,15 +68,66 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 			return
 		}
 
-		// 3. Set UserID in Gin Context
+		// 3. Check the denylist and session state
+		revoked, err := sessionService.IsAccessTokenRevoked(c.Request.Context(), claims.ID, claims.SessionID)
+		if err != nil {
+			log.Printf("Token revocation check failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// 4. Set UserID and claims in Gin Context
 		// The UserID is now available to all downstream handlers in this request chain
 		c.Set(ContextUserIDKey, claims.UserID)
+		c.Set(ContextClaimsKey, claims)
 
-		// 4. Continue to the next handler/logic
+		// 5. Continue to the next handler/logic
 		c.Next()
 	}
 }
 
+// authenticateAPIToken validates a personal API token and checks it against the route's required scope.
+func authenticateAPIToken(c *gin.Context, apiTokenService domain.APITokenService, policy authz.RoutePolicy, tokenString string) {
+	// 1. The route must accept API tokens at all
+	scope := policy.TokenScope
+	if scope == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint is not available to API tokens"})
+		c.Abort()
+		return
+	}
+
+	// 2. Resolve the token (unknown, revoked and expired tokens are rejected)
+	apiToken, err := apiTokenService.Authenticate(c.Request.Context(), tokenString)
+	if err != nil {
+		if _, ok := err.(*domain.UnauthorizedError); ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid, expired or revoked API token"})
+		} else {
+			log.Printf("API token validation failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+		}
+		c.Abort()
+		return
+	}
+
+	// 3. Check the scope
+	if scope != authz.AnyScope && !apiToken.Scopes.Has(scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API token is missing the required scope", "required_scope": scope})
+		c.Abort()
+		return
+	}
+
+	// 4. The token acts as its user (a human or one of their bots)
+	c.Set(ContextUserIDKey, apiToken.UserID)
+	c.Set(ContextAPITokenKey, apiToken)
+	c.Next()
+}
+
 // GetUserIDFromContext is a helper function for handlers to safely retrieve the UserID.
 func GetUserIDFromContext(c *gin.Context) (int64, bool) {
 	idValue, exists := c.Get(ContextUserIDKey)
@@ -65,3 +141,25 @@ func GetUserIDFromContext(c *gin.Context) (int64, bool) {
 	}
 	return userID, true
 }
+
+// GetClaimsFromContext is a helper function for handlers to retrieve the validated token claims.
+func GetClaimsFromContext(c *gin.Context) (*auth.Claims, bool) {
+	value, exists := c.Get(ContextClaimsKey)
+	if !exists {
+		return nil, false
+	}
+
+	claims, ok := value.(*auth.Claims)
+	return claims, ok
+}
+
+// GetAPITokenFromContext returns the API token used to authenticate the request, if any.
+func GetAPITokenFromContext(c *gin.Context) (*domain.APIToken, bool) {
+	value, exists := c.Get(ContextAPITokenKey)
+	if !exists {
+		return nil, false
+	}
+
+	apiToken, ok := value.(*domain.APIToken)
+	return apiToken, ok
+}
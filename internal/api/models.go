@@ -11,16 +11,78 @@ type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3"`
 	Email    string `json:"email" binding:"required,email"` // Clean whitespace before Email
 	Password string `json:"password" binding:"required,min=8"` // Clean whitespace before Password
+	DeviceName string `json:"device_name"` // Optional label for the session shown in GET /v1/sessions
 }
 
 // LoginRequest defines the expected JSON payload for user login
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"` // Clean whitespace before Email
 	Password string `json:"password" binding:"required"` // Clean whitespace before Password
+	DeviceName string `json:"device_name"` // Optional label for the session shown in GET /v1/sessions
 }
 
 // AuthResponse defines the standard response for successful authentication
 type AuthResponse struct {
+	Token        string `json:"token"`         // Short-lived access token (JWT)
+	RefreshToken string `json:"refresh_token"` // Single-use token for POST /v1/auth/refresh
+	ExpiresIn    int    `json:"expires_in"`    // Access token lifetime in seconds
+}
+
+// TwoFactorLoginRequest defines the expected JSON payload for the second login step (POST /v1/users/login/2fa).
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // TOTP code or recovery code
+	DeviceName     string `json:"device_name"`
+}
+
+// TwoFactorCodeRequest carries a TOTP (or recovery) code, e.g. to confirm enrollment or disable 2FA.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// EmailRequest carries an email address, e.g. for POST /v1/auth/password/forgot.
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest defines the expected JSON payload for POST /v1/auth/password/reset.
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// TokenRequest carries a single-use token, e.g. for POST /v1/auth/email/verify.
+type TokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// SessionResponse is a login session as listed by GET /v1/sessions.
+type SessionResponse struct {
+	*domain.Session
+	Current bool `json:"current"` // True for the session the request was made with
+}
+
+// RefreshRequest defines the expected JSON payload for POST /v1/auth/refresh.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// CreateBotRequest defines the expected JSON payload for POST /v1/bots.
+type CreateBotRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// CreateAPITokenRequest defines the expected JSON payload for POST /v1/tokens.
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"` // e.g. ["messages:write", "groups:read"]
+	BotID         int64    `json:"bot_id"`                    // Issue the token for one of your bots instead of yourself
+	ExpiresInDays int      `json:"expires_in_days"`           // 0 = never expires
+}
+
+// APITokenResponse is a newly issued API token; Token is only ever returned here.
+type APITokenResponse struct {
+	*domain.APIToken
 	Token string `json:"token"`
 }
 
@@ -28,8 +90,50 @@ type AuthResponse struct {
 // It includes the content for text messages and an optional MediaURL for images/files.
 type SendMessageRequest struct {
 	Content  string           `json:"content"`  // Text content (required for text message)
-	MediaURL string           `json:"media_url"` // Optional URL for external media (required for image/file message)
-	Type     domain.MessageType `json:"type"`     // Type of message (e.g., "text", "image", "file")
+	MediaURL string           `json:"media_url"` // Optional URL for external media
+	MediaID  string           `json:"media_id"`  // Optional ID of an upload from POST /v1/media; replaces media_url (required for file/audio/video/voice_note)
+	Attachment *domain.AttachmentInfo `json:"attachment"` // Optional duration_ms, and waveform for voice notes
+	Type     domain.MessageType `json:"type"`     // Type of message: "text", "image", "file", "audio", "video" or "voice_note"
+}
+
+// ForwardMessageRequest defines the expected JSON payload for POST /v1/messages/:messageID/forward.
+type ForwardMessageRequest struct {
+	UserIDs  []int64 `json:"user_ids"`  // Users to forward the message to
+	GroupIDs []int64 `json:"group_ids"` // Groups to forward the message to
+}
+
+// CreateUploadRequest defines the expected JSON payload for starting a resumable upload (POST /v1/media/uploads).
+type CreateUploadRequest struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size" binding:"required"` // Total size in bytes
+	Direct   bool   `json:"direct"`                  // Upload straight to object storage with a pre-signed URL
+}
+
+// DirectUploadResponse is returned for direct uploads: the client PUTs the file to UploadURL
+// with a Content-Length of exactly the declared size, then calls POST /v1/media/uploads/:mediaID/complete.
+type DirectUploadResponse struct {
+	*domain.Media
+	UploadURL string `json:"upload_url"`
+}
+
+// PostingPolicyRequest defines the expected JSON payload for changing a group's posting policy.
+type PostingPolicyRequest struct {
+	Policy          domain.PostingPolicy `json:"policy" binding:"required"` // "everyone", "admins_only" or "slow_mode"
+	SlowModeSeconds int                  `json:"slow_mode_seconds"`         // Required (> 0) when policy is "slow_mode"
+}
+
+// UpdateGroupRequest defines the expected JSON payload for changing group settings.
+// Omitted fields are left unchanged.
+type UpdateGroupRequest struct {
+	Description *string `json:"description"`
+	IsPublic    *bool   `json:"is_public"` // Public groups appear in the directory and can be joined by anyone
+}
+
+// SanctionRequest defines the expected JSON payload for muting or banning a group member.
+type SanctionRequest struct {
+	UserID          int64  `json:"user_id" binding:"required"`
+	DurationSeconds int    `json:"duration_seconds"` // 0 means until lifted
+	Reason          string `json:"reason"`
 }
 
 // UserCardResponse defines the structure for a user in the chat list,
@@ -37,8 +141,41 @@ type SendMessageRequest struct {
 type UserCardResponse struct {
 	ID                   int64      `json:"id"`
 	Username             string     `json:"username"`
-	Email                string     `json:"email"`
 	LastMessageContent   *string    `json:"last_message_content,omitempty"`
 	LastMessageTimestamp *time.Time `json:"last_message_timestamp,omitempty"`
 	LastMessageSenderID  *int64     `json:"last_message_sender_id,omitempty"` // ID of the sender of the last message
 }
+
+// AdminActionRequest is the optional JSON payload of administrator actions; the reason is kept in the audit log.
+type AdminActionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// SetAdminRequest defines the expected JSON payload for granting or revoking server administrator rights.
+type SetAdminRequest struct {
+	IsAdmin *bool `json:"is_admin" binding:"required"`
+}
+
+// UpdateProfileRequest defines the JSON payload of PATCH /v1/me/profile; omitted fields are left unchanged.
+type UpdateProfileRequest struct {
+	DisplayName       *string `json:"display_name"`
+	Discoverable      *bool   `json:"discoverable"`       // Listed in the user directory
+	EmailDiscoverable *bool   `json:"email_discoverable"` // Found by searching for the exact email address
+}
+
+// ProfileResponse is the caller's own profile, including the privacy settings hidden from other users.
+type ProfileResponse struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+	domain.PrivacySettings
+}
+
+// PublicProfileResponse is what other users see of an account: no email, role or account state.
+type PublicProfileResponse struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	IsBot       bool   `json:"is_bot"`
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Emmanuel326/chatserver/internal/auth"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCHandler contains the dependencies required by the single sign-on endpoints.
+type OIDCHandler struct {
+	OIDCService    domain.OIDCService
+	UserService    domain.UserService
+	SessionService domain.SessionService
+	JWTManager     *auth.JWTManager
+}
+
+// NewOIDCHandler creates a new handler instance.
+func NewOIDCHandler(oidcService domain.OIDCService, userService domain.UserService, sessionService domain.SessionService, jwtManager *auth.JWTManager) *OIDCHandler {
+	return &OIDCHandler{
+		OIDCService:    oidcService,
+		UserService:    userService,
+		SessionService: sessionService,
+		JWTManager:     jwtManager,
+	}
+}
+
+// Login handles GET /v1/auth/oidc/login by redirecting the browser to the identity provider.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, err := h.OIDCService.BeginLogin(c.Request.Context())
+	if err != nil {
+		log.Printf("Failed to start OIDC login: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback handles GET /v1/auth/oidc/callback, where the provider sends the user back with
+// an authorization code. On success the normal access/refresh token pair is returned.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was not completed at the identity provider", "details": providerErr})
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing state or code"})
+		return
+	}
+
+	user, err := h.OIDCService.CompleteLogin(c.Request.Context(), state, code)
+	if err != nil {
+		switch e := err.(type) {
+		case *domain.UnauthorizedError:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": e.Error()})
+		case *domain.ValidationError:
+			c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+		case *domain.ConflictError:
+			c.JSON(http.StatusConflict, gin.H{"error": e.Error()})
+		case *domain.AccountDisabledError:
+			c.JSON(http.StatusForbidden, gin.H{"error": e.Error(), "code": codeAccountDisabled})
+		default:
+			log.Printf("OIDC login failed: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to complete login with the identity provider"})
+		}
+		return
+	}
+
+	if h.UserService.RequiresEmailVerification() && !user.IsEmailVerified() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden Error: email address has not been verified", "code": "EMAIL_NOT_VERIFIED"})
+		return
+	}
+
+	tokens, err := issueTokens(c, h.SessionService, h.JWTManager, user.ID, c.Query("device_name"))
+	if err != nil {
+		log.Printf("Failed to generate tokens for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login successful, but failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Login successful",
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Emmanuel326/chatserver/internal/api/middleware"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// PinHandler holds dependencies for the pinned and starred message endpoints.
+type PinHandler struct {
+	PinService domain.PinService
+}
+
+// NewPinHandler creates a new handler instance.
+func NewPinHandler(pinService domain.PinService) *PinHandler {
+	return &PinHandler{PinService: pinService}
+}
+
+// PinMessage pins a message in its conversation (group admins, or either P2P participant).
+// POST /v1/messages/:messageID/pin
+func (h *PinHandler) PinMessage(c *gin.Context) {
+	h.changeMessage(c, h.PinService.PinMessage, "Failed to pin message")
+}
+
+// UnpinMessage unpins a message.
+// DELETE /v1/messages/:messageID/pin
+func (h *PinHandler) UnpinMessage(c *gin.Context) {
+	h.changeMessage(c, h.PinService.UnpinMessage, "Failed to unpin message")
+}
+
+// StarMessage stars a message for the caller.
+// POST /v1/messages/:messageID/star
+func (h *PinHandler) StarMessage(c *gin.Context) {
+	h.changeMessage(c, h.PinService.StarMessage, "Failed to star message")
+}
+
+// UnstarMessage removes the caller's star from a message.
+// DELETE /v1/messages/:messageID/star
+func (h *PinHandler) UnstarMessage(c *gin.Context) {
+	h.changeMessage(c, h.PinService.UnstarMessage, "Failed to unstar message")
+}
+
+// changeMessage applies a pin or star change to the message in the path and answers 204.
+func (h *PinHandler) changeMessage(c *gin.Context, change func(ctx context.Context, userID, messageID int64) error, fallback string) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("messageID"), 10, 64)
+	if err != nil || messageID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	if err := change(c.Request.Context(), userID, messageID); err != nil {
+		respondGroupError(c, err, fallback)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListPins lists the pins of a conversation, most recently pinned first.
+// GET /v1/conversations/:conversationID/pins, where conversationID is group_<id> or user_<id>.
+func (h *PinHandler) ListPins(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	conversation, err := domain.ParseConversation(c.Param("conversationID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pins, err := h.PinService.ListPins(c.Request.Context(), userID, conversation)
+	if err != nil {
+		respondGroupError(c, err, "Failed to retrieve pinned messages")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pins": pins, "count": len(pins)})
+}
+
+// ListStarred lists the caller's starred messages, most recently starred first.
+// GET /v1/me/starred?cursor=&limit=
+func (h *PinHandler) ListStarred(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	var beforeID int64
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || cursor <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		beforeID = cursor
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > domain.MaxStarredLimit {
+		limit = domain.DefaultStarredLimit
+	}
+
+	starred, err := h.PinService.ListStarred(c.Request.Context(), userID, beforeID, limit)
+	if err != nil {
+		respondGroupError(c, err, "Failed to retrieve starred messages")
+		return
+	}
+
+	nextCursor := ""
+	if len(starred) > 0 && len(starred) == limit {
+		nextCursor = strconv.FormatInt(starred[len(starred)-1].StarID, 10)
+	}
+	c.JSON(http.StatusOK, gin.H{"messages": starred, "next_cursor": nextCursor})
+}
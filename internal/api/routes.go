@@ -18,34 +18,90 @@ func RegisterRoutes(
 	hub *ws.Hub,
 	messageService domain.MessageService,
 	groupService domain.GroupService,
+	sessionService domain.SessionService,
+	twoFactorService domain.TwoFactorService,
+	accountService domain.AccountService,
+	loginThrottle domain.LoginThrottleService,
+	apiTokenService domain.APITokenService,
+	oidcService domain.OIDCService, // nil when no OIDC provider is configured
+	authorizer domain.Authorizer,
+	adminService domain.AdminService,
+	mediaService domain.MediaService,
+	pinService domain.PinService,
+	maxUploadBytes int64,
 ) {
 	
 	// Initialize Handlers (Dependency Injection)
 	// NOTE: We assume these constructors exist in internal/api/
-	userHandler := NewUserHandler(userService, jwtManager)
-	wsHandler := NewWSHandler(hub, jwtManager)
+	userHandler := NewUserHandler(userService, sessionService, twoFactorService, accountService, loginThrottle, authorizer, jwtManager)
+	accountHandler := NewAccountHandler(accountService, hub)
+	twoFactorHandler := NewTwoFactorHandler(twoFactorService)
+	authHandler := NewAuthHandler(sessionService, jwtManager, hub)
+	wsHandler := NewWSHandler(hub, jwtManager, sessionService)
 	messageHandler := NewMessageHandler(messageService, groupService)
-	groupHandler := NewGroupHandler(groupService)
+	groupHandler := NewGroupHandler(groupService, hub)
+	apiTokenHandler := NewAPITokenHandler(apiTokenService)
+	adminHandler := NewAdminHandler(adminService, hub)
+	mediaHandler := NewMediaHandler(mediaService, maxUploadBytes)
+	pinHandler := NewPinHandler(pinService)
 
 	// --- WebSocket Route ---
 	// The client connects to /ws, so it must be outside the /v1 group
 	router.GET("/ws", wsHandler.ServeWs)
 
-	// V1 API Group
+	// Public keys for verifying our access tokens (key rotation via kid)
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+
+	// V1 API Group. Every route below needs an entry in authz.Routes.
 	v1 := router.Group("/v1")
 	{
 		// --- Public User/Auth Routes (Registration and Login) ---
 		v1.POST("/users/register", userHandler.Register)
 		// Confirmed login route is POST /v1/users/login
 		v1.POST("/users/login", userHandler.Login)
+		// Second login step for users with 2FA: challenge token + TOTP/recovery code
+		v1.POST("/users/login/2fa", userHandler.LoginTwoFactor)
+		// Exchange a refresh token for a new access/refresh token pair
+		v1.POST("/auth/refresh", authHandler.Refresh)
+		// Password reset and email verification (single-use tokens sent by email)
+		v1.POST("/auth/password/forgot", accountHandler.ForgotPassword)
+		v1.POST("/auth/password/reset", accountHandler.ResetPassword)
+		v1.POST("/auth/email/verify", accountHandler.VerifyEmail)
+		v1.POST("/auth/email/resend", accountHandler.ResendVerification)
+
+		// Single sign-on through the configured OpenID Connect provider
+		if oidcService != nil {
+			oidcHandler := NewOIDCHandler(oidcService, userService, sessionService, jwtManager)
+			v1.GET("/auth/oidc/login", oidcHandler.Login)
+			v1.GET("/auth/oidc/callback", oidcHandler.Callback)
+		}
 
 
 		// --- Protected Routes Group ---
 		secured := v1.Group("/")
-		secured.Use(middleware.AuthMiddleware(jwtManager))
+		secured.Use(middleware.AuthMiddleware(jwtManager, sessionService, apiTokenService), authorizeRoute(authorizer))
 		{
-			// User Listing Endpoint (all users)
+			// Revoke the current session and close its live sockets
+			secured.POST("/auth/logout", authHandler.Logout)
+			// Session/device management
+			secured.GET("/sessions", authHandler.ListSessions)
+			secured.DELETE("/sessions/:sessionID", authHandler.RevokeSession)
+			// TOTP two-factor authentication
+			secured.GET("/auth/2fa", twoFactorHandler.Status)
+			secured.POST("/auth/2fa/enroll", twoFactorHandler.Enroll)
+			secured.POST("/auth/2fa/verify", twoFactorHandler.Verify)
+			secured.POST("/auth/2fa/disable", twoFactorHandler.Disable)
+			// Bot accounts and long-lived, scoped API tokens for integrations
+			secured.POST("/bots", apiTokenHandler.CreateBot)
+			secured.GET("/bots", apiTokenHandler.ListBots)
+			secured.POST("/tokens", apiTokenHandler.CreateToken)
+			secured.GET("/tokens", apiTokenHandler.ListTokens)
+			secured.DELETE("/tokens/:tokenID", apiTokenHandler.RevokeToken)
+
+			// User Listing Endpoint (all users; deprecated in favour of the directory)
 			secured.GET("/users", userHandler.ListUsers)
+			// Paginated user directory, searchable with ?q= (prefix, then fuzzy)
+			secured.GET("/users/directory", userHandler.SearchDirectory)
 			// Single User Details Endpoint
 			secured.GET("/users/:userID", userHandler.GetUserByID)
 			// User Listing with last chat message info (for chat cards/previews)
@@ -56,18 +112,73 @@ func RegisterRoutes(
 
 			// Recent Conversations (Chats) Endpoint
 			secured.GET("/chats", messageHandler.GetRecentConversations)
+			// Full-text search over the messages of the caller's conversations
+			secured.GET("/search/messages", messageHandler.SearchMessages)
 			
 			// Group Endpoints
 			secured.GET("/groups", groupHandler.ListUserGroups) // Get all groups for the authenticated user
 			secured.POST("/groups", groupHandler.CreateGroup)
+			secured.GET("/groups/directory", groupHandler.SearchDirectory) // Public group directory with search
+			secured.PATCH("/groups/:groupID", groupHandler.UpdateGroup)
+			secured.DELETE("/groups/:groupID", groupHandler.DeleteGroup)
+			secured.POST("/groups/:groupID/archive", groupHandler.ArchiveGroup)
+			secured.POST("/groups/:groupID/unarchive", groupHandler.UnarchiveGroup)
+			// Group moderation (admins only)
+			secured.GET("/groups/:groupID/mutes", groupHandler.ListMutes)
+			secured.POST("/groups/:groupID/mutes", groupHandler.MuteMember)
+			secured.DELETE("/groups/:groupID/mutes/:userID", groupHandler.UnmuteMember)
+			secured.GET("/groups/:groupID/bans", groupHandler.ListBans)
+			secured.POST("/groups/:groupID/bans", groupHandler.BanMember)
+			secured.DELETE("/groups/:groupID/bans/:userID", groupHandler.UnbanMember)
+			secured.POST("/groups/:groupID/join", groupHandler.JoinGroup)
 			secured.POST("/groups/:groupID/members", groupHandler.AddMember)
-			// ADDED: Missing GetMembers route for completeness
+			// Paginated member profiles (members only), searchable with ?q=
 			secured.GET("/groups/:groupID/members", groupHandler.GetMembers)
 			secured.GET("/groups/:groupID/messages", messageHandler.GetGroupConversationHistory)
+			secured.PUT("/groups/:groupID/posting-policy", groupHandler.SetPostingPolicy)
 
 			// Message Send Endpoint (via API) - The target of our final test
 			secured.POST("/messages/group/:groupID", messageHandler.SendGroupMessage)
 			secured.POST("/messages/p2p/:recipientID", messageHandler.SendP2PMessage)
+			// Copy a message to users and groups, recording where it came from
+			secured.POST("/messages/:messageID/forward", messageHandler.ForwardMessage)
+
+			// Pins are shared with the conversation (admins only in groups); stars are private bookmarks
+			secured.POST("/messages/:messageID/pin", pinHandler.PinMessage)
+			secured.DELETE("/messages/:messageID/pin", pinHandler.UnpinMessage)
+			secured.POST("/messages/:messageID/star", pinHandler.StarMessage)
+			secured.DELETE("/messages/:messageID/star", pinHandler.UnstarMessage)
+			secured.GET("/conversations/:conversationID/pins", pinHandler.ListPins)
+			secured.GET("/me/starred", pinHandler.ListStarred)
+
+			// Uploads: single-request multipart, or resumable in chunks; downloads are membership-checked
+			secured.POST("/media", mediaHandler.Upload)
+			secured.POST("/media/uploads", mediaHandler.CreateUpload)
+			secured.GET("/media/uploads/:mediaID", mediaHandler.GetUpload)
+			secured.PATCH("/media/uploads/:mediaID", mediaHandler.UploadChunk)
+			secured.POST("/media/uploads/:mediaID/complete", mediaHandler.CompleteUpload)
+			secured.GET("/media/:mediaID", mediaHandler.Download)
+			secured.GET("/media/:mediaID/thumbnails/:size", mediaHandler.Thumbnail)
+			secured.GET("/me/storage", mediaHandler.Storage)
+			// The caller's display name and directory privacy settings
+			secured.GET("/me/profile", userHandler.GetProfile)
+			secured.PATCH("/me/profile", userHandler.UpdateProfile)
+
+			// Server administration (global admins only; every change is audited)
+			admin := secured.Group("/admin")
+			{
+				admin.GET("/users", adminHandler.ListUsers)
+				admin.POST("/users/:userID/disable", adminHandler.DisableUser)
+				admin.POST("/users/:userID/enable", adminHandler.EnableUser)
+				admin.PUT("/users/:userID/admin", adminHandler.SetAdmin)
+				admin.POST("/users/:userID/logout", adminHandler.ForceLogout)
+				admin.DELETE("/users/:userID", adminHandler.DeleteUser)
+				admin.GET("/groups", adminHandler.ListGroups)
+				admin.GET("/groups/:groupID", adminHandler.GetGroup)
+				admin.DELETE("/groups/:groupID", adminHandler.DeleteGroup)
+				admin.GET("/connections", adminHandler.Connections)
+				admin.GET("/audit", adminHandler.ListAuditLog)
+			}
 
 			// Test Protected Endpoint
 			secured.GET("/test-auth", func(c *gin.Context) {
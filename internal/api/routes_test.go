@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Emmanuel326/chatserver/internal/api/middleware"
+	"github.com/Emmanuel326/chatserver/internal/authz"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// stubOIDCService only exists so the optional OIDC routes get registered.
+type stubOIDCService struct {
+	domain.OIDCService
+}
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterRoutes(router, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, &stubOIDCService{}, nil, nil, nil, nil, 0)
+	return router
+}
+
+// TestEveryRouteHasPolicy fails when an endpoint is registered without an entry in authz.Routes,
+// or when the table lists a route that no longer exists.
+func TestEveryRouteHasPolicy(t *testing.T) {
+	router := newTestRouter()
+
+	registered := make(map[string]bool)
+	for _, route := range router.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		t.Run(key, func(t *testing.T) {
+			if _, ok := authz.RouteFor(route.Method, route.Path); !ok {
+				t.Errorf("no authorization policy for %s; add it to authz.Routes", key)
+			}
+		})
+	}
+
+	for key := range authz.Routes {
+		if !registered[key] {
+			t.Errorf("authz.Routes has a policy for %s, which is not registered", key)
+		}
+	}
+}
+
+// testPath fills in a route's path parameters.
+func testPath(route string) string {
+	return strings.NewReplacer(":groupID", "1", ":userID", "2", ":recipientID", "2", ":sessionID", "abc", ":tokenID", "1", ":mediaID", "abc", ":size", "160", ":messageID", "1", ":conversationID", "group_1").Replace(route)
+}
+
+// authCase is one request made against a secured route.
+type authCase struct {
+	name   string
+	header string
+	want   int
+}
+
+// TestSecuredRoutesRequireAuth checks that every non-public route refuses anonymous requests
+// and API tokens on routes closed to them, before any handler runs.
+func TestSecuredRoutesRequireAuth(t *testing.T) {
+	router := newTestRouter()
+
+	for _, route := range router.Routes() {
+		policy, ok := authz.RouteFor(route.Method, route.Path)
+		if !ok || policy.Public {
+			continue
+		}
+		path := testPath(route.Path)
+
+		tests := []authCase{
+			{"anonymous", "", http.StatusUnauthorized},
+			{"malformed header", "Token abc", http.StatusUnauthorized},
+		}
+		if policy.TokenScope == "" {
+			tests = append(tests, authCase{"api token", "Bearer " + domain.APITokenPrefix + "abc", http.StatusForbidden})
+		}
+
+		for _, tt := range tests {
+			t.Run(route.Method+" "+route.Path+" "+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(route.Method, path, nil)
+				if tt.header != "" {
+					req.Header.Set("Authorization", tt.header)
+				}
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				if rec.Code != tt.want {
+					t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body.String())
+				}
+			})
+		}
+	}
+}
+
+// recordingAuthorizer records the decisions asked of it and refuses them all.
+type recordingAuthorizer struct {
+	actions   []domain.Action
+	resources []domain.Resource
+}
+
+func (r *recordingAuthorizer) Can(ctx context.Context, subject domain.Subject, action domain.Action, resource domain.Resource) error {
+	r.actions = append(r.actions, action)
+	r.resources = append(r.resources, resource)
+	return &domain.ForbiddenError{Msg: "refused"}
+}
+
+// Secured routes whose resource is not in their path; their handlers make the decision.
+var pathlessRoutes = map[string]bool{
+	"GET /v1/users": true,
+}
+
+// TestSecuredRoutesEnforceDeclaredAction checks that every secured route asks the authorizer for
+// the action authz.Routes declares, on the resource in its path, and stops when refused.
+func TestSecuredRoutesEnforceDeclaredAction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for key, policy := range authz.Routes {
+		if policy.Public {
+			continue
+		}
+		method, route, _ := strings.Cut(key, " ")
+		t.Run(key, func(t *testing.T) {
+			authorizer := &recordingAuthorizer{}
+			handled := false
+			router := gin.New()
+			router.Handle(method, route,
+				func(c *gin.Context) { c.Set(middleware.ContextUserIDKey, int64(7)) },
+				authorizeRoute(authorizer),
+				func(c *gin.Context) { handled = true; c.Status(http.StatusNoContent) },
+			)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(method, testPath(route), nil))
+
+			if pathlessRoutes[key] {
+				if len(authorizer.actions) != 0 || !handled {
+					t.Errorf("asked %v and handled = %v; want the handler to decide", authorizer.actions, handled)
+				}
+				return
+			}
+			if len(authorizer.actions) != 1 || authorizer.actions[0] != policy.Action {
+				t.Fatalf("asked the authorizer for %v, want [%s]", authorizer.actions, policy.Action)
+			}
+			resource := authorizer.resources[0]
+			want := domain.NoResource
+			switch {
+			case policy.Action == domain.ActionOwnAccount || policy.Action == domain.ActionServerAdmin:
+			case strings.Contains(route, ":groupID") || strings.Contains(route, ":conversationID"):
+				want = domain.GroupResource(1)
+			case strings.Contains(route, ":messageID"):
+				want = domain.MessageResource(1)
+			case strings.Contains(route, ":mediaID") && policy.Action == domain.ActionMediaView:
+				want = domain.MediaResource("abc")
+			case strings.Contains(route, ":userID") && policy.Action == domain.ActionUserView,
+				strings.Contains(route, ":recipientID"):
+				want = domain.UserResource(2)
+			}
+			if resource != want {
+				t.Errorf("resource = %+v, want %+v", resource, want)
+			}
+			if handled || rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d and handled = %v; want 403 before the handler", rec.Code, handled)
+			}
+		})
+	}
+}
+
+func TestConversationRoutesAuthorizeThePeer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authorizer := &recordingAuthorizer{}
+	router := gin.New()
+	router.GET("/v1/conversations/:conversationID/pins",
+		func(c *gin.Context) { c.Set(middleware.ContextUserIDKey, int64(7)) },
+		authorizeRoute(authorizer),
+	)
+
+	for _, tt := range []struct {
+		path     string
+		action   domain.Action
+		resource domain.Resource
+	}{
+		{"/v1/conversations/user_3/pins", domain.ActionUserMessage, domain.UserResource(3)},
+		{"/v1/conversations/group_4/pins", domain.ActionGroupView, domain.GroupResource(4)},
+	} {
+		authorizer.actions, authorizer.resources = nil, nil
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if len(authorizer.actions) != 1 || authorizer.actions[0] != tt.action || authorizer.resources[0] != tt.resource {
+			t.Errorf("%s: asked %v on %v, want %s on %+v", tt.path, authorizer.actions, authorizer.resources, tt.action, tt.resource)
+		}
+	}
+
+	// Malformed IDs are left to the handler's validation.
+	authorizer.actions = nil
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/conversations/chan_1/pins", nil))
+	if len(authorizer.actions) != 0 {
+		t.Errorf("asked %v for a malformed conversation", authorizer.actions)
+	}
+}
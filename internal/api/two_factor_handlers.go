@@ -0,0 +1,115 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Emmanuel326/chatserver/internal/api/middleware"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorHandler contains the dependencies required by the 2FA management endpoints.
+type TwoFactorHandler struct {
+	TwoFactorService domain.TwoFactorService
+}
+
+// NewTwoFactorHandler creates a new handler instance.
+func NewTwoFactorHandler(twoFactorService domain.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{TwoFactorService: twoFactorService}
+}
+
+// Status handles GET /v1/auth/2fa.
+func (h *TwoFactorHandler) Status(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	enabled, err := h.TwoFactorService.IsEnabled(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to load 2FA status for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve 2FA status"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": enabled})
+}
+
+// Enroll handles POST /v1/auth/2fa/enroll. It returns a new secret and its otpauth URI;
+// 2FA only becomes active after POST /v1/auth/2fa/verify with a code from the app.
+func (h *TwoFactorHandler) Enroll(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	enrollment, err := h.TwoFactorService.BeginEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		respondTwoFactorError(c, err, "Failed to start 2FA enrollment")
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Verify handles POST /v1/auth/2fa/verify, enabling 2FA. The recovery codes are only shown once.
+func (h *TwoFactorHandler) Verify(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	codes, err := h.TwoFactorService.ConfirmEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err, "Failed to enable 2FA")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable handles POST /v1/auth/2fa/disable; it requires a current or recovery code.
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	userID, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed or user ID missing"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	if err := h.TwoFactorService.Disable(c.Request.Context(), userID, req.Code); err != nil {
+		respondTwoFactorError(c, err, "Failed to disable 2FA")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// respondTwoFactorError maps domain errors from the 2FA service to HTTP responses.
+func respondTwoFactorError(c *gin.Context, err error, fallback string) {
+	switch e := err.(type) {
+	case *domain.ValidationError:
+		c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+	case *domain.NotFoundError:
+		c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+	case *domain.ConflictError:
+		c.JSON(http.StatusConflict, gin.H{"error": e.Error()})
+	default:
+		log.Printf("%s: %v", fallback, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,10 +1,12 @@
 package api
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Emmanuel326/chatserver/internal/api/middleware" // Added for middleware.GetUserIDFromContext
 	"github.com/Emmanuel326/chatserver/internal/auth"
@@ -14,21 +16,61 @@ import (
 
 // UserHandler contains the dependencies required by user API endpoints.
 type UserHandler struct {
-	UserService domain.UserService
-	JWTManager  *auth.JWTManager
+	UserService      domain.UserService
+	SessionService   domain.SessionService
+	TwoFactorService domain.TwoFactorService
+	AccountService   domain.AccountService
+	LoginThrottle    domain.LoginThrottleService
+	Authorizer       domain.Authorizer
+	JWTManager       *auth.JWTManager
 }
 
 // NewUserHandler creates a new handler instance.
-func NewUserHandler(userService domain.UserService, jwtManager *auth.JWTManager) *UserHandler {
+func NewUserHandler(userService domain.UserService, sessionService domain.SessionService, twoFactorService domain.TwoFactorService, accountService domain.AccountService, loginThrottle domain.LoginThrottleService, authorizer domain.Authorizer, jwtManager *auth.JWTManager) *UserHandler {
 	return &UserHandler{
-		UserService: userService,
-		JWTManager:  jwtManager,
+		UserService:      userService,
+		SessionService:   sessionService,
+		TwoFactorService: twoFactorService,
+		AccountService:   accountService,
+		LoginThrottle:    loginThrottle,
+		Authorizer:       authorizer,
+		JWTManager:       jwtManager,
 	}
 }
 
-// ListUsersWithChatInfo handles GET /v1/users/with-chat-info to retrieve
-// all registered users along with the last P2P message content and timestamp
-// for the authenticated user with each listed user.
+// issueTokens starts a new login session for the user and returns its access/refresh token pair.
+func (h *UserHandler) issueTokens(c *gin.Context, userID int64, deviceName string) (*AuthResponse, error) {
+	return issueTokens(c, h.SessionService, h.JWTManager, userID, deviceName)
+}
+
+// issueTokens records a session for the requesting device and returns its access/refresh token pair.
+// It is shared by every login method (password, 2FA, OIDC).
+func issueTokens(c *gin.Context, sessionService domain.SessionService, jwtManager *auth.JWTManager, userID int64, deviceName string) (*AuthResponse, error) {
+	device := domain.SessionDevice{
+		DeviceName: deviceName,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	session, refreshToken, err := sessionService.StartSession(c.Request.Context(), userID, device)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwtManager.GenerateToken(userID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(jwtManager.Expiry.Seconds()),
+	}, nil
+}
+
+// ListUsersWithChatInfo handles GET /v1/users/with-chat-info to retrieve the
+// discoverable users and the authenticated user's chat partners along with the
+// last P2P message content and timestamp with each listed user.
 func (h *UserHandler) ListUsersWithChatInfo(c *gin.Context) {
 	currentUserID, exists := middleware.GetUserIDFromContext(c)
 	if !exists {
@@ -49,7 +91,6 @@ func (h *UserHandler) ListUsersWithChatInfo(c *gin.Context) {
 		response[i] = UserCardResponse{
 			ID:                   u.ID,
 			Username:             u.Username,
-			Email:                u.Email,
 			LastMessageContent:   u.LastMessageContent,
 			LastMessageTimestamp: u.LastMessageTimestamp,
 			LastMessageSenderID:  u.LastMessageSenderID,
@@ -90,21 +131,40 @@ func (h *UserHandler) Register(c *gin.Context) {
 		}
 	}
 
-	token, err := h.JWTManager.GenerateToken(user.ID)
+	// Email delivery is best-effort: the user can ask for a new link later
+	if err := h.AccountService.SendVerificationEmail(c.Request.Context(), user.ID); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	// Logins are blocked until the email is verified, so there are no tokens to hand out yet
+	if h.UserService.RequiresEmailVerification() {
+		c.JSON(http.StatusCreated, gin.H{
+			"message":                     "User registered successfully. Check your email to verify your address before logging in.",
+			"email_verification_required": true,
+		})
+		return
+	}
+
+	tokens, err := h.issueTokens(c, user.ID, req.DeviceName)
 	if err != nil {
-		log.Printf("Failed to generate JWT for user %d: %v", user.ID, err)
+		log.Printf("Failed to generate tokens for user %d: %v", user.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration successful, but failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
-		"token":   token,
+		"message":       "User registered successfully",
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
-// ListUsers handles GET /v1/users to retrieve all registered users.
+// ListUsers handles GET /v1/users to retrieve every discoverable user as a directory entry.
+// Deprecated: the list is unbounded; clients should use GET /v1/users/directory.
 func (h *UserHandler) ListUsers(c *gin.Context) {
+	c.Header("Deprecation", "true")
+	c.Header("Link", `</v1/users/directory>; rel="successor-version"`)
 	users, err := h.UserService.ListAll(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user list"})
@@ -113,7 +173,90 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, users)
 }
 
-// GetUserByID handles GET /v1/users/:userID to retrieve a single user's public details.
+// SearchDirectory handles GET /v1/users/directory?q=&cursor=&limit=, searching discoverable users
+// by prefix and then fuzzily. Without q it lists them all, a page at a time.
+func (h *UserHandler) SearchDirectory(c *gin.Context) {
+	var after *domain.DirectoryCursor
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := domain.ParseDirectoryCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		after = cursor
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(domain.DefaultDirectoryLimit)))
+	if err != nil || limit <= 0 || limit > domain.MaxDirectoryLimit {
+		limit = domain.DefaultDirectoryLimit
+	}
+
+	users, err := h.UserService.SearchDirectory(c.Request.Context(), c.Query("q"), after, limit)
+	if err != nil {
+		log.Printf("Failed to search the user directory: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search user directory"})
+		return
+	}
+
+	// A full page means there may be more results after the last user returned.
+	nextCursor := ""
+	if len(users) == limit {
+		last := users[len(users)-1]
+		nextCursor = domain.DirectoryCursor{Rank: last.MatchRank, UserID: last.ID}.String()
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "next_cursor": nextCursor})
+}
+
+// GetProfile handles GET /v1/me/profile.
+func (h *UserHandler) GetProfile(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+	user, err := h.UserService.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to retrieve profile of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve profile"})
+		return
+	}
+	c.JSON(http.StatusOK, newProfileResponse(user))
+}
+
+// UpdateProfile handles PATCH /v1/me/profile, changing the display name and directory privacy settings.
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	user, err := h.UserService.UpdateProfile(c.Request.Context(), userID, domain.ProfileUpdate{
+		DisplayName:       req.DisplayName,
+		Discoverable:      req.Discoverable,
+		EmailDiscoverable: req.EmailDiscoverable,
+	})
+	if err != nil {
+		if e, ok := err.(*domain.ValidationError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+			return
+		}
+		log.Printf("Failed to update profile of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	c.JSON(http.StatusOK, newProfileResponse(user))
+}
+
+func newProfileResponse(user *domain.User) ProfileResponse {
+	return ProfileResponse{
+		ID:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		DisplayName:     user.DisplayName,
+		PrivacySettings: user.PrivacySettings,
+	}
+}
+
+// GetUserByID handles GET /v1/users/:userID to retrieve a single user's public details. Only the
+// user themselves and server administrators get the full account.
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	userIDStr := c.Param("userID")
 	userID, err := strconv.ParseInt(userIDStr, 10, 64)
@@ -122,11 +265,18 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		return
 	}
 
-	user, err := h.UserService.GetUserByID(c.Request.Context(), userID)
+	requesterID, _ := middleware.GetUserIDFromContext(c)
+	err = h.Authorizer.Can(c.Request.Context(), domain.UserSubject(requesterID), domain.ActionUserView, domain.UserResource(userID))
+	var user *domain.User
+	if err == nil {
+		user, err = h.UserService.GetUserByID(c.Request.Context(), userID)
+	}
 	if err != nil {
 		// Differentiate between "not found" and other errors
 		if _, ok := err.(*domain.NotFoundError); ok {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else if e, ok := err.(*domain.ForbiddenError); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": e.Error()})
 		} else {
 			log.Printf("Failed to retrieve user %d: %v", userID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
@@ -134,7 +284,16 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	if requesterID == userID || h.Authorizer.Can(c.Request.Context(), domain.UserSubject(requesterID), domain.ActionServerAdmin, domain.NoResource) == nil {
+		c.JSON(http.StatusOK, user)
+		return
+	}
+	c.JSON(http.StatusOK, PublicProfileResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		IsBot:       user.IsBot,
+	})
 }
 
 // Login handles user authentication via HTTP POST.
@@ -145,8 +304,36 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.UserService.Authenticate(c.Request.Context(), req.Email, req.Password)
+	// Refuse blocked accounts/IPs before spending any bcrypt work on the attempt
+	ctx := c.Request.Context()
+	attempt, ok := h.reserveLoginAttempt(c, req.Email)
+	if !ok {
+		return
+	}
+
+	user, err := h.UserService.Authenticate(ctx, req.Email, req.Password)
+	result := domain.LoginInterrupted
+	switch err.(type) {
+	case nil:
+		result = domain.LoginSucceeded
+	case *domain.NotFoundError:
+		result = domain.LoginRejectedPassword
+	}
+	// A correct password that still needs a second factor is not a completed login, so it
+	// leaves the account's failures in place.
+	h.settleLoginAttempt(ctx, attempt, result)
 	if err != nil {
+		// Password was correct but a second factor is needed: no tokens yet, only the challenge
+		if e, ok := err.(*domain.TwoFactorRequiredError); ok {
+			c.JSON(http.StatusOK, gin.H{
+				"message":             "Two-factor authentication required",
+				"two_factor_required": true,
+				"challenge_token":     e.ChallengeToken,
+				"expires_in":          int(time.Until(e.ExpiresAt).Seconds()),
+			})
+			return
+		}
+
 		log.Printf("Authentication failed for %s: %v", req.Email, err)
 		switch e := err.(type) {
 		case *domain.ValidationError:
@@ -155,22 +342,133 @@ func (h *UserHandler) Login(c *gin.Context) {
 		case *domain.NotFoundError:
 			c.JSON(http.StatusUnauthorized, gin.H{"error": e.Error()})
 			return
+		case *domain.AccountDisabledError:
+			c.JSON(http.StatusForbidden, gin.H{"error": e.Error(), "code": codeAccountDisabled})
+			return
+		case *domain.ForbiddenError:
+			// Correct password, but REQUIRE_EMAIL_VERIFICATION is on and the email is unverified
+			c.JSON(http.StatusForbidden, gin.H{"error": e.Error(), "code": "EMAIL_NOT_VERIFIED"})
+			return
 		default:
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
 		}
 	}
 
-	token, err := h.JWTManager.GenerateToken(user.ID)
+	tokens, err := h.issueTokens(c, user.ID, req.DeviceName)
 	if err != nil {
-		log.Printf("Failed to generate JWT for user %d: %v", user.ID, err)
+		log.Printf("Failed to generate tokens for user %d: %v", user.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login successful, but failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
+		"message":       "Login successful",
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
+
+// LoginTwoFactor handles POST /v1/users/login/2fa, the second login step for users with 2FA:
+// the challenge token from Login is exchanged together with a TOTP or recovery code.
+func (h *UserHandler) LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format or missing fields"})
+		return
+	}
+
+	// Wrong codes count against the account just like wrong passwords
+	ctx := c.Request.Context()
+	challengeUser, err := h.TwoFactorService.FindChallengeUser(ctx, req.ChallengeToken)
+	if err != nil {
+		if e, ok := err.(*domain.UnauthorizedError); ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": e.Error()})
+			return
+		}
+		log.Printf("Failed to load login challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	attempt, ok := h.reserveLoginAttempt(c, challengeUser.Email)
+	if !ok {
+		return
+	}
+
+	user, err := h.TwoFactorService.VerifyChallenge(ctx, req.ChallengeToken, req.Code)
+	result := domain.LoginInterrupted
+	switch err.(type) {
+	case nil:
+		result = domain.LoginSucceeded
+	case *domain.UnauthorizedError:
+		result = domain.LoginRejectedCode
+	}
+	h.settleLoginAttempt(ctx, attempt, result)
+	if err != nil {
+		if e, ok := err.(*domain.UnauthorizedError); ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": e.Error()})
+			return
+		}
+		if e, ok := err.(*domain.AccountDisabledError); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": e.Error(), "code": codeAccountDisabled})
+			return
+		}
+		log.Printf("Failed to verify login challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	tokens, err := h.issueTokens(c, user.ID, req.DeviceName)
+	if err != nil {
+		log.Printf("Failed to generate tokens for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login successful, but failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Login successful",
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// reserveLoginAttempt counts a login step against the account and the client IP, responding
+// with 429 while either is blocked. It reports false when a response was already sent.
+func (h *UserHandler) reserveLoginAttempt(c *gin.Context, email string) (*domain.LoginAttempt, bool) {
+	ip := c.ClientIP()
+	attempt, err := h.LoginThrottle.Reserve(c.Request.Context(), email, ip, c.Request.UserAgent())
+	if err != nil {
+		if e, ok := err.(*domain.RateLimitedError); ok {
+			log.Printf("Login throttled for %s from %s", email, ip)
+			respondRateLimited(c, e)
+			return nil, false
+		}
+		log.Printf("Failed to check login throttle for %s: %v", email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process login"})
+		return nil, false
+	}
+	return attempt, true
+}
+
+// settleLoginAttempt records how a reserved login step ended; failures are only logged.
+func (h *UserHandler) settleLoginAttempt(ctx context.Context, attempt *domain.LoginAttempt, result domain.LoginResult) {
+	if err := h.LoginThrottle.Settle(ctx, attempt, result); err != nil {
+		log.Printf("Failed to settle login attempt for %s: %v", attempt.Email, err)
+	}
+}
+
+// codeAccountDisabled tells clients that a login was refused because an administrator disabled the account.
+const codeAccountDisabled = "ACCOUNT_DISABLED"
+
+// respondRateLimited sends a 429 with a Retry-After header so clients know when to try again.
+func respondRateLimited(c *gin.Context, e *domain.RateLimitedError) {
+	retryAfter := e.RetryAfter()
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": e.Error(), "retry_after": retryAfter})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/api/middleware"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type stubUserService struct {
+	domain.UserService
+	users map[int64]*domain.User
+}
+
+func (s *stubUserService) GetUserByID(ctx context.Context, id int64) (*domain.User, error) {
+	if user, ok := s.users[id]; ok {
+		return user, nil
+	}
+	return nil, &domain.NotFoundError{Msg: "user not found"}
+}
+
+// adminAuthorizer allows every action, except server administration for anyone but admin.
+type adminAuthorizer struct {
+	admin int64
+}
+
+func (a adminAuthorizer) Can(ctx context.Context, subject domain.Subject, action domain.Action, resource domain.Resource) error {
+	if action == domain.ActionServerAdmin && subject.UserID != a.admin {
+		return &domain.ForbiddenError{Msg: "refused"}
+	}
+	return nil
+}
+
+func TestGetUserByIDHidesAccountDetailsFromOthers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	disabledAt := time.Now()
+	users := &stubUserService{users: map[int64]*domain.User{
+		2: {ID: 2, Username: "ann", Email: "ann@example.com", DisplayName: "Ann", DisabledAt: &disabledAt},
+	}}
+	handler := &UserHandler{UserService: users, Authorizer: adminAuthorizer{admin: 9}}
+
+	for _, tt := range []struct {
+		name      string
+		requester int64
+		full      bool
+	}{
+		{"other user", 7, false},
+		{"the user", 2, true},
+		{"server admin", 9, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/v1/users/:userID",
+				func(c *gin.Context) { c.Set(middleware.ContextUserIDKey, tt.requester) },
+				handler.GetUserByID,
+			)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/2", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body.String())
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["username"] != "ann" || body["display_name"] != "Ann" {
+				t.Errorf("body = %v, want the public profile", body)
+			}
+			for _, field := range []string{"email", "is_admin", "disabled_at"} {
+				if _, ok := body[field]; ok != tt.full {
+					t.Errorf("field %q shown = %v, want %v (body %v)", field, ok, tt.full, body)
+				}
+			}
+		})
+	}
+}
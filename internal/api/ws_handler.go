@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	"github.com/Emmanuel326/chatserver/internal/auth" 
+	"github.com/Emmanuel326/chatserver/internal/domain"
 	"github.com/Emmanuel326/chatserver/internal/ws"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -25,13 +26,15 @@ var upgrader = websocket.Upgrader{
 type WSHandler struct {
 	Hub *ws.Hub
 	jwtManager *auth.JWTManager // <-- Must be used for validation
+	sessionService domain.SessionService // Used to reject revoked tokens
 }
 
-// NewWSHandler remains the same (Correct)
-func NewWSHandler(hub *ws.Hub, jwtManager *auth.JWTManager) *WSHandler {
+// NewWSHandler creates a new WSHandler.
+func NewWSHandler(hub *ws.Hub, jwtManager *auth.JWTManager, sessionService domain.SessionService) *WSHandler {
 	return &WSHandler{
 		Hub: hub,
 		jwtManager: jwtManager,
+		sessionService: sessionService,
 	}
 }
 
@@ -54,6 +57,19 @@ func (h *WSHandler) ServeWs(c *gin.Context) {
     }
     userID := claims.UserID // Ensure claims struct has UserID
 
+    // 2b. Reject revoked tokens (denylisted jti or logged-out session)
+    revoked, err := h.sessionService.IsAccessTokenRevoked(c.Request.Context(), claims.ID, claims.SessionID)
+    if err != nil {
+        log.Printf("WS Connect attempt: revocation check failed for UserID %d: %v", userID, err)
+        c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+        return
+    }
+    if revoked {
+        log.Printf("WS Connect attempt: revoked token for UserID %d", userID)
+        c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+        return
+    }
+
 	// 3. Upgrade HTTP Connection to WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -64,5 +80,5 @@ func (h *WSHandler) ServeWs(c *gin.Context) {
 	log.Printf("User %d successfully connected via WebSocket.", userID)
 
 	
-	ws.ServeWs(h.Hub, conn, userID) 
+	ws.ServeWs(h.Hub, conn, userID, claims.SessionID)
 }
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/Emmanuel326/chatserver/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWKSPublishesEveryPublicKey(t *testing.T) {
+	dir := t.TempDir()
+	rsaPrivate, edPrivate, retired := testRSAKey(t), testEd25519Key(t), testEd25519Key(t)
+	writePrivateKey(t, dir, "b-rsa", rsaPrivate)
+	writePrivateKey(t, dir, "c-ed25519", edPrivate)
+	writePublicKey(t, dir, "a-retired", retired)
+	m := newKeyManager(t, dir, "b-rsa")
+
+	set := m.JWKS()
+	if len(set.Keys) != 3 {
+		t.Fatalf("JWKS has %d keys, want 3", len(set.Keys))
+	}
+	for i, kid := range []string{"a-retired", "b-rsa", "c-ed25519"} {
+		if set.Keys[i].Kid != kid || set.Keys[i].Use != "sig" {
+			t.Errorf("key %d = %q (use %q), want %q sorted by kid, use sig", i, set.Keys[i].Kid, set.Keys[i].Use, kid)
+		}
+	}
+
+	rsaJWK := set.Keys[1]
+	if rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.E != "AQAB" || rsaJWK.Crv != "" || rsaJWK.X != "" {
+		t.Errorf("RSA JWK = %+v", rsaJWK)
+	}
+	edJWK := set.Keys[2]
+	if edJWK.Kty != "OKP" || edJWK.Alg != "EdDSA" || edJWK.Crv != "Ed25519" || edJWK.N != "" || edJWK.E != "" {
+		t.Errorf("Ed25519 JWK = %+v", edJWK)
+	}
+
+	// Other services must be able to verify our tokens from the published keys alone
+	token := mustToken(t, m)
+	published := jwkPublicKey(t, rsaJWK)
+	if _, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return published, nil }, jwt.WithValidMethods([]string{"RS256"})); err != nil {
+		t.Errorf("token does not verify with the published RSA key: %v", err)
+	}
+	if x := jwkPublicKey(t, edJWK); !x.(ed25519.PublicKey).Equal(edPrivate.Public()) {
+		t.Error("published Ed25519 key does not match the private key")
+	}
+
+	// Private key material never ends up in the document
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range raw.Keys {
+		for _, field := range []string{"d", "p", "q", "dp", "dq", "qi"} {
+			if _, ok := key[field]; ok {
+				t.Errorf("JWK %v has private field %q", key["kid"], field)
+			}
+		}
+	}
+}
+
+func TestJWKSIsEmptyWithASharedSecret(t *testing.T) {
+	m, err := NewJWTManager(&config.Config{JWT_SECRET: "test-secret", JWT_EXPIRY: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(m.JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"keys":[]}` {
+		t.Errorf("JWKS = %s, want an empty key list", data)
+	}
+}
+
+// jwkPublicKey rebuilds the public key described by a JWK, as a relying party would.
+func jwkPublicKey(t *testing.T, jwk JWK) interface{} {
+	t.Helper()
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("JWK %s has invalid base64url %q: %v", jwk.Kid, s, err)
+		}
+		return b
+	}
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	case "OKP":
+		x := decode(jwk.X)
+		if len(x) != ed25519.PublicKeySize {
+			t.Fatalf("Ed25519 JWK x is %d bytes, want %d", len(x), ed25519.PublicKeySize)
+		}
+		return ed25519.PublicKey(x)
+	}
+	t.Fatalf("unexpected kty %q", jwk.Kty)
+	return nil
+}
@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 	"errors"
+	"fmt"
 
 	"github.com/Emmanuel326/chatserver/internal/config"
 	"github.com/golang-jwt/jwt/v5"
@@ -10,36 +13,84 @@ import (
 
 // Claims defines the payload structure for our JWT.
 // We embed jwt.RegisteredClaims to include standard claims like Expiration time.
+// The token's jti (RegisteredClaims.ID) identifies it for revocation, and SessionID ties it to
+// the server-side login session so that logging out invalidates every token of that session.
 type Claims struct {
-	UserID int64 `json:"user_id"`
+	UserID    int64  `json:"user_id"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
 // JWTManager handles token creation and validation.
+// Tokens are signed with the shared SecretKey (HS256) unless asymmetric keys are configured:
+// then they are signed with the active key and carry its kid, and every loaded key verifies.
 type JWTManager struct {
 	SecretKey string
 	Expiry    time.Duration
+
+	keys      map[string]*signingKey // Asymmetric keys by kid; empty in HMAC mode
+	activeKey *signingKey            // Key used to sign new tokens
 }
 
 // NewJWTManager creates a new JWTManager instance using the application config.
-func NewJWTManager(cfg *config.Config) *JWTManager {
-	return &JWTManager{
+// If JWT_KEYS_DIR is set, the RSA/Ed25519 keys in it are loaded and JWT_ACTIVE_KID
+// (or, if unset, the last kid in lexical order) is used for signing.
+func NewJWTManager(cfg *config.Config) (*JWTManager, error) {
+	m := &JWTManager{
 		SecretKey: cfg.JWT_SECRET,
 		// Convert minutes from config to time.Duration
 		Expiry: time.Duration(cfg.JWT_EXPIRY) * time.Minute,
 	}
+
+	if cfg.JWT_KEYS_DIR == "" {
+		return m, nil
+	}
+
+	keys, err := loadKeys(cfg.JWT_KEYS_DIR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+
+	activeKID := cfg.JWT_ACTIVE_KID
+	if activeKID == "" {
+		for kid, key := range keys {
+			if key.private != nil && kid > activeKID {
+				activeKID = kid
+			}
+		}
+	}
+
+	active, ok := keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active JWT key %q not found in %s", activeKID, cfg.JWT_KEYS_DIR)
+	}
+	if active.private == nil {
+		return nil, fmt.Errorf("active JWT key %q has no private key", activeKID)
+	}
+
+	m.keys = keys
+	m.activeKey = active
+	return m, nil
 }
 
-// GenerateToken creates a new signed JWT for the given user ID.
-func (m *JWTManager) GenerateToken(userID int64) (string, error) {
+// GenerateToken creates a new signed, short-lived access token for the given user and session.
+func (m *JWTManager) GenerateToken(userID int64, sessionID string) (string, error) {
 	// Define token expiry time
 	expirationTime := time.Now().Add(m.Expiry)
 
+	// Every token gets a unique ID so it can be revoked individually
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	// Create the Claims (payload)
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			// Recommended claims
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -47,6 +98,13 @@ func (m *JWTManager) GenerateToken(userID int64) (string, error) {
 		},
 	}
 
+	// Sign with the active asymmetric key, naming it in the kid header so verifiers can pick it
+	if m.activeKey != nil {
+		token := jwt.NewWithClaims(m.activeKey.method, claims)
+		token.Header["kid"] = m.activeKey.kid
+		return token.SignedString(m.activeKey.private)
+	}
+
 	// Create the token using the claims and the HMAC signing method
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -63,13 +121,7 @@ func (m *JWTManager) GenerateToken(userID int64) (string, error) {
 func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Verify the signing method is what we expect
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(m.SecretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.verificationKey)
 
 	if err != nil {
 		return nil, err
@@ -79,5 +131,41 @@ func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	// Tokens issued before sessions existed cannot be revoked, so they are no longer accepted.
+	if claims.ID == "" || claims.SessionID == "" {
+		return nil, errors.New("token has no session")
+	}
+
 	return claims, nil
 }
+
+// verificationKey selects the key that must have signed the token. With asymmetric keys the
+// token's kid must name a loaded key and its alg must match that key; HMAC is then refused.
+func (m *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if len(m.keys) == 0 {
+		// Verify the signing method is what we expect
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(m.SecretKey), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// newTokenID returns a random identifier for the jti claim.
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Emmanuel326/chatserver/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	rsaKeyOnce sync.Once
+	rsaKey     *rsa.PrivateKey
+)
+
+// testRSAKey returns a 2048-bit key shared by the tests, as generating one is slow.
+func testRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	rsaKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsaKey = key
+	})
+	return rsaKey
+}
+
+func testEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// writePrivateKey stores key as <dir>/<kid>.pem in PKCS#8 form.
+func writePrivateKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid, "PRIVATE KEY", der)
+}
+
+// writePublicKey stores only the public part of key, as kept after a rotation.
+func writePublicKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid, "PUBLIC KEY", der)
+}
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newKeyManager(t *testing.T, dir, activeKID string) *JWTManager {
+	t.Helper()
+	m, err := NewJWTManager(&config.Config{JWT_SECRET: "test-secret", JWT_EXPIRY: 15, JWT_KEYS_DIR: dir, JWT_ACTIVE_KID: activeKID})
+	if err != nil {
+		t.Fatalf("NewJWTManager returned %v", err)
+	}
+	return m
+}
+
+// headerKID returns the kid a token was signed with.
+func headerKID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := testRSAKey(t)
+	writePrivateKey(t, dir, "2024-01", oldKey)
+	before := newKeyManager(t, dir, "")
+	oldToken, err := before.GenerateToken(1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new key takes over signing by default; the old one keeps verifying
+	writePrivateKey(t, dir, "2024-06", testEd25519Key(t))
+	rotated := newKeyManager(t, dir, "")
+	newToken, err := rotated.GenerateToken(1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := headerKID(t, newToken); kid != "2024-06" {
+		t.Errorf("new token signed with kid %q, want 2024-06", kid)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := rotated.ValidateToken(token); err != nil {
+			t.Errorf("%s token rejected after the rotation: %v", name, err)
+		}
+	}
+
+	// Pinning JWT_ACTIVE_KID keeps signing with the old key
+	if kid := headerKID(t, mustToken(t, newKeyManager(t, dir, "2024-01"))); kid != "2024-01" {
+		t.Errorf("pinned manager signed with kid %q, want 2024-01", kid)
+	}
+
+	// Once only the public half is kept, the old key verifies but cannot sign
+	writePublicKey(t, dir, "2024-01", oldKey)
+	if _, err := newKeyManager(t, dir, "").ValidateToken(oldToken); err != nil {
+		t.Errorf("old token rejected by its public key: %v", err)
+	}
+	if _, err := NewJWTManager(&config.Config{JWT_EXPIRY: 15, JWT_KEYS_DIR: dir, JWT_ACTIVE_KID: "2024-01"}); err == nil {
+		t.Error("a public-only key was accepted as the active key")
+	}
+
+	// Removing the key retires its tokens
+	if err := os.Remove(filepath.Join(dir, "2024-01.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newKeyManager(t, dir, "").ValidateToken(oldToken); err == nil {
+		t.Error("token of a removed key still accepted")
+	}
+}
+
+func mustToken(t *testing.T, m *JWTManager) string {
+	t.Helper()
+	token, err := m.GenerateToken(1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestValidateTokenSelectsTheKeyByKID(t *testing.T) {
+	dir := t.TempDir()
+	rsaPrivate, edPrivate := testRSAKey(t), testEd25519Key(t)
+	writePrivateKey(t, dir, "a-rsa", rsaPrivate)
+	writePrivateKey(t, dir, "b-ed25519", edPrivate)
+	m := newKeyManager(t, dir, "")
+
+	// Valid claims of a real token, re-signed below with various keys and headers
+	claims, err := m.ValidateToken(mustToken(t, m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"rsa key", sign(jwt.SigningMethodRS256, "a-rsa", rsaPrivate), true},
+		{"ed25519 key", sign(jwt.SigningMethodEdDSA, "b-ed25519", edPrivate), true},
+		{"kid of another key", sign(jwt.SigningMethodRS256, "b-ed25519", rsaPrivate), false},
+		{"alg not matching the key", sign(jwt.SigningMethodEdDSA, "a-rsa", edPrivate), false},
+		{"unknown kid", sign(jwt.SigningMethodRS256, "c-unknown", rsaPrivate), false},
+		{"no kid", sign(jwt.SigningMethodRS256, "", rsaPrivate), false},
+		{"shared secret", sign(jwt.SigningMethodHS256, "a-rsa", []byte("test-secret")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.ValidateToken(tt.token)
+			if valid := err == nil; valid != tt.valid {
+				t.Errorf("ValidateToken valid = %v (err %v), want %v", valid, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestLoadKeysRejectsUnsafeKeys(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "small", small)
+	if _, err := loadKeys(dir); err == nil || !strings.Contains(err.Error(), "bits") {
+		t.Errorf("loadKeys with a 1024-bit RSA key returned %v, want a key size error", err)
+	}
+	if _, err := loadKeys(t.TempDir()); err == nil {
+		t.Error("loadKeys accepted an empty directory")
+	}
+}
@@ -0,0 +1,376 @@
+// Package authz is the single place where authorization decisions are made. Services, handlers
+// and the WebSocket hub ask Policy.Can before acting on a user or group, and Routes records the
+// decision for every HTTP route so that no endpoint ships without one.
+package authz
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+// Policy implements domain.Authorizer using group membership, roles, sanctions and posting policies.
+type Policy struct {
+	groups   domain.GroupRepository
+	users    domain.UserRepository
+	messages domain.MessageRepository // Needed for slow mode
+	media    domain.MediaRepository
+}
+
+// NewPolicy creates the authorization policy.
+func NewPolicy(groups domain.GroupRepository, users domain.UserRepository, messages domain.MessageRepository, media domain.MediaRepository) *Policy {
+	return &Policy{groups: groups, users: users, messages: messages, media: media}
+}
+
+// Can decides whether subject may perform action on resource. Unknown actions are denied.
+func (p *Policy) Can(ctx context.Context, subject domain.Subject, action domain.Action, resource domain.Resource) error {
+	if subject.UserID == 0 {
+		return &domain.ForbiddenError{Msg: "authentication required"}
+	}
+
+	switch action {
+	case domain.ActionOwnAccount:
+		if resource.Kind != domain.ResourceNone && (resource.Kind != domain.ResourceUser || resource.ID != subject.UserID) {
+			return &domain.ForbiddenError{Msg: "you can only manage your own account"}
+		}
+		return nil
+
+	case domain.ActionGroupCreate, domain.ActionGroupDiscover, domain.ActionMediaUpload:
+		return nil
+
+	case domain.ActionUserView:
+		return p.canViewUser(ctx, subject, resource)
+
+	case domain.ActionUserMessage:
+		_, err := p.requireUser(ctx, resource)
+		return err
+
+	case domain.ActionGroupJoin:
+		return p.canJoin(ctx, subject, resource)
+
+	case domain.ActionGroupView:
+		_, _, err := p.requireMember(ctx, subject, resource, "only members can view this group")
+		return err
+
+	case domain.ActionGroupInvite:
+		_, _, err := p.requireMember(ctx, subject, resource, "only members can add people to this group")
+		return err
+
+	case domain.ActionGroupPost:
+		return p.canPost(ctx, subject, resource)
+
+	case domain.ActionGroupManage:
+		return p.requireAdmin(ctx, subject, resource, "only group admins can change group settings")
+
+	case domain.ActionGroupModerate:
+		return p.requireAdmin(ctx, subject, resource, "only group admins can moderate this group")
+
+	case domain.ActionGroupDelete:
+		group, err := p.loadGroup(ctx, resource)
+		if err != nil {
+			return err
+		}
+		if group.OwnerID == subject.UserID {
+			return nil
+		}
+		err = p.requireServerAdmin(ctx, subject)
+		if _, ok := err.(*domain.ForbiddenError); ok {
+			return &domain.ForbiddenError{Msg: "only the group owner can delete this group"}
+		}
+		return err
+
+	case domain.ActionMediaView:
+		return p.canViewMedia(ctx, subject, resource)
+
+	case domain.ActionMessageView:
+		_, _, _, err := p.loadMessage(ctx, subject, resource)
+		return err
+
+	case domain.ActionMessagePin:
+		_, group, member, err := p.loadMessage(ctx, subject, resource)
+		if err != nil || group == nil {
+			return err
+		}
+		if !member.IsAdmin {
+			return &domain.ForbiddenError{Msg: "only group admins can pin messages"}
+		}
+		if group.IsArchived() {
+			return &domain.ForbiddenError{Msg: "this group is archived and read-only"}
+		}
+		return nil
+
+	case domain.ActionServerAdmin:
+		return p.requireServerAdmin(ctx, subject)
+	}
+
+	return &domain.ForbiddenError{Msg: fmt.Sprintf("no authorization policy for action %q", action)}
+}
+
+// canJoin allows self-joining public groups unless the subject is banned. Private groups are
+// reported as missing so their existence isn't leaked.
+func (p *Policy) canJoin(ctx context.Context, subject domain.Subject, resource domain.Resource) error {
+	group, err := p.loadGroup(ctx, resource)
+	if err != nil {
+		return err
+	}
+	if !group.IsPublic {
+		return &domain.NotFoundError{Msg: "group not found"}
+	}
+
+	ban, err := p.groups.FindActiveSanction(ctx, group.ID, subject.UserID, domain.SanctionBan)
+	if err != nil {
+		return fmt.Errorf("failed to check ban status: %w", err)
+	}
+	if ban != nil {
+		return &domain.ForbiddenError{Msg: "user is banned from this group"}
+	}
+	return nil
+}
+
+// canPost checks that the subject belongs to the group and that the group's posting
+// policy (everyone, admins only, or slow mode) currently allows them to post.
+func (p *Policy) canPost(ctx context.Context, subject domain.Subject, resource domain.Resource) error {
+	group, err := p.loadGroup(ctx, resource)
+	if err != nil {
+		return err
+	}
+
+	member, err := p.groups.FindMember(ctx, group.ID, subject.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check group membership: %w", err)
+	}
+	if member == nil {
+		return &domain.PostingRestrictedError{Code: domain.CodeNotGroupMember, Msg: "sender is not a member of this group"}
+	}
+
+	// Muted members can still read but not post until the mute expires or is lifted.
+	mute, err := p.groups.FindActiveSanction(ctx, group.ID, subject.UserID, domain.SanctionMute)
+	if err != nil {
+		return fmt.Errorf("failed to check mute status: %w", err)
+	}
+	if mute != nil {
+		restricted := &domain.PostingRestrictedError{Code: domain.CodeMuted, Msg: "you are muted in this group"}
+		if mute.ExpiresAt != nil {
+			restricted.RetryAt = *mute.ExpiresAt
+		}
+		return restricted
+	}
+
+	// Archived groups are read-only for everyone, admins included.
+	if group.IsArchived() {
+		return &domain.PostingRestrictedError{Code: domain.CodeGroupArchived, Msg: "this group is archived and read-only"}
+	}
+
+	// Admins are exempt from every other posting restriction.
+	if member.IsAdmin {
+		return nil
+	}
+
+	switch group.PostingPolicy {
+	case domain.PostingAdminsOnly:
+		return &domain.PostingRestrictedError{Code: domain.CodeAdminsOnly, Msg: "only group admins can post in this group"}
+	case domain.PostingSlowMode:
+		if group.SlowModeSeconds <= 0 {
+			return nil
+		}
+		last, err := p.messages.FindLastGroupMessageBySender(ctx, group.ID, subject.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to check slow mode: %w", err)
+		}
+		if last == nil {
+			return nil
+		}
+		retryAt := last.Timestamp.Add(time.Duration(group.SlowModeSeconds) * time.Second)
+		if time.Now().Before(retryAt) {
+			return &domain.PostingRestrictedError{
+				Code:    domain.CodeSlowMode,
+				Msg:     fmt.Sprintf("slow mode is on: members may post once every %d seconds", group.SlowModeSeconds),
+				RetryAt: retryAt,
+			}
+		}
+	}
+
+	return nil
+}
+
+// requireAdmin checks that the subject is an admin of the group.
+func (p *Policy) requireAdmin(ctx context.Context, subject domain.Subject, resource domain.Resource, msg string) error {
+	_, member, err := p.requireMember(ctx, subject, resource, msg)
+	if err != nil {
+		return err
+	}
+	if !member.IsAdmin {
+		return &domain.ForbiddenError{Msg: msg}
+	}
+	return nil
+}
+
+// requireMember loads the group and the subject's membership, refusing non-members with msg.
+func (p *Policy) requireMember(ctx context.Context, subject domain.Subject, resource domain.Resource, msg string) (*domain.Group, *domain.GroupMember, error) {
+	group, err := p.loadGroup(ctx, resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	member, err := p.groups.FindMember(ctx, group.ID, subject.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check group membership: %w", err)
+	}
+	if member == nil {
+		return nil, nil, &domain.ForbiddenError{Msg: msg}
+	}
+	return group, member, nil
+}
+
+// loadGroup resolves a group resource, returning a *NotFoundError if it does not exist.
+func (p *Policy) loadGroup(ctx context.Context, resource domain.Resource) (*domain.Group, error) {
+	if resource.Kind != domain.ResourceGroup {
+		return nil, &domain.ForbiddenError{Msg: fmt.Sprintf("expected a group resource, got %q", resource.Kind)}
+	}
+
+	group, err := p.groups.FindByID(ctx, resource.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group: %w", err)
+	}
+	if group == nil {
+		return nil, &domain.NotFoundError{Msg: "group not found"}
+	}
+	return group, nil
+}
+
+// canViewMedia allows the uploader, and anyone who can read a conversation the upload was sent to.
+// Everyone else is told the upload does not exist.
+func (p *Policy) canViewMedia(ctx context.Context, subject domain.Subject, resource domain.Resource) error {
+	if resource.Kind != domain.ResourceMedia {
+		return &domain.ForbiddenError{Msg: fmt.Sprintf("expected a media resource, got %q", resource.Kind)}
+	}
+
+	media, err := p.media.FindByID(ctx, resource.Key)
+	if err != nil {
+		return fmt.Errorf("failed to load media: %w", err)
+	}
+	if media == nil || media.Status != domain.MediaReady {
+		return &domain.NotFoundError{Msg: "media not found"}
+	}
+	if media.OwnerID == subject.UserID {
+		return nil
+	}
+
+	attached, err := p.media.IsAttachedForUser(ctx, media.ID, subject.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check media access: %w", err)
+	}
+	if !attached {
+		return &domain.NotFoundError{Msg: "media not found"}
+	}
+	return nil
+}
+
+// loadMessage resolves a message resource the subject can see, with its group and the subject's
+// membership for group messages (both nil for P2P messages). Messages the subject cannot see, and
+// tombstones of deleted group messages, are reported as missing.
+func (p *Policy) loadMessage(ctx context.Context, subject domain.Subject, resource domain.Resource) (*domain.Message, *domain.Group, *domain.GroupMember, error) {
+	if resource.Kind != domain.ResourceMessage {
+		return nil, nil, nil, &domain.ForbiddenError{Msg: fmt.Sprintf("expected a message resource, got %q", resource.Kind)}
+	}
+	notFound := &domain.NotFoundError{Msg: "message not found"}
+
+	message, err := p.messages.FindByID(ctx, resource.ID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to load message: %w", err)
+	}
+	if message == nil || message.Type == domain.DeletedMessage {
+		return nil, nil, nil, notFound
+	}
+
+	if message.GroupID == 0 {
+		if message.SenderID != subject.UserID && message.RecipientID != subject.UserID {
+			return nil, nil, nil, notFound
+		}
+		return message, nil, nil, nil
+	}
+
+	group, err := p.groups.FindByID(ctx, message.GroupID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to load group: %w", err)
+	}
+	if group == nil {
+		return nil, nil, nil, notFound
+	}
+
+	member, err := p.groups.FindMember(ctx, group.ID, subject.UserID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to check group membership: %w", err)
+	}
+	if member == nil {
+		return nil, nil, nil, notFound
+	}
+	return message, group, member, nil
+}
+
+// requireServerAdmin checks that the subject is an enabled server administrator.
+func (p *Policy) requireServerAdmin(ctx context.Context, subject domain.Subject) error {
+	user, err := p.users.GetByID(ctx, subject.UserID)
+	if err != nil {
+		if _, ok := err.(*domain.NotFoundError); ok {
+			return &domain.ForbiddenError{Msg: "server administrators only"}
+		}
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if !user.IsAdmin || user.IsDisabled() {
+		return &domain.ForbiddenError{Msg: "server administrators only"}
+	}
+	return nil
+}
+
+// canViewUser lets users see their own profile, the profiles of discoverable users and of
+// the people they share a group or a conversation with. Server administrators see everyone.
+// Other profiles are reported as not found, so user IDs cannot be probed.
+func (p *Policy) canViewUser(ctx context.Context, subject domain.Subject, resource domain.Resource) error {
+	user, err := p.requireUser(ctx, resource)
+	if err != nil {
+		return err
+	}
+	if user.ID == subject.UserID {
+		return nil
+	}
+	if user.Discoverable && !user.IsDisabled() && user.DeletedAt == nil {
+		return nil
+	}
+	shares, err := p.groups.SharesGroup(ctx, subject.UserID, resource.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check shared groups: %w", err)
+	}
+	if shares {
+		return nil
+	}
+	talked, err := p.messages.HasConversation(ctx, subject.UserID, resource.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check conversations: %w", err)
+	}
+	if talked {
+		return nil
+	}
+	if p.requireServerAdmin(ctx, subject) == nil {
+		return nil
+	}
+	return &domain.NotFoundError{Msg: "user not found"}
+}
+
+// requireUser checks that a user resource exists and returns the user.
+func (p *Policy) requireUser(ctx context.Context, resource domain.Resource) (*domain.User, error) {
+	if resource.Kind != domain.ResourceUser {
+		return nil, &domain.ForbiddenError{Msg: fmt.Sprintf("expected a user resource, got %q", resource.Kind)}
+	}
+
+	user, err := p.users.GetByID(ctx, resource.ID)
+	if err != nil {
+		if _, ok := err.(*domain.NotFoundError); ok {
+			return nil, &domain.NotFoundError{Msg: "user not found"}
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	return user, nil
+}
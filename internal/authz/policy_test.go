@@ -0,0 +1,405 @@
+package authz
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+// Fixture users.
+const (
+	owner    int64 = 1 // owns every group and is an admin of each
+	member   int64 = 2
+	outsider int64 = 3
+	banned   int64 = 4
+	muted    int64 = 5
+	admin    int64 = 6 // admin of privateGroup, but not its owner
+	operator int64 = 7 // server administrator, not a member of any group
+	disabled int64 = 8 // server administrator whose account was disabled
+	listed   int64 = 9 // discoverable in the user directory, in no group and no conversation
+)
+
+// Fixture groups.
+const (
+	privateGroup    int64 = 10
+	publicGroup     int64 = 11
+	archivedGroup   int64 = 12
+	adminsOnlyGroup int64 = 13
+	slowModeGroup   int64 = 14
+	missingGroup    int64 = 99
+	missingUser     int64 = 99
+)
+
+// Fixture uploads, all owned by owner.
+const (
+	sharedMedia     = "shared"     // attached to a message in privateGroup
+	unsentMedia     = "unsent"     // not attached to any message
+	unfinishedMedia = "unfinished" // resumable upload still in progress
+	missingMedia    = "missing"
+)
+
+// Fixture messages.
+const (
+	groupMessage   int64 = 100 // sent by member to privateGroup
+	p2pMessage     int64 = 101 // sent by member to outsider
+	deletedMessage int64 = 102 // tombstone in privateGroup
+	archivedPost   int64 = 103 // sent by owner to archivedGroup
+	sameIDMessage  int64 = 104 // P2P message sent by owner to the user whose ID is privateGroup's
+	missingMessage int64 = 199
+)
+
+type fakeGroups struct {
+	domain.GroupRepository
+	groups    map[int64]*domain.Group
+	members   map[int64]map[int64]bool // group -> user -> is admin
+	sanctions map[int64]map[int64]domain.SanctionKind
+}
+
+func (f *fakeGroups) FindByID(ctx context.Context, groupID int64) (*domain.Group, error) {
+	return f.groups[groupID], nil
+}
+
+func (f *fakeGroups) FindMember(ctx context.Context, groupID, userID int64) (*domain.GroupMember, error) {
+	isAdmin, ok := f.members[groupID][userID]
+	if !ok {
+		return nil, nil
+	}
+	return &domain.GroupMember{GroupID: groupID, UserID: userID, IsAdmin: isAdmin}, nil
+}
+
+func (f *fakeGroups) SharesGroup(ctx context.Context, userID1, userID2 int64) (bool, error) {
+	for _, members := range f.members {
+		_, first := members[userID1]
+		_, second := members[userID2]
+		if first && second {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeGroups) FindActiveSanction(ctx context.Context, groupID, userID int64, kind domain.SanctionKind) (*domain.GroupSanction, error) {
+	if f.sanctions[groupID][userID] != kind {
+		return nil, nil
+	}
+	return &domain.GroupSanction{GroupID: groupID, UserID: userID, Kind: kind}, nil
+}
+
+type fakeUsers struct {
+	domain.UserRepository
+}
+
+func (f *fakeUsers) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	switch id {
+	case missingUser:
+		return nil, &domain.NotFoundError{Msg: "user not found"}
+	case operator:
+		return &domain.User{ID: id, IsAdmin: true}, nil
+	case disabled:
+		disabledAt := time.Now()
+		return &domain.User{ID: id, IsAdmin: true, DisabledAt: &disabledAt}, nil
+	case listed:
+		return &domain.User{ID: id, PrivacySettings: domain.PrivacySettings{Discoverable: true}}, nil
+	}
+	return &domain.User{ID: id}, nil
+}
+
+type fakeMessages struct {
+	domain.MessageRepository
+	lastPost map[int64]time.Time // sender -> time of their last post in slowModeGroup
+}
+
+func (f *fakeMessages) FindLastGroupMessageBySender(ctx context.Context, groupID, senderID int64) (*domain.Message, error) {
+	at, ok := f.lastPost[senderID]
+	if !ok || groupID != slowModeGroup {
+		return nil, nil
+	}
+	return &domain.Message{SenderID: senderID, RecipientID: groupID, Timestamp: at}, nil
+}
+
+// HasConversation knows the conversations of p2pMessage and sameIDMessage.
+func (f *fakeMessages) HasConversation(ctx context.Context, userID1, userID2 int64) (bool, error) {
+	for _, pair := range [][2]int64{{member, outsider}, {owner, privateGroup}} {
+		if (userID1 == pair[0] && userID2 == pair[1]) || (userID1 == pair[1] && userID2 == pair[0]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeMessages) FindByID(ctx context.Context, id int64) (*domain.Message, error) {
+	switch id {
+	case groupMessage:
+		return &domain.Message{ID: id, SenderID: member, RecipientID: privateGroup, GroupID: privateGroup, Type: domain.TextMessage}, nil
+	case p2pMessage:
+		return &domain.Message{ID: id, SenderID: member, RecipientID: outsider, Type: domain.TextMessage}, nil
+	case deletedMessage:
+		return &domain.Message{ID: id, SenderID: member, RecipientID: privateGroup, GroupID: privateGroup, Type: domain.DeletedMessage}, nil
+	case archivedPost:
+		return &domain.Message{ID: id, SenderID: owner, RecipientID: archivedGroup, GroupID: archivedGroup, Type: domain.TextMessage}, nil
+	case sameIDMessage:
+		return &domain.Message{ID: id, SenderID: owner, RecipientID: privateGroup, Type: domain.TextMessage}, nil
+	}
+	return nil, nil
+}
+
+type fakeMedia struct {
+	domain.MediaRepository
+	groups *fakeGroups
+}
+
+func (f *fakeMedia) FindByID(ctx context.Context, id string) (*domain.Media, error) {
+	switch id {
+	case sharedMedia, unsentMedia:
+		return &domain.Media{ID: id, OwnerID: owner, Status: domain.MediaReady}, nil
+	case unfinishedMedia:
+		return &domain.Media{ID: id, OwnerID: owner, Status: domain.MediaUploading}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeMedia) IsAttachedForUser(ctx context.Context, id string, userID int64) (bool, error) {
+	if id != sharedMedia {
+		return false, nil
+	}
+	_, isMember := f.groups.members[privateGroup][userID]
+	return isMember, nil
+}
+
+func newTestPolicy() *Policy {
+	archivedAt := time.Now().Add(-time.Hour)
+	groups := &fakeGroups{
+		groups: map[int64]*domain.Group{
+			privateGroup:    {ID: privateGroup, OwnerID: owner, PostingPolicy: domain.PostingEveryone},
+			publicGroup:     {ID: publicGroup, OwnerID: owner, PostingPolicy: domain.PostingEveryone, IsPublic: true},
+			archivedGroup:   {ID: archivedGroup, OwnerID: owner, PostingPolicy: domain.PostingEveryone, ArchivedAt: &archivedAt},
+			adminsOnlyGroup: {ID: adminsOnlyGroup, OwnerID: owner, PostingPolicy: domain.PostingAdminsOnly},
+			slowModeGroup:   {ID: slowModeGroup, OwnerID: owner, PostingPolicy: domain.PostingSlowMode, SlowModeSeconds: 60},
+		},
+		members: map[int64]map[int64]bool{
+			privateGroup:    {owner: true, admin: true, member: false, muted: false},
+			publicGroup:     {owner: true, member: false},
+			archivedGroup:   {owner: true, member: false},
+			adminsOnlyGroup: {owner: true, member: false},
+			slowModeGroup:   {owner: true, member: false, muted: false},
+		},
+		sanctions: map[int64]map[int64]domain.SanctionKind{
+			privateGroup: {muted: domain.SanctionMute},
+			publicGroup:  {banned: domain.SanctionBan},
+		},
+	}
+	messages := &fakeMessages{lastPost: map[int64]time.Time{
+		member: time.Now().Add(-10 * time.Second), // still inside the 60s window
+		owner:  time.Now().Add(-10 * time.Second), // admins are exempt
+		muted:  time.Now().Add(-2 * time.Minute),  // window has passed
+	}}
+	return NewPolicy(groups, &fakeUsers{}, messages, &fakeMedia{groups: groups})
+}
+
+// expected outcomes
+const (
+	allow      = ""
+	forbidden  = "forbidden"
+	notFound   = "not_found"
+	restricted = "restricted:" // followed by the PostingRestrictedError code
+)
+
+func outcome(err error) string {
+	switch e := err.(type) {
+	case nil:
+		return allow
+	case *domain.ForbiddenError:
+		return forbidden
+	case *domain.NotFoundError:
+		return notFound
+	case *domain.PostingRestrictedError:
+		return restricted + e.Code
+	default:
+		return "unexpected: " + err.Error()
+	}
+}
+
+func TestPolicyCan(t *testing.T) {
+	policy := newTestPolicy()
+
+	tests := []struct {
+		name     string
+		subject  int64
+		action   domain.Action
+		resource domain.Resource
+		want     string
+	}{
+		{"anonymous subject", 0, domain.ActionGroupCreate, domain.NoResource, forbidden},
+		{"unknown action", member, domain.Action("group:explode"), domain.GroupResource(privateGroup), forbidden},
+
+		{"own account", member, domain.ActionOwnAccount, domain.NoResource, allow},
+		{"own account by id", member, domain.ActionOwnAccount, domain.UserResource(member), allow},
+		{"someone else's account", member, domain.ActionOwnAccount, domain.UserResource(owner), forbidden},
+		{"own account on a group", member, domain.ActionOwnAccount, domain.GroupResource(privateGroup), forbidden},
+
+		{"view own profile", outsider, domain.ActionUserView, domain.UserResource(outsider), allow},
+		{"view chat partner", outsider, domain.ActionUserView, domain.UserResource(member), allow},
+		{"view chat partner who wrote first", member, domain.ActionUserView, domain.UserResource(outsider), allow},
+		{"view group co-member", member, domain.ActionUserView, domain.UserResource(admin), allow},
+		{"view discoverable user", outsider, domain.ActionUserView, domain.UserResource(listed), allow},
+		{"view stranger", outsider, domain.ActionUserView, domain.UserResource(owner), notFound},
+		{"view stranger as server admin", operator, domain.ActionUserView, domain.UserResource(owner), allow},
+		{"view stranger as disabled admin", disabled, domain.ActionUserView, domain.UserResource(owner), notFound},
+		{"view missing user", outsider, domain.ActionUserView, domain.UserResource(missingUser), notFound},
+		{"view a group as a user", outsider, domain.ActionUserView, domain.GroupResource(privateGroup), forbidden},
+		{"message user", outsider, domain.ActionUserMessage, domain.UserResource(member), allow},
+		{"message missing user", outsider, domain.ActionUserMessage, domain.UserResource(missingUser), notFound},
+		{"message a group as a user", outsider, domain.ActionUserMessage, domain.GroupResource(privateGroup), forbidden},
+
+		{"create group", outsider, domain.ActionGroupCreate, domain.NoResource, allow},
+		{"discover groups", outsider, domain.ActionGroupDiscover, domain.NoResource, allow},
+
+		{"join public group", outsider, domain.ActionGroupJoin, domain.GroupResource(publicGroup), allow},
+		{"join public group while banned", banned, domain.ActionGroupJoin, domain.GroupResource(publicGroup), forbidden},
+		{"join private group", outsider, domain.ActionGroupJoin, domain.GroupResource(privateGroup), notFound},
+		{"join missing group", outsider, domain.ActionGroupJoin, domain.GroupResource(missingGroup), notFound},
+
+		{"view as member", member, domain.ActionGroupView, domain.GroupResource(privateGroup), allow},
+		{"view as muted member", muted, domain.ActionGroupView, domain.GroupResource(privateGroup), allow},
+		{"view as outsider", outsider, domain.ActionGroupView, domain.GroupResource(privateGroup), forbidden},
+		{"view public group as outsider", outsider, domain.ActionGroupView, domain.GroupResource(publicGroup), forbidden},
+		{"view archived group", member, domain.ActionGroupView, domain.GroupResource(archivedGroup), allow},
+		{"view missing group", member, domain.ActionGroupView, domain.GroupResource(missingGroup), notFound},
+		{"view a user as a group", member, domain.ActionGroupView, domain.UserResource(owner), forbidden},
+
+		{"post as member", member, domain.ActionGroupPost, domain.GroupResource(privateGroup), allow},
+		{"post as outsider", outsider, domain.ActionGroupPost, domain.GroupResource(privateGroup), restricted + domain.CodeNotGroupMember},
+		{"post while muted", muted, domain.ActionGroupPost, domain.GroupResource(privateGroup), restricted + domain.CodeMuted},
+		{"post to archived group", member, domain.ActionGroupPost, domain.GroupResource(archivedGroup), restricted + domain.CodeGroupArchived},
+		{"admin posts to archived group", owner, domain.ActionGroupPost, domain.GroupResource(archivedGroup), restricted + domain.CodeGroupArchived},
+		{"post to admins-only group", member, domain.ActionGroupPost, domain.GroupResource(adminsOnlyGroup), restricted + domain.CodeAdminsOnly},
+		{"admin posts to admins-only group", owner, domain.ActionGroupPost, domain.GroupResource(adminsOnlyGroup), allow},
+		{"post inside slow mode window", member, domain.ActionGroupPost, domain.GroupResource(slowModeGroup), restricted + domain.CodeSlowMode},
+		{"post after slow mode window", muted, domain.ActionGroupPost, domain.GroupResource(slowModeGroup), allow},
+		{"admin ignores slow mode", owner, domain.ActionGroupPost, domain.GroupResource(slowModeGroup), allow},
+		{"post to missing group", member, domain.ActionGroupPost, domain.GroupResource(missingGroup), notFound},
+
+		{"invite as member", member, domain.ActionGroupInvite, domain.GroupResource(privateGroup), allow},
+		{"invite as outsider", outsider, domain.ActionGroupInvite, domain.GroupResource(privateGroup), forbidden},
+
+		{"manage as owner", owner, domain.ActionGroupManage, domain.GroupResource(privateGroup), allow},
+		{"manage as admin", admin, domain.ActionGroupManage, domain.GroupResource(privateGroup), allow},
+		{"manage as member", member, domain.ActionGroupManage, domain.GroupResource(privateGroup), forbidden},
+		{"manage as outsider", outsider, domain.ActionGroupManage, domain.GroupResource(privateGroup), forbidden},
+		{"manage missing group", owner, domain.ActionGroupManage, domain.GroupResource(missingGroup), notFound},
+
+		{"moderate as admin", admin, domain.ActionGroupModerate, domain.GroupResource(privateGroup), allow},
+		{"moderate as member", member, domain.ActionGroupModerate, domain.GroupResource(privateGroup), forbidden},
+
+		{"delete as owner", owner, domain.ActionGroupDelete, domain.GroupResource(privateGroup), allow},
+		{"delete as admin", admin, domain.ActionGroupDelete, domain.GroupResource(privateGroup), forbidden},
+		{"delete as member", member, domain.ActionGroupDelete, domain.GroupResource(privateGroup), forbidden},
+		{"delete missing group", owner, domain.ActionGroupDelete, domain.GroupResource(missingGroup), notFound},
+		{"delete as server admin", operator, domain.ActionGroupDelete, domain.GroupResource(privateGroup), allow},
+		{"delete as disabled server admin", disabled, domain.ActionGroupDelete, domain.GroupResource(privateGroup), forbidden},
+
+		{"upload media", outsider, domain.ActionMediaUpload, domain.NoResource, allow},
+		{"view own upload", owner, domain.ActionMediaView, domain.MediaResource(unsentMedia), allow},
+		{"view upload shared in a group", member, domain.ActionMediaView, domain.MediaResource(sharedMedia), allow},
+		{"view upload shared elsewhere", outsider, domain.ActionMediaView, domain.MediaResource(sharedMedia), notFound},
+		{"view someone else's unsent upload", member, domain.ActionMediaView, domain.MediaResource(unsentMedia), notFound},
+		{"view unfinished upload", owner, domain.ActionMediaView, domain.MediaResource(unfinishedMedia), notFound},
+		{"view missing upload", owner, domain.ActionMediaView, domain.MediaResource(missingMedia), notFound},
+		{"view a group as media", owner, domain.ActionMediaView, domain.GroupResource(privateGroup), forbidden},
+
+		{"view group message as member", member, domain.ActionMessageView, domain.MessageResource(groupMessage), allow},
+		{"view group message as outsider", outsider, domain.ActionMessageView, domain.MessageResource(groupMessage), notFound},
+		{"view own p2p message", member, domain.ActionMessageView, domain.MessageResource(p2pMessage), allow},
+		{"view received p2p message", outsider, domain.ActionMessageView, domain.MessageResource(p2pMessage), allow},
+		{"view someone else's p2p message", owner, domain.ActionMessageView, domain.MessageResource(p2pMessage), notFound},
+		{"view deleted message", member, domain.ActionMessageView, domain.MessageResource(deletedMessage), notFound},
+		{"view p2p message to a user sharing a group's ID", member, domain.ActionMessageView, domain.MessageResource(sameIDMessage), notFound},
+		{"view p2p message to a user sharing a group's ID as its sender", owner, domain.ActionMessageView, domain.MessageResource(sameIDMessage), allow},
+		{"view missing message", member, domain.ActionMessageView, domain.MessageResource(missingMessage), notFound},
+		{"view a group as a message", member, domain.ActionMessageView, domain.GroupResource(privateGroup), forbidden},
+		{"pin as group admin", admin, domain.ActionMessagePin, domain.MessageResource(groupMessage), allow},
+		{"pin as group member", member, domain.ActionMessagePin, domain.MessageResource(groupMessage), forbidden},
+		{"pin as outsider", outsider, domain.ActionMessagePin, domain.MessageResource(groupMessage), notFound},
+		{"pin in archived group", owner, domain.ActionMessagePin, domain.MessageResource(archivedPost), forbidden},
+		{"pin p2p message as recipient", outsider, domain.ActionMessagePin, domain.MessageResource(p2pMessage), allow},
+		{"pin someone else's p2p message", admin, domain.ActionMessagePin, domain.MessageResource(p2pMessage), notFound},
+		{"pin p2p message to a user sharing a group's ID as group admin", admin, domain.ActionMessagePin, domain.MessageResource(sameIDMessage), notFound},
+		{"pin p2p message to a user sharing a group's ID as its sender", owner, domain.ActionMessagePin, domain.MessageResource(sameIDMessage), allow},
+
+		{"server admin", operator, domain.ActionServerAdmin, domain.NoResource, allow},
+		{"disabled server admin", disabled, domain.ActionServerAdmin, domain.NoResource, forbidden},
+		{"group owner is not a server admin", owner, domain.ActionServerAdmin, domain.NoResource, forbidden},
+		{"missing user is not a server admin", missingUser, domain.ActionServerAdmin, domain.NoResource, forbidden},
+		{"server admin cannot post to groups", operator, domain.ActionGroupPost, domain.GroupResource(privateGroup), restricted + domain.CodeNotGroupMember},
+		{"server admin cannot manage groups", operator, domain.ActionGroupManage, domain.GroupResource(privateGroup), forbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Can(context.Background(), domain.UserSubject(tt.subject), tt.action, tt.resource)
+			if got := outcome(err); got != tt.want {
+				t.Errorf("Can(%d, %s, %+v) = %q (%v), want %q", tt.subject, tt.action, tt.resource, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestRoutesHaveKnownActions checks that every secured route names an action the policy decides.
+func TestRoutesHaveKnownActions(t *testing.T) {
+	policy := newTestPolicy()
+
+	for route, rp := range Routes {
+		if rp.Public {
+			if rp.Action != "" || rp.TokenScope != "" {
+				t.Errorf("%s: public routes must not declare an action or token scope", route)
+			}
+			continue
+		}
+		if rp.Action == "" {
+			t.Errorf("%s: secured route has no action", route)
+			continue
+		}
+		if rp.TokenScope != "" && rp.TokenScope != AnyScope && !isKnownScope(rp.TokenScope) {
+			t.Errorf("%s: unknown token scope %q", route, rp.TokenScope)
+		}
+
+		// Unknown actions are the only decisions that refuse the group owner (or, for the
+		// operator API, a server administrator) on an existing group.
+		subject := owner
+		if rp.Action == domain.ActionServerAdmin {
+			subject = operator
+		}
+		err := policy.Can(context.Background(), domain.UserSubject(subject), rp.Action, resourceFor(rp.Action))
+		if err != nil {
+			t.Errorf("%s: action %q is not handled by the policy: %v", route, rp.Action, err)
+		}
+	}
+}
+
+// resourceFor returns a resource the fixture owner may act on with the action.
+func resourceFor(action domain.Action) domain.Resource {
+	switch action {
+	case domain.ActionOwnAccount, domain.ActionGroupCreate, domain.ActionGroupDiscover, domain.ActionMediaUpload, domain.ActionServerAdmin:
+		return domain.NoResource
+	case domain.ActionMediaView:
+		return domain.MediaResource(unsentMedia)
+	case domain.ActionMessageView, domain.ActionMessagePin:
+		return domain.MessageResource(groupMessage)
+	case domain.ActionUserView, domain.ActionUserMessage:
+		return domain.UserResource(member)
+	case domain.ActionGroupJoin:
+		return domain.GroupResource(publicGroup)
+	}
+	return domain.GroupResource(privateGroup)
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range domain.KnownScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package authz
+
+import "github.com/Emmanuel326/chatserver/internal/domain"
+
+// AnyScope marks routes that accept every valid API token regardless of its scopes.
+const AnyScope = "*"
+
+// RoutePolicy is the authorization decision recorded for one HTTP route.
+type RoutePolicy struct {
+	// Public routes are served without authentication (login, registration, token refresh...).
+	Public bool
+	// Action is checked with Policy.Can before the handler runs, on the resource named by the
+	// route's path (see api.authorizeRoute); handlers and services may make further decisions.
+	Action domain.Action
+	// TokenScope is the scope an API token needs for the route. Empty means the route is
+	// refused for API tokens and only accepts interactive logins.
+	TokenScope string
+}
+
+// Routes holds the policy for every route, keyed by "METHOD /full/path". The auth middleware
+// refuses secured routes missing from this table, api.authorizeRoute enforces their Action, and
+// the route tests fail if a registered route has no entry, so new endpoints cannot ship without a
+// policy decision.
+var Routes = map[string]RoutePolicy{
+	// WebSocket and key discovery (the socket authenticates itself with ?token=)
+	"GET /ws":                    {Public: true},
+	"GET /.well-known/jwks.json": {Public: true},
+
+	// Registration, login and account recovery
+	"POST /v1/users/register":       {Public: true},
+	"POST /v1/users/login":          {Public: true},
+	"POST /v1/users/login/2fa":      {Public: true},
+	"POST /v1/auth/refresh":         {Public: true},
+	"POST /v1/auth/password/forgot": {Public: true},
+	"POST /v1/auth/password/reset":  {Public: true},
+	"POST /v1/auth/email/verify":    {Public: true},
+	"POST /v1/auth/email/resend":    {Public: true},
+	"GET /v1/auth/oidc/login":       {Public: true},
+	"GET /v1/auth/oidc/callback":    {Public: true},
+
+	// The caller's own sessions, second factor, bots and tokens (interactive logins only)
+	"POST /v1/auth/logout":           {Action: domain.ActionOwnAccount},
+	"GET /v1/sessions":               {Action: domain.ActionOwnAccount},
+	"DELETE /v1/sessions/:sessionID": {Action: domain.ActionOwnAccount},
+	"GET /v1/auth/2fa":               {Action: domain.ActionOwnAccount},
+	"POST /v1/auth/2fa/enroll":       {Action: domain.ActionOwnAccount},
+	"POST /v1/auth/2fa/verify":       {Action: domain.ActionOwnAccount},
+	"POST /v1/auth/2fa/disable":      {Action: domain.ActionOwnAccount},
+	"POST /v1/bots":                  {Action: domain.ActionOwnAccount},
+	"GET /v1/bots":                   {Action: domain.ActionOwnAccount},
+	"POST /v1/tokens":                {Action: domain.ActionOwnAccount},
+	"GET /v1/tokens":                 {Action: domain.ActionOwnAccount},
+	"DELETE /v1/tokens/:tokenID":     {Action: domain.ActionOwnAccount},
+	"GET /v1/me/profile":             {Action: domain.ActionOwnAccount},
+	"PATCH /v1/me/profile":           {Action: domain.ActionOwnAccount},
+	"GET /v1/test-auth":              {Action: domain.ActionOwnAccount, TokenScope: AnyScope},
+
+	// Users
+	"GET /v1/users":                {Action: domain.ActionUserView, TokenScope: domain.ScopeUsersRead},
+	"GET /v1/users/:userID":        {Action: domain.ActionUserView, TokenScope: domain.ScopeUsersRead},
+	"GET /v1/users/with-chat-info": {Action: domain.ActionOwnAccount, TokenScope: domain.ScopeUsersRead},
+	"GET /v1/users/directory":      {Action: domain.ActionOwnAccount, TokenScope: domain.ScopeUsersRead},
+
+	// Messages
+	"GET /v1/chats":                         {Action: domain.ActionOwnAccount, TokenScope: domain.ScopeMessagesRead},
+	"GET /v1/messages/history/:recipientID": {Action: domain.ActionUserMessage, TokenScope: domain.ScopeMessagesRead},
+	"GET /v1/groups/:groupID/messages":      {Action: domain.ActionGroupView, TokenScope: domain.ScopeMessagesRead},
+	"POST /v1/messages/group/:groupID":      {Action: domain.ActionGroupPost, TokenScope: domain.ScopeMessagesWrite},
+	"POST /v1/messages/p2p/:recipientID":    {Action: domain.ActionUserMessage, TokenScope: domain.ScopeMessagesWrite},
+	"GET /v1/search/messages":               {Action: domain.ActionOwnAccount, TokenScope: domain.ScopeMessagesRead},
+	// ActionMessageView on the source; ActionGroupPost and ActionUserMessage on each target
+	"POST /v1/messages/:messageID/forward": {Action: domain.ActionMessageView, TokenScope: domain.ScopeMessagesWrite},
+	"POST /v1/messages/:messageID/pin":     {Action: domain.ActionMessagePin, TokenScope: domain.ScopeMessagesWrite},
+	"DELETE /v1/messages/:messageID/pin":   {Action: domain.ActionMessagePin, TokenScope: domain.ScopeMessagesWrite},
+	"POST /v1/messages/:messageID/star":    {Action: domain.ActionMessageView, TokenScope: domain.ScopeMessagesWrite},
+	// Removing a star needs no access to the message, which the caller may have lost since.
+	"DELETE /v1/messages/:messageID/star": {Action: domain.ActionOwnAccount, TokenScope: domain.ScopeMessagesWrite},
+	// ActionUserMessage for user_<id> conversations
+	"GET /v1/conversations/:conversationID/pins": {Action: domain.ActionGroupView, TokenScope: domain.ScopeMessagesRead},
+	"GET /v1/me/starred":                         {Action: domain.ActionOwnAccount, TokenScope: domain.ScopeMessagesRead},
+
+	// Media
+	"POST /v1/media":                           {Action: domain.ActionMediaUpload, TokenScope: domain.ScopeMessagesWrite},
+	"POST /v1/media/uploads":                   {Action: domain.ActionMediaUpload, TokenScope: domain.ScopeMessagesWrite},
+	"GET /v1/media/uploads/:mediaID":           {Action: domain.ActionMediaUpload, TokenScope: domain.ScopeMessagesWrite},
+	"PATCH /v1/media/uploads/:mediaID":         {Action: domain.ActionMediaUpload, TokenScope: domain.ScopeMessagesWrite},
+	"POST /v1/media/uploads/:mediaID/complete": {Action: domain.ActionMediaUpload, TokenScope: domain.ScopeMessagesWrite},
+	"GET /v1/media/:mediaID":                   {Action: domain.ActionMediaView, TokenScope: domain.ScopeMessagesRead},
+	"GET /v1/media/:mediaID/thumbnails/:size":  {Action: domain.ActionMediaView, TokenScope: domain.ScopeMessagesRead},
+	"GET /v1/me/storage":                       {Action: domain.ActionOwnAccount, TokenScope: domain.ScopeMessagesRead},
+
+	// Groups
+	"GET /v1/groups":                           {Action: domain.ActionOwnAccount, TokenScope: domain.ScopeGroupsRead},
+	"POST /v1/groups":                          {Action: domain.ActionGroupCreate, TokenScope: domain.ScopeGroupsWrite},
+	"GET /v1/groups/directory":                 {Action: domain.ActionGroupDiscover, TokenScope: domain.ScopeGroupsRead},
+	"PATCH /v1/groups/:groupID":                {Action: domain.ActionGroupManage},
+	"DELETE /v1/groups/:groupID":               {Action: domain.ActionGroupDelete},
+	"POST /v1/groups/:groupID/archive":         {Action: domain.ActionGroupManage},
+	"POST /v1/groups/:groupID/unarchive":       {Action: domain.ActionGroupManage},
+	"PUT /v1/groups/:groupID/posting-policy":   {Action: domain.ActionGroupManage},
+	"GET /v1/groups/:groupID/mutes":            {Action: domain.ActionGroupModerate},
+	"POST /v1/groups/:groupID/mutes":           {Action: domain.ActionGroupModerate},
+	"DELETE /v1/groups/:groupID/mutes/:userID": {Action: domain.ActionGroupModerate},
+	"GET /v1/groups/:groupID/bans":             {Action: domain.ActionGroupModerate},
+	"POST /v1/groups/:groupID/bans":            {Action: domain.ActionGroupModerate},
+	"DELETE /v1/groups/:groupID/bans/:userID":  {Action: domain.ActionGroupModerate},
+	"POST /v1/groups/:groupID/join":            {Action: domain.ActionGroupJoin, TokenScope: domain.ScopeGroupsWrite},
+	"POST /v1/groups/:groupID/members":         {Action: domain.ActionGroupInvite, TokenScope: domain.ScopeGroupsWrite},
+	"GET /v1/groups/:groupID/members":          {Action: domain.ActionGroupView, TokenScope: domain.ScopeGroupsRead},
+
+	// Server administration (interactive logins only)
+	"GET /v1/admin/users":                  {Action: domain.ActionServerAdmin},
+	"POST /v1/admin/users/:userID/disable": {Action: domain.ActionServerAdmin},
+	"POST /v1/admin/users/:userID/enable":  {Action: domain.ActionServerAdmin},
+	"PUT /v1/admin/users/:userID/admin":    {Action: domain.ActionServerAdmin},
+	"POST /v1/admin/users/:userID/logout":  {Action: domain.ActionServerAdmin},
+	"DELETE /v1/admin/users/:userID":       {Action: domain.ActionServerAdmin},
+	"GET /v1/admin/groups":                 {Action: domain.ActionServerAdmin},
+	"GET /v1/admin/groups/:groupID":        {Action: domain.ActionServerAdmin},
+	"DELETE /v1/admin/groups/:groupID":     {Action: domain.ActionServerAdmin},
+	"GET /v1/admin/connections":            {Action: domain.ActionServerAdmin},
+	"GET /v1/admin/audit":                  {Action: domain.ActionServerAdmin},
+}
+
+// RouteFor returns the policy for a route as reported by gin's FullPath, and whether one exists.
+func RouteFor(method, fullPath string) (RoutePolicy, bool) {
+	policy, ok := Routes[method+" "+fullPath]
+	return policy, ok
+}
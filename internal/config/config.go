@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
 	"strconv"
@@ -8,14 +9,91 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// DefaultJWTSecret is the placeholder secret used when JWT_SECRET is unset. It is only
+// acceptable in development mode.
+const DefaultJWTSecret = "default_secret"
+
 // Config holds all application-wide configuration
 type Config struct {
+	APP_ENV      string // "development" relaxes safety checks; anything else is treated as production
 	DB_FILE      string // The path to the SQLite DB file
 	
 	JWT_SECRET   string
-	JWT_EXPIRY   int // in minutes
+	JWT_KEYS_DIR string // Directory of RSA/Ed25519 PEM keys named <kid>.pem; when set, tokens are signed with these instead of JWT_SECRET
+	JWT_ACTIVE_KID string // kid of the key that signs new tokens (defaults to the last kid in lexical order)
+	JWT_EXPIRY   int // access token lifetime, in minutes
+	REFRESH_TOKEN_EXPIRY int // refresh token lifetime, in hours
 
 	SERVER_PORT  string
+
+	// What happens to a group's messages when it is deleted: "tombstone" (default) or "delete"
+	GROUP_MESSAGE_RETENTION string
+
+	// Public URL of the web client; password reset and verification links point here
+	APP_BASE_URL string
+	// Secret for signing password reset / email verification tokens (defaults to JWT_SECRET)
+	EMAIL_TOKEN_SECRET string
+	// Refuse logins until the user has verified their email address
+	REQUIRE_EMAIL_VERIFICATION bool
+
+	// Mail delivery: "smtp", "file" (writes .eml files to MAIL_DIR) or "memory"
+	MAIL_DRIVER   string
+	MAIL_FROM     string
+	MAIL_DIR      string
+	SMTP_HOST     string
+	SMTP_PORT     string
+	SMTP_USERNAME string
+	SMTP_PASSWORD string
+
+	// OpenID Connect single sign-on; enabled when OIDC_ISSUER is set
+	OIDC_ISSUER        string
+	OIDC_CLIENT_ID     string
+	OIDC_CLIENT_SECRET string
+	OIDC_REDIRECT_URL  string // Our callback URL as registered at the provider
+	OIDC_SCOPES        string // Space-separated
+
+	// Login brute-force protection
+	LOGIN_FAILURE_WINDOW_MINUTES int // Failures older than this are forgotten
+	LOGIN_BACKOFF_THRESHOLD      int // Failures per account allowed before backoff starts
+	LOGIN_IP_BACKOFF_THRESHOLD   int // Failures per IP allowed before backoff starts
+	LOGIN_BACKOFF_BASE_SECONDS   int // First backoff delay; doubles with every further failure
+	LOGIN_LOCKOUT_THRESHOLD      int // Account failures that trigger a lockout
+	LOGIN_IP_LOCKOUT_THRESHOLD   int // Failures from one IP (across accounts) that trigger a lockout
+	LOGIN_LOCKOUT_MINUTES        int // Lockout duration, also the cap for backoff delays
+	LOGIN_FAILURE_RETENTION_DAYS int // How long failed attempts stay in the audit trail (0 keeps them)
+
+	// Comma-separated emails of existing accounts promoted to server administrator at startup
+	ADMIN_EMAILS string
+
+	// Comma-separated fields the user directory searches: username, display_name and email
+	// (exact addresses of users who allow it)
+	USER_DIRECTORY_FIELDS string
+
+	// Uploads: where they are stored ("local" keeps them in MEDIA_DIR) and what is accepted
+	MEDIA_STORAGE       string
+	MEDIA_DIR           string
+	MEDIA_MAX_UPLOAD_MB int
+	MEDIA_ALLOWED_TYPES string // Comma-separated sniffed content types; "image/*" allows a whole family
+	MEDIA_PRESIGN_MINUTES  int // Lifetime of pre-signed upload and download URLs (s3 storage)
+	MEDIA_ORPHAN_TTL_HOURS int // Unfinished or never-sent uploads older than this are deleted; 0 keeps them
+	MEDIA_IMAGE_WORKERS    int    // Images processed concurrently (thumbnails, blurhash)
+	MEDIA_THUMBNAIL_SIZES  string // Comma-separated bounding squares in pixels
+	MEDIA_USER_QUOTA_MB    int    // Total size of each user's uploads; 0 is unlimited
+	MEDIA_GROUP_QUOTA_MB   int    // Total size of the uploads sent to each group; 0 is unlimited
+
+	// S3-compatible object storage, used when MEDIA_STORAGE=s3 (e.g. MinIO at http://localhost:9000)
+	S3_ENDPOINT   string
+	S3_REGION     string
+	S3_BUCKET     string
+	S3_ACCESS_KEY string
+	S3_SECRET_KEY string
+	S3_PATH_STYLE bool // Address the bucket as endpoint/bucket instead of bucket.endpoint; MinIO needs it
+
+	// Malware scanning of uploads: "none", or "clamd" to quarantine uploads until ClamAV clears them
+	MEDIA_SCANNER         string
+	MEDIA_SCAN_WORKERS    int    // Uploads scanned concurrently
+	CLAMD_ADDRESS         string // host:port, or the path of clamd's Unix socket
+	CLAMD_TIMEOUT_SECONDS int    // Longest a single scan may take
 }
 
 // Load loads configuration from environment variables (or a .env file)
@@ -32,22 +110,144 @@ func Load() *Config {
 		return defaultValue
 	}
 
-	expiryStr := getEnv("JWT_EXPIRY_MINUTES", "10080")
+	// Access tokens are short-lived; clients renew them with a refresh token.
+	expiryStr := getEnv("JWT_EXPIRY_MINUTES", "15")
 	expiry, err := strconv.Atoi(expiryStr)
 	if err != nil {
-		log.Printf("Warning: Invalid JWT_EXPIRY_MINUTES (%s). Defaulting to 10080.\n", expiryStr)
-		expiry = 10080
+		log.Printf("Warning: Invalid JWT_EXPIRY_MINUTES (%s). Defaulting to 15.\n", expiryStr)
+		expiry = 15
+	}
+
+	refreshExpiryStr := getEnv("REFRESH_TOKEN_EXPIRY_HOURS", "720")
+	refreshExpiry, err := strconv.Atoi(refreshExpiryStr)
+	if err != nil {
+		log.Printf("Warning: Invalid REFRESH_TOKEN_EXPIRY_HOURS (%s). Defaulting to 720.\n", refreshExpiryStr)
+		refreshExpiry = 720
+	}
+
+	requireVerification, err := strconv.ParseBool(getEnv("REQUIRE_EMAIL_VERIFICATION", "false"))
+	if err != nil {
+		log.Printf("Warning: Invalid REQUIRE_EMAIL_VERIFICATION. Defaulting to false.\n")
+		requireVerification = false
+	}
+
+	getEnvInt := func(key string, defaultValue int) int {
+		valueStr := getEnv(key, strconv.Itoa(defaultValue))
+		value, err := strconv.Atoi(valueStr)
+		if err != nil || value < 0 {
+			log.Printf("Warning: Invalid %s (%s). Defaulting to %d.\n", key, valueStr, defaultValue)
+			return defaultValue
+		}
+		return value
+	}
+
+	s3PathStyle, err := strconv.ParseBool(getEnv("S3_PATH_STYLE", "true"))
+	if err != nil {
+		log.Printf("Warning: Invalid S3_PATH_STYLE. Defaulting to true.\n")
+		s3PathStyle = true
 	}
 
+	jwtSecret := getEnv("JWT_SECRET", DefaultJWTSecret)
+
 	return &Config{
+		APP_ENV:     getEnv("APP_ENV", "production"),
+
 		// Database
 		DB_FILE:     getEnv("DB_FILE", "chatserver.db"),
 		
 		// JWT
-		JWT_SECRET:  getEnv("JWT_SECRET", "default_secret"),
+		JWT_SECRET:  jwtSecret,
+		JWT_KEYS_DIR: getEnv("JWT_KEYS_DIR", ""),
+		JWT_ACTIVE_KID: getEnv("JWT_ACTIVE_KID", ""),
 		JWT_EXPIRY:  expiry,
+		REFRESH_TOKEN_EXPIRY: refreshExpiry,
 		
 		// Server
 		SERVER_PORT: getEnv("SERVER_PORT", "8080"),
+
+		// Groups
+		GROUP_MESSAGE_RETENTION: getEnv("GROUP_MESSAGE_RETENTION", "tombstone"),
+
+		// Accounts
+		APP_BASE_URL: getEnv("APP_BASE_URL", "http://localhost:8080"),
+		EMAIL_TOKEN_SECRET: getEnv("EMAIL_TOKEN_SECRET", jwtSecret),
+		REQUIRE_EMAIL_VERIFICATION: requireVerification,
+
+		// Mail
+		MAIL_DRIVER:   getEnv("MAIL_DRIVER", "file"),
+		MAIL_FROM:     getEnv("MAIL_FROM", "chatserver <no-reply@localhost>"),
+		MAIL_DIR:      getEnv("MAIL_DIR", "mail"),
+		SMTP_HOST:     getEnv("SMTP_HOST", ""),
+		SMTP_PORT:     getEnv("SMTP_PORT", "587"),
+		SMTP_USERNAME: getEnv("SMTP_USERNAME", ""),
+		SMTP_PASSWORD: getEnv("SMTP_PASSWORD", ""),
+
+		// OIDC
+		OIDC_ISSUER:        getEnv("OIDC_ISSUER", ""),
+		OIDC_CLIENT_ID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDC_CLIENT_SECRET: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDC_REDIRECT_URL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/v1/auth/oidc/callback"),
+		OIDC_SCOPES:        getEnv("OIDC_SCOPES", "openid email profile"),
+
+		// Login protection
+		LOGIN_FAILURE_WINDOW_MINUTES: getEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 15),
+		LOGIN_BACKOFF_THRESHOLD:      getEnvInt("LOGIN_BACKOFF_THRESHOLD", 3),
+		LOGIN_IP_BACKOFF_THRESHOLD:   getEnvInt("LOGIN_IP_BACKOFF_THRESHOLD", 20),
+		LOGIN_BACKOFF_BASE_SECONDS:   getEnvInt("LOGIN_BACKOFF_BASE_SECONDS", 1),
+		LOGIN_LOCKOUT_THRESHOLD:      getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		LOGIN_IP_LOCKOUT_THRESHOLD:   getEnvInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50),
+		LOGIN_LOCKOUT_MINUTES:        getEnvInt("LOGIN_LOCKOUT_MINUTES", 15),
+		LOGIN_FAILURE_RETENTION_DAYS: getEnvInt("LOGIN_FAILURE_RETENTION_DAYS", 90),
+
+		ADMIN_EMAILS: getEnv("ADMIN_EMAILS", ""),
+		USER_DIRECTORY_FIELDS: getEnv("USER_DIRECTORY_FIELDS", "username,display_name"),
+
+		// Media
+		MEDIA_STORAGE:       getEnv("MEDIA_STORAGE", "local"),
+		MEDIA_DIR:           getEnv("MEDIA_DIR", "media"),
+		MEDIA_MAX_UPLOAD_MB: getEnvInt("MEDIA_MAX_UPLOAD_MB", 25),
+		MEDIA_ALLOWED_TYPES: getEnv("MEDIA_ALLOWED_TYPES", "image/*,audio/*,video/*,application/ogg,application/pdf,application/zip,text/plain"),
+		MEDIA_PRESIGN_MINUTES:  getEnvInt("MEDIA_PRESIGN_MINUTES", 15),
+		MEDIA_ORPHAN_TTL_HOURS: getEnvInt("MEDIA_ORPHAN_TTL_HOURS", 24),
+		MEDIA_IMAGE_WORKERS:    getEnvInt("MEDIA_IMAGE_WORKERS", 2),
+		MEDIA_THUMBNAIL_SIZES:  getEnv("MEDIA_THUMBNAIL_SIZES", "160,480,1080"),
+		MEDIA_USER_QUOTA_MB:    getEnvInt("MEDIA_USER_QUOTA_MB", 1024),
+		MEDIA_GROUP_QUOTA_MB:   getEnvInt("MEDIA_GROUP_QUOTA_MB", 5120),
+
+		// S3
+		S3_ENDPOINT:   getEnv("S3_ENDPOINT", ""),
+		S3_REGION:     getEnv("S3_REGION", "us-east-1"),
+		S3_BUCKET:     getEnv("S3_BUCKET", ""),
+		S3_ACCESS_KEY: getEnv("S3_ACCESS_KEY", ""),
+		S3_SECRET_KEY: getEnv("S3_SECRET_KEY", ""),
+		S3_PATH_STYLE: s3PathStyle,
+
+		// Malware scanning
+		MEDIA_SCANNER:         getEnv("MEDIA_SCANNER", "none"),
+		MEDIA_SCAN_WORKERS:    getEnvInt("MEDIA_SCAN_WORKERS", 2),
+		CLAMD_ADDRESS:         getEnv("CLAMD_ADDRESS", "localhost:3310"),
+		CLAMD_TIMEOUT_SECONDS: getEnvInt("CLAMD_TIMEOUT_SECONDS", 60),
+	}
+}
+
+// IsDevMode reports whether the server runs in development mode (APP_ENV=development).
+func (c *Config) IsDevMode() bool {
+	return c.APP_ENV == "development"
+}
+
+// Validate rejects configurations that are unsafe to run outside development mode.
+func (c *Config) Validate() error {
+	if c.IsDevMode() {
+		return nil
+	}
+	if c.JWT_KEYS_DIR == "" && (c.JWT_SECRET == "" || c.JWT_SECRET == DefaultJWTSecret) {
+		return errors.New("JWT_SECRET is unset or uses the default value; set a strong secret or JWT_KEYS_DIR (or APP_ENV=development for local use)")
+	}
+	if c.OIDC_ISSUER != "" && c.OIDC_CLIENT_ID == "" {
+		return errors.New("OIDC_ISSUER is set but OIDC_CLIENT_ID is missing")
+	}
+	if c.EMAIL_TOKEN_SECRET == "" || c.EMAIL_TOKEN_SECRET == DefaultJWTSecret {
+		return errors.New("EMAIL_TOKEN_SECRET is unset or uses the default value; set it (or JWT_SECRET) to a strong secret")
 	}
+	return nil
 }
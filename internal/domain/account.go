@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// EmailMessage is a plain-text email sent through a Mailer.
+type EmailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails. Implementations live in 'ports/mail' (SMTP, file and in-memory).
+type Mailer interface {
+	Send(ctx context.Context, msg *EmailMessage) error
+}
+
+// ---------------------------------------------
+// ACCOUNT INTERFACES
+// ---------------------------------------------
+
+// AccountService handles password resets and email verification using single-use signed tokens.
+type AccountService interface {
+	// RequestPasswordReset emails a reset link. Unknown addresses are silently ignored so the
+	// endpoint cannot be used to find out which emails are registered.
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword sets a new password and signs the user out everywhere. It returns the user's ID.
+	ResetPassword(ctx context.Context, token, newPassword string) (int64, error)
+	// SendVerificationEmail emails a verification link to the user.
+	SendVerificationEmail(ctx context.Context, userID int64) error
+	// ResendVerificationEmail is the unauthenticated variant used by users who cannot log in yet.
+	ResendVerificationEmail(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	// Shutdown waits for emails that are still being sent, until ctx is done.
+	Shutdown(ctx context.Context) error
+}
+
+// ActionTokenRepository records consumed action tokens so each can only be used once.
+type ActionTokenRepository interface {
+	// ConsumeToken marks a token nonce as used; it reports false if it had been used before.
+	ConsumeToken(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+	// DeleteExpiredTokens forgets the nonces of tokens that expired before now; they can no
+	// longer be redeemed anyway.
+	DeleteExpiredTokens(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,279 @@
+package domain
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// passwordResetExpiry is how long a password reset link stays valid.
+	passwordResetExpiry = time.Hour
+	// emailVerificationExpiry is how long an email verification link stays valid.
+	emailVerificationExpiry = 48 * time.Hour
+	// minPasswordLength matches the registration rule for new passwords.
+	minPasswordLength = 8
+	// mailSendTimeout bounds how long a single email may take to deliver.
+	mailSendTimeout = 30 * time.Second
+
+	purposePasswordReset = "reset"
+	purposeVerifyEmail   = "verify"
+)
+
+// accountService is the concrete implementation of the AccountService interface.
+type accountService struct {
+	userRepo       UserRepository
+	tokenRepo      ActionTokenRepository
+	sessionService SessionService
+	mailer         Mailer
+	secret         []byte
+	baseURL        string
+	// sending tracks emails still being delivered, so Shutdown can wait for them
+	sending sync.WaitGroup
+}
+
+// NewAccountService creates a new AccountService. Tokens are signed with secret, and links
+// in emails point at baseURL (e.g. "https://chat.example.com").
+func NewAccountService(userRepo UserRepository, tokenRepo ActionTokenRepository, sessionService SessionService, mailer Mailer, secret, baseURL string) AccountService {
+	return &accountService{
+		userRepo:       userRepo,
+		tokenRepo:      tokenRepo,
+		sessionService: sessionService,
+		mailer:         mailer,
+		secret:         []byte(secret),
+		baseURL:        strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to a user.
+func (s *accountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.signToken(purposePasswordReset, user, passwordResetExpiry)
+	if err != nil {
+		return err
+	}
+	s.send(&EmailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your chatserver account.\n"+
+			"Use this link within %d minutes to choose a new one:\n\n%s\n\nIf this wasn't you, you can ignore this email.\n",
+			user.Username, int(passwordResetExpiry.Minutes()), s.link("/reset-password", token)),
+	})
+	return nil
+}
+
+// ResetPassword checks the token, stores the new password and revokes all sessions.
+func (s *accountService) ResetPassword(ctx context.Context, token, newPassword string) (int64, error) {
+	if len(newPassword) < minPasswordLength {
+		return 0, &ValidationError{Msg: fmt.Sprintf("password must be at least %d characters", minPasswordLength)}
+	}
+
+	user, err := s.redeemToken(ctx, purposePasswordReset, token)
+	if err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, string(hashedPassword)); err != nil {
+		return 0, fmt.Errorf("failed to update password: %w", err)
+	}
+	if err := s.sessionService.RevokeAllSessions(ctx, user.ID); err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	// Receiving the reset link proves ownership of the address as well.
+	if !user.IsEmailVerified() {
+		if err := s.userRepo.MarkEmailVerified(ctx, user.ID, time.Now()); err != nil {
+			log.Printf("Failed to mark email of user %d as verified: %v", user.ID, err)
+		}
+	}
+	return user.ID, nil
+}
+
+// SendVerificationEmail emails a verification link to the user.
+func (s *accountService) SendVerificationEmail(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.IsEmailVerified() {
+		return &ConflictError{Msg: "email address is already verified"}
+	}
+
+	token, err := s.signToken(purposeVerifyEmail, user, emailVerificationExpiry)
+	if err != nil {
+		return err
+	}
+	s.send(&EmailMessage{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that this is your email address by opening this link within %d hours:\n\n%s\n",
+			user.Username, int(emailVerificationExpiry.Hours()), s.link("/verify-email", token)),
+	})
+	return nil
+}
+
+// ResendVerificationEmail sends a new verification link without revealing whether the address exists.
+func (s *accountService) ResendVerificationEmail(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	err = s.SendVerificationEmail(ctx, user.ID)
+	if _, ok := err.(*ConflictError); ok {
+		return nil
+	}
+	return err
+}
+
+// VerifyEmail marks the address in the token as verified.
+func (s *accountService) VerifyEmail(ctx context.Context, token string) error {
+	user, err := s.redeemToken(ctx, purposeVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.MarkEmailVerified(ctx, user.ID, time.Now())
+}
+
+// signToken creates a token of the form base64url(payload).base64url(hmac). The payload is
+// "purpose|userID|expiresUnix|nonce|fingerprint"; the fingerprint binds it to the user's
+// current password hash and email, so changing either invalidates outstanding tokens.
+func (s *accountService) signToken(purpose string, user *User, ttl time.Duration) (string, error) {
+	nonce, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	payload := strings.Join([]string{
+		purpose,
+		strconv.FormatInt(user.ID, 10),
+		strconv.FormatInt(time.Now().Add(ttl).Unix(), 10),
+		nonce,
+		fingerprint(user),
+	}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + s.sign(payload), nil
+}
+
+// redeemToken verifies a token for the given purpose and consumes it.
+func (s *accountService) redeemToken(ctx context.Context, purpose, token string) (*User, error) {
+	invalid := &ValidationError{Msg: "invalid or expired token"}
+
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, invalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid
+	}
+	payload := string(raw)
+	if !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return nil, invalid
+	}
+
+	parts := strings.Split(payload, "|")
+	if len(parts) != 5 || parts[0] != purpose {
+		return nil, invalid
+	}
+	userID, err1 := strconv.ParseInt(parts[1], 10, 64)
+	expiresUnix, err2 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, invalid
+	}
+	expiresAt := time.Unix(expiresUnix, 0)
+	if time.Now().After(expiresAt) {
+		return nil, invalid
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return nil, invalid
+		}
+		return nil, err
+	}
+	if !hmac.Equal([]byte(parts[4]), []byte(fingerprint(user))) {
+		return nil, invalid
+	}
+
+	fresh, err := s.tokenRepo.ConsumeToken(ctx, parts[3], expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume token: %w", err)
+	}
+	if !fresh {
+		return nil, invalid
+	}
+	return user, nil
+}
+
+// sign returns the base64url HMAC-SHA256 of the payload.
+func (s *accountService) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// link builds an email link carrying the token.
+func (s *accountService) link(path, token string) string {
+	return s.baseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// send delivers an email in the background so response times don't reveal whether an
+// address is registered; failures are only logged.
+func (s *accountService) send(msg *EmailMessage) {
+	s.sending.Add(1)
+	go func() {
+		defer s.sending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send %q email to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// Shutdown waits for the emails started by send.
+func (s *accountService) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.sending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("emails still being sent: %w", ctx.Err())
+	}
+}
+
+// fingerprint summarizes the credentials a token is bound to.
+func fingerprint(user *User) string {
+	sum := sha256.Sum256([]byte(user.Password + "|" + user.Email))
+	return hex.EncodeToString(sum[:8])
+}
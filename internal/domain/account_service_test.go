@@ -0,0 +1,239 @@
+package domain_test
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/Emmanuel326/chatserver/internal/ports/mail"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeAccountUsers struct {
+	domain.UserRepository
+	mu    sync.Mutex
+	users map[int64]*domain.User
+}
+
+func (f *fakeAccountUsers) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, ok := f.users[id]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, &domain.NotFoundError{Msg: "user not found"}
+}
+
+func (f *fakeAccountUsers) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, user := range f.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, &domain.NotFoundError{Msg: "user not found"}
+}
+
+func (f *fakeAccountUsers) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[userID].Password = hashedPassword
+	return nil
+}
+
+func (f *fakeAccountUsers) MarkEmailVerified(ctx context.Context, userID int64, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[userID].EmailVerifiedAt = &at
+	return nil
+}
+
+type fakeActionTokens struct {
+	used map[string]bool
+}
+
+func (f *fakeActionTokens) ConsumeToken(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	if f.used[nonce] {
+		return false, nil
+	}
+	f.used[nonce] = true
+	return true, nil
+}
+
+func (f *fakeActionTokens) DeleteExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+type fakeAccountSessions struct {
+	domain.SessionService
+	revoked []int64
+}
+
+func (f *fakeAccountSessions) RevokeAllSessions(ctx context.Context, userID int64) error {
+	f.revoked = append(f.revoked, userID)
+	return nil
+}
+
+type accountFixture struct {
+	service  domain.AccountService
+	users    *fakeAccountUsers
+	sessions *fakeAccountSessions
+	mailer   *mail.MemoryMailer
+}
+
+func newAccountFixture(t *testing.T) *accountFixture {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &accountFixture{
+		users:    &fakeAccountUsers{users: map[int64]*domain.User{1: {ID: 1, Username: "ann", Email: "ann@example.com", Password: string(hashed)}}},
+		sessions: &fakeAccountSessions{},
+		mailer:   mail.NewMemoryMailer(),
+	}
+	f.service = domain.NewAccountService(f.users, &fakeActionTokens{used: make(map[string]bool)}, f.sessions, f.mailer, "test-secret", "https://chat.example.com/")
+	return f
+}
+
+var tokenLink = regexp.MustCompile(`https://chat\.example\.com(/[a-z-]+)\?token=(\S+)`)
+
+// lastLink waits for the emails being sent and returns the path and token of the last link.
+func (f *accountFixture) lastLink(t *testing.T) (string, string) {
+	t.Helper()
+	if err := f.service.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	messages := f.mailer.Messages()
+	if len(messages) == 0 {
+		t.Fatal("no email was sent")
+	}
+	match := tokenLink.FindStringSubmatch(messages[len(messages)-1].Body)
+	if match == nil {
+		t.Fatalf("no link in email %q", messages[len(messages)-1].Body)
+	}
+	token, err := url.QueryUnescape(match[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return match[1], token
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	f := newAccountFixture(t)
+
+	if err := f.service.SendVerificationEmail(ctx, 1); err != nil {
+		t.Fatalf("SendVerificationEmail returned %v", err)
+	}
+	path, token := f.lastLink(t)
+	if path != "/verify-email" {
+		t.Errorf("link path = %q, want /verify-email", path)
+	}
+	if msg := f.mailer.Messages()[0]; msg.To != "ann@example.com" {
+		t.Errorf("email sent to %q, want ann@example.com", msg.To)
+	}
+
+	// A verification token cannot reset the password
+	if _, err := f.service.ResetPassword(ctx, token, "new-password"); err == nil {
+		t.Error("ResetPassword accepted a verification token")
+	}
+	if err := f.service.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("VerifyEmail returned %v", err)
+	}
+	if user, _ := f.users.GetByID(ctx, 1); !user.IsEmailVerified() {
+		t.Error("email not marked verified")
+	}
+	if _, ok := f.service.SendVerificationEmail(ctx, 1).(*domain.ConflictError); !ok {
+		t.Error("SendVerificationEmail for a verified address did not return a ConflictError")
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	f := newAccountFixture(t)
+
+	if err := f.service.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset for an unknown address returned %v", err)
+	}
+	if err := f.service.RequestPasswordReset(ctx, "ann@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset returned %v", err)
+	}
+	path, token := f.lastLink(t)
+	if path != "/reset-password" || len(f.mailer.Messages()) != 1 {
+		t.Fatalf("sent %d emails with link %q, want one /reset-password link", len(f.mailer.Messages()), path)
+	}
+
+	// A rejected password does not use up the token
+	if _, err := f.service.ResetPassword(ctx, token, "short"); err == nil {
+		t.Error("ResetPassword accepted a too short password")
+	}
+	userID, err := f.service.ResetPassword(ctx, token, "new-password")
+	if err != nil || userID != 1 {
+		t.Fatalf("ResetPassword returned %d, %v", userID, err)
+	}
+	user, _ := f.users.GetByID(ctx, 1)
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("new-password")) != nil {
+		t.Error("password not updated")
+	}
+	if !user.IsEmailVerified() {
+		t.Error("a password reset did not verify the email address")
+	}
+	if len(f.sessions.revoked) != 1 || f.sessions.revoked[0] != 1 {
+		t.Errorf("revoked sessions of %v, want user 1", f.sessions.revoked)
+	}
+}
+
+func TestAccountTokensWorkOnce(t *testing.T) {
+	ctx := context.Background()
+	f := newAccountFixture(t)
+
+	if err := f.service.RequestPasswordReset(ctx, "ann@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	_, first := f.lastLink(t)
+	if err := f.service.RequestPasswordReset(ctx, "ann@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	_, second := f.lastLink(t)
+
+	if _, err := f.service.ResetPassword(ctx, first, "new-password"); err != nil {
+		t.Fatalf("ResetPassword returned %v", err)
+	}
+	if _, err := f.service.ResetPassword(ctx, first, "other-password"); err == nil {
+		t.Error("a reset token was accepted twice")
+	}
+	// Changing the password invalidates the other outstanding links
+	if _, err := f.service.ResetPassword(ctx, second, "other-password"); err == nil {
+		t.Error("a reset token issued before the password change was accepted")
+	}
+}
+
+func TestAccountTokensExpire(t *testing.T) {
+	ctx := context.Background()
+	f := newAccountFixture(t)
+	user, _ := f.users.GetByID(ctx, 1)
+
+	for _, purpose := range []string{domain.PurposePasswordReset, domain.PurposeVerifyEmail} {
+		token, err := domain.SignAccountToken(f.service, purpose, user, -time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var redeemErr error
+		if purpose == domain.PurposePasswordReset {
+			_, redeemErr = f.service.ResetPassword(ctx, token, "new-password")
+		} else {
+			redeemErr = f.service.VerifyEmail(ctx, token)
+		}
+		if _, ok := redeemErr.(*domain.ValidationError); !ok {
+			t.Errorf("expired %s token returned %v, want a ValidationError", purpose, redeemErr)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// AuditAction names an administrator action recorded in the audit log.
+type AuditAction string
+
+const (
+	AuditUserDisable     AuditAction = "user.disable"
+	AuditUserEnable      AuditAction = "user.enable"
+	AuditUserDelete      AuditAction = "user.delete"
+	AuditUserLogout      AuditAction = "user.force_logout"
+	AuditUserGrantAdmin  AuditAction = "user.grant_admin"
+	AuditUserRevokeAdmin AuditAction = "user.revoke_admin"
+	AuditGroupView       AuditAction = "group.view" // Private group details are personal data, so reads are audited too
+	AuditGroupDelete     AuditAction = "group.delete"
+)
+
+// Audit target types.
+const (
+	AuditTargetUser  = "user"
+	AuditTargetGroup = "group"
+)
+
+// AuditEntry records one action taken by a server administrator.
+type AuditEntry struct {
+	ID         int64       `json:"id" db:"id"`
+	ActorID    int64       `json:"actor_id" db:"actor_id"`
+	Action     AuditAction `json:"action" db:"action"`
+	TargetType string      `json:"target_type" db:"target_type"`
+	TargetID   int64       `json:"target_id" db:"target_id"`
+	Details    string      `json:"details,omitempty" db:"details"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+}
+
+// AuditFilter narrows an audit log listing. Zero values match everything.
+type AuditFilter struct {
+	ActorID    int64
+	Action     AuditAction
+	TargetType string
+	TargetID   int64
+}
+
+// ConnectionStats is a snapshot of the live WebSocket connections.
+type ConnectionStats struct {
+	Connections int `json:"connections"`  // Open sockets, counting every device
+	OnlineUsers int `json:"online_users"` // Distinct users with at least one socket
+}
+
+// ConnectionCounter reports live connection counts; implemented by the WebSocket hub.
+type ConnectionCounter interface {
+	ConnectionStats() ConnectionStats
+}
+
+// AdminGroupView is a group as seen by a server administrator, members included.
+type AdminGroupView struct {
+	*Group
+	Members []*GroupMemberProfile `json:"members"`
+}
+
+// AdminService is the operator API. Every method requires the actor to be a server administrator
+// and records what it changed in the audit log. Callers disconnect live sockets themselves.
+type AdminService interface {
+	SearchUsers(ctx context.Context, adminID int64, query string, afterID int64, limit int) ([]*User, error)
+	// SetUserDisabled disables an account (revoking its sessions and API tokens) or re-enables it.
+	SetUserDisabled(ctx context.Context, adminID, userID int64, disabled bool, reason string) (*User, error)
+	SetUserAdmin(ctx context.Context, adminID, userID int64, isAdmin bool) (*User, error)
+	// DeleteUser anonymizes the account and signs it out everywhere; its messages are kept.
+	DeleteUser(ctx context.Context, adminID, userID int64, reason string) error
+	// ForceLogout revokes every session of the user.
+	ForceLogout(ctx context.Context, adminID, userID int64) error
+
+	SearchGroups(ctx context.Context, adminID int64, query string, afterID int64, limit int) ([]*GroupDirectoryEntry, error)
+	GetGroup(ctx context.Context, adminID, groupID int64) (*AdminGroupView, error)
+	// DeleteGroup deletes any group and returns its former members so callers can notify them.
+	DeleteGroup(ctx context.Context, adminID, groupID int64, reason string) ([]int64, error)
+
+	ConnectionStats(ctx context.Context, adminID int64) (*ConnectionStats, error)
+	// ListAuditLog returns matching entries newest first, starting before beforeID (0 for the latest).
+	ListAuditLog(ctx context.Context, adminID int64, filter AuditFilter, beforeID int64, limit int) ([]*AuditEntry, error)
+}
+
+// AuditRepository stores the administrator audit log.
+type AuditRepository interface {
+	SaveAuditEntry(ctx context.Context, entry *AuditEntry) error
+	ListAuditEntries(ctx context.Context, filter AuditFilter, beforeID int64, limit int) ([]*AuditEntry, error)
+}
@@ -0,0 +1,276 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// maxAuditReasonLength caps the free-text reason an administrator can attach to an action.
+const maxAuditReasonLength = 500
+
+// adminMemberListLimit caps the members returned when an administrator views a group.
+const adminMemberListLimit = 500
+
+// adminService is the concrete implementation of the AdminService interface.
+type adminService struct {
+	userRepo       UserRepository
+	groupRepo      GroupRepository
+	tokenRepo      APITokenRepository
+	auditRepo      AuditRepository
+	groupService   GroupService
+	sessionService SessionService
+	connections    ConnectionCounter
+	authz          Authorizer
+}
+
+// NewAdminService creates a new AdminService.
+func NewAdminService(userRepo UserRepository, groupRepo GroupRepository, tokenRepo APITokenRepository, auditRepo AuditRepository, groupService GroupService, sessionService SessionService, connections ConnectionCounter, authz Authorizer) AdminService {
+	return &adminService{
+		userRepo:       userRepo,
+		groupRepo:      groupRepo,
+		tokenRepo:      tokenRepo,
+		auditRepo:      auditRepo,
+		groupService:   groupService,
+		sessionService: sessionService,
+		connections:    connections,
+		authz:          authz,
+	}
+}
+
+// requireAdmin checks that the actor is a server administrator.
+func (s *adminService) requireAdmin(ctx context.Context, adminID int64) error {
+	return s.authz.Can(ctx, UserSubject(adminID), ActionServerAdmin, NoResource)
+}
+
+// SearchUsers lists accounts, disabled and deleted ones included.
+func (s *adminService) SearchUsers(ctx context.Context, adminID int64, query string, afterID int64, limit int) ([]*User, error) {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+	return s.userRepo.Search(ctx, strings.TrimSpace(query), afterID, limit)
+}
+
+// SetUserDisabled disables or re-enables an account. Disabling signs the user out everywhere and
+// revokes their API tokens (including those of their bots); re-enabling does not restore them.
+func (s *adminService) SetUserDisabled(ctx context.Context, adminID, userID int64, disabled bool, reason string) (*User, error) {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+	if disabled && userID == adminID {
+		return nil, &ValidationError{Msg: "you cannot disable your own account"}
+	}
+	user, err := s.loadTarget(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if (user.DisabledAt != nil) == disabled {
+		return user, nil
+	}
+
+	now := time.Now()
+	action := AuditUserEnable
+	var disabledAt *time.Time
+	if disabled {
+		action = AuditUserDisable
+		disabledAt = &now
+	}
+	if err := s.userRepo.SetDisabledAt(ctx, userID, disabledAt); err != nil {
+		return nil, fmt.Errorf("failed to update account: %w", err)
+	}
+	user.DisabledAt = disabledAt
+
+	if disabled {
+		if err := s.signOut(ctx, userID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	s.audit(ctx, adminID, action, AuditTargetUser, userID, reason)
+	return user, nil
+}
+
+// SetUserAdmin grants or revokes the server administrator flag. Administrators cannot demote
+// themselves, so there is always at least one left.
+func (s *adminService) SetUserAdmin(ctx context.Context, adminID, userID int64, isAdmin bool) (*User, error) {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+	if !isAdmin && userID == adminID {
+		return nil, &ValidationError{Msg: "you cannot revoke your own administrator rights"}
+	}
+	user, err := s.loadTarget(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isAdmin && user.IsBot {
+		return nil, &ValidationError{Msg: "bots cannot be administrators"}
+	}
+	if user.IsAdmin == isAdmin {
+		return user, nil
+	}
+
+	if err := s.userRepo.SetAdmin(ctx, userID, isAdmin); err != nil {
+		return nil, fmt.Errorf("failed to update account: %w", err)
+	}
+	user.IsAdmin = isAdmin
+
+	action := AuditUserRevokeAdmin
+	if isAdmin {
+		action = AuditUserGrantAdmin
+	}
+	s.audit(ctx, adminID, action, AuditTargetUser, userID, "")
+	return user, nil
+}
+
+// DeleteUser anonymizes the account, removes it from its groups and signs it out everywhere.
+// The row stays so the user's messages keep a sender; groups they own stay with their admins.
+func (s *adminService) DeleteUser(ctx context.Context, adminID, userID int64, reason string) error {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return err
+	}
+	if userID == adminID {
+		return &ValidationError{Msg: "you cannot delete your own account"}
+	}
+	if _, err := s.loadTarget(ctx, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := s.userRepo.Scrub(ctx, userID, now); err != nil {
+		return fmt.Errorf("failed to delete account: %w", err)
+	}
+	if err := s.signOut(ctx, userID, now); err != nil {
+		return err
+	}
+
+	s.audit(ctx, adminID, AuditUserDelete, AuditTargetUser, userID, reason)
+	return nil
+}
+
+// ForceLogout revokes every session of the user; their API tokens are left alone.
+func (s *adminService) ForceLogout(ctx context.Context, adminID, userID int64) error {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return err
+	}
+	if _, err := s.loadTarget(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.sessionService.RevokeAllSessions(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.audit(ctx, adminID, AuditUserLogout, AuditTargetUser, userID, "")
+	return nil
+}
+
+// SearchGroups lists every group, private ones included.
+func (s *adminService) SearchGroups(ctx context.Context, adminID int64, query string, afterID int64, limit int) ([]*GroupDirectoryEntry, error) {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+	return s.groupRepo.SearchAll(ctx, strings.TrimSpace(query), afterID, limit)
+}
+
+// GetGroup returns any group with its members.
+func (s *adminService) GetGroup(ctx context.Context, adminID, groupID int64) (*AdminGroupView, error) {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+
+	group, err := s.groupRepo.FindByID(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group: %w", err)
+	}
+	if group == nil {
+		return nil, &NotFoundError{Msg: "group not found"}
+	}
+
+	members, err := s.groupRepo.FindMemberProfiles(ctx, groupID, "", 0, adminMemberListLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group members: %w", err)
+	}
+	for _, member := range members {
+		member.Role = memberRole(group, member)
+	}
+
+	s.audit(ctx, adminID, AuditGroupView, AuditTargetGroup, groupID, "")
+	return &AdminGroupView{Group: group, Members: members}, nil
+}
+
+// DeleteGroup deletes any group, applying the configured message retention.
+func (s *adminService) DeleteGroup(ctx context.Context, adminID, groupID int64, reason string) ([]int64, error) {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+
+	memberIDs, err := s.groupService.DeleteGroup(ctx, groupID, adminID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, adminID, AuditGroupDelete, AuditTargetGroup, groupID, reason)
+	return memberIDs, nil
+}
+
+// ConnectionStats reports the hub's live connection counts.
+func (s *adminService) ConnectionStats(ctx context.Context, adminID int64) (*ConnectionStats, error) {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+	stats := s.connections.ConnectionStats()
+	return &stats, nil
+}
+
+// ListAuditLog returns audit entries newest first.
+func (s *adminService) ListAuditLog(ctx context.Context, adminID int64, filter AuditFilter, beforeID int64, limit int) ([]*AuditEntry, error) {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+	return s.auditRepo.ListAuditEntries(ctx, filter, beforeID, limit)
+}
+
+// loadTarget loads the user an action applies to; deleted accounts are reported as missing.
+func (s *adminService) loadTarget(ctx context.Context, userID int64) (*User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return nil, &NotFoundError{Msg: "user not found"}
+		}
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, &NotFoundError{Msg: "user has been deleted"}
+	}
+	return user, nil
+}
+
+// signOut revokes all of the user's sessions and API tokens.
+func (s *adminService) signOut(ctx context.Context, userID int64, now time.Time) error {
+	if err := s.sessionService.RevokeAllSessions(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	if err := s.tokenRepo.RevokeUserTokens(ctx, userID, now); err != nil {
+		return fmt.Errorf("failed to revoke API tokens: %w", err)
+	}
+	return nil
+}
+
+// audit records an administrator action. The action already happened, so a failure to record
+// it is logged rather than returned.
+func (s *adminService) audit(ctx context.Context, adminID int64, action AuditAction, targetType string, targetID int64, details string) {
+	entry := &AuditEntry{
+		ActorID:    adminID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    truncate(strings.TrimSpace(details), maxAuditReasonLength),
+		CreatedAt:  time.Now(),
+	}
+	if err := s.auditRepo.SaveAuditEntry(ctx, entry); err != nil {
+		log.Printf("Failed to record audit entry %s on %s %d by admin %d: %v", action, targetType, targetID, adminID, err)
+	}
+}
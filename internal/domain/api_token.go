@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix marks personal API tokens so they can be told apart from JWTs in an Authorization header.
+const APITokenPrefix = "cs_"
+
+// Scopes an API token can be granted. Every route that accepts API tokens requires one of them.
+const (
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeGroupsRead    = "groups:read"
+	ScopeGroupsWrite   = "groups:write"
+	ScopeUsersRead     = "users:read"
+)
+
+// KnownScopes lists every scope that can be granted to an API token.
+var KnownScopes = []string{ScopeMessagesRead, ScopeMessagesWrite, ScopeGroupsRead, ScopeGroupsWrite, ScopeUsersRead}
+
+// TokenScopes is a set of scopes, stored as a space-separated string.
+type TokenScopes []string
+
+// Has reports whether the scope was granted.
+func (s TokenScopes) Has(scope string) bool {
+	for _, granted := range s {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Value implements driver.Valuer.
+func (s TokenScopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+// Scan implements sql.Scanner.
+func (s *TokenScopes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		*s = strings.Fields(v)
+	case []byte:
+		*s = strings.Fields(string(v))
+	case nil:
+		*s = nil
+	default:
+		return fmt.Errorf("cannot scan %T into TokenScopes", src)
+	}
+	return nil
+}
+
+// APIToken is a long-lived, scoped credential for integrations. It acts as UserID, which is
+// either the human who created it or one of their bots. Only a hash of the token is stored.
+type APIToken struct {
+	ID         int64       `json:"id" db:"id"`
+	UserID     int64       `json:"user_id" db:"user_id"`
+	CreatedBy  int64       `json:"created_by" db:"created_by"`
+	Name       string      `json:"name" db:"name"`
+	TokenHash  string      `json:"-" db:"token_hash"`
+	Scopes     TokenScopes `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time  `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt  *time.Time  `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt  *time.Time  `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// IsActive reports whether the token is neither revoked nor expired.
+func (t *APIToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// CreateAPITokenParams describes a token to issue.
+type CreateAPITokenParams struct {
+	Name      string
+	Scopes    []string
+	BotID     int64      // Issue the token for this bot (owned by the caller); 0 issues it for the caller
+	ExpiresAt *time.Time // nil for a token that never expires
+}
+
+// ---------------------------------------------
+// API TOKEN INTERFACES
+// ---------------------------------------------
+
+// APITokenService manages bot accounts and personal API tokens.
+type APITokenService interface {
+	// CreateBot creates a bot user owned by ownerID. Bots cannot log in with a password; they act through API tokens.
+	CreateBot(ctx context.Context, ownerID int64, username string) (*User, error)
+	ListBots(ctx context.Context, ownerID int64) ([]*User, error)
+
+	// CreateToken issues a token and returns it together with its plaintext value, which is shown only once.
+	CreateToken(ctx context.Context, creatorID int64, params CreateAPITokenParams) (*APIToken, string, error)
+	// ListTokens returns the tokens the user created (for themselves and for their bots).
+	ListTokens(ctx context.Context, creatorID int64) ([]*APIToken, error)
+	RevokeToken(ctx context.Context, creatorID int64, tokenID int64) error
+	// Authenticate resolves a plaintext token, returning an *UnauthorizedError if it is unknown, revoked or expired.
+	Authenticate(ctx context.Context, token string) (*APIToken, error)
+}
+
+// APITokenRepository defines the data access operations for API tokens.
+type APITokenRepository interface {
+	CreateToken(ctx context.Context, token *APIToken) (*APIToken, error)
+	FindTokenByHash(ctx context.Context, tokenHash string) (*APIToken, error)
+	FindTokensByCreator(ctx context.Context, creatorID int64) ([]*APIToken, error)
+	// RevokeToken reports whether an active token with that ID, created by creatorID, was revoked.
+	RevokeToken(ctx context.Context, tokenID, creatorID int64, revokedAt time.Time) (bool, error)
+	TouchToken(ctx context.Context, tokenID int64, usedAt time.Time) error
+	// RevokeUserTokens revokes every active token that acts as, or was created by, the user.
+	RevokeUserTokens(ctx context.Context, userID int64, revokedAt time.Time) error
+}
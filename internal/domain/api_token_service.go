@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxAPITokensPerUser caps how many tokens a user can have created (active or not).
+const maxAPITokensPerUser = 50
+
+// apiTokenService is the concrete implementation of the APITokenService interface.
+type apiTokenService struct {
+	tokenRepo APITokenRepository
+	userRepo  UserRepository
+}
+
+// NewAPITokenService creates a new APITokenService.
+func NewAPITokenService(tokenRepo APITokenRepository, userRepo UserRepository) APITokenService {
+	return &apiTokenService{tokenRepo: tokenRepo, userRepo: userRepo}
+}
+
+// CreateBot creates a bot user owned by ownerID. Its password is random and never revealed,
+// and its email uses the reserved .invalid domain, so it can only act through API tokens.
+func (s *apiTokenService) CreateBot(ctx context.Context, ownerID int64, username string) (*User, error) {
+	owner, err := s.userRepo.GetByID(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if owner.IsBot {
+		return nil, &ForbiddenError{Msg: "bots cannot create other bots"}
+	}
+
+	username = strings.TrimSpace(username)
+	if len(username) < 3 || len(username) > 32 || usernameDisallowed.MatchString(username) {
+		return nil, &ValidationError{Msg: "bot username must be 3-32 letters, digits, '.', '_' or '-'"}
+	}
+	if _, err := s.userRepo.GetByUsername(ctx, username); err == nil {
+		return nil, &ConflictError{Msg: "User with this username already exists"}
+	} else if _, ok := err.(*NotFoundError); !ok {
+		return nil, err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	bot := NewUser(username, strings.ToLower(username)+"@bots.invalid", string(hashedPassword))
+	bot.IsBot = true
+	bot.BotOwnerID = &ownerID
+	return s.userRepo.Create(ctx, bot)
+}
+
+// ListBots returns the bots owned by ownerID.
+func (s *apiTokenService) ListBots(ctx context.Context, ownerID int64) ([]*User, error) {
+	return s.userRepo.FindBotsByOwner(ctx, ownerID)
+}
+
+// CreateToken validates the scopes and subject, then issues a new token.
+func (s *apiTokenService) CreateToken(ctx context.Context, creatorID int64, params CreateAPITokenParams) (*APIToken, string, error) {
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > 100 {
+		return nil, "", &ValidationError{Msg: "token name is required (max 100 characters)"}
+	}
+
+	scopes, err := normalizeScopes(params.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(now) {
+		return nil, "", &ValidationError{Msg: "expiry must be in the future"}
+	}
+
+	creator, err := s.userRepo.GetByID(ctx, creatorID)
+	if err != nil {
+		return nil, "", err
+	}
+	if creator.IsBot {
+		return nil, "", &ForbiddenError{Msg: "bots cannot create API tokens"}
+	}
+
+	subjectID := creatorID
+	if params.BotID != 0 {
+		bot, err := s.userRepo.GetByID(ctx, params.BotID)
+		if err != nil {
+			if _, ok := err.(*NotFoundError); ok {
+				return nil, "", &NotFoundError{Msg: "bot not found"}
+			}
+			return nil, "", err
+		}
+		if !bot.IsBot || bot.BotOwnerID == nil || *bot.BotOwnerID != creatorID {
+			return nil, "", &NotFoundError{Msg: "bot not found"}
+		}
+		subjectID = bot.ID
+	}
+
+	existing, err := s.tokenRepo.FindTokensByCreator(ctx, creatorID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to count API tokens: %w", err)
+	}
+	if len(existing) >= maxAPITokensPerUser {
+		return nil, "", &ConflictError{Msg: fmt.Sprintf("token limit reached (%d); revoke unused tokens first", maxAPITokensPerUser)}
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	plaintext := APITokenPrefix + secret
+
+	token, err := s.tokenRepo.CreateToken(ctx, &APIToken{
+		UserID:    subjectID,
+		CreatedBy: creatorID,
+		Name:      name,
+		TokenHash: hashToken(plaintext),
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to save API token: %w", err)
+	}
+	return token, plaintext, nil
+}
+
+// ListTokens returns the tokens created by the user, newest first.
+func (s *apiTokenService) ListTokens(ctx context.Context, creatorID int64) ([]*APIToken, error) {
+	return s.tokenRepo.FindTokensByCreator(ctx, creatorID)
+}
+
+// RevokeToken revokes one of the caller's tokens. Unknown tokens and tokens created by
+// someone else are reported as not found.
+func (s *apiTokenService) RevokeToken(ctx context.Context, creatorID int64, tokenID int64) error {
+	revoked, err := s.tokenRepo.RevokeToken(ctx, tokenID, creatorID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token: %w", err)
+	}
+	if !revoked {
+		return &NotFoundError{Msg: "token not found"}
+	}
+	return nil
+}
+
+// Authenticate looks up the token by hash and records its use (at most once per sessionTouchInterval).
+func (s *apiTokenService) Authenticate(ctx context.Context, token string) (*APIToken, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, &UnauthorizedError{Msg: "invalid API token"}
+	}
+
+	apiToken, err := s.tokenRepo.FindTokenByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API token: %w", err)
+	}
+	now := time.Now()
+	if apiToken == nil || !apiToken.IsActive(now) {
+		return nil, &UnauthorizedError{Msg: "invalid, expired or revoked API token"}
+	}
+
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) > sessionTouchInterval {
+		if err := s.tokenRepo.TouchToken(ctx, apiToken.ID, now); err != nil {
+			log.Printf("Failed to update last use of API token %d: %v", apiToken.ID, err)
+		}
+	}
+	return apiToken, nil
+}
+
+// normalizeScopes rejects unknown scopes and removes duplicates.
+func normalizeScopes(requested []string) (TokenScopes, error) {
+	var scopes TokenScopes
+	for _, scope := range requested {
+		scope = strings.TrimSpace(scope)
+		if !TokenScopes(KnownScopes).Has(scope) {
+			return nil, &ValidationError{Msg: fmt.Sprintf("unknown scope %q (valid: %s)", scope, strings.Join(KnownScopes, ", "))}
+		}
+		if !scopes.Has(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, &ValidationError{Msg: "at least one scope is required"}
+	}
+	return scopes, nil
+}
@@ -0,0 +1,83 @@
+package domain
+
+import "context"
+
+// Action is something a subject wants to do to a resource. Every route and every
+// WebSocket operation maps to one of these; see the authz package for the policy.
+type Action string
+
+const (
+	// ActionOwnAccount covers data that belongs to the caller alone: sessions, 2FA, API tokens,
+	// bots, their recent chats and group list. The resource is always the caller.
+	ActionOwnAccount Action = "account:own"
+
+	ActionUserView    Action = "user:view"    // Read a user's public profile
+	ActionUserMessage Action = "user:message" // Send P2P messages to a user and read the conversation with them
+
+	ActionGroupCreate   Action = "group:create"
+	ActionGroupDiscover Action = "group:discover" // Search the public group directory
+	ActionGroupJoin     Action = "group:join"     // Self-join a public group
+	ActionGroupView     Action = "group:view"     // Read history, members and typing indicators
+	ActionGroupPost     Action = "group:post"     // Post, subject to mutes, archiving and the posting policy
+	ActionGroupInvite   Action = "group:invite"   // Add another user as a member
+	ActionGroupManage   Action = "group:manage"   // Change settings, posting policy, archive state
+	ActionGroupModerate Action = "group:moderate" // Mute, ban and list sanctions
+	ActionGroupDelete   Action = "group:delete"   // The owner, or a server administrator
+
+	ActionMediaUpload Action = "media:upload" // Upload files to attach to messages
+	ActionMediaView   Action = "media:view"   // Download an upload: the owner, or anyone who can see a message it is attached to
+
+	ActionMessageView Action = "message:view" // See a message (e.g. to star it): a member of its group or a participant of its P2P conversation
+	ActionMessagePin  Action = "message:pin"  // Pin and unpin a message: a group admin, or either participant of a P2P conversation
+
+	// ActionServerAdmin covers the operator API under /v1/admin.
+	ActionServerAdmin Action = "server:admin"
+)
+
+// ResourceKind identifies what a Resource's ID refers to.
+type ResourceKind string
+
+const (
+	ResourceNone    ResourceKind = ""
+	ResourceUser    ResourceKind = "user"
+	ResourceGroup   ResourceKind = "group"
+	ResourceMedia   ResourceKind = "media"
+	ResourceMessage ResourceKind = "message"
+)
+
+// Resource is the object of an authorization decision.
+type Resource struct {
+	Kind ResourceKind
+	ID   int64
+	Key  string // Set instead of ID for objects with string identifiers (uploads)
+}
+
+// UserResource refers to a user.
+func UserResource(userID int64) Resource { return Resource{Kind: ResourceUser, ID: userID} }
+
+// GroupResource refers to a group.
+func GroupResource(groupID int64) Resource { return Resource{Kind: ResourceGroup, ID: groupID} }
+
+// MediaResource refers to an upload.
+func MediaResource(mediaID string) Resource { return Resource{Kind: ResourceMedia, Key: mediaID} }
+
+// MessageResource refers to a message.
+func MessageResource(messageID int64) Resource { return Resource{Kind: ResourceMessage, ID: messageID} }
+
+// NoResource is used for actions that do not target a specific object (e.g. creating a group).
+var NoResource = Resource{}
+
+// Subject is the authenticated user an authorization decision is made for.
+type Subject struct {
+	UserID int64
+}
+
+// UserSubject returns the subject for a user ID.
+func UserSubject(userID int64) Subject { return Subject{UserID: userID} }
+
+// Authorizer decides whether a subject may perform an action on a resource. It returns nil when
+// allowed, and otherwise a *ForbiddenError, a *NotFoundError (the resource does not exist or must
+// not be revealed) or, for ActionGroupPost, a *PostingRestrictedError explaining why.
+type Authorizer interface {
+	Can(ctx context.Context, subject Subject, action Action, resource Resource) error
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// Token purposes, for the external account service tests.
+const (
+	PurposePasswordReset = purposePasswordReset
+	PurposeVerifyEmail   = purposeVerifyEmail
+)
+
+// SignAccountToken issues an account token with any lifetime, so tests can build expired ones.
+func SignAccountToken(service AccountService, purpose string, user *User, ttl time.Duration) (string, error) {
+	return service.(*accountService).signToken(purpose, user, ttl)
+}
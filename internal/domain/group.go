@@ -5,12 +5,50 @@ import (
 	"time"
 )
 
+// PostingPolicy defines who is allowed to post messages into a group.
+type PostingPolicy string
+
+const (
+	// PostingEveryone lets any member post without restriction (the default).
+	PostingEveryone PostingPolicy = "everyone"
+	// PostingAdminsOnly turns the group into an announcement channel: only admins may post.
+	PostingAdminsOnly PostingPolicy = "admins_only"
+	// PostingSlowMode lets any member post, but non-admins must wait SlowModeSeconds between posts.
+	PostingSlowMode PostingPolicy = "slow_mode"
+)
+
 // Group defines the core structure for a chat group.
 type Group struct {
-	ID        int64     `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	OwnerID   int64     `json:"owner_id" db:"owner_id"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID              int64         `json:"id" db:"id"`
+	Name            string        `json:"name" db:"name"`
+	OwnerID         int64         `json:"owner_id" db:"owner_id"`
+	CreatedAt       time.Time     `json:"created_at" db:"created_at"`
+	PostingPolicy   PostingPolicy `json:"posting_policy" db:"posting_policy"`
+	SlowModeSeconds int           `json:"slow_mode_seconds" db:"slow_mode_seconds"`
+	Description     string        `json:"description" db:"description"`
+	IsPublic        bool          `json:"is_public" db:"is_public"` // Public groups are listed in the directory and can be self-joined
+	ArchivedAt      *time.Time    `json:"archived_at,omitempty" db:"archived_at"` // Archived groups are read-only
+}
+
+// IsArchived reports whether the group has been archived (read-only).
+func (g *Group) IsArchived() bool {
+	return g.ArchivedAt != nil
+}
+
+// MessageRetention controls what happens to a group's messages when the group is deleted.
+type MessageRetention string
+
+const (
+	// RetentionDelete removes the group's messages permanently.
+	RetentionDelete MessageRetention = "delete"
+	// RetentionTombstone keeps message rows but clears their content and media.
+	RetentionTombstone MessageRetention = "tombstone"
+)
+
+// GroupDirectoryEntry is a public group as listed in the group directory.
+type GroupDirectoryEntry struct {
+	Group
+	MemberCount int `json:"member_count" db:"member_count"`
 }
 
 // GroupMember defines the relationship between a user and a group.
@@ -21,16 +59,69 @@ type GroupMember struct {
 	IsAdmin   bool      `json:"is_admin" db:"is_admin"`
 }
 
+// SanctionKind distinguishes the moderation actions a group admin can take against a member.
+type SanctionKind string
+
+const (
+	// SanctionMute lets the member keep reading but refuses their posts.
+	SanctionMute SanctionKind = "mute"
+	// SanctionBan removes the member and prevents them from re-joining.
+	SanctionBan SanctionKind = "ban"
+)
+
+// GroupSanction is a mute or ban applied to a user in a group. A nil ExpiresAt means it lasts until lifted.
+type GroupSanction struct {
+	GroupID   int64        `json:"group_id" db:"group_id"`
+	UserID    int64        `json:"user_id" db:"user_id"`
+	Kind      SanctionKind `json:"kind" db:"kind"`
+	Reason    string       `json:"reason" db:"reason"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedBy int64        `json:"created_by" db:"created_by"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+}
+
+// Member roles reported in group member listings.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// GroupMemberProfile is a group member together with their public user profile.
+type GroupMemberProfile struct {
+	UserID   int64     `json:"user_id" db:"user_id"`
+	Username string    `json:"username" db:"username"`
+	IsAdmin  bool      `json:"-" db:"is_admin"`
+	Role     string    `json:"role" db:"-"`
+	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
+	Online   bool      `json:"online" db:"-"`
+}
+
 // ---------------------------------------------
 // GROUP INTERFACES (Contracts for Group Management)
 // ---------------------------------------------
 
 // GroupService defines the business operations related to groups.
 type GroupService interface {
-	CreateGroup(ctx context.Context, name string, ownerID int64) (*Group, error)
+	CreateGroup(ctx context.Context, name, description string, isPublic bool, ownerID int64) (*Group, error)
+	UpdateGroup(ctx context.Context, groupID, actorID int64, description *string, isPublic *bool) (*Group, error)
 	AddMember(ctx context.Context, groupID, userID int64, inviterID int64) error
 	GetMembers(ctx context.Context, groupID int64) ([]int64, error)
+	// ListMembers returns member profiles for a group; only members of the group may list them.
+	ListMembers(ctx context.Context, groupID, requesterID int64, query string, afterUserID int64, limit int) ([]*GroupMemberProfile, error)
 	GetGroupsForUser(ctx context.Context, userID int64) ([]*Group, error)
+	SetPostingPolicy(ctx context.Context, groupID, actorID int64, policy PostingPolicy, slowModeSeconds int) (*Group, error)
+	SearchDirectory(ctx context.Context, query string, afterID int64, limit int) ([]*GroupDirectoryEntry, error)
+	JoinPublicGroup(ctx context.Context, groupID, userID int64) error
+	SetArchived(ctx context.Context, groupID, actorID int64, archived bool) (*Group, error)
+	// DeleteGroup removes a group and its memberships, applying the configured message retention.
+	// It returns the IDs of the users who were members so callers can notify them.
+	DeleteGroup(ctx context.Context, groupID, actorID int64) ([]int64, error)
+
+	// Moderation: admins may mute or ban members for an optional duration (zero means until lifted).
+	SanctionMember(ctx context.Context, groupID, actorID, userID int64, kind SanctionKind, duration time.Duration, reason string) (*GroupSanction, error)
+	LiftSanction(ctx context.Context, groupID, actorID, userID int64, kind SanctionKind) error
+	ListSanctions(ctx context.Context, groupID, actorID int64, kind SanctionKind) ([]*GroupSanction, error)
 }
 
 // GroupRepository defines the data access operations for groups and membership.
@@ -40,4 +131,25 @@ type GroupRepository interface {
 	AddMember(ctx context.Context, member *GroupMember) error
 	FindMembersByGroupID(ctx context.Context, groupID int64) ([]int64, error)
 	FindGroupsByUserID(ctx context.Context, userID int64) ([]*Group, error)
+	FindMember(ctx context.Context, groupID, userID int64) (*GroupMember, error)
+	// SharesGroup reports whether two users are members of a common, non-deleted group.
+	SharesGroup(ctx context.Context, userID1, userID2 int64) (bool, error)
+	// FindMemberProfiles lists members whose username contains query, ordered by user ID, starting after afterUserID.
+	FindMemberProfiles(ctx context.Context, groupID int64, query string, afterUserID int64, limit int) ([]*GroupMemberProfile, error)
+	UpdatePostingPolicy(ctx context.Context, groupID int64, policy PostingPolicy, slowModeSeconds int) error
+	UpdateDetails(ctx context.Context, groupID int64, description string, isPublic bool) error
+	// SearchPublic lists public groups whose name or description matches query, ordered by ID, starting after afterID.
+	SearchPublic(ctx context.Context, query string, afterID int64, limit int) ([]*GroupDirectoryEntry, error)
+	// SearchAll is SearchPublic including private groups.
+	SearchAll(ctx context.Context, query string, afterID int64, limit int) ([]*GroupDirectoryEntry, error)
+	SetArchivedAt(ctx context.Context, groupID int64, archivedAt *time.Time) error
+	// Delete removes the group's memberships and applies retention to its messages in one transaction.
+	Delete(ctx context.Context, groupID int64, retention MessageRetention) error
+	RemoveMember(ctx context.Context, groupID, userID int64) error
+
+	SaveSanction(ctx context.Context, sanction *GroupSanction) error
+	DeleteSanction(ctx context.Context, groupID, userID int64, kind SanctionKind) (bool, error)
+	// FindActiveSanction returns the unexpired sanction of the given kind, or nil if there is none.
+	FindActiveSanction(ctx context.Context, groupID, userID int64, kind SanctionKind) (*GroupSanction, error)
+	ListActiveSanctions(ctx context.Context, groupID int64, kind SanctionKind) ([]*GroupSanction, error)
 }
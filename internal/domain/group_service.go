@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"  
+	"strings"
 	"time" 
 )
 
@@ -11,23 +12,37 @@ import (
 type groupService struct {
 	groupRepo GroupRepository
 	userRepo  UserRepository 
+	authz     Authorizer       // Decides who may view, post to, manage and delete groups
+	retention MessageRetention // What happens to messages when a group is deleted
 }
 
 // NewGroupService creates a new instance of the GroupService.
-func NewGroupService(groupRepo GroupRepository, userRepo UserRepository) GroupService {
+func NewGroupService(groupRepo GroupRepository, userRepo UserRepository, authz Authorizer, retention MessageRetention) GroupService {
+	if retention != RetentionDelete {
+		retention = RetentionTombstone // Default to keeping an audit trail
+	}
 	return &groupService{
 		groupRepo: groupRepo,
 		userRepo:  userRepo,
+		authz:     authz,
+		retention: retention,
 	}
 }
 
 // CreateGroup creates a new group and relies on the repository to handle adding the owner as the first member.
-func (s *groupService) CreateGroup(ctx context.Context, name string, ownerID int64) (*Group, error) { 
+func (s *groupService) CreateGroup(ctx context.Context, name, description string, isPublic bool, ownerID int64) (*Group, error) { 
+	if err := s.authz.Can(ctx, UserSubject(ownerID), ActionGroupCreate, NoResource); err != nil {
+		return nil, err
+	}
+
 	// 1. Create the Group structure. The CreatedAt field is omitted here because your 
 	//    SQLite implementation expects the DB to handle setting it implicitly upon creation.
 	group := &Group{
-		Name:    name,
-		OwnerID: ownerID,
+		Name:          name,
+		OwnerID:       ownerID,
+		PostingPolicy: PostingEveryone,
+		Description:   description,
+		IsPublic:      isPublic,
 	}
 
 	// 2. Call the repository's Create method. 
@@ -41,19 +56,27 @@ func (s *groupService) CreateGroup(ctx context.Context, name string, ownerID int
 	return newGroup, nil
 }
 
-// AddMember adds a user to a specified group.
+// AddMember adds a user to a specified group. Only members may add people.
 func (s *groupService) AddMember(ctx context.Context, groupID, userID int64, inviterID int64) error {
-	// 1. Validation: Ensure the user being added exists
+	// 1. Authorization: the group must exist and the inviter must be a member
+	if err := s.authz.Can(ctx, UserSubject(inviterID), ActionGroupInvite, GroupResource(groupID)); err != nil {
+		return err
+	}
+
+	// 2. Validation: Ensure the user being added exists
 	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
-		return errors.New("user to be added does not exist")
+		if _, ok := err.(*NotFoundError); ok {
+			return &NotFoundError{Msg: "user to be added does not exist"}
+		}
+		return fmt.Errorf("failed to load user: %w", err)
 	}
 
-	// 2. Validation: Ensure the group exists 
-	if _, err := s.groupRepo.FindByID(ctx, groupID); err != nil { 
-		return errors.New("group does not exist")
+	// 3. Banned users cannot be invited back until the ban expires or is lifted
+	if err := s.ensureNotBanned(ctx, groupID, userID); err != nil {
+		return err
 	}
 
-	// 3. Add member via repository (must create the struct required by the interface)
+	// 4. Add member via repository (must create the struct required by the interface)
 	member := &GroupMember{
 		GroupID: groupID,
 		UserID:  userID,
@@ -76,7 +99,272 @@ func (s *groupService) GetMembers(ctx context.Context, groupID int64) ([]int64,
 	return s.groupRepo.FindMembersByGroupID(ctx, groupID)
 }
 
+// ListMembers retrieves a page of member profiles for a group, tagged with each member's role.
+func (s *groupService) ListMembers(ctx context.Context, groupID, requesterID int64, query string, afterUserID int64, limit int) ([]*GroupMemberProfile, error) {
+	group, err := s.authorizedGroup(ctx, requesterID, ActionGroupView, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > 200 {
+		limit = 50 // Default page size
+	}
+	members, err := s.groupRepo.FindMemberProfiles(ctx, groupID, strings.TrimSpace(query), afterUserID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+
+	for _, m := range members {
+		m.Role = memberRole(group, m)
+	}
+	return members, nil
+}
+
+// memberRole reports whether a member is the group's owner, an admin or a plain member.
+func memberRole(group *Group, m *GroupMemberProfile) string {
+	switch {
+	case m.UserID == group.OwnerID:
+		return RoleOwner
+	case m.IsAdmin:
+		return RoleAdmin
+	default:
+		return RoleMember
+	}
+}
+
 // GetGroupsForUser retrieves all groups for a given user.
 func (s *groupService) GetGroupsForUser(ctx context.Context, userID int64) ([]*Group, error) {
 	return s.groupRepo.FindGroupsByUserID(ctx, userID)
 }
+
+// SetPostingPolicy changes who may post in a group. Only group admins may change it.
+func (s *groupService) SetPostingPolicy(ctx context.Context, groupID, actorID int64, policy PostingPolicy, slowModeSeconds int) (*Group, error) {
+	switch policy {
+	case PostingEveryone, PostingAdminsOnly:
+		slowModeSeconds = 0
+	case PostingSlowMode:
+		if slowModeSeconds <= 0 {
+			return nil, &ValidationError{Msg: "slow_mode_seconds must be greater than zero for slow mode"}
+		}
+	default:
+		return nil, &ValidationError{Msg: fmt.Sprintf("unknown posting policy %q", policy)}
+	}
+
+	group, err := s.authorizedGroup(ctx, actorID, ActionGroupManage, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.groupRepo.UpdatePostingPolicy(ctx, groupID, policy, slowModeSeconds); err != nil {
+		return nil, fmt.Errorf("failed to update posting policy: %w", err)
+	}
+
+	group.PostingPolicy = policy
+	group.SlowModeSeconds = slowModeSeconds
+	return group, nil
+}
+
+// UpdateGroup changes a group's description and/or directory visibility. Only group admins may change them.
+// Nil arguments leave the corresponding field unchanged.
+func (s *groupService) UpdateGroup(ctx context.Context, groupID, actorID int64, description *string, isPublic *bool) (*Group, error) {
+	group, err := s.authorizedGroup(ctx, actorID, ActionGroupManage, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if description != nil {
+		group.Description = *description
+	}
+	if isPublic != nil {
+		group.IsPublic = *isPublic
+	}
+
+	if err := s.groupRepo.UpdateDetails(ctx, groupID, group.Description, group.IsPublic); err != nil {
+		return nil, fmt.Errorf("failed to update group: %w", err)
+	}
+	return group, nil
+}
+
+// SearchDirectory lists public groups whose name or description matches query, with cursor pagination.
+func (s *groupService) SearchDirectory(ctx context.Context, query string, afterID int64, limit int) ([]*GroupDirectoryEntry, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20 // Default page size
+	}
+	return s.groupRepo.SearchPublic(ctx, strings.TrimSpace(query), afterID, limit)
+}
+
+// JoinPublicGroup lets a user add themselves to a public group.
+func (s *groupService) JoinPublicGroup(ctx context.Context, groupID, userID int64) error {
+	// The policy only lets users join public groups they are not banned from.
+	if err := s.authz.Can(ctx, UserSubject(userID), ActionGroupJoin, GroupResource(groupID)); err != nil {
+		return err
+	}
+
+	existing, err := s.groupRepo.FindMember(ctx, groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check group membership: %w", err)
+	}
+	if existing != nil {
+		return &ConflictError{Msg: "user is already a member of this group"}
+	}
+
+	member := &GroupMember{
+		GroupID:  groupID,
+		UserID:   userID,
+		IsAdmin:  false,
+		JoinedAt: time.Now(),
+	}
+	if err := s.groupRepo.AddMember(ctx, member); err != nil {
+		return fmt.Errorf("failed to add user %d to group %d: %w", userID, groupID, err)
+	}
+	return nil
+}
+
+// SetArchived archives (read-only, hidden from recent chats) or unarchives a group. Only group admins may do this.
+func (s *groupService) SetArchived(ctx context.Context, groupID, actorID int64, archived bool) (*Group, error) {
+	group, err := s.authorizedGroup(ctx, actorID, ActionGroupManage, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var archivedAt *time.Time
+	if archived {
+		now := time.Now()
+		archivedAt = &now
+	}
+	if err := s.groupRepo.SetArchivedAt(ctx, groupID, archivedAt); err != nil {
+		return nil, fmt.Errorf("failed to archive group: %w", err)
+	}
+
+	group.ArchivedAt = archivedAt
+	return group, nil
+}
+
+// DeleteGroup permanently deletes a group. Only the group owner may delete it.
+func (s *groupService) DeleteGroup(ctx context.Context, groupID, actorID int64) ([]int64, error) {
+	if err := s.authz.Can(ctx, UserSubject(actorID), ActionGroupDelete, GroupResource(groupID)); err != nil {
+		return nil, err
+	}
+
+	// Capture the members before they are removed so the caller can notify them.
+	memberIDs, err := s.groupRepo.FindMembersByGroupID(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group members: %w", err)
+	}
+
+	if err := s.groupRepo.Delete(ctx, groupID, s.retention); err != nil {
+		return nil, fmt.Errorf("failed to delete group: %w", err)
+	}
+	return memberIDs, nil
+}
+
+// SanctionMember mutes or bans a member. Only admins may do this, only the owner may sanction
+// another admin, and the owner can never be sanctioned. Banning also removes the membership.
+func (s *groupService) SanctionMember(ctx context.Context, groupID, actorID, userID int64, kind SanctionKind, duration time.Duration, reason string) (*GroupSanction, error) {
+	if kind != SanctionMute && kind != SanctionBan {
+		return nil, &ValidationError{Msg: fmt.Sprintf("unknown sanction %q", kind)}
+	}
+	if duration < 0 {
+		return nil, &ValidationError{Msg: "duration cannot be negative"}
+	}
+	if userID == actorID {
+		return nil, &ValidationError{Msg: "you cannot " + string(kind) + " yourself"}
+	}
+
+	group, err := s.authorizedGroup(ctx, actorID, ActionGroupModerate, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if userID == group.OwnerID {
+		return nil, &ForbiddenError{Msg: "the group owner cannot be " + string(kind) + "d"}
+	}
+
+	target, err := s.groupRepo.FindMember(ctx, groupID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check group membership: %w", err)
+	}
+	// Mutes only make sense for members; bans may also pre-emptively block non-members.
+	if target == nil && kind == SanctionMute {
+		return nil, &NotFoundError{Msg: "user is not a member of this group"}
+	}
+	if target != nil && target.IsAdmin && actorID != group.OwnerID {
+		return nil, &ForbiddenError{Msg: "only the group owner can " + string(kind) + " an admin"}
+	}
+
+	sanction := &GroupSanction{
+		GroupID:   groupID,
+		UserID:    userID,
+		Kind:      kind,
+		Reason:    reason,
+		CreatedBy: actorID,
+		CreatedAt: time.Now(),
+	}
+	if duration > 0 {
+		expiresAt := sanction.CreatedAt.Add(duration)
+		sanction.ExpiresAt = &expiresAt
+	}
+
+	if err := s.groupRepo.SaveSanction(ctx, sanction); err != nil {
+		return nil, fmt.Errorf("failed to save %s: %w", kind, err)
+	}
+
+	if kind == SanctionBan && target != nil {
+		if err := s.groupRepo.RemoveMember(ctx, groupID, userID); err != nil {
+			return nil, fmt.Errorf("failed to remove banned user from group: %w", err)
+		}
+	}
+
+	return sanction, nil
+}
+
+// LiftSanction removes a mute or ban before it expires. Only group admins may do this.
+func (s *groupService) LiftSanction(ctx context.Context, groupID, actorID, userID int64, kind SanctionKind) error {
+	if err := s.authz.Can(ctx, UserSubject(actorID), ActionGroupModerate, GroupResource(groupID)); err != nil {
+		return err
+	}
+
+	deleted, err := s.groupRepo.DeleteSanction(ctx, groupID, userID, kind)
+	if err != nil {
+		return fmt.Errorf("failed to lift %s: %w", kind, err)
+	}
+	if !deleted {
+		return &NotFoundError{Msg: "no such " + string(kind) + " in this group"}
+	}
+	return nil
+}
+
+// ListSanctions lists the active mutes or bans of a group. Only group admins may see them.
+func (s *groupService) ListSanctions(ctx context.Context, groupID, actorID int64, kind SanctionKind) ([]*GroupSanction, error) {
+	if err := s.authz.Can(ctx, UserSubject(actorID), ActionGroupModerate, GroupResource(groupID)); err != nil {
+		return nil, err
+	}
+	return s.groupRepo.ListActiveSanctions(ctx, groupID, kind)
+}
+
+// authorizedGroup checks that actorID may perform action on the group and then loads it.
+func (s *groupService) authorizedGroup(ctx context.Context, actorID int64, action Action, groupID int64) (*Group, error) {
+	if err := s.authz.Can(ctx, UserSubject(actorID), action, GroupResource(groupID)); err != nil {
+		return nil, err
+	}
+
+	group, err := s.groupRepo.FindByID(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group: %w", err)
+	}
+	if group == nil {
+		return nil, &NotFoundError{Msg: "group not found"}
+	}
+	return group, nil
+}
+
+// ensureNotBanned returns a ForbiddenError if the user has an active ban in the group.
+func (s *groupService) ensureNotBanned(ctx context.Context, groupID, userID int64) error {
+	ban, err := s.groupRepo.FindActiveSanction(ctx, groupID, userID, SanctionBan)
+	if err != nil {
+		return fmt.Errorf("failed to check ban status: %w", err)
+	}
+	if ban != nil {
+		return &ForbiddenError{Msg: "user is banned from this group"}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ExternalIdentity is what an OpenID Connect provider asserts about a user after login.
+type ExternalIdentity struct {
+	Issuer            string
+	Subject           string // Stable, provider-unique user ID (the 'sub' claim)
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// UserIdentity links a provider subject to a local user.
+type UserIdentity struct {
+	Provider  string    `db:"provider"` // The provider's issuer URL
+	Subject   string    `db:"subject"`
+	UserID    int64     `db:"user_id"`
+	Email     string    `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// OIDCLoginState is the server-side half of an in-flight authorization code + PKCE login.
+// It is looked up by the hash of the 'state' parameter and can be used once.
+type OIDCLoginState struct {
+	StateHash    string    `db:"state_hash"`
+	Nonce        string    `db:"nonce"`
+	CodeVerifier string    `db:"code_verifier"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+// ---------------------------------------------
+// OIDC INTERFACES
+// ---------------------------------------------
+
+// IdentityProvider is an OpenID Connect provider. The implementation lives in 'ports/oidc'.
+type IdentityProvider interface {
+	Issuer() string
+	// AuthCodeURL returns the provider URL the user is sent to, with a S256 PKCE challenge.
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems the authorization code and returns the identity from the verified ID token.
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error)
+}
+
+// OIDCService implements single sign-on through an IdentityProvider.
+type OIDCService interface {
+	// BeginLogin starts a login and returns the provider URL to redirect the user to.
+	BeginLogin(ctx context.Context) (string, error)
+	// CompleteLogin handles the provider callback and returns the local user, linking or
+	// creating it on first login.
+	CompleteLogin(ctx context.Context, state, code string) (*User, error)
+}
+
+// IdentityRepository defines the data access operations for external identities and OIDC login state.
+type IdentityRepository interface {
+	FindIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	LinkIdentity(ctx context.Context, identity *UserIdentity) error
+
+	SaveLoginState(ctx context.Context, state *OIDCLoginState) error
+	// ConsumeLoginState deletes and returns a login state, or nil if it does not exist.
+	ConsumeLoginState(ctx context.Context, stateHash string) (*OIDCLoginState, error)
+	// DeleteExpiredLoginStates removes the logins abandoned before now and returns how many.
+	DeleteExpiredLoginStates(ctx context.Context, now time.Time) (int64, error)
+}
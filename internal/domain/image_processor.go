@@ -0,0 +1,216 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Emmanuel326/chatserver/pkg/imaging"
+)
+
+// thumbnailQuality is the JPEG quality of opaque thumbnails; others are stored as PNG.
+const thumbnailQuality = 80
+
+// ImageSettings configures image processing.
+type ImageSettings struct {
+	Workers        int   // Images processed concurrently
+	QueueSize      int   // Images waiting beyond this are dropped and picked up on the next send
+	ThumbnailSizes []int // Bounding squares, in pixels
+	MaxPixels      int   // Larger images only get their dimensions recorded, to bound memory use
+}
+
+// ImageProcessor generates thumbnails and metadata for image uploads in a bounded pool of
+// workers, off the request and Hub goroutines.
+type ImageProcessor interface {
+	// Enqueue schedules an upload for processing without blocking. It reports false if the
+	// queue is full; the upload is then processed the next time it is sent.
+	Enqueue(mediaID string) bool
+	// Run starts the workers and blocks until Stop is called.
+	Run()
+	Stop()
+}
+
+// imageProcessor is the concrete implementation of the ImageProcessor interface.
+type imageProcessor struct {
+	mediaRepo   MediaRepository
+	messageRepo MessageRepository
+	store       MediaStore
+	settings    ImageSettings
+
+	jobs    chan string
+	quit    chan struct{}
+	pending sync.Map // media IDs queued or being processed
+}
+
+// NewImageProcessor creates a new ImageProcessor; call Run to start it.
+func NewImageProcessor(mediaRepo MediaRepository, messageRepo MessageRepository, store MediaStore, settings ImageSettings) ImageProcessor {
+	settings.Workers = max(settings.Workers, 1)
+	settings.ThumbnailSizes = append([]int(nil), settings.ThumbnailSizes...)
+	sort.Sort(sort.Reverse(sort.IntSlice(settings.ThumbnailSizes)))
+	return &imageProcessor{
+		mediaRepo:   mediaRepo,
+		messageRepo: messageRepo,
+		store:       store,
+		settings:    settings,
+		jobs:        make(chan string, max(settings.QueueSize, 1)),
+		quit:        make(chan struct{}),
+	}
+}
+
+func (p *imageProcessor) Enqueue(mediaID string) bool {
+	if _, queued := p.pending.LoadOrStore(mediaID, struct{}{}); queued {
+		return true
+	}
+	select {
+	case p.jobs <- mediaID:
+		return true
+	default:
+		p.pending.Delete(mediaID)
+		return false
+	}
+}
+
+func (p *imageProcessor) Run() {
+	var wg sync.WaitGroup
+	for i := 0; i < p.settings.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-p.quit:
+					return
+				case mediaID := <-p.jobs:
+					if err := p.process(context.Background(), mediaID); err != nil {
+						log.Printf("Failed to process image %s: %v", mediaID, err)
+					}
+					p.pending.Delete(mediaID)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *imageProcessor) Stop() {
+	close(p.quit)
+}
+
+// process records the dimensions, a blurhash and thumbnails of an image on the upload and on
+// the messages carrying it. Location data was already stripped when the upload completed.
+func (p *imageProcessor) process(ctx context.Context, mediaID string) error {
+	media, err := p.mediaRepo.FindByID(ctx, mediaID)
+	if err != nil {
+		return fmt.Errorf("failed to load upload: %w", err)
+	}
+	if media == nil || media.Status != MediaReady || !strings.HasPrefix(media.ContentType, "image/") {
+		return nil
+	}
+	if media.Image != nil {
+		// Processed already; catch up messages saved while that was running.
+		return p.messageRepo.UpdateImageInfo(ctx, media.ID, media.Image)
+	}
+
+	content, err := p.store.Open(ctx, media.StorageKey())
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(content, media.Size))
+	content.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// A format the standard library cannot decode (e.g. WebP): keep it as it is.
+		return nil
+	}
+	orientation := imaging.Orientation(data)
+	info := &ImageInfo{Width: config.Width, Height: config.Height}
+	if orientation >= 5 {
+		info.Width, info.Height = config.Height, config.Width
+	}
+
+	if config.Width*config.Height <= p.settings.MaxPixels {
+		decoded, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to decode image: %w", err)
+		}
+		if err := p.thumbnails(ctx, media.ID, imaging.ToRGBA(decoded), orientation, info); err != nil {
+			return err
+		}
+	}
+
+	if err := p.mediaRepo.SetImageInfo(ctx, media.ID, info); err != nil {
+		return fmt.Errorf("failed to save image metadata: %w", err)
+	}
+	return p.messageRepo.UpdateImageInfo(ctx, media.ID, info)
+}
+
+// thumbnails stores a thumbnail per configured size, each scaled from the next larger one,
+// and computes the blurhash from the smallest. Sizes the image already fits are skipped,
+// except the smallest, so every image gets at least one.
+func (p *imageProcessor) thumbnails(ctx context.Context, mediaID string, img *image.RGBA, orientation int, info *ImageInfo) error {
+	source := img
+	var smallest *image.RGBA
+	for i, size := range p.settings.ThumbnailSizes {
+		width, height := source.Bounds().Dx(), source.Bounds().Dy()
+		last := i == len(p.settings.ThumbnailSizes)-1
+		if size >= max(img.Bounds().Dx(), img.Bounds().Dy()) && !last {
+			continue
+		}
+
+		scaledWidth, scaledHeight := imaging.FitSize(width, height, size)
+		scaled := imaging.Resize(source, scaledWidth, scaledHeight)
+		source = scaled
+		thumb := imaging.Orient(scaled, orientation)
+		smallest = thumb
+
+		var buf bytes.Buffer
+		contentType := "image/jpeg"
+		if thumb.Opaque() {
+			err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailQuality})
+			if err != nil {
+				return fmt.Errorf("failed to encode thumbnail: %w", err)
+			}
+		} else {
+			contentType = "image/png"
+			if err := png.Encode(&buf, thumb); err != nil {
+				return fmt.Errorf("failed to encode thumbnail: %w", err)
+			}
+		}
+		if _, err := p.store.Put(ctx, ThumbnailKey(mediaID, size), &buf); err != nil {
+			return fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+
+		info.Thumbnails = append(info.Thumbnails, Thumbnail{
+			Size:        size,
+			Width:       thumb.Bounds().Dx(),
+			Height:      thumb.Bounds().Dy(),
+			ContentType: contentType,
+			URL:         ThumbnailURL(mediaID, size),
+		})
+	}
+
+	// Smallest first, as clients pick the first that is large enough.
+	sort.Slice(info.Thumbnails, func(i, j int) bool { return info.Thumbnails[i].Size < info.Thumbnails[j].Size })
+
+	if smallest != nil {
+		xComponents, yComponents := 4, 3
+		if info.Height > info.Width {
+			xComponents, yComponents = 3, 4
+		}
+		info.Blurhash = imaging.Blurhash(smallest, xComponents, yComponents)
+	}
+	return nil
+}
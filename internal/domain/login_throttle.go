@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// LoginThrottle is the failed-login state for one account or one client IP.
+type LoginThrottle struct {
+	Key           string     `db:"key"` // "account:<email>" or "ip:<address>"
+	Failures      int        `db:"failures"`
+	LastFailureAt time.Time  `db:"last_failure_at"`
+	BlockedUntil  *time.Time `db:"blocked_until"`
+}
+
+// LoginFailure is an audit record of a rejected login attempt.
+type LoginFailure struct {
+	ID        int64     `json:"id" db:"id"`
+	Email     string    `json:"email" db:"email"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	Reason    string    `json:"reason" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Reasons recorded for failed logins.
+const (
+	LoginFailureInvalidCredentials = "invalid_credentials"
+	LoginFailureInvalidCode        = "invalid_code" // Wrong TOTP or recovery code at the second login step
+	LoginFailureThrottled          = "throttled"
+)
+
+// LoginAttempt is a login step reserved with LoginThrottleService.Reserve.
+type LoginAttempt struct {
+	Email     string // Empty when the step is not tied to a known account
+	IPAddress string
+	UserAgent string
+}
+
+// LoginResult is how a reserved login step ended.
+type LoginResult int
+
+const (
+	// LoginRejectedPassword and LoginRejectedCode keep the attempt counted as a failure.
+	LoginRejectedPassword LoginResult = iota
+	LoginRejectedCode
+	// LoginInterrupted means the credential was not rejected but no session was started: a
+	// second factor is still needed, the account is disabled or the server failed. The attempt
+	// is not counted, and the account's earlier failures are kept.
+	LoginInterrupted
+	// LoginSucceeded means a session was started; the account's failures are cleared.
+	LoginSucceeded
+)
+
+// LoginThrottleSettings configures backoff and lockout (see config.Config).
+type LoginThrottleSettings struct {
+	FailureWindow      time.Duration // Failures older than this are forgotten
+	BackoffThreshold   int           // Account failures allowed before backoff starts
+	IPBackoffThreshold int           // Failures from one IP allowed before backoff starts (higher, for shared NATs)
+	BackoffBase        time.Duration // Delay after the first failure past the threshold; doubles each time
+	LockoutThreshold   int           // Account failures that lock the account for LockoutDuration
+	IPLockoutThreshold int           // Failures from one IP (any account) that lock the IP out
+	LockoutDuration    time.Duration // Also the cap for backoff delays
+	AuditRetention     time.Duration // How long failed attempts are kept in the audit trail
+}
+
+// RateLimitedError is returned when a client must wait before trying again.
+type RateLimitedError struct {
+	Msg     string
+	RetryAt time.Time
+}
+
+func (e *RateLimitedError) Error() string { return "Rate Limited: " + e.Msg }
+
+// RetryAfter returns the whole seconds until RetryAt, rounded up (for the Retry-After header).
+func (e *RateLimitedError) RetryAfter() int {
+	return int(math.Ceil(time.Until(e.RetryAt).Seconds()))
+}
+
+// ---------------------------------------------
+// LOGIN THROTTLE INTERFACES
+// ---------------------------------------------
+
+// LoginThrottleService slows down password and second-factor guessing per account and per client IP.
+type LoginThrottleService interface {
+	// Reserve returns a *RateLimitedError if the account or IP is currently blocked. Otherwise it
+	// counts the attempt as a failure against both before the credential is checked, so
+	// concurrent guesses cannot all slip past the limits; Settle takes it back if it was not one.
+	// Blocked attempts cost no bcrypt work.
+	Reserve(ctx context.Context, email, ipAddress, userAgent string) (*LoginAttempt, error)
+	// Settle records how a reserved attempt ended, auditing rejected credentials.
+	Settle(ctx context.Context, attempt *LoginAttempt, result LoginResult) error
+	// PurgeExpired deletes the throttles whose failures are all forgotten and the audit records
+	// older than AuditRetention, returning how many rows were removed.
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// LoginThrottleRepository defines the data access operations for login throttling and its audit trail.
+type LoginThrottleRepository interface {
+	FindThrottle(ctx context.Context, key string) (*LoginThrottle, error)
+	SaveThrottle(ctx context.Context, throttle *LoginThrottle) error
+	DeleteThrottle(ctx context.Context, key string) error
+	// DeleteStaleThrottles removes the throttles whose last failure was before lastFailureBefore
+	// and that are not blocked at now.
+	DeleteStaleThrottles(ctx context.Context, lastFailureBefore, now time.Time) (int64, error)
+	SaveLoginFailure(ctx context.Context, failure *LoginFailure) error
+	// DeleteLoginFailures removes the audit records created before cutoff.
+	DeleteLoginFailures(ctx context.Context, cutoff time.Time) (int64, error)
+}
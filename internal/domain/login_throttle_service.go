@@ -0,0 +1,213 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loginThrottleService is the concrete implementation of the LoginThrottleService interface.
+type loginThrottleService struct {
+	repo     LoginThrottleRepository
+	settings LoginThrottleSettings
+	// mu serializes read-modify-write updates of the counters
+	mu sync.Mutex
+}
+
+// NewLoginThrottleService creates a new LoginThrottleService.
+func NewLoginThrottleService(repo LoginThrottleRepository, settings LoginThrottleSettings) LoginThrottleService {
+	return &loginThrottleService{repo: repo, settings: settings}
+}
+
+// Reserve rejects attempts while the account or the IP is blocked, then counts the attempt
+// against both before the caller checks the credential. Rejected attempts are audited but do
+// not extend the block.
+func (s *loginThrottleService) Reserve(ctx context.Context, email, ipAddress, userAgent string) (*LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := &LoginAttempt{Email: strings.ToLower(strings.TrimSpace(email)), IPAddress: ipAddress, UserAgent: userAgent}
+	keys := attempt.throttleKeys()
+	now := time.Now()
+	throttles := make([]*LoginThrottle, len(keys))
+	for i, key := range keys {
+		throttle, err := s.repo.FindThrottle(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load login throttle: %w", err)
+		}
+		if throttle != nil && throttle.BlockedUntil != nil && now.Before(*throttle.BlockedUntil) {
+			s.audit(ctx, attempt, LoginFailureThrottled)
+			msg := "too many failed login attempts, try again later"
+			if s.isLockedOut(key, throttle.Failures) {
+				msg = "temporarily locked after too many failed login attempts"
+			}
+			return nil, &RateLimitedError{Msg: msg, RetryAt: *throttle.BlockedUntil}
+		}
+		throttles[i] = throttle
+	}
+
+	for i, key := range keys {
+		throttle := throttles[i]
+		if throttle == nil || now.Sub(throttle.LastFailureAt) > s.settings.FailureWindow {
+			throttle = &LoginThrottle{Key: key}
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		s.block(throttle)
+		if err := s.repo.SaveThrottle(ctx, throttle); err != nil {
+			return nil, fmt.Errorf("failed to save login throttle: %w", err)
+		}
+	}
+	return attempt, nil
+}
+
+// Settle keeps rejected attempts counted and audits them. Interrupted attempts are taken back
+// from both counters. A successful login takes back the IP reservation and clears the account
+// counter; the rest of the IP counter is kept, so one valid account cannot be used to reset the
+// budget for guessing others.
+func (s *loginThrottleService) Settle(ctx context.Context, attempt *LoginAttempt, result LoginResult) error {
+	switch result {
+	case LoginRejectedPassword:
+		s.audit(ctx, attempt, LoginFailureInvalidCredentials)
+		return nil
+	case LoginRejectedCode:
+		s.audit(ctx, attempt, LoginFailureInvalidCode)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range attempt.throttleKeys() {
+		if result == LoginSucceeded && !isIPThrottleKey(key) {
+			if err := s.repo.DeleteThrottle(ctx, key); err != nil {
+				return fmt.Errorf("failed to clear login throttle: %w", err)
+			}
+			continue
+		}
+		if err := s.release(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeExpired deletes throttles past their failure window that are no longer blocking, and
+// audit records past the retention period.
+func (s *loginThrottleService) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	throttles, err := s.repo.DeleteStaleThrottles(ctx, now.Add(-s.settings.FailureWindow), now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge login throttles: %w", err)
+	}
+	if s.settings.AuditRetention <= 0 {
+		return throttles, nil
+	}
+	failures, err := s.repo.DeleteLoginFailures(ctx, now.Add(-s.settings.AuditRetention))
+	if err != nil {
+		return throttles, fmt.Errorf("failed to purge login failures: %w", err)
+	}
+	return throttles + failures, nil
+}
+
+// release takes one reserved failure back from a counter and recomputes its block.
+func (s *loginThrottleService) release(ctx context.Context, key string) error {
+	throttle, err := s.repo.FindThrottle(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to load login throttle: %w", err)
+	}
+	if throttle == nil {
+		return nil
+	}
+	if throttle.Failures <= 1 {
+		if err := s.repo.DeleteThrottle(ctx, key); err != nil {
+			return fmt.Errorf("failed to clear login throttle: %w", err)
+		}
+		return nil
+	}
+	throttle.Failures--
+	s.block(throttle)
+	if err := s.repo.SaveThrottle(ctx, throttle); err != nil {
+		return fmt.Errorf("failed to save login throttle: %w", err)
+	}
+	return nil
+}
+
+// block sets BlockedUntil from the last failure and the current failure count.
+func (s *loginThrottleService) block(throttle *LoginThrottle) {
+	throttle.BlockedUntil = nil
+	if delay := s.delay(throttle.Key, throttle.Failures); delay > 0 {
+		blockedUntil := throttle.LastFailureAt.Add(delay)
+		throttle.BlockedUntil = &blockedUntil
+	}
+}
+
+// delay returns how long to block after the given number of failures: nothing up to the
+// backoff threshold, then BackoffBase doubling per failure, and the full lockout once the
+// lockout threshold is reached.
+func (s *loginThrottleService) delay(key string, failures int) time.Duration {
+	if s.isLockedOut(key, failures) {
+		return s.settings.LockoutDuration
+	}
+	threshold := s.settings.BackoffThreshold
+	if isIPThrottleKey(key) {
+		threshold = s.settings.IPBackoffThreshold
+	}
+	if failures <= threshold {
+		return 0
+	}
+
+	delay := s.settings.BackoffBase
+	for i := threshold + 1; i < failures && delay < s.settings.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > s.settings.LockoutDuration {
+		delay = s.settings.LockoutDuration
+	}
+	return delay
+}
+
+// isLockedOut reports whether the failure count reaches the key's lockout threshold (0 disables lockout).
+func (s *loginThrottleService) isLockedOut(key string, failures int) bool {
+	threshold := s.settings.LockoutThreshold
+	if isIPThrottleKey(key) {
+		threshold = s.settings.IPLockoutThreshold
+	}
+	return threshold > 0 && failures >= threshold
+}
+
+// audit records a failed attempt; errors are only logged so auditing never blocks logins.
+func (s *loginThrottleService) audit(ctx context.Context, attempt *LoginAttempt, reason string) {
+	failure := &LoginFailure{
+		Email:     attempt.Email,
+		IPAddress: attempt.IPAddress,
+		UserAgent: truncate(attempt.UserAgent, maxDeviceFieldLength),
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.SaveLoginFailure(ctx, failure); err != nil {
+		log.Printf("Failed to audit login failure for %s from %s: %v", attempt.Email, attempt.IPAddress, err)
+	}
+}
+
+// throttleKeys returns the counters the attempt is charged to: the account, when known, and the IP.
+func (a *LoginAttempt) throttleKeys() []string {
+	if a.Email == "" {
+		return []string{ipThrottleKey(a.IPAddress)}
+	}
+	return []string{accountThrottleKey(a.Email), ipThrottleKey(a.IPAddress)}
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
+
+func isIPThrottleKey(key string) bool {
+	return strings.HasPrefix(key, "ip:")
+}
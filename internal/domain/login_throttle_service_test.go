@@ -0,0 +1,236 @@
+package domain
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLoginThrottleRepo keeps throttles and audit records in memory.
+type fakeLoginThrottleRepo struct {
+	LoginThrottleRepository
+	mu        sync.Mutex
+	throttles map[string]LoginThrottle
+	failures  []*LoginFailure
+}
+
+func newFakeLoginThrottleRepo() *fakeLoginThrottleRepo {
+	return &fakeLoginThrottleRepo{throttles: make(map[string]LoginThrottle)}
+}
+
+func (f *fakeLoginThrottleRepo) FindThrottle(ctx context.Context, key string) (*LoginThrottle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	throttle, ok := f.throttles[key]
+	if !ok {
+		return nil, nil
+	}
+	return &throttle, nil
+}
+
+func (f *fakeLoginThrottleRepo) SaveThrottle(ctx context.Context, throttle *LoginThrottle) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.throttles[throttle.Key] = *throttle
+	return nil
+}
+
+func (f *fakeLoginThrottleRepo) DeleteThrottle(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.throttles, key)
+	return nil
+}
+
+func (f *fakeLoginThrottleRepo) SaveLoginFailure(ctx context.Context, failure *LoginFailure) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, failure)
+	return nil
+}
+
+// failureCount returns the failures counted for a key, 0 if it has none.
+func (f *fakeLoginThrottleRepo) failureCount(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.throttles[key].Failures
+}
+
+var testThrottleSettings = LoginThrottleSettings{
+	FailureWindow:      15 * time.Minute,
+	BackoffThreshold:   3,
+	IPBackoffThreshold: 20,
+	BackoffBase:        time.Second,
+	LockoutThreshold:   10,
+	IPLockoutThreshold: 50,
+	LockoutDuration:    15 * time.Minute,
+}
+
+func TestLoginThrottleDelay(t *testing.T) {
+	noLockout := testThrottleSettings
+	noLockout.LockoutThreshold = 0
+
+	tests := []struct {
+		name     string
+		settings LoginThrottleSettings
+		key      string
+		failures int
+		want     time.Duration
+	}{
+		{"account below threshold", testThrottleSettings, accountThrottleKey("a@example.com"), 3, 0},
+		{"account first backoff", testThrottleSettings, accountThrottleKey("a@example.com"), 4, time.Second},
+		{"account doubles", testThrottleSettings, accountThrottleKey("a@example.com"), 6, 4 * time.Second},
+		{"account before lockout", testThrottleSettings, accountThrottleKey("a@example.com"), 9, 32 * time.Second},
+		{"account lockout", testThrottleSettings, accountThrottleKey("a@example.com"), 10, 15 * time.Minute},
+		{"capped without lockout", noLockout, accountThrottleKey("a@example.com"), 30, 15 * time.Minute},
+		{"ip below threshold", testThrottleSettings, ipThrottleKey("192.0.2.1"), 20, 0},
+		{"ip first backoff", testThrottleSettings, ipThrottleKey("192.0.2.1"), 21, time.Second},
+		{"ip lockout", testThrottleSettings, ipThrottleKey("192.0.2.1"), 50, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &loginThrottleService{settings: tt.settings}
+			if got := s.delay(tt.key, tt.failures); got != tt.want {
+				t.Errorf("delay(%q, %d) = %v, want %v", tt.key, tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleIsLockedOut(t *testing.T) {
+	noLockout := testThrottleSettings
+	noLockout.LockoutThreshold = 0
+	noLockout.IPLockoutThreshold = 0
+
+	tests := []struct {
+		name     string
+		settings LoginThrottleSettings
+		key      string
+		failures int
+		want     bool
+	}{
+		{"account below threshold", testThrottleSettings, accountThrottleKey("a@example.com"), 9, false},
+		{"account at threshold", testThrottleSettings, accountThrottleKey("a@example.com"), 10, true},
+		{"ip uses its own threshold", testThrottleSettings, ipThrottleKey("192.0.2.1"), 10, false},
+		{"ip at threshold", testThrottleSettings, ipThrottleKey("192.0.2.1"), 50, true},
+		{"disabled", noLockout, accountThrottleKey("a@example.com"), 1000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &loginThrottleService{settings: tt.settings}
+			if got := s.isLockedOut(tt.key, tt.failures); got != tt.want {
+				t.Errorf("isLockedOut(%q, %d) = %v, want %v", tt.key, tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReserveCountsConcurrentAttempts(t *testing.T) {
+	repo := newFakeLoginThrottleRepo()
+	service := NewLoginThrottleService(repo, testThrottleSettings)
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved, limited := 0, 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.Reserve(context.Background(), "a@example.com", "192.0.2.1", "test")
+			mu.Lock()
+			defer mu.Unlock()
+			switch err.(type) {
+			case nil:
+				reserved++
+			case *RateLimitedError:
+				limited++
+			default:
+				t.Errorf("Reserve returned %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The attempt that crosses the backoff threshold blocks all the others, even though none
+	// of them has been settled yet.
+	if want := testThrottleSettings.BackoffThreshold + 1; reserved != want || limited != attempts-want {
+		t.Errorf("reserved %d and limited %d attempts, want %d and %d", reserved, limited, want, attempts-want)
+	}
+}
+
+func TestSettleOnlyResetsTheAccountAfterACompletedLogin(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeLoginThrottleRepo()
+	settings := testThrottleSettings
+	settings.BackoffThreshold = 5
+	service := NewLoginThrottleService(repo, settings)
+	account, ip := accountThrottleKey("a@example.com"), ipThrottleKey("192.0.2.1")
+
+	step := func(result LoginResult) {
+		t.Helper()
+		attempt, err := service.Reserve(ctx, "A@example.com ", "192.0.2.1", "test")
+		if err != nil {
+			t.Fatalf("Reserve returned %v", err)
+		}
+		if err := service.Settle(ctx, attempt, result); err != nil {
+			t.Fatalf("Settle returned %v", err)
+		}
+	}
+
+	step(LoginRejectedPassword)
+	step(LoginRejectedPassword)
+	// A correct password that still needs a code neither counts nor clears earlier failures
+	step(LoginInterrupted)
+	if got := repo.failureCount(account); got != 2 {
+		t.Fatalf("account failures after the password step = %d, want 2", got)
+	}
+	step(LoginRejectedCode)
+	if got := repo.failureCount(account); got != 3 {
+		t.Fatalf("account failures after a wrong code = %d, want 3", got)
+	}
+
+	step(LoginSucceeded)
+	if got := repo.failureCount(account); got != 0 {
+		t.Errorf("account failures after a completed login = %d, want 0", got)
+	}
+	if got := repo.failureCount(ip); got != 3 {
+		t.Errorf("ip failures after a completed login = %d, want 3", got)
+	}
+
+	reasons := make([]string, 0, len(repo.failures))
+	for _, failure := range repo.failures {
+		if failure.Email != "a@example.com" {
+			t.Errorf("audited email %q, want it normalized", failure.Email)
+		}
+		reasons = append(reasons, failure.Reason)
+	}
+	want := []string{LoginFailureInvalidCredentials, LoginFailureInvalidCredentials, LoginFailureInvalidCode}
+	if len(reasons) != len(want) || reasons[0] != want[0] || reasons[1] != want[1] || reasons[2] != want[2] {
+		t.Errorf("audited reasons %v, want %v", reasons, want)
+	}
+}
+
+func TestSettleInterruptedLiftsTheReservedBlock(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeLoginThrottleRepo()
+	service := NewLoginThrottleService(repo, testThrottleSettings)
+
+	for i := 0; i < testThrottleSettings.BackoffThreshold; i++ {
+		if _, err := service.Reserve(ctx, "a@example.com", "192.0.2.1", "test"); err != nil {
+			t.Fatalf("Reserve %d returned %v", i, err)
+		}
+	}
+	// This reservation crosses the threshold and blocks the account until it is settled
+	attempt, err := service.Reserve(ctx, "a@example.com", "192.0.2.1", "test")
+	if err != nil {
+		t.Fatalf("Reserve returned %v", err)
+	}
+	if err := service.Settle(ctx, attempt, LoginInterrupted); err != nil {
+		t.Fatalf("Settle returned %v", err)
+	}
+	if _, err := service.Reserve(ctx, "a@example.com", "192.0.2.1", "test"); err != nil {
+		t.Errorf("Reserve after an interrupted attempt returned %v, want no block", err)
+	}
+}
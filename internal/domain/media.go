@@ -0,0 +1,306 @@
+package domain
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+)
+
+// MediaStatus tracks an upload from its first byte to being attachable to messages.
+type MediaStatus string
+
+const (
+	// MediaUploading is a resumable upload that has not received all of its bytes yet.
+	MediaUploading MediaStatus = "uploading"
+	// MediaScanning is a complete upload quarantined until the malware scan has cleared it.
+	MediaScanning MediaStatus = "scanning"
+	// MediaReady is a complete, type-checked upload that can be attached and downloaded.
+	MediaReady MediaStatus = "ready"
+	// MediaRejected is an upload the malware scan found a threat in; it stays quarantined until deleted.
+	MediaRejected MediaStatus = "rejected"
+)
+
+// Media is a file uploaded by a user. Its ID is random; once complete, its bytes are stored
+// under their SHA-256, shared with every identical upload (see StorageKey).
+type Media struct {
+	ID            string      `json:"id" db:"id"`
+	OwnerID       int64       `json:"owner_id" db:"owner_id"`
+	Filename      string      `json:"filename" db:"filename"`
+	ContentType   string      `json:"content_type" db:"content_type"` // Sniffed from the content, never taken from the client
+	Size          int64       `json:"size" db:"size"`                 // Total size; declared up front for resumable uploads
+	ReceivedBytes int64       `json:"received_bytes" db:"received_bytes"`
+	Status        MediaStatus `json:"status" db:"status"`
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+	CompletedAt   *time.Time  `json:"completed_at,omitempty" db:"completed_at"`
+	SHA256        string      `json:"sha256,omitempty" db:"sha256"`           // Hex digest of the stored bytes, set on completion
+	ScanResult    string      `json:"scan_result,omitempty" db:"scan_result"` // Threat found by the malware scan
+	Image         *ImageInfo  `json:"image,omitempty" db:"image"`             // Set once an image has been processed
+	URL           string      `json:"url" db:"-"`                             // Download path, filled in by the service
+}
+
+// ImageInfo describes a processed image upload so that clients can lay out a timeline, and show
+// a placeholder, before downloading anything. Width and Height are as displayed (EXIF orientation applied).
+type ImageInfo struct {
+	Width      int         `json:"width"`
+	Height     int         `json:"height"`
+	Blurhash   string      `json:"blurhash,omitempty"`
+	Thumbnails []Thumbnail `json:"thumbnails,omitempty"`
+}
+
+// Thumbnail is a downscaled copy of an image upload, fitting a Size×Size square.
+type Thumbnail struct {
+	Size        int    `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
+}
+
+// Value implements driver.Valuer; the metadata is stored as JSON.
+func (i ImageInfo) Value() (driver.Value, error) {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (i *ImageInfo) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), i)
+	case []byte:
+		return json.Unmarshal(v, i)
+	default:
+		return fmt.Errorf("cannot scan %T into ImageInfo", src)
+	}
+}
+
+// StorageKey is the MediaStore key of the upload's bytes: the content hash once it is complete.
+// Unfinished uploads, and ones stored before content addressing, are kept under their ID.
+func (m *Media) StorageKey() string {
+	if m.SHA256 != "" {
+		return m.SHA256
+	}
+	return m.ID
+}
+
+// ThumbnailKey is the MediaStore key of an upload's thumbnail of the given size.
+func ThumbnailKey(mediaID string, size int) string {
+	return fmt.Sprintf("%s_%d", mediaID, size)
+}
+
+// ThumbnailURL returns the authenticated download path of a thumbnail.
+func ThumbnailURL(mediaID string, size int) string {
+	return fmt.Sprintf("%s/thumbnails/%d", MediaURL(mediaID), size)
+}
+
+// Thumbnail returns the thumbnail of the given size, or nil if there is none.
+func (m *Media) Thumbnail(size int) *Thumbnail {
+	if m.Image == nil {
+		return nil
+	}
+	for i := range m.Image.Thumbnails {
+		if m.Image.Thumbnails[i].Size == size {
+			return &m.Image.Thumbnails[i]
+		}
+	}
+	return nil
+}
+
+// MediaURL returns the authenticated download path of an upload; it is what messages carry in media_url.
+func MediaURL(mediaID string) string {
+	return "/v1/media/" + mediaID
+}
+
+// ContentDisposition is how the upload is served: images, audio and video inline, everything
+// else as an attachment so browsers never render it.
+func (m *Media) ContentDisposition() string {
+	disposition := "attachment"
+	for _, inline := range []string{"image/", "audio/", "video/"} {
+		if strings.HasPrefix(m.ContentType, inline) {
+			disposition = "inline"
+		}
+	}
+	if m.Filename == "" {
+		return disposition
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": m.Filename})
+}
+
+// MediaTooLargeError is returned when an upload exceeds the configured size limit.
+type MediaTooLargeError struct {
+	Limit int64 // bytes
+}
+
+func (e *MediaTooLargeError) Error() string {
+	return fmt.Sprintf("upload exceeds the %d byte limit", e.Limit)
+}
+
+// Storage quota scopes reported by QuotaExceededError.
+const (
+	UserQuota  = "user"
+	GroupQuota = "group"
+)
+
+// QuotaExceededError is returned when an upload, or sending one to a group, would take the
+// user's or the group's stored media past its quota.
+type QuotaExceededError struct {
+	Scope string // UserQuota or GroupQuota
+	Limit int64  // bytes
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s storage quota of %d bytes exceeded", e.Scope, e.Limit)
+}
+
+// StorageQuotas caps stored media in bytes; zero means unlimited. A user's uploads count
+// towards their quota, and the uploads sent to a group count towards the group's, whether
+// or not the bytes are shared with identical files.
+type StorageQuotas struct {
+	UserBytes  int64
+	GroupBytes int64
+}
+
+// StorageUsage is how much of their quota a user's uploads take up.
+type StorageUsage struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	QuotaBytes int64 `json:"quota_bytes"` // 0 when unlimited
+	Files      int   `json:"files"`
+}
+
+// MediaSettings configures upload limits.
+type MediaSettings struct {
+	MaxUploadBytes int64
+	// AllowedTypes lists the sniffed content types that may be uploaded; "image/*" matches a whole family.
+	AllowedTypes []string
+	// PresignExpiry is how long pre-signed upload and download URLs stay valid.
+	PresignExpiry time.Duration
+	// OrphanTTL is how long unfinished uploads, and uploads never sent in a message, are kept.
+	// Stored files no upload refers to any more are kept as long before they are deleted.
+	OrphanTTL time.Duration
+	Quotas    StorageQuotas
+	// ScanUploads quarantines completed uploads until the malware scan has cleared them.
+	ScanUploads bool
+}
+
+// ErrMediaNotStored is returned by MediaStore implementations for keys they hold no object for.
+var ErrMediaNotStored = errors.New("media object not found")
+
+// MediaStore keeps the bytes of uploads: complete ones under their content hash, others under
+// their media ID. Implementations live in ports/media.
+type MediaStore interface {
+	// Put stores everything read from r under key and returns the number of bytes written.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Append writes r into the object at offset, discarding anything stored past offset,
+	// and returns the object's new size. Resumable uploads are assembled with it.
+	Append(ctx context.Context, key string, offset int64, r io.Reader) (int64, error)
+	// Complete is called once every byte of an appended object has arrived; stores that
+	// assemble appends elsewhere move the object into place.
+	Complete(ctx context.Context, key string) error
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Stat returns the size of the stored object, or ErrMediaNotStored.
+	Stat(ctx context.Context, key string) (int64, error)
+	// Rename moves an object to another key, replacing any object stored there.
+	Rename(ctx context.Context, from, to string) error
+	Delete(ctx context.Context, key string) error
+}
+
+// MediaPresigner is implemented by stores that can hand out time-limited URLs, so that large
+// files travel between clients and the store without passing through the server.
+type MediaPresigner interface {
+	// PresignPut returns a URL accepting a single PUT of exactly size bytes.
+	PresignPut(ctx context.Context, key string, size int64, expires time.Duration) (string, error)
+	// PresignGet returns a download URL; the store serves it with the given content type and disposition.
+	PresignGet(ctx context.Context, key string, contentType, disposition string, expires time.Duration) (string, error)
+}
+
+// MediaRepository stores upload metadata.
+type MediaRepository interface {
+	Create(ctx context.Context, media *Media) error
+	// CreateWithinQuota stores a new upload unless it would take its owner's uploads past
+	// quotaBytes, and reports whether it did. The check and the insert are a single statement.
+	CreateWithinQuota(ctx context.Context, media *Media, quotaBytes int64) (bool, error)
+	// FindByID returns nil, nil when the upload does not exist.
+	FindByID(ctx context.Context, id string) (*Media, error)
+	// ClaimChunk reserves an upload that has received exactly offset bytes for writing the next
+	// chunk, until the claim is released or expires at until. It reports false if the upload is no
+	// longer uploading, stands at another offset, or is claimed by another request.
+	ClaimChunk(ctx context.Context, id string, offset int64, now, until time.Time) (bool, error)
+	// UpdateProgress records the bytes received by the chunk claimed at offset and releases the
+	// claim, unless the upload is now fully received: the claim is then kept while it completes.
+	// It reports false if the upload no longer stands at offset.
+	UpdateProgress(ctx context.Context, id string, offset, receivedBytes int64) (bool, error)
+	// ReleaseChunk drops the claim on an upload whose chunk was not recorded or did not complete it.
+	ReleaseChunk(ctx context.Context, id string) error
+	// MarkComplete records the sniffed content type of a fully received upload and its new status:
+	// ready, or scanning while it waits for the malware scan.
+	MarkComplete(ctx context.Context, id string, status MediaStatus, contentType string, size int64, completedAt time.Time) error
+	// SetScanResult releases (ready) or rejects an upload waiting for the malware scan.
+	SetScanResult(ctx context.Context, id string, status MediaStatus, threat string) error
+	// FindByStatus returns up to limit uploads with the given status, oldest first.
+	FindByStatus(ctx context.Context, status MediaStatus, limit int) ([]*Media, error)
+	// Delete removes an upload and releases its reference to the stored file.
+	Delete(ctx context.Context, id string) error
+	// AttachBlob points the upload at the stored file with the given hash, recording the file or
+	// taking another reference to it, and reports whether the file was already stored.
+	AttachBlob(ctx context.Context, id string, sha256 string, size int64) (bool, error)
+	// FindUnreferencedBlobs returns the hashes of stored files no upload has referred to since cutoff.
+	FindUnreferencedBlobs(ctx context.Context, cutoff time.Time, limit int) ([]string, error)
+	// DeleteBlob forgets a stored file if it is still unreferenced, and reports whether it did.
+	DeleteBlob(ctx context.Context, sha256 string) (bool, error)
+	// UsageByOwner returns the total size and number of a user's uploads, unfinished ones included.
+	UsageByOwner(ctx context.Context, ownerID int64) (int64, int, error)
+	// UsageByGroup returns the total size of the uploads sent to a group, counting withMediaID,
+	// if not empty, as if it had been sent too.
+	UsageByGroup(ctx context.Context, groupID int64, withMediaID string) (int64, error)
+	// IsAttachedForUser reports whether the upload is attached to a message in a conversation
+	// the user belongs to: a P2P chat they are part of or a group they are a member of.
+	IsAttachedForUser(ctx context.Context, id string, userID int64) (bool, error)
+	// FindOrphans returns uploads created before cutoff that are unfinished or not attached to any message.
+	FindOrphans(ctx context.Context, cutoff time.Time, limit int) ([]*Media, error)
+	// ListReady pages through completed uploads in ID order, starting after afterID.
+	ListReady(ctx context.Context, afterID string, limit int) ([]*Media, error)
+	// SetImageInfo records the result of processing an image.
+	SetImageInfo(ctx context.Context, id string, info *ImageInfo) error
+}
+
+// MediaService handles uploads and downloads.
+type MediaService interface {
+	// Upload stores a complete file in one request.
+	Upload(ctx context.Context, ownerID int64, filename string, r io.Reader) (*Media, error)
+	// CreateUpload starts a resumable upload of size bytes.
+	CreateUpload(ctx context.Context, ownerID int64, filename string, size int64) (*Media, error)
+	// AppendChunk adds the next chunk of a resumable upload; offset must equal the bytes received so far.
+	// The upload becomes ready once all bytes have arrived.
+	AppendChunk(ctx context.Context, ownerID int64, mediaID string, offset int64, r io.Reader) (*Media, error)
+	// GetUpload returns one of the owner's uploads, e.g. to resume it after a dropped connection.
+	GetUpload(ctx context.Context, ownerID int64, mediaID string) (*Media, error)
+	// Open returns a ready upload and its content if the requester may see it. Callers close the reader.
+	Open(ctx context.Context, requesterID int64, mediaID string) (*Media, io.ReadSeekCloser, error)
+
+	// CreateDirectUpload starts an upload that the client PUTs straight to the store with the
+	// returned pre-signed URL, then finishes with CompleteDirectUpload. Needs a presigning store.
+	CreateDirectUpload(ctx context.Context, ownerID int64, filename string, size int64) (*Media, string, error)
+	// CompleteDirectUpload checks the size and type of the object the client stored and marks it ready.
+	CompleteDirectUpload(ctx context.Context, ownerID int64, mediaID string) (*Media, error)
+	// DownloadURL returns a pre-signed URL for the upload if the requester may see it, or "" when
+	// the store cannot presign and the content must be streamed with Open.
+	DownloadURL(ctx context.Context, requesterID int64, mediaID string) (string, error)
+	// OpenThumbnail returns a thumbnail of a processed image and its content, like Open.
+	OpenThumbnail(ctx context.Context, requesterID int64, mediaID string, size int) (*Thumbnail, io.ReadSeekCloser, error)
+	// ThumbnailURL is DownloadURL for a thumbnail.
+	ThumbnailURL(ctx context.Context, requesterID int64, mediaID string, size int) (string, error)
+	// CleanupOrphans deletes uploads older than the orphan TTL that were never finished or never
+	// sent, and returns how many were removed. Stored files left unreferenced are deleted too.
+	CleanupOrphans(ctx context.Context) (int, error)
+	// Usage reports the storage a user's uploads take up against their quota.
+	Usage(ctx context.Context, userID int64) (*StorageUsage, error)
+}
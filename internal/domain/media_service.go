@@ -0,0 +1,607 @@
+package domain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/pkg/imaging"
+)
+
+// sniffLength is how much of a file content type detection looks at.
+const sniffLength = 512
+
+// maxFilenameLength caps the stored name of an upload.
+const maxFilenameLength = 255
+
+// gpsStrippedTypes are the image types that can carry location metadata, which
+// imaging.StripGPS removes.
+var gpsStrippedTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/webp": true}
+
+// chunkClaimTimeout is how long a resumable upload chunk may take to arrive before another
+// request at the same offset may take over.
+const chunkClaimTimeout = 10 * time.Minute
+
+// mediaService is the concrete implementation of the MediaService interface.
+type mediaService struct {
+	mediaRepo MediaRepository
+	store     MediaStore
+	scans     UploadScanner // Releases quarantined uploads once scanned
+	authz     Authorizer
+	settings  MediaSettings
+
+	// blobMu serializes taking references to stored files with deleting unreferenced ones,
+	// so that an upload is never pointed at a file being deleted.
+	blobMu sync.Mutex
+}
+
+// NewMediaService creates a new MediaService.
+func NewMediaService(mediaRepo MediaRepository, store MediaStore, scans UploadScanner, authz Authorizer, settings MediaSettings) MediaService {
+	return &mediaService{
+		mediaRepo: mediaRepo,
+		store:     store,
+		scans:     scans,
+		authz:     authz,
+		settings:  settings,
+	}
+}
+
+// Upload sniffs the content type from the first bytes, refuses disallowed types before storing
+// anything, and stops reading once the size limit is exceeded. The file is then completed like
+// a resumable upload.
+func (s *mediaService) Upload(ctx context.Context, ownerID int64, filename string, r io.Reader) (*Media, error) {
+	if err := s.authz.Can(ctx, UserSubject(ownerID), ActionMediaUpload, NoResource); err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReaderSize(r, sniffLength)
+	head, err := buffered.Peek(sniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(head) == 0 {
+		return nil, &ValidationError{Msg: "the uploaded file is empty"}
+	}
+	if _, err := s.checkContentType(head); err != nil {
+		return nil, err
+	}
+
+	media, err := s.newMedia(ownerID, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read one byte past the limit so oversized uploads can be told apart from exact fits.
+	size, err := s.store.Put(ctx, media.ID, io.LimitReader(buffered, s.settings.MaxUploadBytes+1))
+	if err != nil {
+		s.discard(ctx, media.ID)
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+	if size > s.settings.MaxUploadBytes {
+		s.discard(ctx, media.ID)
+		return nil, &MediaTooLargeError{Limit: s.settings.MaxUploadBytes}
+	}
+
+	media.Size = size
+	media.ReceivedBytes = size
+	media.Status = MediaUploading
+	if err := s.create(ctx, media); err != nil {
+		s.discard(ctx, media.ID)
+		return nil, err
+	}
+	if err := s.complete(ctx, media); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// CreateUpload registers a resumable upload; its bytes arrive through AppendChunk.
+func (s *mediaService) CreateUpload(ctx context.Context, ownerID int64, filename string, size int64) (*Media, error) {
+	if err := s.authz.Can(ctx, UserSubject(ownerID), ActionMediaUpload, NoResource); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, &ValidationError{Msg: "size must be positive"}
+	}
+	if size > s.settings.MaxUploadBytes {
+		return nil, &MediaTooLargeError{Limit: s.settings.MaxUploadBytes}
+	}
+
+	media, err := s.newMedia(ownerID, filename)
+	if err != nil {
+		return nil, err
+	}
+	media.Size = size
+	media.Status = MediaUploading
+	if err := s.create(ctx, media); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// AppendChunk stores the chunk at offset. A mismatched offset is a conflict: the client resyncs
+// with GetUpload and resends from ReceivedBytes. Completing the upload sniffs and checks its type.
+// The chunk is claimed before anything is written, so concurrent requests for the same upload
+// cannot interleave their writes or both complete it.
+func (s *mediaService) AppendChunk(ctx context.Context, ownerID int64, mediaID string, offset int64, r io.Reader) (*Media, error) {
+	media, err := s.GetUpload(ctx, ownerID, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if media.Status != MediaUploading {
+		return nil, &ConflictError{Msg: "upload is already complete"}
+	}
+	if offset != media.ReceivedBytes {
+		return nil, &ConflictError{Msg: fmt.Sprintf("expected offset %d", media.ReceivedBytes)}
+	}
+
+	now := time.Now()
+	claimed, err := s.mediaRepo.ClaimChunk(ctx, media.ID, offset, now, now.Add(chunkClaimTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim upload chunk: %w", err)
+	}
+	if !claimed {
+		return nil, &ConflictError{Msg: fmt.Sprintf("another chunk at offset %d is being written; resync the upload", offset)}
+	}
+
+	remaining := media.Size - offset
+	received, err := s.store.Append(ctx, media.ID, offset, io.LimitReader(r, remaining+1))
+	if err != nil {
+		s.releaseChunk(ctx, media.ID)
+		return nil, fmt.Errorf("failed to store chunk: %w", err)
+	}
+	if received > media.Size {
+		// Nothing is recorded, so the next chunk at the old offset overwrites the excess.
+		s.releaseChunk(ctx, media.ID)
+		return nil, &ValidationError{Msg: fmt.Sprintf("chunk runs past the declared size of %d bytes", media.Size)}
+	}
+	recorded, err := s.mediaRepo.UpdateProgress(ctx, media.ID, offset, received)
+	if err != nil {
+		s.releaseChunk(ctx, media.ID)
+		return nil, fmt.Errorf("failed to record upload progress: %w", err)
+	}
+	if !recorded {
+		// The claim expired and another request moved the upload on.
+		return nil, &ConflictError{Msg: "upload changed while the chunk was written; resync the upload"}
+	}
+	media.ReceivedBytes = received
+
+	if received == media.Size {
+		if err := s.complete(ctx, media); err != nil {
+			// Let the client retry the completion with an empty chunk at the final offset.
+			s.releaseChunk(ctx, media.ID)
+			return nil, err
+		}
+	}
+	return media, nil
+}
+
+// releaseChunk drops the upload's chunk claim, logging failures: the claim expires anyway.
+func (s *mediaService) releaseChunk(ctx context.Context, mediaID string) {
+	if err := s.mediaRepo.ReleaseChunk(ctx, mediaID); err != nil {
+		log.Printf("Failed to release chunk claim on upload %s: %v", mediaID, err)
+	}
+}
+
+// GetUpload returns one of the owner's uploads; other users' uploads are reported as missing.
+func (s *mediaService) GetUpload(ctx context.Context, ownerID int64, mediaID string) (*Media, error) {
+	media, err := s.mediaRepo.FindByID(ctx, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload: %w", err)
+	}
+	if media == nil || media.OwnerID != ownerID {
+		return nil, &NotFoundError{Msg: "upload not found"}
+	}
+	media.URL = MediaURL(media.ID)
+	return media, nil
+}
+
+// Open checks that the requester may see the upload and opens its content.
+func (s *mediaService) Open(ctx context.Context, requesterID int64, mediaID string) (*Media, io.ReadSeekCloser, error) {
+	if err := s.authz.Can(ctx, UserSubject(requesterID), ActionMediaView, MediaResource(mediaID)); err != nil {
+		return nil, nil, err
+	}
+
+	media, err := s.mediaRepo.FindByID(ctx, mediaID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load upload: %w", err)
+	}
+	if media == nil {
+		return nil, nil, &NotFoundError{Msg: "media not found"}
+	}
+
+	content, err := s.store.Open(ctx, media.StorageKey())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	media.URL = MediaURL(media.ID)
+	return media, content, nil
+}
+
+// OpenThumbnail returns a thumbnail of an image the requester may see.
+func (s *mediaService) OpenThumbnail(ctx context.Context, requesterID int64, mediaID string, size int) (*Thumbnail, io.ReadSeekCloser, error) {
+	thumbnail, err := s.findThumbnail(ctx, requesterID, mediaID, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := s.store.Open(ctx, ThumbnailKey(mediaID, size))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open thumbnail: %w", err)
+	}
+	return thumbnail, content, nil
+}
+
+// ThumbnailURL presigns a thumbnail download, or returns "" when the store cannot presign.
+func (s *mediaService) ThumbnailURL(ctx context.Context, requesterID int64, mediaID string, size int) (string, error) {
+	presigner, ok := s.store.(MediaPresigner)
+	if !ok {
+		return "", nil
+	}
+	thumbnail, err := s.findThumbnail(ctx, requesterID, mediaID, size)
+	if err != nil {
+		return "", err
+	}
+	return presigner.PresignGet(ctx, ThumbnailKey(mediaID, size), thumbnail.ContentType, "inline", s.settings.PresignExpiry)
+}
+
+// findThumbnail checks the requester may see the upload and that it has a thumbnail of that size.
+func (s *mediaService) findThumbnail(ctx context.Context, requesterID int64, mediaID string, size int) (*Thumbnail, error) {
+	if err := s.authz.Can(ctx, UserSubject(requesterID), ActionMediaView, MediaResource(mediaID)); err != nil {
+		return nil, err
+	}
+	media, err := s.mediaRepo.FindByID(ctx, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload: %w", err)
+	}
+	if media == nil {
+		return nil, &NotFoundError{Msg: "media not found"}
+	}
+	thumbnail := media.Thumbnail(size)
+	if thumbnail == nil {
+		return nil, &NotFoundError{Msg: "thumbnail not found"}
+	}
+	return thumbnail, nil
+}
+
+// CreateDirectUpload registers an upload whose bytes the client PUTs straight to the store.
+func (s *mediaService) CreateDirectUpload(ctx context.Context, ownerID int64, filename string, size int64) (*Media, string, error) {
+	presigner, ok := s.store.(MediaPresigner)
+	if !ok {
+		return nil, "", &ValidationError{Msg: "direct uploads are not supported by this server's media storage"}
+	}
+
+	media, err := s.CreateUpload(ctx, ownerID, filename, size)
+	if err != nil {
+		return nil, "", err
+	}
+	uploadURL, err := presigner.PresignPut(ctx, media.ID, size, s.settings.PresignExpiry)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to presign upload: %w", err)
+	}
+	return media, uploadURL, nil
+}
+
+// CompleteDirectUpload finishes an upload the client stored with a pre-signed URL. The URL only
+// accepts the declared size, but the stored object is checked again before it is trusted.
+func (s *mediaService) CompleteDirectUpload(ctx context.Context, ownerID int64, mediaID string) (*Media, error) {
+	media, err := s.GetUpload(ctx, ownerID, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if media.Status != MediaUploading {
+		return nil, &ConflictError{Msg: "upload is already complete"}
+	}
+
+	size, err := s.store.Stat(ctx, media.ID)
+	if errors.Is(err, ErrMediaNotStored) {
+		return nil, &ConflictError{Msg: "nothing has been uploaded yet"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check upload: %w", err)
+	}
+	if size != media.Size {
+		s.discard(ctx, media.ID)
+		return nil, &ValidationError{Msg: fmt.Sprintf("uploaded %d bytes but declared %d", size, media.Size)}
+	}
+
+	media.ReceivedBytes = size
+	if err := s.complete(ctx, media); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// DownloadURL presigns a download for requesters allowed to see the upload.
+func (s *mediaService) DownloadURL(ctx context.Context, requesterID int64, mediaID string) (string, error) {
+	presigner, ok := s.store.(MediaPresigner)
+	if !ok {
+		return "", nil
+	}
+	if err := s.authz.Can(ctx, UserSubject(requesterID), ActionMediaView, MediaResource(mediaID)); err != nil {
+		return "", err
+	}
+
+	media, err := s.mediaRepo.FindByID(ctx, mediaID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load upload: %w", err)
+	}
+	if media == nil {
+		return "", &NotFoundError{Msg: "media not found"}
+	}
+	return presigner.PresignGet(ctx, media.StorageKey(), media.ContentType, media.ContentDisposition(), s.settings.PresignExpiry)
+}
+
+// orphanBatchSize is how many orphaned uploads CleanupOrphans loads at a time.
+const orphanBatchSize = 100
+
+// CleanupOrphans removes abandoned uploads: unfinished ones and ones never attached to a message.
+// Removing them releases their stored files, which are deleted once unreferenced for as long.
+func (s *mediaService) CleanupOrphans(ctx context.Context) (int, error) {
+	if s.settings.OrphanTTL <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-s.settings.OrphanTTL)
+
+	removed := 0
+	for {
+		orphans, err := s.mediaRepo.FindOrphans(ctx, cutoff, orphanBatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("failed to find orphaned uploads: %w", err)
+		}
+		for _, media := range orphans {
+			if media.Image != nil {
+				for _, thumbnail := range media.Image.Thumbnails {
+					s.discard(ctx, ThumbnailKey(media.ID, thumbnail.Size))
+				}
+			}
+			if media.SHA256 == "" {
+				if err := s.store.Delete(ctx, media.ID); err != nil {
+					return removed, fmt.Errorf("failed to delete stored upload %s: %w", media.ID, err)
+				}
+			}
+			if err := s.mediaRepo.Delete(ctx, media.ID); err != nil {
+				return removed, fmt.Errorf("failed to delete upload %s: %w", media.ID, err)
+			}
+			removed++
+		}
+		if len(orphans) < orphanBatchSize {
+			break
+		}
+	}
+
+	deleted := 0
+	for {
+		hashes, err := s.mediaRepo.FindUnreferencedBlobs(ctx, cutoff, orphanBatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("failed to find unreferenced media files: %w", err)
+		}
+		for _, sum := range hashes {
+			ok, err := s.deleteBlob(ctx, sum)
+			if err != nil {
+				return removed, fmt.Errorf("failed to delete media file %s: %w", sum, err)
+			}
+			if ok {
+				deleted++
+			}
+		}
+		if len(hashes) < orphanBatchSize {
+			break
+		}
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d unreferenced media files", deleted)
+	}
+	return removed, nil
+}
+
+// deleteBlob deletes a stored file unless an upload took a reference to it since it was found.
+func (s *mediaService) deleteBlob(ctx context.Context, sum string) (bool, error) {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+	deleted, err := s.mediaRepo.DeleteBlob(ctx, sum)
+	if err != nil || !deleted {
+		return false, err
+	}
+	return true, s.store.Delete(ctx, sum)
+}
+
+// Usage reports the size and number of the user's uploads against their quota.
+func (s *mediaService) Usage(ctx context.Context, userID int64) (*StorageUsage, error) {
+	used, files, err := s.mediaRepo.UsageByOwner(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute storage usage: %w", err)
+	}
+	return &StorageUsage{UsedBytes: used, QuotaBytes: s.settings.Quotas.UserBytes, Files: files}, nil
+}
+
+// create stores a new upload, refusing it if it would take the owner past their quota. The
+// repository checks the quota as it inserts, so concurrent uploads cannot overshoot it together.
+func (s *mediaService) create(ctx context.Context, media *Media) error {
+	limit := s.settings.Quotas.UserBytes
+	if limit <= 0 {
+		if err := s.mediaRepo.Create(ctx, media); err != nil {
+			return fmt.Errorf("failed to save upload: %w", err)
+		}
+		return nil
+	}
+	created, err := s.mediaRepo.CreateWithinQuota(ctx, media, limit)
+	if err != nil {
+		return fmt.Errorf("failed to save upload: %w", err)
+	}
+	if !created {
+		return &QuotaExceededError{Scope: UserQuota, Limit: limit}
+	}
+	return nil
+}
+
+// complete sniffs a fully received upload, moves it to its content address and marks it ready,
+// deleting it if its type is refused. When uploads are scanned, it is quarantined and queued for
+// the malware scan instead.
+func (s *mediaService) complete(ctx context.Context, media *Media) error {
+	if err := s.store.Complete(ctx, media.ID); err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	content, err := s.store.Open(ctx, media.ID)
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(content, head)
+	content.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	contentType, err := s.checkContentType(head[:n])
+	if err != nil {
+		s.discard(ctx, media.ID)
+		if deleteErr := s.mediaRepo.Delete(ctx, media.ID); deleteErr != nil {
+			log.Printf("Failed to delete refused upload %s: %v", media.ID, deleteErr)
+		}
+		return err
+	}
+	if err := s.storeBlob(ctx, media, contentType); err != nil {
+		return err
+	}
+
+	status := MediaReady
+	if s.settings.ScanUploads {
+		status = MediaScanning
+	}
+	now := time.Now()
+	if err := s.mediaRepo.MarkComplete(ctx, media.ID, status, contentType, media.Size, now); err != nil {
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+	media.ContentType = contentType
+	media.Status = status
+	media.CompletedAt = &now
+	if status == MediaScanning && !s.scans.Enqueue(media.ID) {
+		log.Printf("Scan queue is full; %s will be scanned by the next sweep", media.ID)
+	}
+	return nil
+}
+
+// storeBlob moves a complete upload from under its ID to under the SHA-256 of its content. If an
+// identical file is already stored, the upload shares it and its own copy is deleted, so a file
+// sent many times is stored once.
+func (s *mediaService) storeBlob(ctx context.Context, media *Media, contentType string) error {
+	sum, size, err := s.hashContent(ctx, media.ID, contentType)
+	if err != nil {
+		return err
+	}
+
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+	stored, err := s.mediaRepo.AttachBlob(ctx, media.ID, sum, size)
+	if err != nil {
+		return fmt.Errorf("failed to record stored upload: %w", err)
+	}
+	if stored {
+		s.discard(ctx, media.ID)
+	} else if err := s.store.Rename(ctx, media.ID, sum); err != nil {
+		// Deleting the upload releases the reference taken above, so the file is not
+		// assumed to be stored by the next identical upload.
+		s.discard(ctx, media.ID)
+		if deleteErr := s.mediaRepo.Delete(ctx, media.ID); deleteErr != nil {
+			log.Printf("Failed to delete upload %s: %v", media.ID, deleteErr)
+		}
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	media.SHA256 = sum
+	media.Size = size
+	media.ReceivedBytes = size
+	return nil
+}
+
+// hashContent returns the SHA-256 and size of the object stored under key. GPS data is first
+// stripped from JPEG, PNG and WebP photos, rewriting the object, so that location data is never
+// served and the hash covers the bytes actually kept. The other image types content sniffing
+// allows (GIF, BMP and icons) have no EXIF metadata.
+func (s *mediaService) hashContent(ctx context.Context, key string, contentType string) (string, int64, error) {
+	content, err := s.store.Open(ctx, key)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open upload: %w", err)
+	}
+	hash := sha256.New()
+
+	if !gpsStrippedTypes[contentType] {
+		size, err := io.Copy(hash, content)
+		content.Close()
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read upload: %w", err)
+		}
+		return hex.EncodeToString(hash.Sum(nil)), size, nil
+	}
+
+	data, err := io.ReadAll(content)
+	content.Close()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if stripped, changed := imaging.StripGPS(data); changed {
+		if _, err := s.store.Put(ctx, key, bytes.NewReader(stripped)); err != nil {
+			return "", 0, fmt.Errorf("failed to store image without location data: %w", err)
+		}
+		data = stripped
+	}
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)), int64(len(data)), nil
+}
+
+// checkContentType sniffs the content type of a file from its first bytes and checks it is allowed.
+func (s *mediaService) checkContentType(head []byte) (string, error) {
+	contentType := http.DetectContentType(head)
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	for _, allowed := range s.settings.AllowedTypes {
+		if allowed == contentType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(allowed, "*"))) {
+			return contentType, nil
+		}
+	}
+	return "", &ValidationError{Msg: fmt.Sprintf("files of type %s are not allowed", contentType)}
+}
+
+// newMedia creates the metadata of a new upload with a random, unguessable ID.
+func (s *mediaService) newMedia(ownerID int64, filename string) (*Media, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate media ID: %w", err)
+	}
+	return &Media{
+		ID:        id,
+		OwnerID:   ownerID,
+		Filename:  cleanFilename(filename),
+		CreatedAt: time.Now(),
+		URL:       MediaURL(id),
+	}, nil
+}
+
+// discard deletes stored bytes that will not be kept; failures only leak storage, so they are logged.
+func (s *mediaService) discard(ctx context.Context, mediaID string) {
+	if err := s.store.Delete(ctx, mediaID); err != nil {
+		log.Printf("Failed to delete stored upload %s: %v", mediaID, err)
+	}
+}
+
+// cleanFilename keeps only the base name of a client-supplied filename.
+func cleanFilename(filename string) string {
+	name := filepath.Base(strings.ReplaceAll(strings.TrimSpace(filename), "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return truncate(name, maxFilenameLength)
+}
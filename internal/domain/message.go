@@ -2,6 +2,12 @@ package domain
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,8 +19,98 @@ const (
 	ImageMessage  MessageType = "image"
 	SystemMessage MessageType = "system"
 	TypingMessage MessageType = "typing"
+	// DeletedMessage marks a tombstoned message whose content has been removed.
+	DeletedMessage MessageType = "deleted"
+	// File, audio, video and voice note messages attach an upload and describe it in Attachment.
+	FileMessage      MessageType = "file"
+	AudioMessage     MessageType = "audio"
+	VideoMessage     MessageType = "video"
+	VoiceNoteMessage MessageType = "voice_note"
 )
 
+// HasAttachment reports whether messages of this type carry AttachmentInfo.
+func (t MessageType) HasAttachment() bool {
+	switch t {
+	case FileMessage, AudioMessage, VideoMessage, VoiceNoteMessage:
+		return true
+	}
+	return false
+}
+
+// Limits on the attachment metadata supplied by senders.
+const (
+	MaxAttachmentDurationMs = 24 * 60 * 60 * 1000 // Audio and video
+	MaxVoiceNoteDurationMs  = 60 * 60 * 1000
+	MaxWaveformSamples      = 256
+	MaxWaveformValue        = 255
+)
+
+// AttachmentInfo describes the upload of a file, audio, video or voice note message. Filename,
+// Size and ContentType are taken from the upload; senders supply DurationMs (audio, video and
+// voice notes, required for the latter) and a voice note's Waveform.
+type AttachmentInfo struct {
+	Filename    string `json:"filename,omitempty"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	DurationMs  int64  `json:"duration_ms,omitempty"`
+	Waveform    []int  `json:"waveform,omitempty"` // Amplitude samples from 0 to MaxWaveformValue
+}
+
+// Value implements driver.Valuer; the metadata is stored as JSON.
+func (a AttachmentInfo) Value() (driver.Value, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (a *AttachmentInfo) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	case []byte:
+		return json.Unmarshal(v, a)
+	default:
+		return fmt.Errorf("cannot scan %T into AttachmentInfo", src)
+	}
+}
+
+// MaxForwardTargets caps the conversations a message is forwarded to at once.
+const MaxForwardTargets = 20
+
+// ForwardInfo records where a forwarded message came from. Forwarding a forwarded message keeps
+// the provenance of the original. The conversation is only named for group messages, so
+// forwarding a P2P message does not reveal who it was sent to.
+type ForwardInfo struct {
+	MessageID int64     `json:"message_id"`
+	SenderID  int64     `json:"sender_id"`
+	GroupID   int64     `json:"group_id,omitempty"` // 0 for P2P messages
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Value implements driver.Valuer; the provenance is stored as JSON.
+func (f ForwardInfo) Value() (driver.Value, error) {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (f *ForwardInfo) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case []byte:
+		return json.Unmarshal(v, f)
+	default:
+		return fmt.Errorf("cannot scan %T into ForwardInfo", src)
+	}
+}
+
 // MessageStatus defines the delivery status of a message.
 type MessageStatus string
 
@@ -32,11 +128,105 @@ type Message struct {
 	ID          int64      `json:"id" db:"id"`
 	SenderID    int64      `json:"sender_id" db:"sender_id"`
 	RecipientID int64         `json:"recipient_id" db:"recipient_id"`
+	GroupID     int64         `json:"group_id,omitempty" db:"group_id"` // Set on group messages (RecipientID is then the group); 0 for P2P messages
 	Type        MessageType   `json:"type" db:"type"`
 	Content     string        `json:"content" db:"content"`
 	MediaURL    string        `json:"media_url" db:"media_url"`
+	MediaID     string        `json:"media_id,omitempty" db:"media_id"` // Set when the media is an upload; MediaURL then points at GET /v1/media/:id
+	Image       *ImageInfo    `json:"image,omitempty" db:"image"`       // Dimensions, blurhash and thumbnails of an attached image, once processed
+	Attachment  *AttachmentInfo `json:"attachment,omitempty" db:"attachment"` // File, audio, video and voice note messages
+	ForwardedFrom *ForwardInfo `json:"forwarded_from,omitempty" db:"forwarded_from"` // Set on forwarded copies
 	Timestamp   time.Time     `json:"timestamp" db:"timestamp"`
 	Status      MessageStatus `json:"status" db:"status"`
+	IsBot       bool          `json:"is_bot" db:"is_bot"` // Sent by a bot account, so clients can badge it
+}
+
+// Conversation identifies a conversation by its group, or by the other participant of a P2P
+// conversation. Its string form is "group_<id>" or "user_<id>".
+type Conversation struct {
+	GroupID int64
+	PeerID  int64
+}
+
+// ParseConversation parses the string form of a Conversation.
+func ParseConversation(s string) (Conversation, error) {
+	kind, id, _ := strings.Cut(s, "_")
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err == nil && n > 0 {
+		switch kind {
+		case "group":
+			return Conversation{GroupID: n}, nil
+		case "user":
+			return Conversation{PeerID: n}, nil
+		}
+	}
+	return Conversation{}, &ValidationError{Msg: "conversation must be group_<id> or user_<id>"}
+}
+
+func (c Conversation) String() string {
+	if c.GroupID != 0 {
+		return "group_" + strconv.FormatInt(c.GroupID, 10)
+	}
+	return "user_" + strconv.FormatInt(c.PeerID, 10)
+}
+
+// Limits on message searches.
+const (
+	MaxSearchQueryLength = 256
+	DefaultSearchLimit   = 20
+	MaxSearchLimit       = 100
+)
+
+// MessageSearch is a full-text search over the messages of the conversations a user belongs to.
+// Zero fields do not filter.
+type MessageSearch struct {
+	Query        string        // Words to match; a trailing * matches a prefix
+	Conversation *Conversation // Only this conversation
+	SenderID     int64
+	Before       time.Time
+	After        time.Time
+	HasMedia     bool  // Only messages carrying media
+	BeforeID     int64 // Cursor: the ID of the last result of the previous page
+	Limit        int
+}
+
+// MessageSearchResult is a message matching a search. Snippet is an HTML-escaped excerpt of its
+// content with the matching words wrapped in <mark> tags.
+type MessageSearchResult struct {
+	Message
+	Snippet string `json:"snippet" db:"snippet"`
+}
+
+// Error codes returned to clients when a group post is refused by the posting policy.
+const (
+	CodeNotGroupMember = "NOT_GROUP_MEMBER"
+	CodeAdminsOnly     = "ADMINS_ONLY"
+	CodeSlowMode       = "SLOW_MODE"
+	CodeGroupArchived  = "GROUP_ARCHIVED"
+	CodeGroupDeleted   = "GROUP_DELETED"
+	CodeMuted          = "MUTED"
+	CodeBanned         = "BANNED"
+)
+
+// PostingRestrictedError is returned when a group's posting policy refuses a message.
+// Code tells the client why; RetryAt (zero unless slow mode applies) tells it when it may post again.
+type PostingRestrictedError struct {
+	Code    string
+	Msg     string
+	RetryAt time.Time
+}
+func (e *PostingRestrictedError) Error() string { return "Posting Restricted: " + e.Msg }
+
+// RetryAfter returns how long the sender must wait before posting again, rounded up to whole seconds.
+func (e *PostingRestrictedError) RetryAfter() time.Duration {
+	if e.RetryAt.IsZero() {
+		return 0
+	}
+	wait := time.Until(e.RetryAt)
+	if wait < 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(wait.Seconds())) * time.Second
 }
 
 // ---------------------------------------------
@@ -50,14 +240,39 @@ type Hub interface {
 }
 
 
+// GroupPostLimits are the conditions checked by the insert of a group message, so that
+// concurrent posts cannot all pass them. A zero field does not limit anything.
+type GroupPostLimits struct {
+	// PostedSince refuses the message if its sender posted to the group after it (slow mode).
+	PostedSince time.Time
+	// QuotaBytes refuses a message whose upload would take the uploads sent to the group past it.
+	QuotaBytes int64
+}
+
 // MessageRepository defines the data access operations for messages.
 type MessageRepository interface {
 	Save(ctx context.Context, message *Message) (*Message, error)
+	// SaveAll saves all of the messages or, on error, none of them. A message to a group in limits
+	// is refused as by SaveGroupPost with the group's limits; a refused message is returned and
+	// then nothing is saved.
+	SaveAll(ctx context.Context, messages []*Message, limits map[int64]GroupPostLimits) (*Message, error)
+	// SaveGroupPost atomically saves a group message unless it breaks one of the limits,
+	// returning nil if it was refused. Zero limits always save.
+	SaveGroupPost(ctx context.Context, message *Message, limits GroupPostLimits) (*Message, error)
 	FindConversationHistory(ctx context.Context, userID1, userID2 int64, limit int, beforeID int64) ([]*Message, error)
+	// HasConversation reports whether two users have exchanged any P2P message.
+	HasConversation(ctx context.Context, userID1, userID2 int64) (bool, error)
 	GetGroupConversationHistory(ctx context.Context, groupID int64, limit int, beforeID int64) ([]*Message, error)
-	GetRecentConversations(ctx context.Context, userID int64) ([]*Message, error)
+	GetRecentConversations(ctx context.Context, userID int64, includeArchived bool) ([]*Message, error)
 	FindPendingForUser(ctx context.Context, userID int64) ([]*Message, error)
 	UpdateStatus(ctx context.Context, messageIDs []int64, status MessageStatus) error
+	// FindByID returns a message, or nil if it does not exist.
+	FindByID(ctx context.Context, id int64) (*Message, error)
+	FindLastGroupMessageBySender(ctx context.Context, groupID, senderID int64) (*Message, error)
+	// UpdateImageInfo fills in the image metadata of messages carrying the upload that lack it.
+	UpdateImageInfo(ctx context.Context, mediaID string, info *ImageInfo) error
+	// Search returns the messages matching search in the conversations userID belongs to, newest first.
+	Search(ctx context.Context, userID int64, search MessageSearch) ([]*MessageSearchResult, error)
 }
 
 // ---------------------------------------------
@@ -67,12 +282,27 @@ type MessageRepository interface {
 // MessageService defines the business operations related to messages.
 type MessageService interface {
 	Save(ctx context.Context, message *Message) (*Message, error)
+	// SaveGroupMessage is Save for messages sent to a group.
+	SaveGroupMessage(ctx context.Context, message *Message) (*Message, error)
+	// GetConversationHistory returns the P2P messages between userID1 (the requester) and userID2.
 	GetConversationHistory(ctx context.Context, userID1, userID2 int64, limit int, beforeID int64) ([]*Message, error)
-	GetRecentConversations(ctx context.Context, userID int64) ([]*Message, error)
+	// GetRecentConversations omits archived groups unless includeArchived is set.
+	GetRecentConversations(ctx context.Context, userID int64, includeArchived bool) ([]*Message, error)
 	GetPendingMessages(ctx context.Context, userID int64) ([]*Message, error)
 	MarkMessagesAsDelivered(ctx context.Context, messageIDs []int64) error
-	GetGroupConversationHistory(ctx context.Context, groupID int64, limit int, beforeID int64) ([]*Message, error)
-	// Updated interface signatures to include MessageType
-	SendGroupMessage(ctx context.Context, senderID int64, groupID int64, content string, mediaURL string, messageType MessageType) (*Message, error)
-	SendP2PMessage(ctx context.Context, senderID int64, recipientID int64, content string, mediaURL string, messageType MessageType) (*Message, error)
+	// GetGroupConversationHistory returns a group's messages; requesterID must be a member.
+	GetGroupConversationHistory(ctx context.Context, requesterID, groupID int64, limit int, beforeID int64) ([]*Message, error)
+	// Updated interface signatures to include MessageType. mediaID attaches one of the sender's uploads
+	// and takes precedence over mediaURL. attachment carries the sender's duration and waveform for
+	// audio, video and voice notes; it may be nil.
+	SendGroupMessage(ctx context.Context, senderID int64, groupID int64, content string, mediaURL string, mediaID string, attachment *AttachmentInfo, messageType MessageType) (*Message, error)
+	SendP2PMessage(ctx context.Context, senderID int64, recipientID int64, content string, mediaURL string, mediaID string, attachment *AttachmentInfo, messageType MessageType) (*Message, error)
+	// SearchMessages searches the messages of the conversations userID belongs to.
+	SearchMessages(ctx context.Context, userID int64, search MessageSearch) ([]*MessageSearchResult, error)
+	// ForwardMessage copies a message userID can see into each target conversation (group or peer),
+	// recording its provenance in ForwardedFrom. Every target is checked before anything is sent.
+	ForwardMessage(ctx context.Context, userID, messageID int64, targets []Conversation) ([]*Message, error)
+	// SaveSystemNotice stores a system message for userID about one of their uploads (mediaID may
+	// be empty). A notice saved as pending is delivered the next time the user connects.
+	SaveSystemNotice(ctx context.Context, userID int64, content string, mediaID string, status MessageStatus) (*Message, error)
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 )
 
@@ -12,43 +14,315 @@ type messageService struct {
 	messageRepo  MessageRepository
 	userRepo   UserRepository
 	groupRepo   GroupRepository
+	mediaRepo   MediaRepository
+	images      ImageProcessor // Generates thumbnails and metadata for attached images
+	quotas      StorageQuotas // Caps the media sent to each group
+	authz      Authorizer // Decides who may read and post to conversations
 	hub        Hub
 }
 
 // NewMessageService creates a new instance of the MessageService.
-func NewMessageService(messageRepo MessageRepository, userRepo UserRepository, groupRepo GroupRepository, hub Hub) MessageService {
+func NewMessageService(messageRepo MessageRepository, userRepo UserRepository, groupRepo GroupRepository, mediaRepo MediaRepository, images ImageProcessor, quotas StorageQuotas, authz Authorizer, hub Hub) MessageService {
 	return &messageService{
 		messageRepo:  messageRepo,
 		userRepo:    userRepo,
 		groupRepo:   groupRepo,
+		mediaRepo:   mediaRepo,
+		images:      images,
+		quotas:      quotas,
+		authz:       authz,
 		hub:           hub,
 	}
 }
 
 // Save implements the MessageService Save method, directly persisting the message.
+// An attached upload (MediaID) is resolved first.
 func (s *messageService) Save(ctx context.Context, message *Message) (*Message, error) {
+	message.GroupID = 0
+	if err := s.attachMedia(ctx, message, 0); err != nil {
+		return nil, err
+	}
 	return s.messageRepo.Save(ctx, message)
 }
 
+// SaveGroupMessage is Save for a message whose recipient is a group, so that the group's
+// storage quota applies to an attached upload.
+func (s *messageService) SaveGroupMessage(ctx context.Context, message *Message) (*Message, error) {
+	message.GroupID = message.RecipientID
+	if err := s.attachMedia(ctx, message, message.RecipientID); err != nil {
+		return nil, err
+	}
+	return s.saveGroupPost(ctx, message)
+}
+
+// saveGroupPost saves a group message, enforcing slow mode and the group's storage quota in the
+// same statement as the insert: the checks made beforehand could let concurrent posts through.
+func (s *messageService) saveGroupPost(ctx context.Context, message *Message) (*Message, error) {
+	group, limits, err := s.groupPostLimits(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.messageRepo.SaveGroupPost(ctx, message, limits)
+	if err != nil {
+		return nil, err
+	}
+	if saved == nil {
+		return nil, s.groupPostRefusal(ctx, message, group, limits)
+	}
+	return saved, nil
+}
+
+// groupPostLimits returns the message's group and the limits its insert must check: slow mode,
+// unless the group is not in it or the sender is one of its admins, and the group's storage
+// quota for a message attaching an upload.
+func (s *messageService) groupPostLimits(ctx context.Context, message *Message) (*Group, GroupPostLimits, error) {
+	var limits GroupPostLimits
+	if message.MediaID != "" {
+		limits.QuotaBytes = s.quotas.GroupBytes
+	}
+	group, err := s.groupRepo.FindByID(ctx, message.GroupID)
+	if err != nil {
+		return nil, limits, fmt.Errorf("failed to load group: %w", err)
+	}
+	if group != nil && group.PostingPolicy == PostingSlowMode && group.SlowModeSeconds > 0 {
+		member, err := s.groupRepo.FindMember(ctx, group.ID, message.SenderID)
+		if err != nil {
+			return nil, limits, fmt.Errorf("failed to check group membership: %w", err)
+		}
+		// Admins are exempt from slow mode.
+		if member != nil && !member.IsAdmin {
+			limits.PostedSince = time.Now().Add(-time.Duration(group.SlowModeSeconds) * time.Second)
+		}
+	}
+	return group, limits, nil
+}
+
+// groupPostRefusal is the error for a post refused by the insert: another post or upload won
+// the race, so it is reported like the checks made beforehand would.
+func (s *messageService) groupPostRefusal(ctx context.Context, message *Message, group *Group, limits GroupPostLimits) error {
+	quotaErr := &QuotaExceededError{Scope: GroupQuota, Limit: limits.QuotaBytes}
+	if limits.PostedSince.IsZero() {
+		return quotaErr
+	}
+	if limits.QuotaBytes > 0 {
+		if err := s.checkGroupQuota(ctx, message.GroupID, message.MediaID); err != nil {
+			return err
+		}
+	}
+	if err := s.authz.Can(ctx, UserSubject(message.SenderID), ActionGroupPost, GroupResource(message.GroupID)); err != nil {
+		return err
+	}
+	return &PostingRestrictedError{
+		Code:    CodeSlowMode,
+		Msg:     fmt.Sprintf("slow mode is on: members may post once every %d seconds", group.SlowModeSeconds),
+		RetryAt: time.Now().Add(time.Duration(group.SlowModeSeconds) * time.Second),
+	}
+}
+
+// attachMedia resolves message.MediaID to one of the sender's completed uploads and points
+// MediaURL at its download route. The upload must match the message type, which defaults to
+// one matching the upload. Image metadata is copied onto the message, or the image is queued
+// for processing the first time it is sent; other media types get their AttachmentInfo.
+// Sending an upload to a group (groupID is 0 otherwise) counts it towards the group's storage quota.
+func (s *messageService) attachMedia(ctx context.Context, message *Message, groupID int64) error {
+	switch message.Type {
+	case "", TextMessage, ImageMessage, FileMessage, AudioMessage, VideoMessage, VoiceNoteMessage:
+	default:
+		return &ValidationError{Msg: fmt.Sprintf("unknown message type %q", message.Type)}
+	}
+	if message.MediaID == "" {
+		if message.Type.HasAttachment() {
+			return &ValidationError{Msg: fmt.Sprintf("%s messages must attach an upload with media_id", message.Type)}
+		}
+		if message.Attachment != nil {
+			return &ValidationError{Msg: "attachment metadata requires a media_id"}
+		}
+		return nil
+	}
+
+	media, err := s.mediaRepo.FindByID(ctx, message.MediaID)
+	if err != nil {
+		return fmt.Errorf("failed to load media: %w", err)
+	}
+	if media == nil || media.OwnerID != message.SenderID {
+		return &ValidationError{Msg: "media_id does not refer to one of your completed uploads"}
+	}
+	switch media.Status {
+	case MediaReady:
+	case MediaScanning:
+		return &ValidationError{Msg: "the upload is still being scanned for malware; send it once its status is ready"}
+	case MediaRejected:
+		return &ValidationError{Msg: "the upload was rejected by the malware scan"}
+	default:
+		return &ValidationError{Msg: "media_id does not refer to one of your completed uploads"}
+	}
+
+	isImage := strings.HasPrefix(media.ContentType, "image/")
+	isAudio := strings.HasPrefix(media.ContentType, "audio/") || media.ContentType == "application/ogg"
+	isVideo := strings.HasPrefix(media.ContentType, "video/")
+	if message.Type == "" {
+		switch {
+		case isImage:
+			message.Type = ImageMessage
+		case isAudio:
+			message.Type = AudioMessage
+		case isVideo:
+			message.Type = VideoMessage
+		default:
+			message.Type = FileMessage
+		}
+	}
+	switch {
+	case message.Type == ImageMessage && !isImage:
+		return &ValidationError{Msg: "image messages must attach an image"}
+	case (message.Type == AudioMessage || message.Type == VoiceNoteMessage) && !isAudio:
+		return &ValidationError{Msg: fmt.Sprintf("%s messages must attach an audio file", message.Type)}
+	case message.Type == VideoMessage && !isVideo:
+		return &ValidationError{Msg: "video messages must attach a video"}
+	}
+	if err := describeAttachment(message, media); err != nil {
+		return err
+	}
+	if groupID != 0 {
+		if err := s.checkGroupQuota(ctx, groupID, media.ID); err != nil {
+			return err
+		}
+	}
+	message.MediaURL = MediaURL(media.ID)
+
+	if message.Type == ImageMessage {
+		message.Image = media.Image
+		if media.Image == nil && !s.images.Enqueue(media.ID) {
+			log.Printf("Image processing queue is full; %s will be processed when sent again", media.ID)
+		}
+	}
+	return nil
+}
+
+// checkGroupQuota refuses an upload that would take a group past its storage quota. Uploads
+// already sent to the group do not count twice.
+func (s *messageService) checkGroupQuota(ctx context.Context, groupID int64, mediaID string) error {
+	limit := s.quotas.GroupBytes
+	if limit <= 0 {
+		return nil
+	}
+	used, err := s.mediaRepo.UsageByGroup(ctx, groupID, mediaID)
+	if err != nil {
+		return fmt.Errorf("failed to compute group storage usage: %w", err)
+	}
+	if used > limit {
+		return &QuotaExceededError{Scope: GroupQuota, Limit: limit}
+	}
+	return nil
+}
+
+// describeAttachment validates the sender's attachment metadata and fills in what the server
+// knows about the upload. Only file, audio, video and voice note messages carry it.
+func describeAttachment(message *Message, media *Media) error {
+	declared := message.Attachment
+	if !message.Type.HasAttachment() {
+		if declared != nil {
+			return &ValidationError{Msg: fmt.Sprintf("%s messages do not take attachment metadata", message.Type)}
+		}
+		return nil
+	}
+	if declared == nil {
+		declared = &AttachmentInfo{}
+	}
+
+	switch {
+	case message.Type == FileMessage && declared.DurationMs != 0:
+		return &ValidationError{Msg: "file messages do not have a duration"}
+	case message.Type != VoiceNoteMessage && len(declared.Waveform) > 0:
+		return &ValidationError{Msg: "only voice notes have a waveform"}
+	case declared.DurationMs < 0 || declared.DurationMs > MaxAttachmentDurationMs:
+		return &ValidationError{Msg: "duration_ms is out of range"}
+	case message.Type == VoiceNoteMessage && (declared.DurationMs == 0 || declared.DurationMs > MaxVoiceNoteDurationMs):
+		return &ValidationError{Msg: fmt.Sprintf("voice notes need a duration_ms between 1 and %d", MaxVoiceNoteDurationMs)}
+	case len(declared.Waveform) > MaxWaveformSamples:
+		return &ValidationError{Msg: fmt.Sprintf("a waveform has at most %d samples", MaxWaveformSamples)}
+	}
+	for _, sample := range declared.Waveform {
+		if sample < 0 || sample > MaxWaveformValue {
+			return &ValidationError{Msg: fmt.Sprintf("waveform samples range from 0 to %d", MaxWaveformValue)}
+		}
+	}
+
+	message.Attachment = &AttachmentInfo{
+		Filename:    media.Filename,
+		Size:        media.Size,
+		ContentType: media.ContentType,
+		DurationMs:  declared.DurationMs,
+		Waveform:    declared.Waveform,
+	}
+	return nil
+}
+
+// SaveSystemNotice persists a notice to userID. The user is also its sender, as messages must
+// reference an existing sender, and the upload is recorded as is: it need not be attachable.
+func (s *messageService) SaveSystemNotice(ctx context.Context, userID int64, content string, mediaID string, status MessageStatus) (*Message, error) {
+	return s.messageRepo.Save(ctx, &Message{
+		SenderID:    userID,
+		RecipientID: userID,
+		Type:        SystemMessage,
+		Content:     content,
+		MediaID:     mediaID,
+		Timestamp:   time.Now(),
+		Status:      status,
+	})
+}
+
 // GetConversationHistory retrieves a list of messages between two users (P2P).
+// userID1 is the requesting user, who is always a participant.
 func (s *messageService) GetConversationHistory(ctx context.Context, userID1, userID2 int64, limit int, beforeID int64) ([]*Message, error) {
+	if err := s.authz.Can(ctx, UserSubject(userID1), ActionUserMessage, UserResource(userID2)); err != nil {
+		return nil, err
+	}
 	if limit <= 0 {
 		limit = 50 // Default limit
 	}
 	return s.messageRepo.FindConversationHistory(ctx, userID1, userID2, limit, beforeID)
 }
 
-// GetGroupConversationHistory retrieves a list of messages for a group.
-func (s *messageService) GetGroupConversationHistory(ctx context.Context, groupID int64, limit int, beforeID int64) ([]*Message, error) {
+// GetGroupConversationHistory retrieves a list of messages for a group. Only members may read it.
+func (s *messageService) GetGroupConversationHistory(ctx context.Context, requesterID, groupID int64, limit int, beforeID int64) ([]*Message, error) {
+	if err := s.authz.Can(ctx, UserSubject(requesterID), ActionGroupView, GroupResource(groupID)); err != nil {
+		return nil, err
+	}
 	if limit <= 0 {
 		limit = 50 // Default limit
 	}
 	return s.messageRepo.GetGroupConversationHistory(ctx, groupID, limit, beforeID)
 }
 
+// SearchMessages searches the messages of the conversations userID belongs to. Searching a group
+// the user cannot read is refused rather than returning nothing.
+func (s *messageService) SearchMessages(ctx context.Context, userID int64, search MessageSearch) ([]*MessageSearchResult, error) {
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		return nil, &ValidationError{Msg: "search query is required"}
+	}
+	if len(search.Query) > MaxSearchQueryLength {
+		return nil, &ValidationError{Msg: fmt.Sprintf("search query must be at most %d characters", MaxSearchQueryLength)}
+	}
+	if !search.Before.IsZero() && !search.After.IsZero() && !search.After.Before(search.Before) {
+		return nil, &ValidationError{Msg: "after must be earlier than before"}
+	}
+	if search.Conversation != nil && search.Conversation.GroupID != 0 {
+		if err := s.authz.Can(ctx, UserSubject(userID), ActionGroupView, GroupResource(search.Conversation.GroupID)); err != nil {
+			return nil, err
+		}
+	}
+	if search.Limit <= 0 || search.Limit > MaxSearchLimit {
+		search.Limit = DefaultSearchLimit
+	}
+	return s.messageRepo.Search(ctx, userID, search)
+}
+
 // GetRecentConversations retrieves the latest message from each of the user's conversations.
-func (s *messageService) GetRecentConversations(ctx context.Context, userID int64) ([]*Message, error) {
-	return s.messageRepo.GetRecentConversations(ctx, userID)
+func (s *messageService) GetRecentConversations(ctx context.Context, userID int64, includeArchived bool) ([]*Message, error) {
+	return s.messageRepo.GetRecentConversations(ctx, userID, includeArchived)
 }
 
 // GetPendingMessages retrieves all messages for a user marked as 'PENDING'.
@@ -65,75 +339,91 @@ func (s *messageService) MarkMessagesAsDelivered(ctx context.Context, messageIDs
 }
 
 // SendGroupMessage saves a message to the database and broadcasts it to all group members.
-func (s *messageService) SendGroupMessage(ctx context.Context, senderID int64, groupID int64, content string, mediaURL string, messageType MessageType) (*Message, error) {
-	// 1. Check if sender is a member of the group
-	memberIDs, err := s.groupRepo.FindMembersByGroupID(ctx, groupID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check group membership: %w", err)
-	}
-
-	isMember := false
-	for _, id := range memberIDs {
-		if id == senderID {
-			isMember = true
-			break
-		}
-	}
-
-	if !isMember {
-		return nil, errors.New("sender is not a member of this group")
+func (s *messageService) SendGroupMessage(ctx context.Context, senderID int64, groupID int64, content string, mediaURL string, mediaID string, attachment *AttachmentInfo, messageType MessageType) (*Message, error) {
+	// 1. Check that the sender is a member and the group's posting policy allows the post
+	if err := s.authz.Can(ctx, UserSubject(senderID), ActionGroupPost, GroupResource(groupID)); err != nil {
+		return nil, err
 	}
 
 	// 2. Create the message struct
+	sender, err := s.userRepo.GetByID(ctx, senderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sender: %w", err)
+	}
 	message := &Message{
 		SenderID:    senderID,
 		RecipientID: groupID, // Recipient is the Group ID
+		GroupID:     groupID,
 		Type:        messageType,
 		Content:     content,
 		MediaURL:    mediaURL,
+		MediaID:     mediaID,
+		Attachment:  attachment,
 		Timestamp:   time.Now(),
+		IsBot:       sender.IsBot,
 	}
 
 	// 3. Input Validation (Safety Check)
+	if err := s.attachMedia(ctx, message, groupID); err != nil {
+		return nil, err
+	}
+	return s.deliverGroupMessage(ctx, message)
+}
+
+// deliverGroupMessage saves a validated group message and broadcasts it to the group's members.
+func (s *messageService) deliverGroupMessage(ctx context.Context, message *Message) (*Message, error) {
 	if message.Content == "" && message.MediaURL == "" {
 		return nil, errors.New("message cannot be empty (no content or media URL provided)")
 	}
 
 	// 4. Save the message
-	savedMessage, err := s.messageRepo.Save(ctx, message)
+	savedMessage, err := s.saveGroupPost(ctx, message)
 	if err != nil {
+		if _, ok := err.(*PostingRestrictedError); ok {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to save message: %w", err)
 	}
 
 	// 5. Broadcast the message to all group members (WebSocket Hub)
-	s.hub.BroadcastGroupMessage(groupID, savedMessage)
+	s.hub.BroadcastGroupMessage(message.RecipientID, savedMessage)
 
 	return savedMessage, nil
 }
 
-
 // SendP2PMessage saves a message to the database and broadcasts it to the recipient and sender.
-func (s *messageService) SendP2PMessage(ctx context.Context, senderID int64, recipientID int64, content string, mediaURL string, messageType MessageType) (*Message, error) {
-	// 1. Check if recipient user exists
-	_, err := s.userRepo.GetByID(ctx, recipientID)
-	if err != nil {
-		if errors.Is(err, errors.New("user not found")) { // Assuming FindByID returns a "user not found" error
-			return nil, errors.New("recipient user not found")
-		}
-		return nil, fmt.Errorf("failed to check recipient existence: %w", err)
+func (s *messageService) SendP2PMessage(ctx context.Context, senderID int64, recipientID int64, content string, mediaURL string, mediaID string, attachment *AttachmentInfo, messageType MessageType) (*Message, error) {
+	// 1. Check that the recipient exists and may be messaged
+	if err := s.authz.Can(ctx, UserSubject(senderID), ActionUserMessage, UserResource(recipientID)); err != nil {
+		return nil, err
 	}
 
 	// 2. Create the message struct
+	sender, err := s.userRepo.GetByID(ctx, senderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sender: %w", err)
+	}
 	message := &Message{
 		SenderID:    senderID,
 		RecipientID: recipientID, // Recipient is the User ID
 		Type:        messageType,
 		Content:     content,
 		MediaURL:    mediaURL,
+		MediaID:     mediaID,
+		Attachment:  attachment,
 		Timestamp:   time.Now(),
+		IsBot:       sender.IsBot,
 	}
 
 	// 3. Input Validation (Safety Check)
+	if err := s.attachMedia(ctx, message, 0); err != nil {
+		return nil, err
+	}
+	return s.deliverP2PMessage(ctx, message)
+}
+
+// deliverP2PMessage saves a validated P2P message and broadcasts it to the sender and recipient.
+func (s *messageService) deliverP2PMessage(ctx context.Context, message *Message) (*Message, error) {
 	if message.Content == "" && message.MediaURL == "" {
 		return nil, errors.New("message cannot be empty (no content or media URL provided)")
 	}
@@ -145,7 +435,134 @@ func (s *messageService) SendP2PMessage(ctx context.Context, senderID int64, rec
 	}
 
 	// 5. Broadcast the message to the sender and recipient (WebSocket Hub)
-	s.hub.BroadcastP2PMessage(senderID, recipientID, savedMessage)
+	s.hub.BroadcastP2PMessage(message.SenderID, message.RecipientID, savedMessage)
 
 	return savedMessage, nil
 }
+
+// ForwardMessage copies a message into each target conversation. The forwarder must be able to
+// see the original and post to every target; targets are all checked first and the copies are
+// saved together, with slow mode and the quota applied to each group copy, so a refused target or
+// a failed save sends nothing. Copies reuse the original's upload, which still counts towards group
+// quotas, and are broadcast like any other message.
+func (s *messageService) ForwardMessage(ctx context.Context, userID, messageID int64, targets []Conversation) ([]*Message, error) {
+	if len(targets) == 0 {
+		return nil, &ValidationError{Msg: "at least one user or group to forward to is required"}
+	}
+	if len(targets) > MaxForwardTargets {
+		return nil, &ValidationError{Msg: fmt.Sprintf("a message can be forwarded to at most %d conversations at once", MaxForwardTargets)}
+	}
+
+	// 1. Check that the forwarder can see the original
+	subject := UserSubject(userID)
+	if err := s.authz.Can(ctx, subject, ActionMessageView, MessageResource(messageID)); err != nil {
+		return nil, err
+	}
+	original, err := s.messageRepo.FindByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load message: %w", err)
+	}
+	if original == nil {
+		return nil, &NotFoundError{Msg: "message not found"}
+	}
+	switch original.Type {
+	case "", TextMessage, ImageMessage, FileMessage, AudioMessage, VideoMessage, VoiceNoteMessage:
+	default:
+		return nil, &ValidationError{Msg: fmt.Sprintf("%s messages cannot be forwarded", original.Type)}
+	}
+	if original.MediaID != "" {
+		media, err := s.mediaRepo.FindByID(ctx, original.MediaID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load media: %w", err)
+		}
+		if media == nil || media.Status != MediaReady {
+			return nil, &ValidationError{Msg: "the message's media is no longer available"}
+		}
+	}
+
+	provenance := original.ForwardedFrom
+	if provenance == nil {
+		provenance = &ForwardInfo{MessageID: original.ID, SenderID: original.SenderID, GroupID: original.GroupID, Timestamp: original.Timestamp}
+	}
+	if original.Content == "" && original.MediaURL == "" {
+		return nil, &ValidationError{Msg: "empty messages cannot be forwarded"}
+	}
+
+	// 2. Check every target before sending anything
+	seen := make(map[Conversation]bool, len(targets))
+	unique := make([]Conversation, 0, len(targets))
+	for _, target := range targets {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+
+		if target.GroupID != 0 {
+			err = s.authz.Can(ctx, subject, ActionGroupPost, GroupResource(target.GroupID))
+			if err == nil && original.MediaID != "" {
+				err = s.checkGroupQuota(ctx, target.GroupID, original.MediaID)
+			}
+		} else if target.PeerID == userID {
+			err = &ValidationError{Msg: "cannot forward a message to yourself"}
+		} else {
+			err = s.authz.Can(ctx, subject, ActionUserMessage, UserResource(target.PeerID))
+		}
+		if err != nil {
+			return nil, err
+		}
+		unique = append(unique, target)
+	}
+
+	// 3. Save a copy for each target, all or nothing
+	sender, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sender: %w", err)
+	}
+	forwarded := make([]*Message, 0, len(unique))
+	limits := make(map[int64]GroupPostLimits)
+	groups := make(map[int64]*Group)
+	for _, target := range unique {
+		message := &Message{
+			SenderID:      userID,
+			Type:          original.Type,
+			Content:       original.Content,
+			MediaURL:      original.MediaURL,
+			MediaID:       original.MediaID,
+			Image:         original.Image,
+			Attachment:    original.Attachment,
+			ForwardedFrom: provenance,
+			Timestamp:     time.Now(),
+			IsBot:         sender.IsBot,
+		}
+		if target.GroupID != 0 {
+			message.RecipientID = target.GroupID
+			message.GroupID = target.GroupID
+			group, groupLimits, err := s.groupPostLimits(ctx, message)
+			if err != nil {
+				return nil, err
+			}
+			groups[target.GroupID] = group
+			limits[target.GroupID] = groupLimits
+		} else {
+			message.RecipientID = target.PeerID
+		}
+		forwarded = append(forwarded, message)
+	}
+	refused, err := s.messageRepo.SaveAll(ctx, forwarded, limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save forwarded messages: %w", err)
+	}
+	if refused != nil {
+		return nil, s.groupPostRefusal(ctx, refused, groups[refused.GroupID], limits[refused.GroupID])
+	}
+
+	// 4. Broadcast the copies
+	for _, message := range forwarded {
+		if message.GroupID != 0 {
+			s.hub.BroadcastGroupMessage(message.GroupID, message)
+		} else {
+			s.hub.BroadcastP2PMessage(message.SenderID, message.RecipientID, message)
+		}
+	}
+	return forwarded, nil
+}
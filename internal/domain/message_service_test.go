@@ -0,0 +1,235 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Fixture users and groups for the forwarding tests.
+const (
+	forwarder     int64 = 1
+	peer          int64 = 2
+	stranger      int64 = 3
+	openGroup     int64 = 1 // shares its ID with the forwarder
+	closedGroup   int64 = 10
+	slowGroup     int64 = 11  // in slow mode; the forwarder posted there a moment ago
+	groupPost     int64 = 100 // sent by peer to openGroup
+	directMessage int64 = 101 // sent by peer to the forwarder
+	forwardedPost int64 = 102 // a forward of groupPost
+	pollMessage   int64 = 103
+)
+
+// fakeAuthorizer refuses the resources in refused and allows everything else.
+type fakeAuthorizer struct {
+	refused map[Resource]error
+}
+
+func (f *fakeAuthorizer) Can(ctx context.Context, subject Subject, action Action, resource Resource) error {
+	return f.refused[resource]
+}
+
+type fakeMessageRepo struct {
+	MessageRepository
+	saveErr error
+	saved   []*Message
+}
+
+func (f *fakeMessageRepo) FindByID(ctx context.Context, id int64) (*Message, error) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	switch id {
+	case groupPost:
+		return &Message{ID: id, SenderID: peer, RecipientID: openGroup, GroupID: openGroup, Type: TextMessage, Content: "hi all", Timestamp: at}, nil
+	case directMessage:
+		return &Message{ID: id, SenderID: peer, RecipientID: forwarder, Type: TextMessage, Content: "hi you", Timestamp: at}, nil
+	case forwardedPost:
+		return &Message{ID: id, SenderID: stranger, RecipientID: peer, Type: TextMessage, Content: "hi all", Timestamp: at,
+			ForwardedFrom: &ForwardInfo{MessageID: groupPost, SenderID: peer, GroupID: openGroup, Timestamp: at}}, nil
+	case pollMessage:
+		return &Message{ID: id, SenderID: peer, RecipientID: forwarder, Type: MessageType("poll"), Content: "?", Timestamp: at}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeMessageRepo) Save(ctx context.Context, message *Message) (*Message, error) {
+	message.ID = int64(1000 + len(f.saved))
+	f.saved = append(f.saved, message)
+	return message, nil
+}
+
+func (f *fakeMessageRepo) SaveAll(ctx context.Context, messages []*Message, limits map[int64]GroupPostLimits) (*Message, error) {
+	if f.saveErr != nil {
+		return nil, f.saveErr
+	}
+	for _, message := range messages {
+		// The forwarder's last post to slowGroup was a second ago.
+		if since := limits[message.GroupID].PostedSince; message.GroupID == slowGroup && time.Now().Add(-time.Second).After(since) {
+			return message, nil
+		}
+	}
+	for _, message := range messages {
+		message.ID = int64(1000 + len(f.saved))
+		f.saved = append(f.saved, message)
+	}
+	return nil, nil
+}
+
+// fakeGroupRepo puts slowGroup in a one minute slow mode.
+type fakeGroupRepo struct {
+	GroupRepository
+}
+
+func (f *fakeGroupRepo) FindByID(ctx context.Context, groupID int64) (*Group, error) {
+	if groupID == slowGroup {
+		return &Group{ID: groupID, PostingPolicy: PostingSlowMode, SlowModeSeconds: 60}, nil
+	}
+	return &Group{ID: groupID, PostingPolicy: PostingEveryone}, nil
+}
+
+func (f *fakeGroupRepo) FindMember(ctx context.Context, groupID, userID int64) (*GroupMember, error) {
+	return &GroupMember{GroupID: groupID, UserID: userID}, nil
+}
+
+type fakeUserRepo struct {
+	UserRepository
+}
+
+func (f *fakeUserRepo) GetByID(ctx context.Context, id int64) (*User, error) {
+	return &User{ID: id}, nil
+}
+
+// fakeHub records the conversations messages were broadcast to.
+type fakeHub struct {
+	broadcasts []Conversation
+}
+
+func (f *fakeHub) BroadcastGroupMessage(groupID int64, message *Message) {
+	f.broadcasts = append(f.broadcasts, Conversation{GroupID: groupID})
+}
+
+func (f *fakeHub) BroadcastP2PMessage(senderID int64, recipientID int64, message *Message) {
+	f.broadcasts = append(f.broadcasts, Conversation{PeerID: recipientID})
+}
+
+func newForwardingService(messages *fakeMessageRepo, hub *fakeHub) MessageService {
+	authz := &fakeAuthorizer{refused: map[Resource]error{
+		GroupResource(closedGroup): &ForbiddenError{Msg: "not a member"},
+		UserResource(stranger):     &NotFoundError{Msg: "user not found"},
+	}}
+	return NewMessageService(messages, &fakeUserRepo{}, &fakeGroupRepo{}, nil, nil, StorageQuotas{}, authz, hub)
+}
+
+func TestForwardMessageRecordsProvenance(t *testing.T) {
+	tests := []struct {
+		name      string
+		messageID int64
+		want      ForwardInfo
+	}{
+		{"group message", groupPost, ForwardInfo{MessageID: groupPost, SenderID: peer, GroupID: openGroup}},
+		{"P2P message to a user sharing a group's ID", directMessage, ForwardInfo{MessageID: directMessage, SenderID: peer}},
+		{"forward of a forward keeps the original", forwardedPost, ForwardInfo{MessageID: groupPost, SenderID: peer, GroupID: openGroup}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, hub := &fakeMessageRepo{}, &fakeHub{}
+			forwarded, err := newForwardingService(messages, hub).ForwardMessage(context.Background(), forwarder, tt.messageID, []Conversation{{PeerID: peer}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(forwarded) != 1 || forwarded[0].ForwardedFrom == nil {
+				t.Fatalf("forwarded = %+v, want one forwarded message", forwarded)
+			}
+			got := *forwarded[0].ForwardedFrom
+			got.Timestamp = time.Time{}
+			if got != tt.want {
+				t.Errorf("ForwardedFrom = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardMessageDeliversEveryTarget(t *testing.T) {
+	messages, hub := &fakeMessageRepo{}, &fakeHub{}
+	targets := []Conversation{{GroupID: openGroup}, {PeerID: peer}, {GroupID: openGroup}}
+	forwarded, err := newForwardingService(messages, hub).ForwardMessage(context.Background(), forwarder, groupPost, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forwarded) != 2 || len(messages.saved) != 2 {
+		t.Fatalf("forwarded %d and saved %d messages, want 2 (duplicates are dropped)", len(forwarded), len(messages.saved))
+	}
+
+	group, direct := forwarded[0], forwarded[1]
+	if group.GroupID != openGroup || group.RecipientID != openGroup {
+		t.Errorf("group copy has GroupID %d and RecipientID %d, want both %d", group.GroupID, group.RecipientID, openGroup)
+	}
+	if direct.GroupID != 0 || direct.RecipientID != peer {
+		t.Errorf("P2P copy has GroupID %d and RecipientID %d, want 0 and %d", direct.GroupID, direct.RecipientID, peer)
+	}
+	for _, message := range forwarded {
+		if message.SenderID != forwarder || message.Content != "hi all" {
+			t.Errorf("copy = %+v, want the original's content sent by the forwarder", message)
+		}
+	}
+	if len(hub.broadcasts) != 2 || hub.broadcasts[0] != (Conversation{GroupID: openGroup}) || hub.broadcasts[1] != (Conversation{PeerID: peer}) {
+		t.Errorf("broadcasts = %+v", hub.broadcasts)
+	}
+}
+
+func TestForwardMessageSendsNothingOnError(t *testing.T) {
+	var validation *ValidationError
+	var forbidden *ForbiddenError
+	var notFound *NotFoundError
+	var restricted *PostingRestrictedError
+	saveErr := errors.New("disk full")
+
+	tests := []struct {
+		name      string
+		messageID int64
+		targets   []Conversation
+		saveErr   error
+		want      interface{}
+	}{
+		{"no targets", groupPost, nil, nil, &validation},
+		{"too many targets", groupPost, make([]Conversation, MaxForwardTargets+1), nil, &validation},
+		{"missing message", 199, []Conversation{{PeerID: peer}}, nil, &notFound},
+		{"unforwardable type", pollMessage, []Conversation{{PeerID: peer}}, nil, &validation},
+		{"forward to self", groupPost, []Conversation{{PeerID: peer}, {PeerID: forwarder}}, nil, &validation},
+		{"refused group after allowed target", groupPost, []Conversation{{PeerID: peer}, {GroupID: closedGroup}}, nil, &forbidden},
+		{"refused user after allowed target", groupPost, []Conversation{{GroupID: openGroup}, {PeerID: stranger}}, nil, &notFound},
+		{"slow mode group within the interval", groupPost, []Conversation{{PeerID: peer}, {GroupID: slowGroup}}, nil, &restricted},
+		{"failed save", groupPost, []Conversation{{GroupID: openGroup}, {PeerID: peer}}, saveErr, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, hub := &fakeMessageRepo{saveErr: tt.saveErr}, &fakeHub{}
+			forwarded, err := newForwardingService(messages, hub).ForwardMessage(context.Background(), forwarder, tt.messageID, tt.targets)
+			switch {
+			case err == nil:
+				t.Fatal("expected an error")
+			case tt.want == nil && !errors.Is(err, saveErr):
+				t.Errorf("got error %v, want %v", err, saveErr)
+			case tt.want != nil && !errors.As(err, tt.want):
+				t.Errorf("got error %T (%v), want %T", err, err, tt.want)
+			}
+			if forwarded != nil || len(messages.saved) != 0 || len(hub.broadcasts) != 0 {
+				t.Errorf("returned %d, saved %d and broadcast %d messages; want none", len(forwarded), len(messages.saved), len(hub.broadcasts))
+			}
+		})
+	}
+}
+
+func TestSaveSystemNoticeKeepsItPendingForTheUser(t *testing.T) {
+	messages := &fakeMessageRepo{}
+	notice, err := newForwardingService(messages, &fakeHub{}).SaveSystemNotice(context.Background(), peer, "upload rejected", "m1", MessagePending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages.saved) != 1 || messages.saved[0] != notice {
+		t.Fatalf("saved %+v, want the notice", messages.saved)
+	}
+	if notice.Type != SystemMessage || notice.RecipientID != peer || notice.GroupID != 0 || notice.Status != MessagePending || notice.MediaID != "m1" {
+		t.Errorf("notice = %+v, want a pending system message to user %d about m1", notice, peer)
+	}
+}
@@ -0,0 +1,202 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oidcLoginExpiry is how long the user has to complete the login at the provider.
+const oidcLoginExpiry = 10 * time.Minute
+
+// usernameDisallowed matches characters dropped when deriving a username from provider claims.
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// oidcService is the concrete implementation of the OIDCService interface.
+type oidcService struct {
+	provider     IdentityProvider
+	identityRepo IdentityRepository
+	userRepo     UserRepository
+}
+
+// NewOIDCService creates a new OIDCService for a single provider.
+func NewOIDCService(provider IdentityProvider, identityRepo IdentityRepository, userRepo UserRepository) OIDCService {
+	return &oidcService{
+		provider:     provider,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+	}
+}
+
+// BeginLogin creates the state, nonce and PKCE verifier and returns the authorization URL.
+func (s *oidcService) BeginLogin(ctx context.Context) (string, error) {
+	state, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	loginState := &OIDCLoginState{
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcLoginExpiry),
+	}
+	if err := s.identityRepo.SaveLoginState(ctx, loginState); err != nil {
+		return "", fmt.Errorf("failed to save login state: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	return s.provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+}
+
+// CompleteLogin redeems the code and maps the provider identity to a local user:
+// a known subject logs in as its linked user; otherwise a user with the same email is linked,
+// provided both the provider and the local account verified it; otherwise a new user is created.
+func (s *oidcService) CompleteLogin(ctx context.Context, state, code string) (*User, error) {
+	loginState, err := s.identityRepo.ConsumeLoginState(ctx, hashToken(state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load login state: %w", err)
+	}
+	if loginState == nil || time.Now().After(loginState.ExpiresAt) {
+		return nil, &UnauthorizedError{Msg: "invalid or expired login state"}
+	}
+
+	identity, err := s.provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Returning user
+	linked, err := s.identityRepo.FindIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up identity: %w", err)
+	}
+	if linked != nil {
+		user, err := s.userRepo.GetByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user.IsDisabled() {
+			return nil, &AccountDisabledError{}
+		}
+		return user, nil
+	}
+
+	if identity.Email == "" {
+		return nil, &ValidationError{Msg: "identity provider did not return an email address"}
+	}
+
+	// 2. Existing account with the same email: only linked if the provider verified the address
+	user, err := s.userRepo.GetByEmail(ctx, identity.Email)
+	if err != nil {
+		if _, ok := err.(*NotFoundError); !ok {
+			return nil, err
+		}
+		user = nil
+	}
+	if user != nil && user.IsDisabled() {
+		return nil, &AccountDisabledError{}
+	}
+	if user != nil && !identity.EmailVerified {
+		return nil, &ConflictError{Msg: "an account with this email exists, but the identity provider has not verified the address"}
+	}
+	// Whoever registered an unverified account may not own the address: linking it would let them
+	// keep a password login into the provider user's account.
+	if user != nil && !user.IsEmailVerified() {
+		return nil, &ConflictError{Msg: "an account with this email exists but its address is not verified; verify it before signing in with the identity provider"}
+	}
+
+	// 3. First login: provision a user without a usable password
+	if user == nil {
+		if user, err = s.provisionUser(ctx, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.identityRepo.LinkIdentity(ctx, &UserIdentity{
+		Provider:  identity.Issuer,
+		Subject:   identity.Subject,
+		UserID:    user.ID,
+		Email:     identity.Email,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	// Accounts provisioned above start unverified; the provider vouches for the address.
+	if identity.EmailVerified && !user.IsEmailVerified() {
+		now := time.Now()
+		if err := s.userRepo.MarkEmailVerified(ctx, user.ID, now); err != nil {
+			log.Printf("Failed to mark email of user %d as verified: %v", user.ID, err)
+		} else {
+			user.EmailVerifiedAt = &now
+		}
+	}
+
+	log.Printf("Linked %s identity %s to user %d", identity.Issuer, identity.Subject, user.ID)
+	return user, nil
+}
+
+// provisionUser creates a local account for a first-time SSO user. The random password hash
+// means the account can only log in through the provider (or after a password reset).
+func (s *oidcService) provisionUser(ctx context.Context, identity *ExternalIdentity) (*User, error) {
+	username, err := s.availableUsername(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userRepo.Create(ctx, NewUser(username, identity.Email, string(hashedPassword)))
+}
+
+// availableUsername derives a username from the provider claims, adding a numeric suffix if taken.
+func (s *oidcService) availableUsername(ctx context.Context, identity *ExternalIdentity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = usernameDisallowed.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = "user" + base
+	}
+
+	candidate := base
+	for i := 2; i < 100; i++ {
+		_, err := s.userRepo.GetByUsername(ctx, candidate)
+		if _, ok := err.(*NotFoundError); ok {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+
+	suffix, err := randomToken(4)
+	if err != nil {
+		return "", err
+	}
+	return base + "-" + suffix, nil
+}
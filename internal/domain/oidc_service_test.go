@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeIdentityProvider returns its identity for every code.
+type fakeIdentityProvider struct {
+	IdentityProvider
+	identity *ExternalIdentity
+}
+
+func (f *fakeIdentityProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error) {
+	copied := *f.identity
+	return &copied, nil
+}
+
+type fakeIdentityRepo struct {
+	IdentityRepository
+	identities map[string]int64 // subject -> user ID
+}
+
+func (f *fakeIdentityRepo) ConsumeLoginState(ctx context.Context, stateHash string) (*OIDCLoginState, error) {
+	if stateHash != hashToken("state") {
+		return nil, nil
+	}
+	return &OIDCLoginState{StateHash: stateHash, ExpiresAt: time.Now().Add(time.Minute)}, nil
+}
+
+func (f *fakeIdentityRepo) FindIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error) {
+	userID, ok := f.identities[subject]
+	if !ok {
+		return nil, nil
+	}
+	return &UserIdentity{Provider: provider, Subject: subject, UserID: userID}, nil
+}
+
+func (f *fakeIdentityRepo) LinkIdentity(ctx context.Context, identity *UserIdentity) error {
+	f.identities[identity.Subject] = identity.UserID
+	return nil
+}
+
+type fakeOIDCUsers struct {
+	UserRepository
+	users map[int64]*User
+}
+
+func (f *fakeOIDCUsers) GetByID(ctx context.Context, id int64) (*User, error) {
+	if user, ok := f.users[id]; ok {
+		return user, nil
+	}
+	return nil, &NotFoundError{Msg: "user not found"}
+}
+
+func (f *fakeOIDCUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, &NotFoundError{Msg: "user not found"}
+}
+
+func (f *fakeOIDCUsers) GetByUsername(ctx context.Context, username string) (*User, error) {
+	for _, user := range f.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, &NotFoundError{Msg: "user not found"}
+}
+
+func (f *fakeOIDCUsers) Create(ctx context.Context, user *User) (*User, error) {
+	user.ID = int64(len(f.users) + 1)
+	f.users[user.ID] = user
+	return user, nil
+}
+
+func (f *fakeOIDCUsers) MarkEmailVerified(ctx context.Context, userID int64, at time.Time) error {
+	f.users[userID].EmailVerifiedAt = &at
+	return nil
+}
+
+func TestCompleteLogin(t *testing.T) {
+	verifiedAt := time.Now()
+	tests := []struct {
+		name          string
+		existing      *User // Registered locally with the provider identity's email
+		linked        bool  // The provider subject is already linked to the existing user
+		emailVerified bool  // The provider verified the email
+		wantErr       interface{}
+		wantUser      int64 // 0: a new user is created
+	}{
+		{"new user", nil, false, true, nil, 0},
+		{"new user with unverified provider email", nil, false, false, nil, 0},
+		{"links verified local account", &User{ID: 1, Email: "ann@example.com", EmailVerifiedAt: &verifiedAt}, false, true, nil, 1},
+		{"refuses unverified provider email", &User{ID: 1, Email: "ann@example.com", EmailVerifiedAt: &verifiedAt}, false, false, &ConflictError{}, 0},
+		{"refuses unverified local account", &User{ID: 1, Email: "ann@example.com"}, false, true, &ConflictError{}, 0},
+		{"returning user", &User{ID: 1, Email: "ann@example.com"}, true, false, nil, 1},
+		{"disabled returning user", &User{ID: 1, Email: "ann@example.com", DisabledAt: &verifiedAt}, true, true, &AccountDisabledError{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeOIDCUsers{users: map[int64]*User{}}
+			identities := &fakeIdentityRepo{identities: map[string]int64{}}
+			if tt.existing != nil {
+				users.users[tt.existing.ID] = tt.existing
+				if tt.linked {
+					identities.identities["subject"] = tt.existing.ID
+				}
+			}
+			provider := &fakeIdentityProvider{identity: &ExternalIdentity{
+				Issuer: "https://idp.example.com", Subject: "subject", Email: "ann@example.com", EmailVerified: tt.emailVerified,
+			}}
+			service := NewOIDCService(provider, identities, users)
+
+			user, err := service.CompleteLogin(context.Background(), "state", "code")
+			if tt.wantErr != nil {
+				if err == nil || typeName(err) != typeName(tt.wantErr) {
+					t.Fatalf("got error %v (%T), want %T", err, err, tt.wantErr)
+				}
+				if _, ok := identities.identities["subject"]; ok && !tt.linked {
+					t.Error("linked the identity despite refusing the login")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantUser != 0 && user.ID != tt.wantUser {
+				t.Errorf("logged in as user %d, want %d", user.ID, tt.wantUser)
+			}
+			if tt.wantUser == 0 && (tt.existing != nil && user.ID == tt.existing.ID) {
+				t.Errorf("logged in as the existing user %d, want a new one", user.ID)
+			}
+			if identities.identities["subject"] != user.ID {
+				t.Errorf("identity linked to user %d, want %d", identities.identities["subject"], user.ID)
+			}
+			if user.IsEmailVerified() != (tt.emailVerified || tt.existing != nil && tt.existing.IsEmailVerified()) {
+				t.Errorf("email verified = %v", user.IsEmailVerified())
+			}
+		})
+	}
+}
+
+func TestCompleteLoginRejectsUnknownState(t *testing.T) {
+	provider := &fakeIdentityProvider{identity: &ExternalIdentity{Subject: "subject", Email: "ann@example.com", EmailVerified: true}}
+	service := NewOIDCService(provider, &fakeIdentityRepo{identities: map[string]int64{}}, &fakeOIDCUsers{users: map[int64]*User{}})
+	if _, err := service.CompleteLogin(context.Background(), "forged", "code"); typeName(err) != typeName(&UnauthorizedError{}) {
+		t.Errorf("got error %v, want *UnauthorizedError", err)
+	}
+}
+
+// typeName names the dynamic type of an error, to compare error kinds.
+func typeName(v interface{}) string {
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Pins and stars. Pins are shared by everyone in a conversation; stars are private bookmarks.
+const (
+	// MaxPinsPerConversation caps the messages pinned in one conversation.
+	MaxPinsPerConversation = 50
+	DefaultStarredLimit    = 20
+	MaxStarredLimit        = 100
+)
+
+// Hub events telling the participants of a conversation that a message was pinned or unpinned.
+// They carry the message ID, the user who pinned or unpinned it and the conversation.
+const (
+	MessagePinnedEvent   MessageType = "message_pinned"
+	MessageUnpinnedEvent MessageType = "message_unpinned"
+)
+
+// PinnedMessage is a message pinned in its conversation.
+type PinnedMessage struct {
+	Message
+	PinnedBy int64     `json:"pinned_by" db:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at" db:"pinned_at"`
+}
+
+// StarredMessage is a message a user starred. StarID orders a user's stars and is the listing cursor.
+type StarredMessage struct {
+	Message
+	StarID    int64     `json:"-" db:"star_id"`
+	StarredAt time.Time `json:"starred_at" db:"starred_at"`
+}
+
+// PinNotifier tells the participants of a conversation about pin changes; implemented by the WebSocket hub.
+type PinNotifier interface {
+	// MessagePinned tells the members of groupID, or both P2P participants when groupID is 0.
+	MessagePinned(actorID, groupID int64, message *Message, pinned bool)
+}
+
+// PinRepository defines the data access operations for pinned and starred messages.
+// Pins of group messages are stored with their group; pins of P2P messages without one.
+type PinRepository interface {
+	// Pin reports false if the message was already pinned or its conversation already has
+	// maxPins pins, counted in the same statement as the insert.
+	Pin(ctx context.Context, message *Message, pinnedBy int64, pinnedAt time.Time, maxPins int) (bool, error)
+	// Unpin reports false if the message was not pinned.
+	Unpin(ctx context.Context, messageID int64) (bool, error)
+	// CountGroupPins and CountP2PPins count the pins of a conversation.
+	CountGroupPins(ctx context.Context, groupID int64) (int, error)
+	CountP2PPins(ctx context.Context, userID1, userID2 int64) (int, error)
+	// FindGroupPins and FindP2PPins return the pins of a conversation, most recently pinned first.
+	FindGroupPins(ctx context.Context, groupID int64) ([]*PinnedMessage, error)
+	FindP2PPins(ctx context.Context, userID1, userID2 int64) ([]*PinnedMessage, error)
+	// Star is a no-op if the user already starred the message.
+	Star(ctx context.Context, userID, messageID int64, starredAt time.Time) error
+	// Unstar is a no-op if the user had not starred the message.
+	Unstar(ctx context.Context, userID, messageID int64) error
+	// FindStarred returns the starred messages the user can still see, most recently starred first,
+	// starting below the star ID beforeID (0 for the first page).
+	FindStarred(ctx context.Context, userID, beforeID int64, limit int) ([]*StarredMessage, error)
+}
+
+// PinService defines the business operations on pinned and starred messages.
+type PinService interface {
+	// PinMessage pins a message in its conversation: any participant of a P2P conversation
+	// may pin, while in groups only admins may.
+	PinMessage(ctx context.Context, userID, messageID int64) error
+	UnpinMessage(ctx context.Context, userID, messageID int64) error
+	// ListPins returns the pins of a conversation the user belongs to.
+	ListPins(ctx context.Context, userID int64, conversation Conversation) ([]*PinnedMessage, error)
+	// StarMessage and UnstarMessage bookmark a message the user can see, for them only.
+	StarMessage(ctx context.Context, userID, messageID int64) error
+	UnstarMessage(ctx context.Context, userID, messageID int64) error
+	// ListStarred returns the user's starred messages, most recently starred first.
+	ListStarred(ctx context.Context, userID, beforeID int64, limit int) ([]*StarredMessage, error)
+}
@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// pinService is the concrete implementation of the PinService interface.
+type pinService struct {
+	pinRepo     PinRepository
+	messageRepo MessageRepository
+	authz       Authorizer
+	notifier    PinNotifier
+}
+
+// NewPinService creates a new instance of the PinService.
+func NewPinService(pinRepo PinRepository, messageRepo MessageRepository, authz Authorizer, notifier PinNotifier) PinService {
+	return &pinService{
+		pinRepo:     pinRepo,
+		messageRepo: messageRepo,
+		authz:       authz,
+		notifier:    notifier,
+	}
+}
+
+// PinMessage pins a message, refusing a second pin of the same message and conversations
+// that already have MaxPinsPerConversation pins, and tells the conversation about it.
+func (s *pinService) PinMessage(ctx context.Context, userID, messageID int64) error {
+	message, groupID, err := s.loadPinnable(ctx, userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	pinned, err := s.pinRepo.Pin(ctx, message, userID, time.Now(), MaxPinsPerConversation)
+	if err != nil {
+		return fmt.Errorf("failed to pin message: %w", err)
+	}
+	if !pinned {
+		// The insert does not say which check refused it; count the pins to tell.
+		var count int
+		if groupID != 0 {
+			count, err = s.pinRepo.CountGroupPins(ctx, groupID)
+		} else {
+			count, err = s.pinRepo.CountP2PPins(ctx, message.SenderID, message.RecipientID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to count pins: %w", err)
+		}
+		if count >= MaxPinsPerConversation {
+			return &ConflictError{Msg: fmt.Sprintf("a conversation can have at most %d pinned messages", MaxPinsPerConversation)}
+		}
+		return &ConflictError{Msg: "message is already pinned"}
+	}
+
+	s.notifier.MessagePinned(userID, groupID, message, true)
+	return nil
+}
+
+// UnpinMessage unpins a message and tells the conversation about it.
+func (s *pinService) UnpinMessage(ctx context.Context, userID, messageID int64) error {
+	message, groupID, err := s.loadPinnable(ctx, userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	unpinned, err := s.pinRepo.Unpin(ctx, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to unpin message: %w", err)
+	}
+	if !unpinned {
+		return &NotFoundError{Msg: "message is not pinned"}
+	}
+
+	s.notifier.MessagePinned(userID, groupID, message, false)
+	return nil
+}
+
+// loadPinnable checks that the user may pin or unpin the message and returns it with its
+// group ID (0 for P2P messages).
+func (s *pinService) loadPinnable(ctx context.Context, userID, messageID int64) (*Message, int64, error) {
+	if err := s.authz.Can(ctx, UserSubject(userID), ActionMessagePin, MessageResource(messageID)); err != nil {
+		return nil, 0, err
+	}
+
+	message, err := s.messageRepo.FindByID(ctx, messageID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load message: %w", err)
+	}
+	if message == nil {
+		return nil, 0, &NotFoundError{Msg: "message not found"}
+	}
+	return message, message.GroupID, nil
+}
+
+// ListPins returns the pins of a group the user is a member of, or of their P2P conversation with a peer.
+func (s *pinService) ListPins(ctx context.Context, userID int64, conversation Conversation) ([]*PinnedMessage, error) {
+	if conversation.GroupID != 0 {
+		if err := s.authz.Can(ctx, UserSubject(userID), ActionGroupView, GroupResource(conversation.GroupID)); err != nil {
+			return nil, err
+		}
+		return s.pinRepo.FindGroupPins(ctx, conversation.GroupID)
+	}
+
+	if err := s.authz.Can(ctx, UserSubject(userID), ActionUserMessage, UserResource(conversation.PeerID)); err != nil {
+		return nil, err
+	}
+	return s.pinRepo.FindP2PPins(ctx, userID, conversation.PeerID)
+}
+
+// StarMessage stars a message the user can see.
+func (s *pinService) StarMessage(ctx context.Context, userID, messageID int64) error {
+	if err := s.authz.Can(ctx, UserSubject(userID), ActionMessageView, MessageResource(messageID)); err != nil {
+		return err
+	}
+	return s.pinRepo.Star(ctx, userID, messageID, time.Now())
+}
+
+// UnstarMessage removes a star, even from a message the user can no longer see.
+func (s *pinService) UnstarMessage(ctx context.Context, userID, messageID int64) error {
+	return s.pinRepo.Unstar(ctx, userID, messageID)
+}
+
+// ListStarred returns a page of the user's starred messages.
+func (s *pinService) ListStarred(ctx context.Context, userID, beforeID int64, limit int) ([]*StarredMessage, error) {
+	if limit <= 0 || limit > MaxStarredLimit {
+		limit = DefaultStarredLimit
+	}
+	return s.pinRepo.FindStarred(ctx, userID, beforeID, limit)
+}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Session is a server-side login session. Every access token carries its session ID,
+// and the session's refresh tokens are rotated on each use.
+type Session struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     int64      `json:"user_id" db:"user_id"`
+	DeviceName string     `json:"device_name" db:"device_name"`
+	IPAddress  string     `json:"ip_address" db:"ip_address"`
+	UserAgent  string     `json:"user_agent" db:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// SessionDevice describes the client a session was started from.
+type SessionDevice struct {
+	DeviceName string // Client-supplied label, e.g. "Pixel 8" (optional)
+	IPAddress  string
+	UserAgent  string
+}
+
+// IsRevoked reports whether the session has been logged out or otherwise revoked.
+func (s *Session) IsRevoked() bool {
+	return s.RevokedAt != nil
+}
+
+// RefreshToken is a single-use token that can be exchanged for a new access/refresh token pair.
+// Only a hash of the token is stored.
+type RefreshToken struct {
+	TokenHash string     `db:"token_hash"`
+	SessionID string     `db:"session_id"`
+	UserID    int64      `db:"user_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	CreatedAt time.Time  `db:"created_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// UnauthorizedError is returned when credentials (e.g. a refresh token) are invalid, expired or revoked.
+type UnauthorizedError struct {
+	Msg string
+}
+func (e *UnauthorizedError) Error() string { return "Unauthorized Error: " + e.Msg }
+
+// ---------------------------------------------
+// SESSION INTERFACES
+// ---------------------------------------------
+
+// SessionService manages login sessions, refresh token rotation and access token revocation.
+type SessionService interface {
+	// StartSession creates a session for a freshly authenticated user and returns its first refresh token.
+	StartSession(ctx context.Context, userID int64, device SessionDevice) (*Session, string, error)
+	// Refresh exchanges a refresh token for a new one. Presenting an already used token revokes the whole session.
+	Refresh(ctx context.Context, refreshToken string) (*Session, string, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	// ListSessions returns the user's sessions that are still usable, most recently used first.
+	ListSessions(ctx context.Context, userID int64) ([]*Session, error)
+	// RevokeUserSession revokes one of the user's own sessions; other users' sessions are reported as not found.
+	RevokeUserSession(ctx context.Context, userID int64, sessionID string) error
+	// RevokeAllSessions logs the user out everywhere, e.g. after a password reset.
+	RevokeAllSessions(ctx context.Context, userID int64) error
+	// RevokeAccessToken adds a token ID to the denylist until the token would have expired anyway.
+	RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// IsAccessTokenRevoked reports whether the token was denylisted or its session revoked.
+	IsAccessTokenRevoked(ctx context.Context, tokenID, sessionID string) (bool, error)
+}
+
+// SessionRepository defines the data access operations for sessions, refresh tokens and the token denylist.
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *Session) error
+	FindSession(ctx context.Context, sessionID string) (*Session, error)
+	FindSessionsByUser(ctx context.Context, userID int64) ([]*Session, error)
+	TouchSession(ctx context.Context, sessionID string, lastUsedAt time.Time) error
+	RevokeSession(ctx context.Context, sessionID string, revokedAt time.Time) error
+	RevokeUserSessions(ctx context.Context, userID int64, revokedAt time.Time) error
+
+	SaveRefreshToken(ctx context.Context, token *RefreshToken) error
+	FindRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	// MarkRefreshTokenUsed flags a token as used. It reports false if the token had already been used.
+	MarkRefreshTokenUsed(ctx context.Context, tokenHash string, usedAt time.Time) (bool, error)
+
+	DenyToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsTokenDenied(ctx context.Context, tokenID string) (bool, error)
+	// DeleteExpiredDeniedTokens removes denylist entries for tokens that expired before now,
+	// which would be rejected anyway. It returns the number of entries removed.
+	DeleteExpiredDeniedTokens(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,232 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// sessionTouchInterval limits how often authenticated requests update a session's last_used_at.
+const sessionTouchInterval = time.Minute
+
+// maxDeviceFieldLength caps the client-supplied device name and user agent stored per session.
+const maxDeviceFieldLength = 256
+
+// sessionService is the concrete implementation of the SessionService interface.
+type sessionService struct {
+	sessionRepo   SessionRepository
+	refreshExpiry time.Duration
+}
+
+// NewSessionService creates a new SessionService; refresh tokens live for refreshExpiry.
+func NewSessionService(sessionRepo SessionRepository, refreshExpiry time.Duration) SessionService {
+	return &sessionService{
+		sessionRepo:   sessionRepo,
+		refreshExpiry: refreshExpiry,
+	}
+}
+
+// StartSession creates a new session and issues its first refresh token.
+func (s *sessionService) StartSession(ctx context.Context, userID int64, device SessionDevice) (*Session, string, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:         sessionID,
+		UserID:     userID,
+		DeviceName: truncate(strings.TrimSpace(device.DeviceName), maxDeviceFieldLength),
+		IPAddress:  device.IPAddress,
+		UserAgent:  truncate(device.UserAgent, maxDeviceFieldLength),
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
+		return nil, "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	refreshToken, err := s.issueRefreshToken(ctx, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, refreshToken, nil
+}
+
+// Refresh rotates a refresh token. Each token is single-use: if a token that was already
+// exchanged shows up again it has probably been stolen, so the whole session is revoked.
+func (s *sessionService) Refresh(ctx context.Context, refreshToken string) (*Session, string, error) {
+	stored, err := s.sessionRepo.FindRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load refresh token: %w", err)
+	}
+	if stored == nil {
+		return nil, "", &UnauthorizedError{Msg: "invalid refresh token"}
+	}
+
+	session, err := s.sessionRepo.FindSession(ctx, stored.SessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load session: %w", err)
+	}
+	if session == nil || session.IsRevoked() {
+		return nil, "", &UnauthorizedError{Msg: "session has been revoked"}
+	}
+
+	now := time.Now()
+	if stored.UsedAt != nil {
+		log.Printf("Refresh token reuse detected for session %s (user %d); revoking session", session.ID, session.UserID)
+		if err := s.sessionRepo.RevokeSession(ctx, session.ID, now); err != nil {
+			return nil, "", fmt.Errorf("failed to revoke session: %w", err)
+		}
+		return nil, "", &UnauthorizedError{Msg: "refresh token has already been used"}
+	}
+	if now.After(stored.ExpiresAt) {
+		return nil, "", &UnauthorizedError{Msg: "refresh token has expired"}
+	}
+
+	// Guard against two concurrent refreshes with the same token: only one may win.
+	fresh, err := s.sessionRepo.MarkRefreshTokenUsed(ctx, stored.TokenHash, now)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if !fresh {
+		return nil, "", &UnauthorizedError{Msg: "refresh token has already been used"}
+	}
+
+	if err := s.sessionRepo.TouchSession(ctx, session.ID, now); err != nil {
+		return nil, "", fmt.Errorf("failed to update session: %w", err)
+	}
+	session.LastUsedAt = now
+
+	newToken, err := s.issueRefreshToken(ctx, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, newToken, nil
+}
+
+// RevokeSession logs a session out: its refresh tokens and access tokens stop working.
+func (s *sessionService) RevokeSession(ctx context.Context, sessionID string) error {
+	return s.sessionRepo.RevokeSession(ctx, sessionID, time.Now())
+}
+
+// ListSessions returns the user's live sessions. A session whose last refresh token has
+// expired can no longer be used, so it is left out even though it was never revoked.
+func (s *sessionService) ListSessions(ctx context.Context, userID int64) ([]*Session, error) {
+	sessions, err := s.sessionRepo.FindSessionsByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	now := time.Now()
+	live := make([]*Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.IsRevoked() || now.After(session.LastUsedAt.Add(s.refreshExpiry)) {
+			continue
+		}
+		live = append(live, session)
+	}
+	return live, nil
+}
+
+// RevokeUserSession revokes a session after checking that it belongs to the user.
+func (s *sessionService) RevokeUserSession(ctx context.Context, userID int64, sessionID string) error {
+	session, err := s.sessionRepo.FindSession(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to load session: %w", err)
+	}
+	if session == nil || session.UserID != userID || session.IsRevoked() {
+		return &NotFoundError{Msg: "session not found"}
+	}
+	return s.sessionRepo.RevokeSession(ctx, sessionID, time.Now())
+}
+
+// RevokeAllSessions revokes every session of the user.
+func (s *sessionService) RevokeAllSessions(ctx context.Context, userID int64) error {
+	return s.sessionRepo.RevokeUserSessions(ctx, userID, time.Now())
+}
+
+// RevokeAccessToken denylists a single access token by its jti.
+func (s *sessionService) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return s.sessionRepo.DenyToken(ctx, tokenID, expiresAt)
+}
+
+// IsAccessTokenRevoked checks the jti denylist and the state of the token's session.
+func (s *sessionService) IsAccessTokenRevoked(ctx context.Context, tokenID, sessionID string) (bool, error) {
+	denied, err := s.sessionRepo.IsTokenDenied(ctx, tokenID)
+	if err != nil || denied {
+		return denied, err
+	}
+
+	session, err := s.sessionRepo.FindSession(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	if session == nil || session.IsRevoked() {
+		return true, nil
+	}
+
+	// Keep last_used_at roughly current without writing on every request.
+	if now := time.Now(); now.Sub(session.LastUsedAt) > sessionTouchInterval {
+		if err := s.sessionRepo.TouchSession(ctx, session.ID, now); err != nil {
+			log.Printf("Failed to update last use of session %s: %v", session.ID, err)
+		}
+	}
+	return false, nil
+}
+
+// issueRefreshToken creates and stores (hashed) a new refresh token for the session.
+func (s *sessionService) issueRefreshToken(ctx context.Context, session *Session) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	stored := &RefreshToken{
+		TokenHash: hashToken(token),
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		ExpiresAt: now.Add(s.refreshExpiry),
+		CreatedAt: now,
+	}
+	if err := s.sessionRepo.SaveRefreshToken(ctx, stored); err != nil {
+		return "", fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return token, nil
+}
+
+// randomToken returns n random bytes encoded as URL-safe base64.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// hashToken returns the hex SHA-256 of a token; only hashes are ever stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// TOTPSecret holds a user's authenticator secret. Two-factor authentication is only
+// enforced once the enrollment has been confirmed with a valid code (EnabledAt is set).
+type TOTPSecret struct {
+	UserID       int64      `db:"user_id"`
+	Secret       string     `db:"secret"`
+	EnabledAt    *time.Time `db:"enabled_at"`
+	LastUsedStep int64      `db:"last_used_step"` // Last accepted time step, to reject replayed codes
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+// IsEnabled reports whether the enrollment has been confirmed.
+func (t *TOTPSecret) IsEnabled() bool {
+	return t.EnabledAt != nil
+}
+
+// TOTPEnrollment is returned when a user starts enrolling an authenticator app.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// LoginChallenge is the short-lived, single-use second step of a login for users with 2FA.
+// Only a hash of the challenge token is stored.
+type LoginChallenge struct {
+	TokenHash string    `db:"token_hash"`
+	UserID    int64     `db:"user_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+	Attempts  int       `db:"attempts"`
+}
+
+// TwoFactorRequiredError is returned by UserService.Authenticate when the password was correct
+// but the user has 2FA enabled: the challenge token must be exchanged together with a code.
+type TwoFactorRequiredError struct {
+	ChallengeToken string
+	ExpiresAt      time.Time
+}
+func (e *TwoFactorRequiredError) Error() string { return "Two-factor authentication required" }
+
+// ---------------------------------------------
+// TWO-FACTOR INTERFACES
+// ---------------------------------------------
+
+// TwoFactorService manages TOTP enrollment, recovery codes and login challenges.
+type TwoFactorService interface {
+	// BeginEnrollment generates a new (not yet enabled) secret and its otpauth URI.
+	BeginEnrollment(ctx context.Context, userID int64) (*TOTPEnrollment, error)
+	// ConfirmEnrollment enables 2FA if the code matches the pending secret and returns fresh recovery codes.
+	ConfirmEnrollment(ctx context.Context, userID int64, code string) ([]string, error)
+	// Disable turns 2FA off; it requires a current code or an unused recovery code.
+	Disable(ctx context.Context, userID int64, code string) error
+	IsEnabled(ctx context.Context, userID int64) (bool, error)
+
+	// CreateChallenge issues a login challenge token for a user whose password was verified.
+	CreateChallenge(ctx context.Context, userID int64) (string, time.Time, error)
+	// FindChallengeUser returns the user a pending challenge was issued to, so the second login
+	// step can be throttled per account before the code is checked.
+	FindChallengeUser(ctx context.Context, challengeToken string) (*User, error)
+	// VerifyChallenge consumes a challenge with a TOTP or recovery code and returns the authenticated user.
+	VerifyChallenge(ctx context.Context, challengeToken, code string) (*User, error)
+}
+
+// TwoFactorRepository defines the data access operations for TOTP secrets, recovery codes and login challenges.
+type TwoFactorRepository interface {
+	SaveTOTP(ctx context.Context, secret *TOTPSecret) error
+	FindTOTP(ctx context.Context, userID int64) (*TOTPSecret, error)
+	// EnableTOTP marks the secret as enabled and replaces the user's recovery codes.
+	EnableTOTP(ctx context.Context, userID int64, enabledAt time.Time, recoveryCodeHashes []string) error
+	DeleteTOTP(ctx context.Context, userID int64) error
+	// AdvanceTOTPStep records step as the last used one; it reports false if step was not newer.
+	AdvanceTOTPStep(ctx context.Context, userID int64, step int64) (bool, error)
+	// UseRecoveryCode marks an unused recovery code as used; it reports false if there was none.
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string, usedAt time.Time) (bool, error)
+
+	SaveChallenge(ctx context.Context, challenge *LoginChallenge) error
+	FindChallenge(ctx context.Context, tokenHash string) (*LoginChallenge, error)
+	IncrementChallengeAttempts(ctx context.Context, tokenHash string) error
+	// DeleteChallenge removes a challenge; it reports false if it was already gone.
+	DeleteChallenge(ctx context.Context, tokenHash string) (bool, error)
+}
@@ -0,0 +1,257 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/pkg/totp"
+)
+
+const (
+	// totpIssuer is the account issuer shown in authenticator apps.
+	totpIssuer = "chatserver"
+	// totpSkew is the number of 30s steps of clock drift accepted either way.
+	totpSkew = 1
+	// recoveryCodeCount is the number of recovery codes issued on enrollment.
+	recoveryCodeCount = 10
+	// challengeExpiry is how long a login challenge can be exchanged for tokens.
+	challengeExpiry = 5 * time.Minute
+	// maxChallengeAttempts is the number of wrong codes after which a challenge is discarded.
+	maxChallengeAttempts = 5
+)
+
+// twoFactorService is the concrete implementation of the TwoFactorService interface.
+type twoFactorService struct {
+	twoFactorRepo TwoFactorRepository
+	userRepo      UserRepository
+}
+
+// NewTwoFactorService creates a new TwoFactorService.
+func NewTwoFactorService(twoFactorRepo TwoFactorRepository, userRepo UserRepository) TwoFactorService {
+	return &twoFactorService{
+		twoFactorRepo: twoFactorRepo,
+		userRepo:      userRepo,
+	}
+}
+
+// BeginEnrollment creates a pending secret, replacing any earlier unconfirmed one.
+func (s *twoFactorService) BeginEnrollment(ctx context.Context, userID int64) (*TOTPEnrollment, error) {
+	existing, err := s.twoFactorRepo.FindTOTP(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load 2FA settings: %w", err)
+	}
+	if existing != nil && existing.IsEnabled() {
+		return nil, &ConflictError{Msg: "two-factor authentication is already enabled"}
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactorRepo.SaveTOTP(ctx, &TOTPSecret{UserID: userID, Secret: secret, CreatedAt: time.Now()}); err != nil {
+		return nil, fmt.Errorf("failed to save 2FA secret: %w", err)
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables 2FA once the user proves their app produces valid codes.
+func (s *twoFactorService) ConfirmEnrollment(ctx context.Context, userID int64, code string) ([]string, error) {
+	secret, err := s.twoFactorRepo.FindTOTP(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load 2FA settings: %w", err)
+	}
+	if secret == nil {
+		return nil, &NotFoundError{Msg: "no pending two-factor enrollment"}
+	}
+	if secret.IsEnabled() {
+		return nil, &ConflictError{Msg: "two-factor authentication is already enabled"}
+	}
+
+	ok, err := s.checkTOTP(ctx, secret, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &ValidationError{Msg: "invalid verification code"}
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.twoFactorRepo.EnableTOTP(ctx, userID, time.Now(), hashes); err != nil {
+		return nil, fmt.Errorf("failed to enable 2FA: %w", err)
+	}
+	return codes, nil
+}
+
+// Disable removes the secret and recovery codes after checking a code.
+func (s *twoFactorService) Disable(ctx context.Context, userID int64, code string) error {
+	secret, err := s.twoFactorRepo.FindTOTP(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load 2FA settings: %w", err)
+	}
+	if secret == nil || !secret.IsEnabled() {
+		return &NotFoundError{Msg: "two-factor authentication is not enabled"}
+	}
+
+	ok, err := s.checkCode(ctx, secret, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &ValidationError{Msg: "invalid verification code"}
+	}
+	return s.twoFactorRepo.DeleteTOTP(ctx, userID)
+}
+
+// IsEnabled reports whether the user has confirmed a 2FA enrollment.
+func (s *twoFactorService) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	secret, err := s.twoFactorRepo.FindTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return secret != nil && secret.IsEnabled(), nil
+}
+
+// CreateChallenge issues the token for the second login step.
+func (s *twoFactorService) CreateChallenge(ctx context.Context, userID int64) (string, time.Time, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(challengeExpiry)
+	challenge := &LoginChallenge{TokenHash: hashToken(token), UserID: userID, ExpiresAt: expiresAt}
+	if err := s.twoFactorRepo.SaveChallenge(ctx, challenge); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to save login challenge: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// FindChallengeUser looks up the user of a usable challenge without consuming it.
+func (s *twoFactorService) FindChallengeUser(ctx context.Context, challengeToken string) (*User, error) {
+	challenge, err := s.findChallenge(ctx, hashToken(challengeToken))
+	if err != nil {
+		return nil, err
+	}
+	return s.userRepo.GetByID(ctx, challenge.UserID)
+}
+
+// VerifyChallenge exchanges a challenge and a code for the authenticated user. A challenge
+// can be used once and is discarded after too many wrong codes.
+func (s *twoFactorService) VerifyChallenge(ctx context.Context, challengeToken, code string) (*User, error) {
+	tokenHash := hashToken(challengeToken)
+	challenge, err := s.findChallenge(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := s.twoFactorRepo.FindTOTP(ctx, challenge.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load 2FA settings: %w", err)
+	}
+	if secret == nil || !secret.IsEnabled() {
+		s.twoFactorRepo.DeleteChallenge(ctx, tokenHash)
+		return nil, &UnauthorizedError{Msg: "invalid or expired login challenge"}
+	}
+
+	ok, err := s.checkCode(ctx, secret, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := s.twoFactorRepo.IncrementChallengeAttempts(ctx, tokenHash); err != nil {
+			return nil, fmt.Errorf("failed to record failed attempt: %w", err)
+		}
+		return nil, &UnauthorizedError{Msg: "invalid verification code"}
+	}
+
+	// Only one concurrent exchange of the same challenge may succeed.
+	deleted, err := s.twoFactorRepo.DeleteChallenge(ctx, tokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume login challenge: %w", err)
+	}
+	if !deleted {
+		return nil, &UnauthorizedError{Msg: "invalid or expired login challenge"}
+	}
+
+	user, err := s.userRepo.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// The account may have been disabled after the password step.
+	if user.IsDisabled() {
+		return nil, &AccountDisabledError{}
+	}
+	return user, nil
+}
+
+// findChallenge loads a challenge that has not expired or run out of attempts, discarding
+// unusable ones.
+func (s *twoFactorService) findChallenge(ctx context.Context, tokenHash string) (*LoginChallenge, error) {
+	challenge, err := s.twoFactorRepo.FindChallenge(ctx, tokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load login challenge: %w", err)
+	}
+	if challenge == nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= maxChallengeAttempts {
+		if challenge != nil {
+			s.twoFactorRepo.DeleteChallenge(ctx, tokenHash)
+		}
+		return nil, &UnauthorizedError{Msg: "invalid or expired login challenge"}
+	}
+	return challenge, nil
+}
+
+// checkCode accepts either a current TOTP code or an unused recovery code.
+func (s *twoFactorService) checkCode(ctx context.Context, secret *TOTPSecret, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.checkTOTP(ctx, secret, code)
+	}
+	return s.twoFactorRepo.UseRecoveryCode(ctx, secret.UserID, hashToken(normalizeRecoveryCode(code)), time.Now())
+}
+
+// checkTOTP validates a TOTP code and rejects codes from a step that was already used.
+func (s *twoFactorService) checkTOTP(ctx context.Context, secret *TOTPSecret, code string) (bool, error) {
+	step, ok := totp.Validate(secret.Secret, strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return false, nil
+	}
+	return s.twoFactorRepo.AdvanceTOTPStep(ctx, secret.UserID, step)
+}
+
+// newRecoveryCode returns a random 50-bit code formatted as xxxxx-xxxxx (lowercase base32).
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return raw[:5] + "-" + raw[5:10], nil
+}
+
+// normalizeRecoveryCode makes recovery codes case- and separator-insensitive.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
@@ -0,0 +1,182 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// CodeMediaRejected is sent to an uploader whose upload the malware scan rejected.
+const CodeMediaRejected = "MEDIA_REJECTED"
+
+// MalwareScanner checks file contents for malware. Implementations live in ports/scanner.
+type MalwareScanner interface {
+	// Scan reads r to the end and returns the name of the threat found, or "" if the content is clean.
+	Scan(ctx context.Context, r io.Reader) (string, error)
+}
+
+// UploadNotifier tells uploaders what became of their uploads; implemented by the WebSocket hub.
+type UploadNotifier interface {
+	// MediaRejected tells the owner that the malware scan rejected one of their uploads.
+	MediaRejected(ownerID int64, media *Media)
+}
+
+// ScanSettings configures the scanning of uploads.
+type ScanSettings struct {
+	Workers   int           // Uploads scanned concurrently
+	QueueSize int           // Uploads waiting beyond this are picked up by the next sweep
+	Sweep     time.Duration // How often uploads still waiting for a scan are queued again
+	Timeout   time.Duration // Longest a single scan may take
+}
+
+// UploadScanner scans quarantined uploads in a bounded pool of workers and releases or rejects
+// them. Uploads whose scan failed, or that did not fit in the queue, are retried by a periodic
+// sweep, which also picks up the uploads left waiting by a restart.
+type UploadScanner interface {
+	// Enqueue schedules an upload for scanning without blocking and reports false if the queue is full.
+	Enqueue(mediaID string) bool
+	// Run starts the workers and the sweep and blocks until Stop is called.
+	Run()
+	Stop()
+}
+
+// scanSweepBatchSize is how many waiting uploads a sweep queues at most.
+const scanSweepBatchSize = 100
+
+// uploadScanner is the concrete implementation of the UploadScanner interface.
+type uploadScanner struct {
+	mediaRepo MediaRepository
+	store     MediaStore
+	scanner   MalwareScanner
+	notifier  UploadNotifier
+	settings  ScanSettings
+
+	jobs    chan string
+	quit    chan struct{}
+	pending sync.Map // media IDs queued or being scanned
+}
+
+// NewUploadScanner creates a new UploadScanner; call Run to start it.
+func NewUploadScanner(mediaRepo MediaRepository, store MediaStore, scanner MalwareScanner, notifier UploadNotifier, settings ScanSettings) UploadScanner {
+	settings.Workers = max(settings.Workers, 1)
+	return &uploadScanner{
+		mediaRepo: mediaRepo,
+		store:     store,
+		scanner:   scanner,
+		notifier:  notifier,
+		settings:  settings,
+		jobs:      make(chan string, max(settings.QueueSize, 1)),
+		quit:      make(chan struct{}),
+	}
+}
+
+func (s *uploadScanner) Enqueue(mediaID string) bool {
+	if _, queued := s.pending.LoadOrStore(mediaID, struct{}{}); queued {
+		return true
+	}
+	select {
+	case s.jobs <- mediaID:
+		return true
+	default:
+		s.pending.Delete(mediaID)
+		return false
+	}
+}
+
+func (s *uploadScanner) Run() {
+	var wg sync.WaitGroup
+	for i := 0; i < s.settings.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-s.quit:
+					return
+				case mediaID := <-s.jobs:
+					if err := s.scan(context.Background(), mediaID); err != nil {
+						log.Printf("Failed to scan upload %s: %v", mediaID, err)
+					}
+					s.pending.Delete(mediaID)
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(max(s.settings.Sweep, time.Second))
+		defer ticker.Stop()
+		for {
+			s.sweep(context.Background())
+			select {
+			case <-s.quit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func (s *uploadScanner) Stop() {
+	close(s.quit)
+}
+
+// sweep queues uploads still waiting for a scan.
+func (s *uploadScanner) sweep(ctx context.Context) {
+	waiting, err := s.mediaRepo.FindByStatus(ctx, MediaScanning, scanSweepBatchSize)
+	if err != nil {
+		log.Printf("Failed to find uploads waiting for a scan: %v", err)
+		return
+	}
+	for _, media := range waiting {
+		if !s.Enqueue(media.ID) {
+			return
+		}
+	}
+}
+
+// scan runs a quarantined upload through the scanner, then releases it or rejects it and tells
+// the uploader. Scanner failures leave it quarantined for the next sweep.
+func (s *uploadScanner) scan(ctx context.Context, mediaID string) error {
+	media, err := s.mediaRepo.FindByID(ctx, mediaID)
+	if err != nil {
+		return fmt.Errorf("failed to load upload: %w", err)
+	}
+	if media == nil || media.Status != MediaScanning {
+		return nil
+	}
+
+	if s.settings.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.settings.Timeout)
+		defer cancel()
+	}
+	content, err := s.store.Open(ctx, media.StorageKey())
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	threat, err := s.scanner.Scan(ctx, content)
+	content.Close()
+	if err != nil {
+		return fmt.Errorf("scanner failed: %w", err)
+	}
+
+	if threat == "" {
+		return s.mediaRepo.SetScanResult(context.Background(), media.ID, MediaReady, "")
+	}
+	if err := s.mediaRepo.SetScanResult(context.Background(), media.ID, MediaRejected, threat); err != nil {
+		return fmt.Errorf("failed to reject upload: %w", err)
+	}
+	log.Printf("Rejected upload %s of user %d: %s", media.ID, media.OwnerID, threat)
+	media.Status = MediaRejected
+	media.ScanResult = threat
+	media.URL = MediaURL(media.ID)
+	s.notifier.MediaRejected(media.OwnerID, media)
+	return nil
+}
@@ -2,6 +2,8 @@ package domain
 
 import (
 	"context"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +14,117 @@ type User struct {
 	Email     string    `json:"email" db:"email"`
 	Password  string    `json:"-" db:"password"` // '-' means ignore in JSON output
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	EmailVerifiedAt *time.Time `json:"-" db:"email_verified_at"` // Set once the user proved they own the address
+	IsBot      bool   `json:"is_bot" db:"is_bot"` // Bots act only through API tokens
+	BotOwnerID *int64 `json:"bot_owner_id,omitempty" db:"bot_owner_id"`
+	IsAdmin    bool       `json:"is_admin" db:"is_admin"` // Server administrator (operator), not a group admin
+	DisabledAt *time.Time `json:"disabled_at,omitempty" db:"disabled_at"` // Disabled accounts cannot log in
+	DeletedAt  *time.Time `json:"deleted_at,omitempty" db:"deleted_at"` // Deleted accounts are anonymized but kept for message history
+	DisplayName string `json:"display_name" db:"display_name"`
+	PrivacySettings `json:"-"` // Only shown to the user themselves, through GET /v1/me/profile
+}
+
+// PrivacySettings control how other users can find an account in the user directory.
+type PrivacySettings struct {
+	Discoverable      bool `json:"discoverable" db:"discoverable"`             // Listed in the directory at all
+	EmailDiscoverable bool `json:"email_discoverable" db:"email_discoverable"` // Found by searching for the exact email address
+}
+
+// MaxDisplayNameLength is the longest display name, in characters.
+const MaxDisplayNameLength = 64
+
+// ProfileUpdate changes a user's display name and privacy settings; nil fields are left unchanged.
+type ProfileUpdate struct {
+	DisplayName       *string
+	Discoverable      *bool
+	EmailDiscoverable *bool
+}
+
+// Fields the user directory can search, enabled server-wide by the operator.
+const (
+	DirectoryFieldUsername    = "username"
+	DirectoryFieldDisplayName = "display_name"
+	DirectoryFieldEmail       = "email"
+)
+
+// DirectorySettings is the set of fields the user directory searches. Email searches match only the
+// exact address of users who allow it, so the directory cannot be used to harvest addresses.
+type DirectorySettings struct {
+	Fields []string
+}
+
+// Searches reports whether the directory searches field.
+func (s DirectorySettings) Searches(field string) bool {
+	for _, f := range s.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits on user directory searches.
+const (
+	DefaultDirectoryLimit = 20
+	MaxDirectoryLimit     = 100
+	// MinFuzzyQueryLength is the shortest query also matched as a subsequence ("jdoe" finds "john_doe").
+	MinFuzzyQueryLength = 3
+)
+
+// Match ranks of directory results, best first.
+const (
+	DirectoryPrefixMatch = iota // Username prefix, or every user when listing
+	DirectoryNameMatch          // Display name word prefix, or exact email
+	DirectoryFuzzyMatch         // Subsequence of the username or display name
+)
+
+// UserDirectoryEntry is a user listed in the directory. Email addresses are never listed.
+type UserDirectoryEntry struct {
+	ID          int64  `json:"id" db:"id"`
+	Username    string `json:"username" db:"username"`
+	DisplayName string `json:"display_name" db:"display_name"`
+	IsBot       bool   `json:"is_bot" db:"is_bot"`
+	MatchRank   int    `json:"-" db:"match_rank"`
+}
+
+// DirectoryCursor is the position of the last result of a directory page: results are ordered by
+// match rank, then username, then ID. Its string form is "<rank>.<id>".
+type DirectoryCursor struct {
+	Rank   int
+	UserID int64
+}
+
+// ParseDirectoryCursor parses the string form of a DirectoryCursor.
+func ParseDirectoryCursor(s string) (*DirectoryCursor, error) {
+	rank, id, ok := strings.Cut(s, ".")
+	r, rankErr := strconv.Atoi(rank)
+	userID, idErr := strconv.ParseInt(id, 10, 64)
+	if !ok || rankErr != nil || idErr != nil || r < DirectoryPrefixMatch || r > DirectoryFuzzyMatch || userID <= 0 {
+		return nil, &ValidationError{Msg: "invalid cursor"}
+	}
+	return &DirectoryCursor{Rank: r, UserID: userID}, nil
+}
+
+func (c DirectoryCursor) String() string {
+	return strconv.Itoa(c.Rank) + "." + strconv.FormatInt(c.UserID, 10)
+}
+
+// DirectorySearch is a page of a user directory search. An empty Query lists every discoverable user.
+type DirectorySearch struct {
+	Query  string
+	Fields DirectorySettings
+	After  *DirectoryCursor
+	Limit  int
+}
+
+// IsEmailVerified reports whether the user confirmed their email address.
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsDisabled reports whether an administrator disabled (or deleted) the account.
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil || u.DeletedAt != nil
 }
 
 
@@ -22,6 +135,7 @@ func NewUser(username, email, hashedPassword string) *User {
 		Email:     email,
 		Password:  hashedPassword,
 		CreatedAt: time.Now(),
+		PrivacySettings: PrivacySettings{Discoverable: true},
 	}
 }
 
@@ -44,6 +158,17 @@ type NotFoundError struct {
 }
 func (e *NotFoundError) Error() string { return "Not Found Error: " + e.Msg }
 
+// ForbiddenError is returned when the caller is authenticated but not allowed to perform an action.
+type ForbiddenError struct {
+	Msg string
+}
+func (e *ForbiddenError) Error() string { return "Forbidden Error: " + e.Msg }
+
+// AccountDisabledError is returned when a disabled or deleted account tries to log in.
+type AccountDisabledError struct{}
+
+func (e *AccountDisabledError) Error() string { return "this account has been disabled" }
+
 
 // UserRepository defines the data access operations for users.
 // This interface is implemented by the 'ports/sqlite' package.
@@ -53,16 +178,30 @@ type UserRepository interface {
 	// FIX: Add GetByUsername which is required by the UserService implementation
 	GetByUsername(ctx context.Context, username string) (*User, error) 
 	Create(ctx context.Context, user *User) (*User, error)
-	GetAll(ctx context.Context) ([]*User, error)
+	// GetAll lists every discoverable, active user as a directory entry.
+	GetAll(ctx context.Context) ([]*UserDirectoryEntry, error)
 	GetAllUsersWithLastMessageInfo(ctx context.Context, currentUserID int64) ([]*UserWithChatInfo, error)
+	UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error
+	MarkEmailVerified(ctx context.Context, userID int64, verifiedAt time.Time) error
+	FindBotsByOwner(ctx context.Context, ownerID int64) ([]*User, error)
+	// Search lists users (deleted ones included) whose username or email contains query, ordered by ID, starting after afterID.
+	Search(ctx context.Context, query string, afterID int64, limit int) ([]*User, error)
+	// SearchDirectory lists the discoverable, active users matching search, best matches first.
+	SearchDirectory(ctx context.Context, search DirectorySearch) ([]*UserDirectoryEntry, error)
+	UpdateProfile(ctx context.Context, userID int64, displayName string, privacy PrivacySettings) error
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	// SetDisabledAt disables the account at the given time, or re-enables it when disabledAt is nil.
+	SetDisabledAt(ctx context.Context, userID int64, disabledAt *time.Time) error
+	// Scrub anonymizes a deleted account and removes its memberships, second factor and linked identities.
+	// The row is kept so the user's messages still resolve to a sender.
+	Scrub(ctx context.Context, userID int64, deletedAt time.Time) error
 }
 
 // UserWithChatInfo combines basic user information with the latest message details
-// between this user and a specific requesting user.
+// between this user and a specific requesting user. Like directory entries it has no email.
 type UserWithChatInfo struct {
 	ID                   int64
 	Username             string
-	Email                string
 	CreatedAt            time.Time
 	LastMessageContent   *string // Use pointer for nullable fields from SQL
 	LastMessageTimestamp *time.Time // Use pointer for nullable fields from SQL
@@ -2,6 +2,10 @@ package domain
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -10,8 +14,12 @@ import (
 type UserService interface {
 	// Methods implemented below:
 	Register(ctx context.Context, username, email, password string) (*User, error)
+	// Authenticate checks the password. For users with 2FA it returns a *TwoFactorRequiredError
+	// carrying a challenge token instead of the user.
 	Authenticate(ctx context.Context, email, password string) (*User, error)
-	ListAll(ctx context.Context) ([]*User, error)
+	ListAll(ctx context.Context) ([]*UserDirectoryEntry, error)
+	// RequiresEmailVerification reports whether users must verify their email before logging in.
+	RequiresEmailVerification() bool
 	
 	// FIXES REQUIRED BY main.go (for creating default users and checking):
 	GetUserByUsername(ctx context.Context, username string) (*User, error)
@@ -20,16 +28,25 @@ type UserService interface {
 	// Other methods often required by other layers:
 	GetUserByID(ctx context.Context, userID int64) (*User, error)
 	ListAllUsersWithChatInfo(ctx context.Context, currentUserID int64) ([]*UserWithChatInfo, error)
+	// SearchDirectory searches the user directory by prefix, then fuzzily, over the fields the
+	// server allows; after is the cursor of the previous page, or nil.
+	SearchDirectory(ctx context.Context, query string, after *DirectoryCursor, limit int) ([]*UserDirectoryEntry, error)
+	// UpdateProfile changes the user's display name and privacy settings and returns the updated user.
+	UpdateProfile(ctx context.Context, userID int64, update ProfileUpdate) (*User, error)
 	// NOTE: You may need to add or adjust other methods later
 }
 
 type userService struct {
-	userRepo UserRepository
+	userRepo  UserRepository
+	twoFactor TwoFactorService
+	// requireVerifiedEmail blocks logins until the user verified their email address
+	requireVerifiedEmail bool
+	directory            DirectorySettings // Fields the user directory searches
 }
 
 // NewUserService creates a new UserService instance.
-func NewUserService(repo UserRepository) UserService {
-	return &userService{userRepo: repo}
+func NewUserService(repo UserRepository, twoFactor TwoFactorService, requireVerifiedEmail bool, directory DirectorySettings) UserService {
+	return &userService{userRepo: repo, twoFactor: twoFactor, requireVerifiedEmail: requireVerifiedEmail, directory: directory}
 }
 
 // Register implements the domain.UserService interface.
@@ -68,11 +85,37 @@ func (s *userService) Authenticate(ctx context.Context, email, password string)
 		return nil, &NotFoundError{Msg: "Invalid email or password"}
 	}
 
+	if user.IsDisabled() {
+		return nil, &AccountDisabledError{}
+	}
+
+	if s.requireVerifiedEmail && !user.IsEmailVerified() {
+		return nil, &ForbiddenError{Msg: "email address has not been verified"}
+	}
+
+	// With 2FA enabled the password alone is not enough: hand out a challenge instead
+	enabled, err := s.twoFactor.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		token, expiresAt, err := s.twoFactor.CreateChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &TwoFactorRequiredError{ChallengeToken: token, ExpiresAt: expiresAt}
+	}
+
 	return user, nil
 }
 
-// ListAll retrieves all registered users.
-func (s *userService) ListAll(ctx context.Context) ([]*User, error) {
+// RequiresEmailVerification reports whether logins are blocked until the email is verified.
+func (s *userService) RequiresEmailVerification() bool {
+	return s.requireVerifiedEmail
+}
+
+// ListAll lists every user the directory would, unpaginated.
+func (s *userService) ListAll(ctx context.Context) ([]*UserDirectoryEntry, error) {
 	return s.userRepo.GetAll(ctx)
 }
 
@@ -112,8 +155,51 @@ func (s *userService) GetUserByID(ctx context.Context, userID int64) (*User, err
 	return s.userRepo.GetByID(ctx, userID)
 }
 
-// ListAllUsersWithChatInfo retrieves all users along with their last P2P message
-// content and timestamp with the currentUserID.
+// ListAllUsersWithChatInfo retrieves the discoverable users and the users currentUserID has
+// a conversation with, along with their last P2P message content and timestamp.
 func (s *userService) ListAllUsersWithChatInfo(ctx context.Context, currentUserID int64) ([]*UserWithChatInfo, error) {
 	return s.userRepo.GetAllUsersWithLastMessageInfo(ctx, currentUserID)
 }
+
+// SearchDirectory lists discoverable users matching query, best matches first.
+func (s *userService) SearchDirectory(ctx context.Context, query string, after *DirectoryCursor, limit int) ([]*UserDirectoryEntry, error) {
+	if limit <= 0 || limit > MaxDirectoryLimit {
+		limit = DefaultDirectoryLimit
+	}
+	return s.userRepo.SearchDirectory(ctx, DirectorySearch{
+		Query:  strings.TrimSpace(query),
+		Fields: s.directory,
+		After:  after,
+		Limit:  limit,
+	})
+}
+
+// UpdateProfile changes the user's display name and privacy settings.
+func (s *userService) UpdateProfile(ctx context.Context, userID int64, update ProfileUpdate) (*User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.DisplayName != nil {
+		name := strings.TrimSpace(*update.DisplayName)
+		if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+			return nil, &ValidationError{Msg: fmt.Sprintf("display name must be at most %d characters", MaxDisplayNameLength)}
+		}
+		if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+			return nil, &ValidationError{Msg: "display name must not contain control characters"}
+		}
+		user.DisplayName = name
+	}
+	if update.Discoverable != nil {
+		user.Discoverable = *update.Discoverable
+	}
+	if update.EmailDiscoverable != nil {
+		user.EmailDiscoverable = *update.EmailDiscoverable
+	}
+
+	if err := s.userRepo.UpdateProfile(ctx, userID, user.DisplayName, user.PrivacySettings); err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+	return user, nil
+}
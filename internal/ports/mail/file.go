@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+// FileMailer writes each email as an .eml file into a directory instead of sending it.
+// Useful in development and for integration tests that need to read the links.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a new FileMailer, creating dir if needed.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes the email to <dir>/<unix-nanos>-<recipient>.eml.
+func (m *FileMailer) Send(ctx context.Context, msg *domain.EmailMessage) error {
+	recipient := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(msg.To)
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), recipient)
+	return os.WriteFile(filepath.Join(m.dir, name), formatMessage(m.from, msg), 0o600)
+}
@@ -0,0 +1,25 @@
+package mail
+
+import (
+	"fmt"
+
+	"github.com/Emmanuel326/chatserver/internal/config"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+// NewMailer builds the Mailer selected by MAIL_DRIVER: "smtp", "file" or "memory".
+func NewMailer(cfg *config.Config) (domain.Mailer, error) {
+	switch cfg.MAIL_DRIVER {
+	case "smtp":
+		if cfg.SMTP_HOST == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER=smtp requires SMTP_HOST")
+		}
+		return NewSMTPMailer(cfg.SMTP_HOST, cfg.SMTP_PORT, cfg.SMTP_USERNAME, cfg.SMTP_PASSWORD, cfg.MAIL_FROM), nil
+	case "file":
+		return NewFileMailer(cfg.MAIL_DIR, cfg.MAIL_FROM)
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q (expected smtp, file or memory)", cfg.MAIL_DRIVER)
+	}
+}
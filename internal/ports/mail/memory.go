@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+// MemoryMailer keeps sent emails in memory, for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []domain.EmailMessage
+}
+
+// NewMemoryMailer creates a new, empty MemoryMailer.
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send records the email.
+func (m *MemoryMailer) Send(ctx context.Context, msg *domain.EmailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of all emails sent so far.
+func (m *MemoryMailer) Messages() []domain.EmailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]domain.EmailMessage(nil), m.messages...)
+}
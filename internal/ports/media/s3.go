@@ -0,0 +1,323 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+// S3Store keeps uploads in a bucket of an S3-compatible object store (AWS S3, MinIO, ...).
+// Chunks of resumable uploads are assembled in a local staging directory and sent to the
+// bucket in one piece when the upload completes.
+type S3Store struct {
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool
+	signer    *sigV4Signer
+	client    *http.Client
+	staging   *LocalStore
+}
+
+// NewS3Store creates a store for bucket at endpoint (e.g. https://s3.eu-west-1.amazonaws.com
+// or http://localhost:9000). With pathStyle the bucket is addressed as endpoint/bucket, as
+// MinIO expects; otherwise as bucket.endpoint.
+func NewS3Store(endpoint, region, bucket, accessKey, secretKey string, pathStyle bool, stagingDir string) (*S3Store, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+	staging, err := NewLocalStore(stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{
+		endpoint:  u,
+		bucket:    bucket,
+		pathStyle: pathStyle,
+		signer: &sigV4Signer{
+			accessKey: accessKey,
+			secretKey: secretKey,
+			region:    region,
+			service:   "s3",
+		},
+		client:  &http.Client{Timeout: 10 * time.Minute},
+		staging: staging,
+	}, nil
+}
+
+// objectURL returns the URL of the object stored under key.
+func (s *S3Store) objectURL(key string) (*url.URL, error) {
+	if _, err := s.staging.path(key); err != nil {
+		return nil, err
+	}
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		u.Path = base + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = ""
+	return &u, nil
+}
+
+// do signs and sends a request for the object stored under key.
+func (s *S3Store) do(ctx context.Context, method, key string, body io.Reader, size int64, payloadHash string, header http.Header) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	s.signer.signRequest(req, payloadHash, time.Now())
+	// Go sends Content-Length from the field, not the header map.
+	req.Header.Del("Content-Length")
+	return s.client.Do(req)
+}
+
+// Put spools r to the staging directory, so that its size and hash are known, then uploads it.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	n, err := s.staging.Put(ctx, key, r)
+	if err != nil {
+		return n, err
+	}
+	if err := s.Complete(ctx, key); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// Append adds to the staged copy of a resumable upload.
+func (s *S3Store) Append(ctx context.Context, key string, offset int64, r io.Reader) (int64, error) {
+	return s.staging.Append(ctx, key, offset, r)
+}
+
+// Complete uploads the staged copy of key, if there is one, and removes it. Objects PUT
+// directly with a pre-signed URL have no staged copy and are already in place.
+func (s *S3Store) Complete(ctx context.Context, key string) error {
+	f, err := s.staging.Open(ctx, key)
+	if errors.Is(err, domain.ErrMediaNotStored) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, f, size, hex.EncodeToString(hash.Sum(nil)), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("put", key, resp)
+	}
+	f.Close()
+	return s.staging.Delete(ctx, key)
+}
+
+// Open returns a reader that fetches the object with ranged GETs, so seeking is cheap.
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	size, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Reader{ctx: ctx, store: s, key: key, size: size}, nil
+}
+
+// Stat returns the size of the object from a HEAD request.
+func (s *S3Store) Stat(ctx context.Context, key string) (int64, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.ContentLength, nil
+	case http.StatusNotFound:
+		return 0, domain.ErrMediaNotStored
+	default:
+		return 0, responseError("stat", key, resp)
+	}
+}
+
+// Rename copies the object server-side to another key, then deletes the original. S3 reports
+// some copy failures in the body of a 200 response, so the body is checked too.
+func (s *S3Store) Rename(ctx context.Context, from, to string) error {
+	if err := s.Complete(ctx, from); err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+s.bucket+"/"+from)
+	resp, err := s.do(ctx, http.MethodPut, to, nil, 0, emptyPayloadHash, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return domain.ErrMediaNotStored
+	default:
+		return responseError("copy", from, resp)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(body, []byte("<Error>")) {
+		return fmt.Errorf("s3 copy %s: %s", from, strings.TrimSpace(string(body)))
+	}
+	return s.Delete(ctx, from)
+}
+
+// Delete removes the object and any staged copy; missing ones are ignored.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := s.staging.Delete(ctx, key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError("delete", key, resp)
+	}
+	return nil
+}
+
+// PresignPut returns a URL accepting one PUT of exactly size bytes; the length is signed.
+func (s *S3Store) PresignPut(ctx context.Context, key string, size int64, expires time.Duration) (string, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	return s.signer.presign(http.MethodPut, u, map[string]string{"content-length": strconv.FormatInt(size, 10)}, expires, time.Now()), nil
+}
+
+// PresignGet returns a download URL; the store overrides the response headers with the given values.
+func (s *S3Store) PresignGet(ctx context.Context, key string, contentType, disposition string, expires time.Duration) (string, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response-content-type", contentType)
+	query.Set("response-content-disposition", disposition)
+	u.RawQuery = query.Encode()
+	return s.signer.presign(http.MethodGet, u, nil, expires, time.Now()), nil
+}
+
+// responseError describes an unexpected response, including the start of the error document.
+func responseError(op, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s: %s: %s", op, key, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// s3Reader reads an object from the current offset with a ranged GET, reopened after seeks.
+type s3Reader struct {
+	ctx    context.Context
+	store  *S3Store
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		resp, err := r.store.do(r.ctx, http.MethodGet, r.key, nil, 0, emptyPayloadHash, header)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+			err := responseError("get", r.key, resp)
+			resp.Body.Close()
+			return 0, err
+		}
+		if resp.StatusCode == http.StatusOK && r.offset > 0 {
+			// The range was ignored; skip to the offset.
+			if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+				resp.Body.Close()
+				return 0, err
+			}
+		}
+		r.body = resp.Body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.offset + offset
+	case io.SeekEnd:
+		target = r.size + offset
+	default:
+		return r.offset, errors.New("invalid whence")
+	}
+	if target < 0 {
+		return r.offset, errors.New("negative position")
+	}
+	if target != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = target
+	return target, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
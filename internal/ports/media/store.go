@@ -0,0 +1,24 @@
+package media
+
+import (
+	"fmt"
+
+	"github.com/Emmanuel326/chatserver/internal/config"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+// NewStore builds the MediaStore selected by MEDIA_STORAGE: "local" or "s3".
+func NewStore(cfg *config.Config) (domain.MediaStore, error) {
+	switch cfg.MEDIA_STORAGE {
+	case "local":
+		return NewLocalStore(cfg.MEDIA_DIR)
+	case "s3":
+		if cfg.S3_ENDPOINT == "" || cfg.S3_BUCKET == "" || cfg.S3_ACCESS_KEY == "" || cfg.S3_SECRET_KEY == "" {
+			return nil, fmt.Errorf("MEDIA_STORAGE=s3 requires S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY")
+		}
+		// MEDIA_DIR only stages resumable uploads until they are complete.
+		return NewS3Store(cfg.S3_ENDPOINT, cfg.S3_REGION, cfg.S3_BUCKET, cfg.S3_ACCESS_KEY, cfg.S3_SECRET_KEY, cfg.S3_PATH_STYLE, cfg.MEDIA_DIR)
+	default:
+		return nil, fmt.Errorf("unknown MEDIA_STORAGE %q (expected local or s3)", cfg.MEDIA_STORAGE)
+	}
+}
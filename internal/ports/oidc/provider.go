@@ -0,0 +1,313 @@
+// Package oidc implements domain.IdentityProvider for OpenID Connect providers using the
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// keyRefreshInterval rate-limits JWKS refetches triggered by unknown key IDs.
+	keyRefreshInterval = time.Minute
+	// clockSkew is the leeway allowed when checking ID token timestamps.
+	clockSkew = time.Minute
+)
+
+// discoveryDocument holds the parts of /.well-known/openid-configuration we use.
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// idTokenClaims are the ID token claims mapped to a domain.ExternalIdentity.
+type idTokenClaims struct {
+	Nonce             string      `json:"nonce"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"` // Some providers send "true" as a string
+	PreferredUsername string      `json:"preferred_username"`
+	Name              string      `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// Provider is an OpenID Connect provider discovered from its issuer URL.
+// Discovery happens on first use, so the server can start while the provider is unreachable.
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	httpClient   *http.Client
+
+	// mu guards the cached documents below; it is never held during HTTP requests.
+	mu            sync.Mutex
+	discovery     *discoveryDocument
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+	keysRefresh   chan struct{} // Closed when the JWKS fetch in progress, if any, finishes
+}
+
+// NewProvider creates a new Provider. redirectURL is our callback URL registered at the provider.
+func NewProvider(issuer, clientID, clientSecret, redirectURL string, scopes []string) *Provider {
+	return &Provider{
+		issuer:       strings.TrimRight(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issuer returns the provider's issuer URL, which namespaces subjects.
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// AuthCodeURL builds the authorization request URL.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.clientID)
+	params.Set("redirect_uri", p.redirectURL)
+	params.Set("scope", strings.Join(p.scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems the code at the token endpoint and verifies the returned ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*domain.ExternalIdentity, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.clientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &domain.UnauthorizedError{Msg: fmt.Sprintf("identity provider rejected the authorization code (HTTP %d)", resp.StatusCode)}
+	}
+
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil || tokenResponse.IDToken == "" {
+		return nil, &domain.UnauthorizedError{Msg: "identity provider returned no ID token"}
+	}
+
+	claims, err := p.verifyIDToken(ctx, doc, tokenResponse.IDToken)
+	if err != nil {
+		return nil, &domain.UnauthorizedError{Msg: "invalid ID token: " + err.Error()}
+	}
+	if claims.Nonce != nonce {
+		return nil, &domain.UnauthorizedError{Msg: "invalid ID token: nonce mismatch"}
+	}
+
+	return &domain.ExternalIdentity{
+		Issuer:            p.issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified == true || claims.EmailVerified == "true",
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+// verifyIDToken checks the signature against the provider's JWKS plus issuer, audience and expiry.
+func (p *Provider) verifyIDToken(ctx context.Context, doc *discoveryDocument, rawToken string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(ctx, doc, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("missing subject")
+	}
+	return claims, nil
+}
+
+// discover fetches and caches the provider's discovery document. Concurrent first uses may
+// each fetch it; the first to finish is kept.
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	cached := p.discovery
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	doc := &discoveryDocument{}
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", doc); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", doc.Issuer, p.issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery == nil {
+		p.discovery = doc
+	}
+	return p.discovery, nil
+}
+
+// key returns the provider's verification key with the given kid, refetching the JWKS
+// (at most once per keyRefreshInterval) when the provider rotated its keys. Callers arriving
+// during a fetch wait for it rather than starting their own.
+func (p *Provider) key(ctx context.Context, doc *discoveryDocument, kid string) (interface{}, error) {
+	p.mu.Lock()
+	if key, ok := p.keys[kid]; ok {
+		p.mu.Unlock()
+		return key, nil
+	}
+	if refresh := p.keysRefresh; refresh != nil {
+		p.mu.Unlock()
+		select {
+		case <-refresh:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return p.cachedKey(kid)
+	}
+	if time.Since(p.keysFetchedAt) < keyRefreshInterval {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	refresh := make(chan struct{})
+	p.keysRefresh = refresh
+	p.mu.Unlock()
+
+	keys, err := p.fetchKeys(ctx, doc)
+
+	p.mu.Lock()
+	if err == nil {
+		p.keys = keys
+	}
+	p.keysFetchedAt = time.Now()
+	p.keysRefresh = nil
+	close(refresh)
+	p.mu.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	return p.cachedKey(kid)
+}
+
+// cachedKey returns a key from the last JWKS fetched.
+func (p *Provider) cachedKey(kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetchKeys downloads the provider's JWKS and returns its signing keys by kid.
+func (p *Provider) fetchKeys(ctx context.Context, doc *discoveryDocument) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, doc.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// getJSON fetches a URL and decodes its JSON body.
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: HTTP %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
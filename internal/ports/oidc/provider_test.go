@@ -0,0 +1,281 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "chatserver"
+	testVerifier = "verifier"
+	testNonce    = "nonce"
+)
+
+// mockIdP is an OpenID Connect provider serving discovery, a JWKS and a token endpoint that
+// answers every code with the ID token returned by its claims function.
+type mockIdP struct {
+	server     *httptest.Server
+	mu         sync.Mutex
+	keys       map[string]*rsa.PrivateKey // Published in the JWKS
+	signingKid string
+	claims     func(issuer string) jwt.MapClaims
+	jwksHits   atomic.Int32
+	gotForm    url.Values
+	issuer     string // Advertised by discovery instead of the server URL when set
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	idp := &mockIdP{keys: map[string]*rsa.PrivateKey{}}
+	idp.rotate(t, "key-1")
+	idp.claims = func(issuer string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            issuer,
+			"sub":            "subject-1",
+			"aud":            testClientID,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          testNonce,
+			"email":          "ann@example.com",
+			"email_verified": "true",
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := idp.server.URL
+		if idp.issuer != "" {
+			issuer = idp.issuer
+		}
+		json.NewEncoder(w).Encode(discoveryDocument{
+			Issuer:                issuer,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.jwksHits.Add(1)
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		var keys []jsonWebKey
+		for kid, key := range idp.keys {
+			keys = append(keys, jsonWebKey{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		idp.gotForm = r.PostForm
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims(idp.server.URL))
+		token.Header["kid"] = idp.signingKid
+		signed, err := token.SignedString(idp.keys[idp.signingKid])
+		idp.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r.PostForm.Get("code") == "bad" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// rotate publishes a new key and signs with it from now on.
+func (idp *mockIdP) rotate(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys[kid] = key
+	idp.signingKid = kid
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(idp.server.URL+"/", testClientID, "secret", "https://chat.example.com/callback", []string{"openid", "email"})
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+	authURL, err := idp.provider().AuthCodeURL(context.Background(), "state-1", testNonce, "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		t.Errorf("authorization URL %s does not point at the provider", authURL)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "https://chat.example.com/callback",
+		"scope":                 "openid email",
+		"state":                 "state-1",
+		"nonce":                 testNonce,
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := parsed.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+
+	identity, err := provider.Exchange(context.Background(), "code-1", testVerifier, testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := domain.ExternalIdentity{Issuer: idp.server.URL, Subject: "subject-1", Email: "ann@example.com", EmailVerified: true}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+	if idp.gotForm.Get("code") != "code-1" || idp.gotForm.Get("code_verifier") != testVerifier || idp.gotForm.Get("grant_type") != "authorization_code" {
+		t.Errorf("token request form = %v", idp.gotForm)
+	}
+}
+
+func TestExchangeRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		nonce  string
+		change func(claims jwt.MapClaims)
+	}{
+		{"rejected code", "bad", testNonce, nil},
+		{"nonce mismatch", "code", "other-nonce", nil},
+		{"wrong audience", "code", testNonce, func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{"wrong issuer", "code", testNonce, func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", "code", testNonce, func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"no expiry", "code", testNonce, func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"no subject", "code", testNonce, func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			if tt.change != nil {
+				claims := idp.claims
+				idp.claims = func(issuer string) jwt.MapClaims {
+					c := claims(issuer)
+					tt.change(c)
+					return c
+				}
+			}
+			_, err := idp.provider().Exchange(context.Background(), tt.code, testVerifier, tt.nonce)
+			if _, ok := err.(*domain.UnauthorizedError); !ok {
+				t.Errorf("got error %v (%T), want *domain.UnauthorizedError", err, err)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsTokensSignedWithUnpublishedKeys(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	if _, err := provider.Exchange(context.Background(), "code", testVerifier, testNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens now signed by another key under the same kid must not verify against the cached one.
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	idp.keys = map[string]*rsa.PrivateKey{"key-1": forged}
+	idp.mu.Unlock()
+	if _, err := provider.Exchange(context.Background(), "code", testVerifier, testNonce); err == nil {
+		t.Error("accepted an ID token whose signature does not match the cached key")
+	}
+}
+
+func TestKeyRotationRefetchesJWKSOncePerInterval(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	if _, err := provider.Exchange(context.Background(), "code", testVerifier, testNonce); err != nil {
+		t.Fatal(err)
+	}
+	if hits := idp.jwksHits.Load(); hits != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", hits)
+	}
+
+	// A rotated key is not fetched again within keyRefreshInterval...
+	idp.rotate(t, "key-2")
+	if _, err := provider.Exchange(context.Background(), "code", testVerifier, testNonce); err == nil {
+		t.Error("accepted a token signed with an unknown key before the refresh interval passed")
+	}
+	if hits := idp.jwksHits.Load(); hits != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", hits)
+	}
+
+	// ...but is once it has passed, by a single fetch however many logins are waiting.
+	provider.mu.Lock()
+	provider.keysFetchedAt = time.Now().Add(-keyRefreshInterval)
+	provider.mu.Unlock()
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := provider.Exchange(context.Background(), "code", testVerifier, testNonce)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("login after rotation: %v", err)
+		}
+	}
+	if hits := idp.jwksHits.Load(); hits != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", hits)
+	}
+}
+
+func TestDiscoveryRejectsMismatchedIssuer(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.issuer = "https://evil.example.com"
+	_, err := idp.provider().AuthCodeURL(context.Background(), "state", testNonce, "challenge")
+	if err == nil || !strings.Contains(err.Error(), "evil.example.com") {
+		t.Errorf("got error %v, want the mismatched issuer refused", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Package scanner implements domain.MalwareScanner: ClamAV's clamd daemon, plus a no-op
+// scanner for deployments without one and a fake for tests.
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the chunks streamed to clamd; it must stay below clamd's StreamMaxLength.
+const clamdChunkSize = 64 << 10
+
+// ClamdScanner scans files with a clamd daemon using its INSTREAM command, so the daemon needs
+// no access to the media storage.
+type ClamdScanner struct {
+	network string // "tcp" or "unix"
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner creates a scanner for the clamd listening at address: host:port, or the
+// path of a Unix socket. timeout bounds each scan, in addition to the caller's context.
+func NewClamdScanner(address string, timeout time.Duration) *ClamdScanner {
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	return &ClamdScanner{network: network, address: address, timeout: timeout}
+}
+
+// Scan streams r to clamd and parses its verdict: "stream: OK" or "stream: <threat> FOUND".
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	if s.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+	// Unblock reads and writes once the context is done.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := writeInstream(conn, r); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// writeInstream sends the INSTREAM command followed by r in length-prefixed chunks and the
+// zero-length chunk that ends the stream.
+func writeInstream(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriterSize(w, clamdChunkSize+4)
+	if _, err := bw.WriteString("zINSTREAM\x00"); err != nil {
+		return fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	chunk := make([]byte, clamdChunkSize)
+	var size [4]byte
+	for {
+		n, readErr := io.ReadFull(r, chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			bw.Write(size[:])
+			if _, err := bw.Write(chunk[:n]); err != nil {
+				return fmt.Errorf("failed to send to clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read file to scan: %w", readErr)
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	bw.Write(size[:])
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	return nil
+}
+
+// parseClamdReply returns the threat named in a reply, "" for a clean file, or the error clamd reported.
+func parseClamdReply(reply string) (string, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	case strings.HasSuffix(result, "ERROR"):
+		return "", fmt.Errorf("clamd: %s", result)
+	default:
+		return "", fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+}
@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd accepts INSTREAM sessions, reassembles the streamed file and answers like clamd:
+// FOUND for files containing the EICAR test string, OK otherwise.
+func fakeClamd(t *testing.T, received chan<- []byte) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				command, err := r.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var file bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&file, r, int64(size)); err != nil {
+						return
+					}
+				}
+				received <- file.Bytes()
+				if bytes.Contains(file.Bytes(), []byte(EICAR)) {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamdScannerStreamsFile(t *testing.T) {
+	received := make(chan []byte, 1)
+	s := NewClamdScanner(fakeClamd(t, received), 5*time.Second)
+
+	// Larger than one chunk, so the file is split.
+	file := bytes.Repeat([]byte("0123456789abcdef"), clamdChunkSize/8)
+	threat, err := s.Scan(context.Background(), bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if threat != "" {
+		t.Errorf("threat = %q, want clean", threat)
+	}
+	if got := <-received; !bytes.Equal(got, file) {
+		t.Errorf("clamd received %d bytes, want the %d byte file", len(got), len(file))
+	}
+}
+
+func TestClamdScannerReportsThreat(t *testing.T) {
+	received := make(chan []byte, 1)
+	s := NewClamdScanner(fakeClamd(t, received), 5*time.Second)
+
+	threat, err := s.Scan(context.Background(), strings.NewReader("prefix "+EICAR))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if threat != "Eicar-Test-Signature" {
+		t.Errorf("threat = %q, want Eicar-Test-Signature", threat)
+	}
+}
+
+func TestClamdScannerUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	if _, err := NewClamdScanner(address, time.Second).Scan(context.Background(), strings.NewReader("x")); err == nil {
+		t.Error("Scan succeeded without a clamd to talk to")
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		reply   string
+		threat  string
+		wantErr bool
+	}{
+		{"stream: OK\x00", "", false},
+		{"stream: Win.Test.EICAR_HDB-1 FOUND\x00", "Win.Test.EICAR_HDB-1", false},
+		{"INSTREAM size limit exceeded. ERROR\x00", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		threat, err := parseClamdReply(tt.reply)
+		if threat != tt.threat || (err != nil) != tt.wantErr {
+			t.Errorf("parseClamdReply(%q) = %q, %v; want %q, error %v", tt.reply, threat, err, tt.threat, tt.wantErr)
+		}
+	}
+}
+
+func TestFakeScanner(t *testing.T) {
+	var fake FakeScanner
+	if threat, _ := fake.Scan(context.Background(), strings.NewReader(EICAR)); threat != "Eicar-Test-Signature" {
+		t.Errorf("EICAR threat = %q", threat)
+	}
+	if threat, _ := fake.Scan(context.Background(), strings.NewReader("hello")); threat != "" {
+		t.Errorf("clean file threat = %q", threat)
+	}
+}
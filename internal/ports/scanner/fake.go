@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// EICAR is the standard antivirus test file, which every scanner reports as a threat.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// FakeScanner flags files containing one of its signatures, for tests. The zero value flags
+// the EICAR test file.
+type FakeScanner struct {
+	// Signatures maps threat names to byte patterns.
+	Signatures map[string]string
+	// Err, if set, is returned instead of scanning.
+	Err error
+}
+
+// Scan reads r and returns the name of the first signature it contains.
+func (f *FakeScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	signatures := f.Signatures
+	if signatures == nil {
+		signatures = map[string]string{"Eicar-Test-Signature": EICAR}
+	}
+	for threat, pattern := range signatures {
+		if bytes.Contains(data, []byte(pattern)) {
+			return threat, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,16 @@
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// NoopScanner reports every file as clean. It is used when no scanner is configured, so that
+// uploads quarantined while one was are released.
+type NoopScanner struct{}
+
+// Scan drains r and reports it clean.
+func (NoopScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	_, err := io.Copy(io.Discard, r)
+	return "", err
+}
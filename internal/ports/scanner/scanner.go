@@ -0,0 +1,24 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/config"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+// New builds the MalwareScanner selected by MEDIA_SCANNER: "none" or "clamd".
+func New(cfg *config.Config) (domain.MalwareScanner, error) {
+	switch cfg.MEDIA_SCANNER {
+	case "none":
+		return NoopScanner{}, nil
+	case "clamd":
+		if cfg.CLAMD_ADDRESS == "" {
+			return nil, fmt.Errorf("MEDIA_SCANNER=clamd requires CLAMD_ADDRESS")
+		}
+		return NewClamdScanner(cfg.CLAMD_ADDRESS, time.Duration(cfg.CLAMD_TIMEOUT_SECONDS)*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown MEDIA_SCANNER %q (expected none or clamd)", cfg.MEDIA_SCANNER)
+	}
+}
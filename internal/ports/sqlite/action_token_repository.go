@@ -0,0 +1,37 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ActionTokenRepository implements the domain.ActionTokenRepository interface using SQLite.
+type ActionTokenRepository struct {
+	db *sqlx.DB
+}
+
+// NewActionTokenRepository creates a new ActionTokenRepository instance.
+func NewActionTokenRepository(db *sqlx.DB) *ActionTokenRepository {
+	return &ActionTokenRepository{db: db}
+}
+
+// ConsumeToken records a token nonce; the primary key makes the second use fail.
+func (r *ActionTokenRepository) ConsumeToken(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `INSERT OR IGNORE INTO used_action_tokens (nonce, expires_at) VALUES (?, ?)`, nonce, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DeleteExpiredTokens removes the nonces of tokens that expired before now.
+func (r *ActionTokenRepository) DeleteExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM used_action_tokens WHERE expires_at < ?`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
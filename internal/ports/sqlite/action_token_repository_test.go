@@ -0,0 +1,27 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeleteExpiredTokens(t *testing.T) {
+	repo := NewActionTokenRepository(newTestDB(t))
+	ctx := context.Background()
+	now := time.Now()
+	for nonce, expiresAt := range map[string]time.Time{"expired": now.Add(-time.Minute), "live": now.Add(time.Minute)} {
+		if fresh, err := repo.ConsumeToken(ctx, nonce, expiresAt); err != nil || !fresh {
+			t.Fatalf("ConsumeToken(%q) = %v, %v", nonce, fresh, err)
+		}
+	}
+
+	removed, err := repo.DeleteExpiredTokens(ctx, now)
+	if err != nil || removed != 1 {
+		t.Fatalf("removed %d tokens (err %v), want 1", removed, err)
+	}
+	// The live nonce must still be refused a second time
+	if fresh, err := repo.ConsumeToken(ctx, "live", now.Add(time.Minute)); err != nil || fresh {
+		t.Errorf("live token consumed again = %v (err %v), want it refused", fresh, err)
+	}
+}
@@ -0,0 +1,96 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// apiTokenColumns lists the api_tokens columns mapped onto domain.APIToken.
+const apiTokenColumns = `id, user_id, created_by, name, token_hash, scopes, created_at, last_used_at, expires_at, revoked_at`
+
+// APITokenRepository implements the domain.APITokenRepository interface using SQLite.
+type APITokenRepository struct {
+	db *sqlx.DB
+}
+
+// NewAPITokenRepository creates a new APITokenRepository instance.
+func NewAPITokenRepository(db *sqlx.DB) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+// CreateToken inserts a new API token and returns it with its ID.
+func (r *APITokenRepository) CreateToken(ctx context.Context, token *domain.APIToken) (*domain.APIToken, error) {
+	query := `
+		INSERT INTO api_tokens (user_id, created_by, name, token_hash, scopes, created_at, expires_at)
+		VALUES (:user_id, :created_by, :name, :token_hash, :scopes, :created_at, :expires_at)
+	`
+	res, err := r.db.NamedExecContext(ctx, query, token)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	token.ID = id
+	return token, nil
+}
+
+// FindTokenByHash retrieves a token by the hash of its value, or nil if none matches.
+func (r *APITokenRepository) FindTokenByHash(ctx context.Context, tokenHash string) (*domain.APIToken, error) {
+	token := &domain.APIToken{}
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash = ?`
+
+	err := r.db.GetContext(ctx, token, query, tokenHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// FindTokensByCreator retrieves all tokens created by a user, newest first.
+func (r *APITokenRepository) FindTokensByCreator(ctx context.Context, creatorID int64) ([]*domain.APIToken, error) {
+	tokens := []*domain.APIToken{}
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE created_by = ? ORDER BY id DESC`
+
+	if err := r.db.SelectContext(ctx, &tokens, query, creatorID); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeToken marks an active token as revoked if it was created by creatorID.
+func (r *APITokenRepository) RevokeToken(ctx context.Context, tokenID, creatorID int64, revokedAt time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND created_by = ? AND revoked_at IS NULL`,
+		revokedAt, tokenID, creatorID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RevokeUserTokens revokes every active token that acts as, or was created by, the user.
+func (r *APITokenRepository) RevokeUserTokens(ctx context.Context, userID int64, revokedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE api_tokens SET revoked_at = ? WHERE (user_id = ? OR created_by = ?) AND revoked_at IS NULL`,
+		revokedAt, userID, userID)
+	return err
+}
+
+// TouchToken records when a token was last used.
+func (r *APITokenRepository) TouchToken(ctx context.Context, tokenID int64, usedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, usedAt, tokenID)
+	return err
+}
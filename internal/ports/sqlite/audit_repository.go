@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// AuditRepository implements the domain.AuditRepository interface using SQLite.
+type AuditRepository struct {
+	db *sqlx.DB
+}
+
+// NewAuditRepository creates a new repository instance.
+func NewAuditRepository(db *sqlx.DB) domain.AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// SaveAuditEntry appends an entry to the administrator audit log.
+func (r *AuditRepository) SaveAuditEntry(ctx context.Context, entry *domain.AuditEntry) error {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO admin_audit_log (actor_id, action, target_type, target_id, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.ActorID, entry.Action, entry.TargetType, entry.TargetID, entry.Details, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListAuditEntries returns matching entries newest first, starting before beforeID (0 for the latest).
+func (r *AuditRepository) ListAuditEntries(ctx context.Context, filter domain.AuditFilter, beforeID int64, limit int) ([]*domain.AuditEntry, error) {
+	query := `SELECT id, actor_id, action, target_type, target_id, details, created_at FROM admin_audit_log WHERE 1 = 1`
+	var args []interface{}
+
+	if beforeID > 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeID)
+	}
+	if filter.ActorID != 0 {
+		query += ` AND actor_id = ?`
+		args = append(args, filter.ActorID)
+	}
+	if filter.Action != "" {
+		query += ` AND action = ?`
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		query += ` AND target_type = ?`
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != 0 {
+		query += ` AND target_id = ?`
+		args = append(args, filter.TargetID)
+	}
+
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	entries := []*domain.AuditEntry{}
+	if err := r.db.SelectContext(ctx, &entries, query, args...); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -2,16 +2,27 @@ package sqlite
 
 import (
 	"log"
+	"strings"
 
 	"github.com/Emmanuel326/chatserver/internal/config"
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite" // SQLite driver
 )
 
+// busyTimeoutPragma is how long, in milliseconds, a statement waits for a locked database.
+const busyTimeoutPragma = "_pragma=busy_timeout(5000)"
+
 // InitDB initializes the database connection using the provided configuration.
 func InitDB(cfg *config.Config) *sqlx.DB {
-	// Connect using the modernc.org/sqlite driver
-	db, err := sqlx.Connect("sqlite", cfg.DB_FILE) // <- driver name must be "sqlite"
+	// Connect using the modernc.org/sqlite driver. Every pooled connection waits for locks held by
+	// others (e.g. background workers) instead of failing at once with SQLITE_BUSY.
+	dsn := cfg.DB_FILE
+	if strings.Contains(dsn, "?") {
+		dsn += "&" + busyTimeoutPragma
+	} else {
+		dsn += "?" + busyTimeoutPragma
+	}
+	db, err := sqlx.Connect("sqlite", dsn) // <- driver name must be "sqlite"
 	if err != nil {
 		log.Fatalf("FATAL: Could not connect to the SQLite database: %v", err)
 	}
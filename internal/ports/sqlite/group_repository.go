@@ -4,12 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/Emmanuel326/chatserver/internal/domain"
 	"github.com/jmoiron/sqlx"
 )
 
+// groupColumns lists the columns selected into domain.Group. None of them clash with
+// group_members columns, so the list can be used unqualified in membership joins.
+const groupColumns = `id, name, owner_id, created_at, posting_policy, slow_mode_seconds, description, is_public, archived_at`
+
 // GroupRepository implements the domain.GroupRepository interface using SQLite.
 type GroupRepository struct {
 	db *sqlx.DB
@@ -26,10 +31,13 @@ func (r *GroupRepository) Create(ctx context.Context, group *domain.Group) (*dom
 	if group.CreatedAt.IsZero() {
 		group.CreatedAt = time.Now()
 	}
+	if group.PostingPolicy == "" {
+		group.PostingPolicy = domain.PostingEveryone
+	}
 
 	query := `
-		INSERT INTO groups (name, owner_id, created_at)
-		VALUES (:name, :owner_id, :created_at)
+		INSERT INTO groups (name, owner_id, created_at, posting_policy, slow_mode_seconds, description, is_public)
+		VALUES (:name, :owner_id, :created_at, :posting_policy, :slow_mode_seconds, :description, :is_public)
 	`
 
 	res, err := r.db.NamedExecContext(ctx, query, group)
@@ -60,7 +68,7 @@ func (r *GroupRepository) Create(ctx context.Context, group *domain.Group) (*dom
 // FindByID retrieves a group by its ID.
 func (r *GroupRepository) FindByID(ctx context.Context, groupID int64) (*domain.Group, error) {
 	group := &domain.Group{}
-	query := `SELECT id, name, owner_id, created_at FROM groups WHERE id = ?`
+	query := `SELECT ` + groupColumns + ` FROM groups WHERE id = ? AND deleted_at IS NULL`
 	
 	err := r.db.GetContext(ctx, group, query, groupID)
 	if err == sql.ErrNoRows {
@@ -98,11 +106,41 @@ func (r *GroupRepository) FindMembersByGroupID(ctx context.Context, groupID int6
 	return userIDs, nil
 }
 
+// FindMemberProfiles retrieves a page of group members joined with their user profiles.
+// Results are ordered by user ID so afterUserID works as a cursor.
+func (r *GroupRepository) FindMemberProfiles(ctx context.Context, groupID int64, query string, afterUserID int64, limit int) ([]*domain.GroupMemberProfile, error) {
+	sqlQuery := `
+		SELECT gm.user_id, u.username, gm.is_admin, gm.joined_at
+		FROM group_members gm
+		JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = ? AND gm.user_id > ?
+	`
+	args := []interface{}{groupID, afterUserID}
+
+	if query != "" {
+		sqlQuery += ` AND u.username LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLike(query)+"%")
+	}
+
+	sqlQuery += `
+		ORDER BY gm.user_id ASC
+		LIMIT ?;
+	`
+	args = append(args, limit)
+
+	members := []*domain.GroupMemberProfile{}
+	if err := r.db.SelectContext(ctx, &members, sqlQuery, args...); err != nil {
+		log.Printf("Error listing members of group %d: %v", groupID, err)
+		return nil, err
+	}
+	return members, nil
+}
+
 // FindGroupsByUserID retrieves all groups a specific user is a member of.
 func (r *GroupRepository) FindGroupsByUserID(ctx context.Context, userID int64) ([]*domain.Group, error) {
 	var groups []*domain.Group
 	query := `
-		SELECT g.id, g.name, g.owner_id, g.created_at
+		SELECT ` + groupColumns + `
 		FROM groups g
 		JOIN group_members gm ON g.id = gm.group_id
 		WHERE gm.user_id = ?
@@ -113,3 +151,236 @@ func (r *GroupRepository) FindGroupsByUserID(ctx context.Context, userID int64)
 	}
 	return groups, nil
 }
+
+// FindMember retrieves a single membership row, or nil if the user is not in the group.
+func (r *GroupRepository) FindMember(ctx context.Context, groupID, userID int64) (*domain.GroupMember, error) {
+	member := &domain.GroupMember{}
+	query := `SELECT group_id, user_id, joined_at, is_admin FROM group_members WHERE group_id = ? AND user_id = ?`
+
+	err := r.db.GetContext(ctx, member, query, groupID, userID)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not a member
+	}
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// SharesGroup reports whether both users are members of the same non-deleted group.
+func (r *GroupRepository) SharesGroup(ctx context.Context, userID1, userID2 int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM group_members a
+			JOIN group_members b ON b.group_id = a.group_id AND b.user_id = ?
+			JOIN groups g ON g.id = a.group_id AND g.deleted_at IS NULL
+			WHERE a.user_id = ?
+		)
+	`
+	var shares bool
+	err := r.db.GetContext(ctx, &shares, query, userID2, userID1)
+	return shares, err
+}
+
+// UpdatePostingPolicy sets the posting policy and slow mode interval for a group.
+func (r *GroupRepository) UpdatePostingPolicy(ctx context.Context, groupID int64, policy domain.PostingPolicy, slowModeSeconds int) error {
+	query := `UPDATE groups SET posting_policy = ?, slow_mode_seconds = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, policy, slowModeSeconds, groupID)
+	return err
+}
+
+// UpdateDetails sets the description and directory visibility of a group.
+func (r *GroupRepository) UpdateDetails(ctx context.Context, groupID int64, description string, isPublic bool) error {
+	query := `UPDATE groups SET description = ?, is_public = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, description, isPublic, groupID)
+	return err
+}
+
+// SearchPublic lists public groups whose name or description contains words starting with every
+// word of query, together with their member counts. Matches come from the groups_fts index.
+// Results are ordered by ID so afterID works as a cursor.
+func (r *GroupRepository) SearchPublic(ctx context.Context, query string, afterID int64, limit int) ([]*domain.GroupDirectoryEntry, error) {
+	return r.search(ctx, true, query, afterID, limit)
+}
+
+// SearchAll is SearchPublic including private groups, for server administrators.
+func (r *GroupRepository) SearchAll(ctx context.Context, query string, afterID int64, limit int) ([]*domain.GroupDirectoryEntry, error) {
+	return r.search(ctx, false, query, afterID, limit)
+}
+
+// search lists non-deleted groups matching query, optionally only public ones.
+func (r *GroupRepository) search(ctx context.Context, publicOnly bool, query string, afterID int64, limit int) ([]*domain.GroupDirectoryEntry, error) {
+	sqlQuery, args := groupSearchQuery(publicOnly, query, afterID, limit)
+	entries := []*domain.GroupDirectoryEntry{}
+	if err := r.db.SelectContext(ctx, &entries, sqlQuery, args...); err != nil {
+		log.Printf("Error searching group directory: %v", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// groupSearchQuery builds the directory search behind SearchPublic and SearchAll.
+func groupSearchQuery(publicOnly bool, query string, afterID int64, limit int) (string, []interface{}) {
+	// groups_fts has name and description columns as well, so groupColumns cannot be used unqualified
+	sqlQuery := `
+		SELECT g.id, g.name, g.owner_id, g.created_at, g.posting_policy, g.slow_mode_seconds,
+			g.description, g.is_public, g.archived_at,
+			(SELECT COUNT(*) FROM group_members gm WHERE gm.group_id = g.id) AS member_count
+		FROM groups g
+	`
+	var args []interface{}
+	if match := groupMatchQuery(query); match != "" {
+		sqlQuery += ` JOIN groups_fts ON groups_fts.rowid = g.id AND groups_fts MATCH ?`
+		args = append(args, match)
+	}
+	sqlQuery += ` WHERE g.deleted_at IS NULL AND g.id > ?`
+	args = append(args, afterID)
+	if publicOnly {
+		sqlQuery += ` AND g.is_public = TRUE`
+	}
+
+	sqlQuery += `
+		ORDER BY g.id ASC
+		LIMIT ?;
+	`
+	args = append(args, limit)
+	return sqlQuery, args
+}
+
+// groupMatchQuery turns a directory search into an FTS5 query: every word must start a word of
+// the group's name or description. Words are quoted so FTS5 syntax is searched for literally.
+func groupMatchQuery(input string) string {
+	var terms []string
+	for _, word := range strings.Fields(input) {
+		word = strings.ReplaceAll(strings.Trim(word, `*"`), `"`, `""`)
+		if word != "" {
+			terms = append(terms, `"`+word+`"*`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// SetArchivedAt archives a group at the given time, or unarchives it when archivedAt is nil.
+func (r *GroupRepository) SetArchivedAt(ctx context.Context, groupID int64, archivedAt *time.Time) error {
+	query := `UPDATE groups SET archived_at = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, archivedAt, groupID)
+	return err
+}
+
+// Delete removes a group's memberships and pins and applies the retention policy to its messages.
+// With RetentionTombstone the group row is kept (marked deleted) so its ID still resolves
+// to a group and the blanked messages are never mistaken for P2P messages.
+func (r *GroupRepository) Delete(ctx context.Context, groupID int64, retention domain.MessageRetention) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No-op once committed
+
+	// Delete memberships explicitly: PRAGMA foreign_keys only applies to the connection it ran on.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = ?`, groupID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM group_sanctions WHERE group_id = ?`, groupID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM message_pins WHERE group_id = ?`, groupID); err != nil {
+		return err
+	}
+
+	if retention == domain.RetentionDelete {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE group_id = ?`, groupID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM groups WHERE id = ?`, groupID); err != nil {
+			return err
+		}
+	} else {
+		tombstone := `UPDATE messages SET content = '', media_url = '', media_id = '', image = NULL, attachment = NULL, forwarded_from = NULL, type = ? WHERE group_id = ?`
+		if _, err := tx.ExecContext(ctx, tombstone, domain.DeletedMessage, groupID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE groups SET deleted_at = ? WHERE id = ?`, time.Now(), groupID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMember deletes a single membership row.
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupID, userID int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = ? AND user_id = ?`, groupID, userID)
+	return err
+}
+
+// SaveSanction inserts a mute or ban, replacing any existing one of the same kind for that user.
+func (r *GroupRepository) SaveSanction(ctx context.Context, sanction *domain.GroupSanction) error {
+	query := `
+		INSERT OR REPLACE INTO group_sanctions (group_id, user_id, kind, reason, expires_at, created_by, created_at)
+		VALUES (:group_id, :user_id, :kind, :reason, :expires_at, :created_by, :created_at)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, sanction)
+	return err
+}
+
+// DeleteSanction removes a mute or ban. It reports whether one existed.
+func (r *GroupRepository) DeleteSanction(ctx context.Context, groupID, userID int64, kind domain.SanctionKind) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM group_sanctions WHERE group_id = ? AND user_id = ? AND kind = ?`, groupID, userID, kind)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// FindActiveSanction retrieves an unexpired mute or ban, or nil if there is none.
+func (r *GroupRepository) FindActiveSanction(ctx context.Context, groupID, userID int64, kind domain.SanctionKind) (*domain.GroupSanction, error) {
+	sanction := &domain.GroupSanction{}
+	query := `
+		SELECT group_id, user_id, kind, reason, expires_at, created_by, created_at
+		FROM group_sanctions
+		WHERE group_id = ? AND user_id = ? AND kind = ?
+	`
+	err := r.db.GetContext(ctx, sanction, query, groupID, userID, kind)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Expiry is checked here rather than in SQL because timestamps are stored as Go-formatted strings.
+	if sanction.ExpiresAt != nil && !sanction.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return sanction, nil
+}
+
+// ListActiveSanctions retrieves all unexpired mutes or bans in a group.
+func (r *GroupRepository) ListActiveSanctions(ctx context.Context, groupID int64, kind domain.SanctionKind) ([]*domain.GroupSanction, error) {
+	query := `
+		SELECT group_id, user_id, kind, reason, expires_at, created_by, created_at
+		FROM group_sanctions
+		WHERE group_id = ? AND kind = ?
+		ORDER BY created_at DESC
+	`
+	all := []*domain.GroupSanction{}
+	if err := r.db.SelectContext(ctx, &all, query, groupID, kind); err != nil {
+		log.Printf("Error listing %s sanctions for group %d: %v", kind, groupID, err)
+		return nil, err
+	}
+
+	now := time.Now()
+	active := []*domain.GroupSanction{}
+	for _, s := range all {
+		if s.ExpiresAt == nil || s.ExpiresAt.After(now) {
+			active = append(active, s)
+		}
+	}
+	return active, nil
+}
+
+// escapeLike escapes the LIKE wildcards in user input so they match literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
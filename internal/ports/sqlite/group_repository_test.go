@@ -0,0 +1,140 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSearchPublicMatchesNamesAndDescriptions(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := NewGroupRepository(db)
+	owner := createUsers(t, db, "tom")[0]
+
+	groups := map[string]int64{}
+	for _, g := range []struct{ name, description string }{
+		{"Go Gophers", "All about the Go language"},
+		{"golang", ""},
+		{"Rustaceans", "Systems programming, fearless concurrency"},
+		{"Café crème", "Coffee lovers"},
+		{"go_private", "Hidden gophers"},
+		{"Book club", `Monthly "reads" for gophers`},
+	} {
+		groups[g.name] = createGroup(t, db, g.name, owner)
+		if err := repo.UpdateDetails(ctx, groups[g.name], g.description, g.name != "go_private"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"go", []string{"Go Gophers", "golang", "Book club"}}, // "gophers" in the description
+		{"GOPH", []string{"Go Gophers", "Book club"}},
+		{"about", []string{"Go Gophers"}},
+		{"fearless rust", []string{"Rustaceans"}},
+		{"cafe", []string{"Café crème"}},
+		{`"reads"`, []string{"Book club"}},
+		{"go AND rust", nil},
+		{"nothing", nil},
+		{"", []string{"Go Gophers", "golang", "Rustaceans", "Café crème", "Book club"}},
+	}
+	for _, tt := range tests {
+		entries, err := repo.SearchPublic(ctx, tt.query, 0, 10)
+		if err != nil {
+			t.Fatalf("SearchPublic(%q) returned %v", tt.query, err)
+		}
+		var want []int64
+		for _, name := range tt.want {
+			want = append(want, groups[name])
+		}
+		var got []int64
+		for _, entry := range entries {
+			got = append(got, entry.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("SearchPublic(%q) = %v, want %v (%v)", tt.query, got, want, tt.want)
+		}
+	}
+
+	all, err := repo.SearchAll(ctx, "hidden", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].ID != groups["go_private"] {
+		t.Errorf("SearchAll(%q) = %+v, want only the private group", "hidden", all)
+	}
+
+	// Renames and new descriptions are searchable right away
+	if _, err := db.Exec(`UPDATE groups SET name = 'Ferris fans' WHERE id = ?`, groups["Rustaceans"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateDetails(ctx, groups["golang"], "Weekly meetup", true); err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]int64{"ferris": groups["Rustaceans"], "meetup": groups["golang"]} {
+		entries, err := repo.SearchPublic(ctx, query, 0, 10)
+		if err != nil || len(entries) != 1 || entries[0].ID != want {
+			t.Errorf("SearchPublic(%q) after an update = %+v (err %v), want group %d", query, entries, err, want)
+		}
+	}
+	if entries, _ := repo.SearchPublic(ctx, "rustaceans", 0, 10); len(entries) != 0 {
+		t.Errorf("SearchPublic still finds the old name: %+v", entries)
+	}
+}
+
+func TestSearchPublicUsesTheSearchIndex(t *testing.T) {
+	db := newTestDB(t)
+	for _, publicOnly := range []bool{true, false} {
+		query, args := groupSearchQuery(publicOnly, "go", 0, 20)
+		var plan []struct {
+			ID      int    `db:"id"`
+			Parent  int    `db:"parent"`
+			NotUsed int    `db:"notused"`
+			Detail  string `db:"detail"`
+		}
+		if err := db.Select(&plan, "EXPLAIN QUERY PLAN "+query, args...); err != nil {
+			t.Fatal(err)
+		}
+		var details []string
+		for _, step := range plan {
+			details = append(details, step.Detail)
+		}
+		if !strings.Contains(strings.Join(details, "\n"), "VIRTUAL TABLE INDEX") {
+			t.Errorf("publicOnly=%v: query plan does not use groups_fts:\n%s", publicOnly, strings.Join(details, "\n"))
+		}
+	}
+}
+
+func TestSharesGroup(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := NewGroupRepository(db)
+	users := createUsers(t, db, "ann", "bob", "cat", "dan")
+	createGroup(t, db, "ann and bob", users[0], users[1])
+	deleted := createGroup(t, db, "ann and cat", users[0], users[2])
+	if _, err := db.Exec(`UPDATE groups SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?`, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		a, b int64
+		want bool
+	}{
+		{users[0], users[1], true},
+		{users[1], users[0], true},
+		{users[0], users[2], false}, // only in a deleted group
+		{users[1], users[3], false},
+	} {
+		shares, err := repo.SharesGroup(ctx, tt.a, tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shares != tt.want {
+			t.Errorf("SharesGroup(%d, %d) = %v, want %v", tt.a, tt.b, shares, tt.want)
+		}
+	}
+}
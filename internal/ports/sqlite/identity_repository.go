@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// IdentityRepository implements the domain.IdentityRepository interface using SQLite.
+type IdentityRepository struct {
+	db *sqlx.DB
+}
+
+// NewIdentityRepository creates a new IdentityRepository instance.
+func NewIdentityRepository(db *sqlx.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// FindIdentity retrieves the link for a provider subject, or nil if there is none.
+func (r *IdentityRepository) FindIdentity(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	identity := &domain.UserIdentity{}
+	query := `SELECT provider, subject, user_id, email, created_at FROM user_identities WHERE provider = ? AND subject = ?`
+
+	err := r.db.GetContext(ctx, identity, query, provider, subject)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// LinkIdentity links a provider subject to a user.
+func (r *IdentityRepository) LinkIdentity(ctx context.Context, identity *domain.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email, created_at)
+		VALUES (:provider, :subject, :user_id, :email, :created_at)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, identity)
+	return err
+}
+
+// SaveLoginState persists the state of an in-flight OIDC login.
+func (r *IdentityRepository) SaveLoginState(ctx context.Context, state *domain.OIDCLoginState) error {
+	query := `
+		INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at)
+		VALUES (:state_hash, :nonce, :code_verifier, :expires_at)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, state)
+	return err
+}
+
+// DeleteExpiredLoginStates removes the login states that expired before now.
+func (r *IdentityRepository) DeleteExpiredLoginStates(ctx context.Context, now time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < ?`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ConsumeLoginState deletes and returns a login state in one transaction, so it can only be used once.
+func (r *IdentityRepository) ConsumeLoginState(ctx context.Context, stateHash string) (*domain.OIDCLoginState, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	state := &domain.OIDCLoginState{}
+	query := `SELECT state_hash, nonce, code_verifier, expires_at FROM oidc_login_states WHERE state_hash = ?`
+	err = tx.GetContext(ctx, state, query, stateHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE state_hash = ?`, stateHash)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return nil, err
+	}
+	return state, tx.Commit()
+}
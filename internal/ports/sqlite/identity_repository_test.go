@@ -0,0 +1,31 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+func TestDeleteExpiredLoginStates(t *testing.T) {
+	repo := NewIdentityRepository(newTestDB(t))
+	ctx := context.Background()
+	now := time.Now()
+	for hash, expiresAt := range map[string]time.Time{"expired": now.Add(-time.Minute), "live": now.Add(time.Minute)} {
+		if err := repo.SaveLoginState(ctx, &domain.OIDCLoginState{StateHash: hash, ExpiresAt: expiresAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := repo.DeleteExpiredLoginStates(ctx, now)
+	if err != nil || removed != 1 {
+		t.Fatalf("removed %d login states (err %v), want 1", removed, err)
+	}
+	if state, err := repo.ConsumeLoginState(ctx, "expired"); err != nil || state != nil {
+		t.Errorf("expired state = %+v (err %v), want it deleted", state, err)
+	}
+	if state, err := repo.ConsumeLoginState(ctx, "live"); err != nil || state == nil {
+		t.Errorf("live state = %+v (err %v), want it kept", state, err)
+	}
+}
@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// LoginThrottleRepository implements the domain.LoginThrottleRepository interface using SQLite.
+type LoginThrottleRepository struct {
+	db *sqlx.DB
+}
+
+// NewLoginThrottleRepository creates a new LoginThrottleRepository instance.
+func NewLoginThrottleRepository(db *sqlx.DB) *LoginThrottleRepository {
+	return &LoginThrottleRepository{db: db}
+}
+
+// FindThrottle retrieves the throttle state for a key, or nil if there were no recent failures.
+func (r *LoginThrottleRepository) FindThrottle(ctx context.Context, key string) (*domain.LoginThrottle, error) {
+	throttle := &domain.LoginThrottle{}
+	query := `SELECT key, failures, last_failure_at, blocked_until FROM login_throttles WHERE key = ?`
+
+	err := r.db.GetContext(ctx, throttle, query, key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return throttle, nil
+}
+
+// SaveThrottle inserts or replaces the throttle state for a key.
+func (r *LoginThrottleRepository) SaveThrottle(ctx context.Context, throttle *domain.LoginThrottle) error {
+	query := `
+		INSERT OR REPLACE INTO login_throttles (key, failures, last_failure_at, blocked_until)
+		VALUES (:key, :failures, :last_failure_at, :blocked_until)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, throttle)
+	return err
+}
+
+// DeleteThrottle clears the throttle state for a key.
+func (r *LoginThrottleRepository) DeleteThrottle(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_throttles WHERE key = ?`, key)
+	return err
+}
+
+// DeleteStaleThrottles removes throttles whose failures are all older than lastFailureBefore
+// and whose block, if any, has ended by now.
+func (r *LoginThrottleRepository) DeleteStaleThrottles(ctx context.Context, lastFailureBefore, now time.Time) (int64, error) {
+	query := `
+		DELETE FROM login_throttles
+		WHERE last_failure_at < ? AND (blocked_until IS NULL OR blocked_until < ?)
+	`
+	result, err := r.db.ExecContext(ctx, query, lastFailureBefore, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SaveLoginFailure appends a record to the login failure audit trail.
+func (r *LoginThrottleRepository) SaveLoginFailure(ctx context.Context, failure *domain.LoginFailure) error {
+	query := `
+		INSERT INTO login_failures (email, ip_address, user_agent, reason, created_at)
+		VALUES (:email, :ip_address, :user_agent, :reason, :created_at)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, failure)
+	return err
+}
+
+// DeleteLoginFailures removes audit records created before cutoff.
+func (r *LoginThrottleRepository) DeleteLoginFailures(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM login_failures WHERE created_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+func TestDeleteStaleThrottles(t *testing.T) {
+	repo := NewLoginThrottleRepository(newTestDB(t))
+	ctx := context.Background()
+	now := time.Now()
+	blockedUntil := now.Add(time.Hour)
+	throttles := []*domain.LoginThrottle{
+		{Key: "account:stale@example.com", Failures: 2, LastFailureAt: now.Add(-time.Hour)},
+		{Key: "account:recent@example.com", Failures: 2, LastFailureAt: now.Add(-time.Minute)},
+		{Key: "account:locked@example.com", Failures: 10, LastFailureAt: now.Add(-time.Hour), BlockedUntil: &blockedUntil},
+	}
+	for _, throttle := range throttles {
+		if err := repo.SaveThrottle(ctx, throttle); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := repo.DeleteStaleThrottles(ctx, now.Add(-15*time.Minute), now)
+	if err != nil || removed != 1 {
+		t.Fatalf("removed %d throttles (err %v), want 1", removed, err)
+	}
+	for _, throttle := range throttles {
+		found, err := repo.FindThrottle(ctx, throttle.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := found != nil; kept != (throttle.Key != "account:stale@example.com") {
+			t.Errorf("throttle %s kept = %v", throttle.Key, kept)
+		}
+	}
+}
+
+func TestDeleteLoginFailures(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewLoginThrottleRepository(db)
+	ctx := context.Background()
+	now := time.Now()
+	for _, createdAt := range []time.Time{now.Add(-100 * 24 * time.Hour), now.Add(-time.Hour)} {
+		failure := &domain.LoginFailure{Email: "a@example.com", IPAddress: "192.0.2.1", Reason: domain.LoginFailureInvalidCredentials, CreatedAt: createdAt}
+		if err := repo.SaveLoginFailure(ctx, failure); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := repo.DeleteLoginFailures(ctx, now.Add(-90*24*time.Hour))
+	if err != nil || removed != 1 {
+		t.Fatalf("removed %d login failures (err %v), want 1", removed, err)
+	}
+	var left int
+	if err := db.Get(&left, `SELECT COUNT(*) FROM login_failures`); err != nil || left != 1 {
+		t.Errorf("%d login failures left (err %v), want 1", left, err)
+	}
+}
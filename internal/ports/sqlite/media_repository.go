@@ -0,0 +1,295 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// MediaRepository implements the domain.MediaRepository interface using SQLite.
+type MediaRepository struct {
+	db *sqlx.DB
+}
+
+// NewMediaRepository creates a new repository instance.
+func NewMediaRepository(db *sqlx.DB) domain.MediaRepository {
+	return &MediaRepository{db: db}
+}
+
+// Create stores the metadata of a new upload.
+func (r *MediaRepository) Create(ctx context.Context, media *domain.Media) error {
+	_, err := r.db.NamedExecContext(ctx, `
+		INSERT INTO media (id, owner_id, filename, content_type, size, received_bytes, status, created_at, completed_at)
+		VALUES (:id, :owner_id, :filename, :content_type, :size, :received_bytes, :status, :created_at, :completed_at)`,
+		media)
+	return err
+}
+
+// CreateWithinQuota stores a new upload if the owner's uploads, unfinished ones included, stay
+// within quotaBytes with it, in a single statement so that concurrent uploads cannot both pass.
+func (r *MediaRepository) CreateWithinQuota(ctx context.Context, media *domain.Media, quotaBytes int64) (bool, error) {
+	query, args, err := sqlx.Named(`
+		INSERT INTO media (id, owner_id, filename, content_type, size, received_bytes, status, created_at, completed_at)
+		SELECT :id, :owner_id, :filename, :content_type, :size, :received_bytes, :status, :created_at, :completed_at
+		WHERE (SELECT COALESCE(SUM(size), 0) FROM media WHERE owner_id = :owner_id) + :size <= ?`,
+		media)
+	if err != nil {
+		return false, err
+	}
+	res, err := r.db.ExecContext(ctx, query, append(args, quotaBytes)...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// FindByID returns the upload, or nil if it does not exist.
+func (r *MediaRepository) FindByID(ctx context.Context, id string) (*domain.Media, error) {
+	media := &domain.Media{}
+	err := r.db.GetContext(ctx, media, `
+		SELECT id, owner_id, filename, content_type, size, received_bytes, status, created_at, completed_at, sha256, scan_result, image
+		FROM media WHERE id = ?`, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// ClaimChunk reserves an upload standing at offset for writing its next chunk.
+func (r *MediaRepository) ClaimChunk(ctx context.Context, id string, offset int64, now, until time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE media SET chunk_claimed_until = ?
+		WHERE id = ? AND status = ? AND received_bytes = ?
+			AND (chunk_claimed_until IS NULL OR chunk_claimed_until < ?)`,
+		until, id, domain.MediaUploading, offset, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// UpdateProgress records how many bytes of a resumable upload have been received, if it still
+// stands at offset, and releases the chunk claim until the upload is fully received.
+func (r *MediaRepository) UpdateProgress(ctx context.Context, id string, offset, receivedBytes int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE media SET received_bytes = ?,
+			chunk_claimed_until = CASE WHEN ? = size THEN chunk_claimed_until ELSE NULL END
+		WHERE id = ? AND received_bytes = ?`,
+		receivedBytes, receivedBytes, id, offset)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReleaseChunk drops the chunk claim on an upload.
+func (r *MediaRepository) ReleaseChunk(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE media SET chunk_claimed_until = NULL WHERE id = ?`, id)
+	return err
+}
+
+// MarkComplete completes an upload with its sniffed content type.
+func (r *MediaRepository) MarkComplete(ctx context.Context, id string, status domain.MediaStatus, contentType string, size int64, completedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE media SET content_type = ?, size = ?, received_bytes = ?, status = ?, completed_at = ?
+		WHERE id = ?`,
+		contentType, size, size, status, completedAt, id)
+	return err
+}
+
+// SetScanResult records the outcome of the malware scan of an upload that is still waiting for it.
+func (r *MediaRepository) SetScanResult(ctx context.Context, id string, status domain.MediaStatus, threat string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE media SET status = ?, scan_result = ? WHERE id = ? AND status = ?`,
+		status, threat, id, domain.MediaScanning)
+	return err
+}
+
+// FindByStatus returns the oldest uploads with the given status.
+func (r *MediaRepository) FindByStatus(ctx context.Context, status domain.MediaStatus, limit int) ([]*domain.Media, error) {
+	media := []*domain.Media{}
+	err := r.db.SelectContext(ctx, &media, `
+		SELECT id, owner_id, filename, content_type, size, received_bytes, status, created_at, completed_at, sha256, scan_result, image
+		FROM media
+		WHERE status = ?
+		ORDER BY created_at
+		LIMIT ?`,
+		status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// Delete removes the metadata of an upload and releases its reference to the stored file. A file
+// left unreferenced is timestamped, so it is deleted only once it has stayed unreferenced.
+func (r *MediaRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sha256 string
+	err = tx.GetContext(ctx, &sha256, `SELECT sha256 FROM media WHERE id = ?`, id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM media WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if sha256 != "" {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE media_blobs
+			SET ref_count = ref_count - 1,
+			    released_at = CASE WHEN ref_count = 1 THEN ? ELSE released_at END
+			WHERE sha256 = ?`,
+			time.Now(), sha256)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// IsAttachedForUser reports whether a message carrying the upload is visible to the user.
+func (r *MediaRepository) IsAttachedForUser(ctx context.Context, id string, userID int64) (bool, error) {
+	var attached bool
+	err := r.db.GetContext(ctx, &attached, `
+		SELECT EXISTS (
+			SELECT 1 FROM messages m
+			WHERE m.media_id = ? AND (
+				(m.group_id != 0 AND EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = m.group_id AND gm.user_id = ?))
+				OR (m.group_id = 0 AND (m.sender_id = ? OR m.recipient_id = ?))
+			)
+		)`,
+		id, userID, userID, userID)
+	return attached, err
+}
+
+// FindOrphans returns uploads created before cutoff that never completed or were never sent.
+func (r *MediaRepository) FindOrphans(ctx context.Context, cutoff time.Time, limit int) ([]*domain.Media, error) {
+	orphans := []*domain.Media{}
+	err := r.db.SelectContext(ctx, &orphans, `
+		SELECT id, owner_id, filename, content_type, size, received_bytes, status, created_at, completed_at, sha256, scan_result, image
+		FROM media
+		WHERE created_at < ?
+		  AND (status != ? OR NOT EXISTS (SELECT 1 FROM messages m WHERE m.media_id = media.id))
+		ORDER BY created_at
+		LIMIT ?`,
+		cutoff, domain.MediaReady, limit)
+	if err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// ListReady pages through completed uploads in ID order.
+func (r *MediaRepository) ListReady(ctx context.Context, afterID string, limit int) ([]*domain.Media, error) {
+	media := []*domain.Media{}
+	err := r.db.SelectContext(ctx, &media, `
+		SELECT id, owner_id, filename, content_type, size, received_bytes, status, created_at, completed_at, sha256, scan_result, image
+		FROM media
+		WHERE status = ? AND id > ?
+		ORDER BY id
+		LIMIT ?`,
+		domain.MediaReady, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// SetImageInfo records the metadata of a processed image.
+func (r *MediaRepository) SetImageInfo(ctx context.Context, id string, info *domain.ImageInfo) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE media SET image = ? WHERE id = ?`, info, id)
+	return err
+}
+
+// AttachBlob points the upload at a stored file in one transaction with counting the reference.
+// A file whose references all went away may already be deleted, so it does not count as stored.
+func (r *MediaRepository) AttachBlob(ctx context.Context, id string, sha256 string, size int64) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var refCount int64
+	err = tx.GetContext(ctx, &refCount, `SELECT ref_count FROM media_blobs WHERE sha256 = ?`, sha256)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO media_blobs (sha256, size, ref_count, created_at) VALUES (?, ?, 1, ?)`,
+			sha256, size, time.Now())
+	case err == nil:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE media_blobs SET ref_count = ref_count + 1, released_at = NULL WHERE sha256 = ?`, sha256)
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE media SET sha256 = ? WHERE id = ?`, sha256, id); err != nil {
+		return false, err
+	}
+	return refCount > 0, tx.Commit()
+}
+
+// FindUnreferencedBlobs returns stored files whose last reference was released before cutoff.
+func (r *MediaRepository) FindUnreferencedBlobs(ctx context.Context, cutoff time.Time, limit int) ([]string, error) {
+	hashes := []string{}
+	err := r.db.SelectContext(ctx, &hashes, `
+		SELECT sha256 FROM media_blobs
+		WHERE ref_count = 0 AND released_at < ?
+		ORDER BY released_at
+		LIMIT ?`,
+		cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// DeleteBlob forgets a stored file unless it has been referenced again.
+func (r *MediaRepository) DeleteBlob(ctx context.Context, sha256 string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM media_blobs WHERE sha256 = ? AND ref_count = 0`, sha256)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// UsageByOwner sums the sizes of a user's uploads; unfinished ones count with their declared size.
+func (r *MediaRepository) UsageByOwner(ctx context.Context, ownerID int64) (int64, int, error) {
+	var usage struct {
+		Bytes int64 `db:"bytes"`
+		Files int   `db:"files"`
+	}
+	err := r.db.GetContext(ctx, &usage, `
+		SELECT COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS files FROM media WHERE owner_id = ?`, ownerID)
+	return usage.Bytes, usage.Files, err
+}
+
+// UsageByGroup sums the sizes of the distinct uploads attached to the group's messages.
+func (r *MediaRepository) UsageByGroup(ctx context.Context, groupID int64, withMediaID string) (int64, error) {
+	var used int64
+	err := r.db.GetContext(ctx, &used, `
+		SELECT COALESCE(SUM(size), 0) FROM media
+		WHERE id IN (SELECT media_id FROM messages WHERE group_id = ? AND media_id != '')
+		   OR id = ?`,
+		groupID, withMediaID)
+	return used, err
+}
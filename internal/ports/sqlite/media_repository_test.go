@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+func TestClaimChunkAllowsOneWriterPerOffset(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := NewMediaRepository(db)
+	owner := createUsers(t, db, "tom")[0]
+	if err := repo.Create(ctx, &domain.Media{ID: "upload", OwnerID: owner, Size: 10, Status: domain.MediaUploading, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	until := now.Add(time.Minute)
+
+	var claims atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed, err := repo.ClaimChunk(ctx, "upload", 0, now, until)
+			if err != nil {
+				t.Error(err)
+			}
+			if claimed {
+				claims.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := claims.Load(); got != 1 {
+		t.Fatalf("%d requests claimed offset 0, want 1", got)
+	}
+
+	if recorded, err := repo.UpdateProgress(ctx, "upload", 4, 8); err != nil || recorded {
+		t.Errorf("progress from the wrong offset: recorded = %v, err = %v; want false, nil", recorded, err)
+	}
+	if recorded, err := repo.UpdateProgress(ctx, "upload", 0, 4); err != nil || !recorded {
+		t.Fatalf("progress: recorded = %v, err = %v", recorded, err)
+	}
+
+	// Recording progress released the claim, but only at the new offset.
+	if claimed, err := repo.ClaimChunk(ctx, "upload", 0, now, until); err != nil || claimed {
+		t.Errorf("claim at the old offset: claimed = %v, err = %v; want false, nil", claimed, err)
+	}
+	if claimed, err := repo.ClaimChunk(ctx, "upload", 4, now, until); err != nil || !claimed {
+		t.Fatalf("claim at the new offset: claimed = %v, err = %v", claimed, err)
+	}
+
+	// An expired claim can be taken over.
+	later := until.Add(time.Second)
+	if claimed, err := repo.ClaimChunk(ctx, "upload", 4, later, later.Add(time.Minute)); err != nil || !claimed {
+		t.Fatalf("claim after expiry: claimed = %v, err = %v", claimed, err)
+	}
+
+	// The final chunk keeps its claim while the upload completes.
+	if recorded, err := repo.UpdateProgress(ctx, "upload", 4, 10); err != nil || !recorded {
+		t.Fatalf("final progress: recorded = %v, err = %v", recorded, err)
+	}
+	if claimed, err := repo.ClaimChunk(ctx, "upload", 10, later, later.Add(time.Minute)); err != nil || claimed {
+		t.Errorf("claim while completing: claimed = %v, err = %v; want false, nil", claimed, err)
+	}
+	if err := repo.ReleaseChunk(ctx, "upload"); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := repo.ClaimChunk(ctx, "upload", 10, later, later.Add(time.Minute)); err != nil || !claimed {
+		t.Errorf("claim after a failed completion: claimed = %v, err = %v", claimed, err)
+	}
+}
+
+func TestCreateWithinQuotaAllowsConcurrentUploadsUpToTheQuota(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := NewMediaRepository(db)
+	users := createUsers(t, db, "tom", "jerry")
+	tom, jerry := users[0], users[1]
+	// Other users' uploads do not count against tom's quota.
+	if created, err := repo.CreateWithinQuota(ctx, &domain.Media{ID: "jerry", OwnerID: jerry, Size: 90, Status: domain.MediaUploading, CreatedAt: time.Now()}, 100); err != nil || !created {
+		t.Fatalf("jerry's upload: created = %v, err = %v", created, err)
+	}
+
+	var created atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			media := &domain.Media{ID: fmt.Sprintf("tom-%d", i), OwnerID: tom, Size: 40, Status: domain.MediaUploading, CreatedAt: time.Now()}
+			ok, err := repo.CreateWithinQuota(ctx, media, 100)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				created.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got := created.Load(); got != 2 {
+		t.Errorf("created %d uploads of 40 bytes within a 100-byte quota, want 2", got)
+	}
+	if used, files, err := repo.UsageByOwner(ctx, tom); err != nil || used != 80 || files != 2 {
+		t.Errorf("tom uses %d bytes in %d files (err %v), want 80 in 2", used, files, err)
+	}
+}
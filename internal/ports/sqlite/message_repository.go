@@ -2,7 +2,10 @@ package sqlite
 
 import (
 	"context"
+	"database/sql"
+	"html"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/Emmanuel326/chatserver/internal/domain"
@@ -21,35 +24,152 @@ func NewMessageRepository(db *sqlx.DB) domain.MessageRepository {
 
 // Save persists a new message to the database.
 func (r *messageRepository) Save(ctx context.Context, message *domain.Message) (*domain.Message, error) {
+	if err := insertMessage(ctx, r.db, message); err != nil {
+		log.Printf("Error saving message: %v", err)
+		return nil, err
+	}
+	return message, nil
+}
+
+// SaveAll persists several new messages in one transaction: either all are saved or none is.
+// A message to a group in limits is inserted as SaveGroupPost would, with the group's limits;
+// if it is refused, nothing is saved and the refused message is returned.
+func (r *messageRepository) SaveAll(ctx context.Context, messages []*domain.Message, limits map[int64]domain.GroupPostLimits) (*domain.Message, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // No-op once committed
+
+	for _, message := range messages {
+		saved := true
+		if message.GroupID != 0 {
+			saved, err = insertGroupPost(ctx, tx, message, limits[message.GroupID])
+		} else {
+			err = insertMessage(ctx, tx, message)
+		}
+		if err != nil {
+			log.Printf("Error saving message: %v", err)
+			return nil, err
+		}
+		if !saved {
+			return message, nil
+		}
+	}
+	return nil, tx.Commit()
+}
+
+// SaveGroupPost saves a group message unless its sender posted to the group after
+// limits.PostedSince or its upload takes the group's uploads past limits.QuotaBytes, in a single
+// statement so that concurrent posts cannot all pass the checks. It returns nil when the message
+// was refused.
+func (r *messageRepository) SaveGroupPost(ctx context.Context, message *domain.Message, limits domain.GroupPostLimits) (*domain.Message, error) {
+	saved, err := insertGroupPost(ctx, r.db, message, limits)
+	if err != nil {
+		log.Printf("Error saving message: %v", err)
+		return nil, err
+	}
+	if !saved {
+		return nil, nil
+	}
+	return message, nil
+}
+
+// insertGroupPost inserts a group message and sets its ID unless it breaks one of the limits.
+// It reports whether the message was inserted.
+func insertGroupPost(ctx context.Context, db sqlx.ExtContext, message *domain.Message, limits domain.GroupPostLimits) (bool, error) {
+	var conditions []string
+	if !limits.PostedSince.IsZero() {
+		conditions = append(conditions, `NOT EXISTS (
+			SELECT 1 FROM messages WHERE group_id = :group_id AND sender_id = :sender_id AND timestamp > :posted_since
+		)`)
+	}
+	if limits.QuotaBytes > 0 && message.MediaID != "" {
+		// Uploads already sent to the group do not count twice, as in MediaRepository.UsageByGroup.
+		conditions = append(conditions, `(
+			SELECT COALESCE(SUM(size), 0) FROM media
+			WHERE id IN (SELECT media_id FROM messages WHERE group_id = :group_id AND media_id != '')
+			   OR id = :media_id
+		) <= :quota_bytes`)
+	}
+	if len(conditions) == 0 {
+		return true, insertMessage(ctx, db, message)
+	}
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
+	}
+
+	query, args, err := sqlx.Named(`
+		INSERT INTO messages (sender_id, recipient_id, group_id, type, content, media_url, media_id, image, attachment, forwarded_from, timestamp, status, is_bot)
+		SELECT :sender_id, :recipient_id, :group_id, :type, :content, :media_url, :media_id, :image, :attachment, :forwarded_from, :timestamp, :status, :is_bot
+		WHERE `+strings.Join(conditions, " AND "),
+		struct {
+			*domain.Message
+			PostedSince time.Time `db:"posted_since"`
+			QuotaBytes  int64     `db:"quota_bytes"`
+		}{message, limits.PostedSince, limits.QuotaBytes})
+	if err != nil {
+		return false, err
+	}
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	message.ID = id
+	return true, nil
+}
+
+// insertMessage inserts a message and sets its ID.
+func insertMessage(ctx context.Context, db sqlx.ExtContext, message *domain.Message) error {
 	if message.Timestamp.IsZero() {
 		message.Timestamp = time.Now()
 	}
 
 	query := `
-		INSERT INTO messages (sender_id, recipient_id, type, content, media_url, timestamp, status)
-		VALUES (:sender_id, :recipient_id, :type, :content, :media_url, :timestamp, :status);
+		INSERT INTO messages (sender_id, recipient_id, group_id, type, content, media_url, media_id, image, attachment, forwarded_from, timestamp, status, is_bot)
+		VALUES (:sender_id, :recipient_id, :group_id, :type, :content, :media_url, :media_id, :image, :attachment, :forwarded_from, :timestamp, :status, :is_bot);
 	`
     // FIX: NamedExecContext automatically maps message.MediaURL to :media_url
-	res, err := r.db.NamedExecContext(ctx, query, message)
+	res, err := sqlx.NamedExecContext(ctx, db, query, message)
 	if err != nil {
-		log.Printf("Error saving message: %v", err)
-		return nil, err
+		return err
 	}
 
 	id, err := res.LastInsertId()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	message.ID = id
-	return message, nil
+	return nil
+}
+
+// HasConversation reports whether either user has sent the other a P2P message.
+func (r *messageRepository) HasConversation(ctx context.Context, userID1, userID2 int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM messages
+			WHERE group_id = 0 AND ((sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?))
+		)
+	`
+	var exists bool
+	err := r.db.GetContext(ctx, &exists, query, userID1, userID2, userID2, userID1)
+	return exists, err
 }
 
 // FindConversationHistory retrieves the message history between two users with pagination.
 func (r *messageRepository) FindConversationHistory(ctx context.Context, userID1, userID2 int64, limit int, beforeID int64) ([]*domain.Message, error) {
 	// Base query
 	query := `
-		SELECT id, sender_id, recipient_id, type, content, media_url, timestamp, status FROM messages
-		WHERE ((sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?))
+		SELECT id, sender_id, recipient_id, group_id, type, content, media_url, media_id, image, attachment, forwarded_from, timestamp, status, is_bot FROM messages
+		WHERE group_id = 0 AND ((sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?))
 	`
 	args := []interface{}{userID1, userID2, userID2, userID1}
 
@@ -84,8 +204,8 @@ func (r *messageRepository) FindConversationHistory(ctx context.Context, userID1
 // GetGroupConversationHistory retrieves the message history for a group.
 func (r *messageRepository) GetGroupConversationHistory(ctx context.Context, groupID int64, limit int, beforeID int64) ([]*domain.Message, error) {
 	query := `
-		SELECT id, sender_id, recipient_id, type, content, media_url, timestamp, status FROM messages
-		WHERE recipient_id = ?
+		SELECT id, sender_id, recipient_id, group_id, type, content, media_url, media_id, image, attachment, forwarded_from, timestamp, status, is_bot FROM messages
+		WHERE group_id = ?
 	`
 	args := []interface{}{groupID}
 
@@ -117,36 +237,38 @@ func (r *messageRepository) GetGroupConversationHistory(ctx context.Context, gro
 
 // GetRecentConversations returns the latest message for every unique conversation
 // a user has participated in (both P2P and Group chats).
-func (r *messageRepository) GetRecentConversations(ctx context.Context, userID int64) ([]*domain.Message, error) {
+// Archived groups are left out unless includeArchived is set.
+func (r *messageRepository) GetRecentConversations(ctx context.Context, userID int64, includeArchived bool) ([]*domain.Message, error) {
 	query := `
-		-- CTE for groups the user is a member of
+		-- CTE for groups the user is a member of (optionally skipping archived groups)
 		WITH user_groups AS (
-		  SELECT group_id FROM group_members WHERE user_id = ?
+		  SELECT gm.group_id FROM group_members gm
+		  JOIN groups ug ON ug.id = gm.group_id
+		  WHERE gm.user_id = ? AND (? OR ug.archived_at IS NULL)
 		),
 		-- All relevant messages for the user, with a generated conversation ID
 		messages_with_conv_id AS (
 		  SELECT
-			m.id, m.sender_id, m.recipient_id, m.type, m.content, m.media_url, m.timestamp, m.status,
+			m.id, m.sender_id, m.recipient_id, m.group_id, m.type, m.content, m.media_url, m.media_id, m.image, m.attachment, m.forwarded_from, m.timestamp, m.status, m.is_bot,
 			CASE
 			  -- Group message where user is a member
-			  WHEN g.id IS NOT NULL AND m.recipient_id IN (SELECT group_id FROM user_groups)
-				THEN 'group_' || m.recipient_id
+			  WHEN m.group_id != 0 AND m.group_id IN (SELECT group_id FROM user_groups)
+				THEN 'group_' || m.group_id
 			  -- P2P message sent by user
-			  WHEN g.id IS NULL AND m.sender_id = ?
+			  WHEN m.group_id = 0 AND m.sender_id = ?
 				THEN 'user_' || m.recipient_id
 			  -- P2P message received by user
-			  WHEN g.id IS NULL AND m.recipient_id = ?
+			  WHEN m.group_id = 0 AND m.recipient_id = ?
 				THEN 'user_' || m.sender_id
 			  ELSE NULL
 			END AS conv_id
 		  FROM messages m
-		  LEFT JOIN groups g ON m.recipient_id = g.id
 		  WHERE
 			-- It's a group message and the user is a member
-			(g.id IS NOT NULL AND m.recipient_id IN (SELECT group_id FROM user_groups))
+			(m.group_id != 0 AND m.group_id IN (SELECT group_id FROM user_groups))
 			OR
 			-- or it's a P2P message involving the user
-			(g.id IS NULL AND (m.sender_id = ? OR m.recipient_id = ?))
+			(m.group_id = 0 AND (m.sender_id = ? OR m.recipient_id = ?))
 		),
 		-- Rank messages within each conversation by timestamp
 		ranked_messages AS (
@@ -157,14 +279,14 @@ func (r *messageRepository) GetRecentConversations(ctx context.Context, userID i
 		  WHERE conv_id IS NOT NULL
 		)
 		-- Select only the latest message from each conversation
-		SELECT id, sender_id, recipient_id, type, content, media_url, timestamp, status
+		SELECT id, sender_id, recipient_id, group_id, type, content, media_url, media_id, image, attachment, forwarded_from, timestamp, status, is_bot
 		FROM ranked_messages
 		WHERE rn = 1
 		ORDER BY timestamp DESC;
 	`
 
 	messages := []*domain.Message{}
-	err := r.db.SelectContext(ctx, &messages, query, userID, userID, userID, userID, userID)
+	err := r.db.SelectContext(ctx, &messages, query, userID, includeArchived, userID, userID, userID, userID)
 	if err != nil {
 		log.Printf("Error finding recent conversations: %v", err)
 		return nil, err
@@ -176,9 +298,9 @@ func (r *messageRepository) GetRecentConversations(ctx context.Context, userID i
 // FindPendingForUser retrieves all messages for a user with 'PENDING' status.
 func (r *messageRepository) FindPendingForUser(ctx context.Context, userID int64) ([]*domain.Message, error) {
 	query := `
-		SELECT id, sender_id, recipient_id, type, content, media_url, timestamp, status
+		SELECT id, sender_id, recipient_id, group_id, type, content, media_url, media_id, image, attachment, forwarded_from, timestamp, status, is_bot
 		FROM messages
-		WHERE recipient_id = ? AND status = ?
+		WHERE recipient_id = ? AND group_id = 0 AND status = ?
 		ORDER BY timestamp ASC;
 	`
 	messages := []*domain.Message{}
@@ -208,3 +330,152 @@ func (r *messageRepository) UpdateStatus(ctx context.Context, messageIDs []int64
 	}
 	return err
 }
+
+// FindByID retrieves a message by its ID, or nil if it does not exist.
+func (r *messageRepository) FindByID(ctx context.Context, id int64) (*domain.Message, error) {
+	query := `
+		SELECT id, sender_id, recipient_id, group_id, type, content, media_url, media_id, image, attachment, forwarded_from, timestamp, status, is_bot
+		FROM messages
+		WHERE id = ?;
+	`
+	message := &domain.Message{}
+	err := r.db.GetContext(ctx, message, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error finding message %d: %v", id, err)
+		return nil, err
+	}
+	return message, nil
+}
+
+// FindLastGroupMessageBySender retrieves the most recent message a user posted in a group, or nil if none.
+func (r *messageRepository) FindLastGroupMessageBySender(ctx context.Context, groupID, senderID int64) (*domain.Message, error) {
+	query := `
+		SELECT id, sender_id, recipient_id, group_id, type, content, media_url, media_id, image, attachment, forwarded_from, timestamp, status, is_bot
+		FROM messages
+		WHERE group_id = ? AND sender_id = ?
+		ORDER BY id DESC
+		LIMIT 1;
+	`
+	message := &domain.Message{}
+	err := r.db.GetContext(ctx, message, query, groupID, senderID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error finding last message of user %d in group %d: %v", senderID, groupID, err)
+		return nil, err
+	}
+	return message, nil
+}
+
+// UpdateImageInfo fills in the image metadata of messages carrying the upload that lack it.
+func (r *messageRepository) UpdateImageInfo(ctx context.Context, mediaID string, info *domain.ImageInfo) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE messages SET image = ? WHERE media_id = ? AND image IS NULL`, info, mediaID)
+	return err
+}
+
+// Markers wrapped around the matching words by snippet(); they are replaced by <mark> tags
+// once the rest of the snippet has been HTML-escaped.
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// Search returns the messages matching search in the conversations userID belongs to, newest first:
+// the groups they are a member of and their P2P messages.
+func (r *messageRepository) Search(ctx context.Context, userID int64, search domain.MessageSearch) ([]*domain.MessageSearchResult, error) {
+	match := ftsMatchQuery(search.Query)
+	if match == "" {
+		return []*domain.MessageSearchResult{}, nil
+	}
+
+	query := `
+		SELECT m.id, m.sender_id, m.recipient_id, m.group_id, m.type, m.content, m.media_url, m.media_id, m.image, m.attachment, m.forwarded_from, m.timestamp, m.status, m.is_bot,
+			snippet(messages_fts, 0, ?, ?, '…', 16) AS snippet
+		FROM messages_fts
+		JOIN messages m ON m.id = messages_fts.rowid
+		LEFT JOIN groups g ON g.id = m.group_id
+		WHERE messages_fts MATCH ?
+		  AND m.type != ?
+		  AND (
+			(m.group_id != 0 AND g.deleted_at IS NULL
+			  AND EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = m.group_id AND gm.user_id = ?))
+			OR (m.group_id = 0 AND (m.sender_id = ? OR m.recipient_id = ?))
+		  )
+	`
+	args := []interface{}{snippetOpen, snippetClose, match, domain.DeletedMessage, userID, userID, userID}
+
+	if c := search.Conversation; c != nil {
+		if c.GroupID != 0 {
+			query += " AND m.group_id = ?"
+			args = append(args, c.GroupID)
+		} else {
+			query += " AND m.group_id = 0 AND (m.sender_id = ? OR m.recipient_id = ?)"
+			args = append(args, c.PeerID, c.PeerID)
+		}
+	}
+	if search.SenderID != 0 {
+		query += " AND m.sender_id = ?"
+		args = append(args, search.SenderID)
+	}
+	if !search.Before.IsZero() {
+		query += " AND m.timestamp < ?"
+		args = append(args, search.Before)
+	}
+	if !search.After.IsZero() {
+		query += " AND m.timestamp >= ?"
+		args = append(args, search.After)
+	}
+	if search.HasMedia {
+		query += " AND (m.media_id != '' OR COALESCE(m.media_url, '') != '')"
+	}
+	if search.BeforeID > 0 {
+		query += " AND m.id < ?"
+		args = append(args, search.BeforeID)
+	}
+	query += `
+		ORDER BY m.id DESC
+		LIMIT ?;
+	`
+	args = append(args, search.Limit)
+
+	results := []*domain.MessageSearchResult{}
+	if err := r.db.SelectContext(ctx, &results, query, args...); err != nil {
+		log.Printf("Error searching messages for user %d: %v", userID, err)
+		return nil, err
+	}
+	for _, result := range results {
+		result.Snippet = highlightSnippet(result.Snippet)
+	}
+	return results, nil
+}
+
+// ftsMatchQuery turns a user's search into an FTS5 query matching all of its words, so FTS5 syntax
+// in the input is searched for literally. A trailing * on a word matches it as a prefix.
+func ftsMatchQuery(input string) string {
+	var terms []string
+	for _, word := range strings.Fields(input) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.Trim(word, `*"`)
+		word = strings.ReplaceAll(word, `"`, `""`)
+		if word == "" {
+			continue
+		}
+		term := `"` + word + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+// highlightSnippet HTML-escapes a snippet and turns its match markers into <mark> tags.
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, snippetOpen, "<mark>")
+	return strings.ReplaceAll(snippet, snippetClose, "</mark>")
+}
@@ -0,0 +1,422 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/config"
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// newTestDB returns a migrated database in a temporary directory.
+func newTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db := InitDB(&config.Config{DB_FILE: filepath.Join(t.TempDir(), "test.db")})
+	t.Cleanup(func() { db.Close() })
+	Migrate(db)
+	return db
+}
+
+// createUsers registers users named after the given names and returns their IDs, in order.
+func createUsers(t *testing.T, db *sqlx.DB, names ...string) []int64 {
+	t.Helper()
+	repo := NewUserRepository(db)
+	ids := make([]int64, len(names))
+	for i, name := range names {
+		user, err := repo.Create(context.Background(), &domain.User{
+			Username:        name,
+			Email:           name + "@example.com",
+			Password:        "hash",
+			CreatedAt:       time.Now(),
+			PrivacySettings: domain.PrivacySettings{Discoverable: true},
+		})
+		if err != nil {
+			t.Fatalf("create user %s: %v", name, err)
+		}
+		ids[i] = user.ID
+	}
+	return ids
+}
+
+// createGroup creates a group owned by the first member, who joins as its admin, and adds the others.
+func createGroup(t *testing.T, db *sqlx.DB, name string, members ...int64) int64 {
+	t.Helper()
+	repo := NewGroupRepository(db)
+	group, err := repo.Create(context.Background(), &domain.Group{Name: name, OwnerID: members[0]})
+	if err != nil {
+		t.Fatalf("create group %s: %v", name, err)
+	}
+	for _, userID := range members[1:] {
+		if err := repo.AddMember(context.Background(), &domain.GroupMember{GroupID: group.ID, UserID: userID}); err != nil {
+			t.Fatalf("add member %d: %v", userID, err)
+		}
+	}
+	return group.ID
+}
+
+// saveMessage stores a text message, to a group when groupID is set and to the user recipientID otherwise.
+func saveMessage(t *testing.T, repo domain.MessageRepository, senderID, recipientID, groupID int64, content string) int64 {
+	t.Helper()
+	if groupID != 0 {
+		recipientID = groupID
+	}
+	message, err := repo.Save(context.Background(), &domain.Message{
+		SenderID:    senderID,
+		RecipientID: recipientID,
+		GroupID:     groupID,
+		Type:        domain.TextMessage,
+		Content:     content,
+		Timestamp:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("save message: %v", err)
+	}
+	return message.ID
+}
+
+func resultIDs(results []*domain.MessageSearchResult) []int64 {
+	ids := make([]int64, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids
+}
+
+func TestFtsMatchQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"hello", `"hello"`},
+		{"  hello   world ", `"hello" "world"`},
+		{"hel*", `"hel"*`},
+		{`say "hi"`, `"say" "hi"`},
+		{`a"b`, `"a""b"`},
+		{"NEAR(a b) OR c", `"NEAR(a" "b)" "OR" "c"`},
+		{"col:value -x", `"col:value" "-x"`},
+		{`* "" **`, ``},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ftsMatchQuery(tt.input); got != tt.want {
+			t.Errorf("ftsMatchQuery(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		snippet string
+		want    string
+	}{
+		{"plain", "plain"},
+		{"a " + snippetOpen + "match" + snippetClose + " b", "a <mark>match</mark> b"},
+		{"<script>" + snippetOpen + "x&y" + snippetClose, "&lt;script&gt;<mark>x&amp;y</mark>"},
+		{"<mark>fake</mark>", "&lt;mark&gt;fake&lt;/mark&gt;"},
+	}
+	for _, tt := range tests {
+		if got := highlightSnippet(tt.snippet); got != tt.want {
+			t.Errorf("highlightSnippet(%q) = %q, want %q", tt.snippet, got, tt.want)
+		}
+	}
+}
+
+func TestSearchOnlyMatchesTheCallersConversations(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewMessageRepository(db)
+	users := createUsers(t, db, "tom", "jerry", "alice")
+	tom, jerry, alice := users[0], users[1], users[2]
+	// The group's ID equals tom's user ID, so DMs to tom have the group's ID as recipient_id.
+	group := createGroup(t, db, "g1", tom, alice)
+	if group != tom {
+		t.Fatalf("group ID = %d, want it to equal tom's user ID %d", group, tom)
+	}
+
+	dm := saveMessage(t, repo, jerry, tom, 0, "zebra secret")
+	post := saveMessage(t, repo, tom, 0, group, "zebra in the group")
+	other := saveMessage(t, repo, alice, jerry, 0, "zebra for jerry")
+
+	tests := []struct {
+		name   string
+		userID int64
+		search domain.MessageSearch
+		want   []int64
+	}{
+		{"group member sees group posts and own DMs", alice, domain.MessageSearch{Query: "zebra"}, []int64{other, post}},
+		{"DM recipient", tom, domain.MessageSearch{Query: "zebra"}, []int64{post, dm}},
+		{"non-member", jerry, domain.MessageSearch{Query: "zebra"}, []int64{other, dm}},
+		{"group conversation", tom, domain.MessageSearch{Query: "zebra", Conversation: &domain.Conversation{GroupID: group}}, []int64{post}},
+		{"P2P conversation", tom, domain.MessageSearch{Query: "zebra", Conversation: &domain.Conversation{PeerID: jerry}}, []int64{dm}},
+		{"group conversation of a non-member", jerry, domain.MessageSearch{Query: "zebra", Conversation: &domain.Conversation{GroupID: group}}, []int64{}},
+		{"sender filter", tom, domain.MessageSearch{Query: "zebra", SenderID: jerry}, []int64{dm}},
+		{"prefix", alice, domain.MessageSearch{Query: "zeb*"}, []int64{other, post}},
+		{"no match", alice, domain.MessageSearch{Query: "secret"}, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.search.Limit = 10
+			results, err := repo.Search(context.Background(), tt.userID, tt.search)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultIDs(results); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got messages %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchSkipsLeftAndDeletedGroups(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewMessageRepository(db)
+	groups := NewGroupRepository(db)
+	users := createUsers(t, db, "tom", "alice")
+	tom, alice := users[0], users[1]
+	left := createGroup(t, db, "left", tom, alice)
+	deleted := createGroup(t, db, "deleted", alice, tom)
+	saveMessage(t, repo, tom, 0, left, "zebra one")
+	saveMessage(t, repo, alice, 0, deleted, "zebra two")
+
+	if err := groups.RemoveMember(context.Background(), left, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := groups.Delete(context.Background(), deleted, domain.RetentionTombstone); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := repo.Search(context.Background(), alice, domain.MessageSearch{Query: "zebra", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("got messages %v, want none", resultIDs(results))
+	}
+}
+
+func TestSearchPagesWithCursor(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewMessageRepository(db)
+	users := createUsers(t, db, "tom", "jerry")
+	var want []int64
+	for i := 0; i < 5; i++ {
+		want = append([]int64{saveMessage(t, repo, users[0], users[1], 0, fmt.Sprintf("zebra %d", i))}, want...)
+	}
+	saveMessage(t, repo, users[0], users[1], 0, "unrelated")
+
+	var got []int64
+	search := domain.MessageSearch{Query: "zebra", Limit: 2}
+	for page := 0; ; page++ {
+		if page > 3 {
+			t.Fatal("paging did not stop")
+		}
+		results, err := repo.Search(context.Background(), users[1], search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, resultIDs(results)...)
+		if len(results) < search.Limit {
+			break
+		}
+		search.BeforeID = results[len(results)-1].ID
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("paged through %v, want %v", got, want)
+	}
+}
+
+func TestFindLastGroupMessageBySenderIgnoresDMs(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewMessageRepository(db)
+	users := createUsers(t, db, "tom", "jerry")
+	tom, jerry := users[0], users[1]
+	group := createGroup(t, db, "g1", tom, jerry)
+
+	post := saveMessage(t, repo, jerry, 0, group, "in the group")
+	saveMessage(t, repo, jerry, tom, 0, "a DM to the user sharing the group's ID")
+
+	last, err := repo.FindLastGroupMessageBySender(context.Background(), group, jerry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.ID != post {
+		t.Errorf("last group message = %+v, want message %d", last, post)
+	}
+}
+
+func TestSaveGroupPostAllowsOneConcurrentPost(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewMessageRepository(db)
+	users := createUsers(t, db, "tom", "jerry")
+	group := createGroup(t, db, "g1", users[0], users[1])
+
+	since := time.Now().Add(-time.Minute)
+	const posts = 8
+	saved := make(chan bool, posts)
+	for i := 0; i < posts; i++ {
+		go func(i int) {
+			message, err := repo.SaveGroupPost(context.Background(), &domain.Message{
+				SenderID:    users[1],
+				RecipientID: group,
+				GroupID:     group,
+				Type:        domain.TextMessage,
+				Content:     fmt.Sprintf("post %d", i),
+				Timestamp:   time.Now(),
+			}, domain.GroupPostLimits{PostedSince: since})
+			if err != nil {
+				t.Error(err)
+			}
+			saved <- message != nil
+		}(i)
+	}
+	count := 0
+	for i := 0; i < posts; i++ {
+		if <-saved {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("%d concurrent posts were saved, want 1", count)
+	}
+
+	// Posts made before since do not count, and zero limits always save.
+	message, err := repo.SaveGroupPost(context.Background(), &domain.Message{
+		SenderID: users[1], RecipientID: group, GroupID: group, Type: domain.TextMessage, Content: "later",
+	}, domain.GroupPostLimits{PostedSince: time.Now().Add(time.Minute)})
+	if err != nil || message == nil {
+		t.Errorf("post after the interval: message = %v, err = %v", message, err)
+	}
+	message, err = repo.SaveGroupPost(context.Background(), &domain.Message{
+		SenderID: users[1], RecipientID: group, GroupID: group, Type: domain.TextMessage, Content: "no slow mode",
+	}, domain.GroupPostLimits{})
+	if err != nil || message == nil {
+		t.Errorf("post without slow mode: message = %v, err = %v", message, err)
+	}
+}
+
+func TestSaveGroupPostKeepsConcurrentUploadsWithinTheQuota(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(db)
+	media := NewMediaRepository(db)
+	users := createUsers(t, db, "tom", "jerry")
+	group := createGroup(t, db, "g1", users[0], users[1])
+
+	const posts = 8
+	for i := 0; i < posts; i++ {
+		if err := media.Create(ctx, &domain.Media{ID: fmt.Sprintf("m%d", i), OwnerID: users[1], Size: 40, Status: domain.MediaReady, CreatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	post := func(mediaID string) *domain.Message {
+		message, err := repo.SaveGroupPost(ctx, &domain.Message{
+			SenderID: users[1], RecipientID: group, GroupID: group, Type: domain.FileMessage, MediaID: mediaID, Timestamp: time.Now(),
+		}, domain.GroupPostLimits{QuotaBytes: 100})
+		if err != nil {
+			t.Error(err)
+		}
+		return message
+	}
+
+	saved := make(chan bool, posts)
+	for i := 0; i < posts; i++ {
+		go func(i int) { saved <- post(fmt.Sprintf("m%d", i)) != nil }(i)
+	}
+	count := 0
+	for i := 0; i < posts; i++ {
+		if <-saved {
+			count++
+		}
+	}
+	if count != 2 {
+		t.Errorf("%d concurrent posts of 40-byte uploads were saved within a 100-byte quota, want 2", count)
+	}
+	if used, err := media.UsageByGroup(ctx, group, ""); err != nil || used != 80 {
+		t.Errorf("group uses %d bytes (err %v), want 80", used, err)
+	}
+
+	// Sending an upload the group already has takes no more space
+	var sent string
+	if err := db.Get(&sent, `SELECT media_id FROM messages WHERE group_id = ? LIMIT 1`, group); err != nil {
+		t.Fatal(err)
+	}
+	if post(sent) == nil {
+		t.Error("an upload already sent to the group was refused")
+	}
+}
+
+func TestSaveAllAppliesGroupLimitsPerGroup(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(db)
+	users := createUsers(t, db, "tom", "jerry")
+	slow := createGroup(t, db, "slow", users[0], users[1])
+	other := createGroup(t, db, "other", users[0], users[1])
+	saveMessage(t, repo, users[1], 0, slow, "recent post")
+
+	copies := func() []*domain.Message {
+		return []*domain.Message{
+			{SenderID: users[1], RecipientID: users[0], Type: domain.TextMessage, Content: "copy"},
+			{SenderID: users[1], RecipientID: other, GroupID: other, Type: domain.TextMessage, Content: "copy"},
+			{SenderID: users[1], RecipientID: slow, GroupID: slow, Type: domain.TextMessage, Content: "copy"},
+		}
+	}
+	countCopies := func() int {
+		var n int
+		if err := db.Get(&n, `SELECT COUNT(*) FROM messages WHERE content = 'copy'`); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	messages := copies()
+	refused, err := repo.SaveAll(ctx, messages, map[int64]domain.GroupPostLimits{slow: {PostedSince: time.Now().Add(-time.Minute)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refused != messages[2] {
+		t.Errorf("refused = %+v, want the copy to the slow mode group", refused)
+	}
+	if n := countCopies(); n != 0 {
+		t.Errorf("%d copies saved after a refusal, want none", n)
+	}
+
+	// Once the interval has passed, every copy is saved
+	refused, err = repo.SaveAll(ctx, copies(), map[int64]domain.GroupPostLimits{slow: {PostedSince: time.Now().Add(time.Minute)}})
+	if err != nil || refused != nil {
+		t.Fatalf("SaveAll refused %+v (err %v), want every copy saved", refused, err)
+	}
+	if n := countCopies(); n != 3 {
+		t.Errorf("%d copies saved, want 3", n)
+	}
+}
+
+func TestHasConversation(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(db)
+	users := createUsers(t, db, "ann", "bob", "cat")
+	saveMessage(t, repo, users[0], users[1], 0, "hi bob")
+	group := createGroup(t, db, "all", users...)
+	saveMessage(t, repo, users[0], 0, group, "hi all")
+
+	for _, tt := range []struct {
+		a, b int64
+		want bool
+	}{
+		{users[0], users[1], true},
+		{users[1], users[0], true},
+		{users[0], users[2], false}, // only talked in a group
+	} {
+		talked, err := repo.HasConversation(ctx, tt.a, tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if talked != tt.want {
+			t.Errorf("HasConversation(%d, %d) = %v, want %v", tt.a, tt.b, talked, tt.want)
+		}
+	}
+}
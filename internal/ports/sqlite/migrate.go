@@ -3,6 +3,7 @@ package sqlite
 import (
 	"log"
 
+	"github.com/Emmanuel326/chatserver/internal/domain"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -13,10 +14,17 @@ CREATE TABLE IF NOT EXISTS users (
 	username TEXT NOT NULL,
 	email TEXT NOT NULL UNIQUE,
 	password TEXT NOT NULL,
-	created_at DATETIME NOT NULL
+	created_at DATETIME NOT NULL,
+	email_verified_at DATETIME,
+	is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+	bot_owner_id INTEGER,
+	is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+	disabled_at DATETIME,
+	deleted_at DATETIME
 );
 
--- NOTE: recipient_id can be a UserID (P2P) or a GroupID (Group Chat).
+-- NOTE: recipient_id can be a UserID (P2P) or a GroupID (Group Chat); group_id (added below)
+-- tells them apart: it is the group for group messages and 0 for P2P messages.
 CREATE TABLE IF NOT EXISTS messages (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	sender_id INTEGER NOT NULL,
@@ -35,6 +43,12 @@ CREATE TABLE IF NOT EXISTS groups (
 	name TEXT NOT NULL,
 	owner_id INTEGER NOT NULL,
 	created_at DATETIME NOT NULL,
+	posting_policy TEXT NOT NULL DEFAULT 'everyone',
+	slow_mode_seconds INTEGER NOT NULL DEFAULT 0,
+	description TEXT NOT NULL DEFAULT '',
+	is_public BOOLEAN NOT NULL DEFAULT FALSE,
+	archived_at DATETIME,
+	deleted_at DATETIME,
 	FOREIGN KEY(owner_id) REFERENCES users(id)
 );
 
@@ -47,6 +61,257 @@ CREATE TABLE IF NOT EXISTS group_members (
 	FOREIGN KEY(group_id) REFERENCES groups(id) ON DELETE CASCADE,
 	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 );
+
+-- Per-member moderation: kind is 'mute' or 'ban'; a NULL expires_at lasts until lifted.
+CREATE TABLE IF NOT EXISTS group_sanctions (
+	group_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	expires_at DATETIME,
+	created_by INTEGER NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (group_id, user_id, kind),
+	FOREIGN KEY(group_id) REFERENCES groups(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Auth Tables --
+-- A session is created per login; access tokens carry its ID in the 'sid' claim.
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	device_name TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	last_used_at DATETIME NOT NULL,
+	revoked_at DATETIME,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Refresh tokens are single-use and stored only as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token_hash TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL,
+	used_at DATETIME,
+	FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+-- Denylist of revoked access token IDs (jti).
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti TEXT PRIMARY KEY,
+	expires_at DATETIME NOT NULL
+);
+
+-- TOTP two-factor authentication. enabled_at stays NULL until the enrollment is confirmed.
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id INTEGER PRIMARY KEY,
+	secret TEXT NOT NULL,
+	enabled_at DATETIME,
+	last_used_step INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Single-use recovery codes, stored only as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+	code_hash TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	used_at DATETIME,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Nonces of consumed password reset / email verification tokens, so each token works once.
+CREATE TABLE IF NOT EXISTS used_action_tokens (
+	nonce TEXT PRIMARY KEY,
+	expires_at DATETIME NOT NULL
+);
+
+-- Links OpenID Connect identities (issuer + subject) to local users.
+CREATE TABLE IF NOT EXISTS user_identities (
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (provider, subject),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- In-flight OIDC logins (authorization code + PKCE), keyed by the hash of the state parameter.
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+	state_hash TEXT PRIMARY KEY,
+	nonce TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	expires_at DATETIME NOT NULL
+);
+
+-- Long-lived, scoped API tokens for integrations; only SHA-256 hashes are stored.
+-- user_id is the account the token acts as (the creator or one of their bots).
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	created_by INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	last_used_at DATETIME,
+	expires_at DATETIME,
+	revoked_at DATETIME,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Failed-login counters per account ("account:<email>") and per client IP ("ip:<address>").
+CREATE TABLE IF NOT EXISTS login_throttles (
+	key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure_at DATETIME NOT NULL,
+	blocked_until DATETIME
+);
+
+-- Audit trail of rejected login attempts.
+CREATE TABLE IF NOT EXISTS login_failures (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL,
+	ip_address TEXT NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	reason TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+-- Actions taken by server administrators. target_type is 'user' or 'group'.
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	actor_id INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id INTEGER NOT NULL,
+	details TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+
+-- Uploaded files. The bytes live in the configured media store under sha256 once complete
+-- (under the id before that, and for uploads stored before content addressing).
+CREATE TABLE IF NOT EXISTS media (
+	id TEXT PRIMARY KEY,
+	owner_id INTEGER NOT NULL,
+	filename TEXT NOT NULL DEFAULT '',
+	content_type TEXT NOT NULL DEFAULT '',
+	size INTEGER NOT NULL,
+	received_bytes INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	completed_at DATETIME,
+	FOREIGN KEY(owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Stored upload contents, shared by identical uploads. ref_count is the number of media rows
+-- pointing at the file; released_at is when it dropped to zero.
+CREATE TABLE IF NOT EXISTS media_blobs (
+	sha256 TEXT PRIMARY KEY,
+	size INTEGER NOT NULL,
+	ref_count INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	released_at DATETIME
+);
+
+-- Pending second login steps for users with 2FA, stored only as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS login_challenges (
+	token_hash TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	expires_at DATETIME NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Messages pinned in their conversation. group_id is NULL for P2P messages.
+CREATE TABLE IF NOT EXISTS message_pins (
+	message_id INTEGER PRIMARY KEY,
+	group_id INTEGER,
+	pinned_by INTEGER NOT NULL,
+	pinned_at DATETIME NOT NULL,
+	FOREIGN KEY(message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+-- Messages users starred (bookmarked) for themselves.
+CREATE TABLE IF NOT EXISTS message_stars (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	starred_at DATETIME NOT NULL,
+	UNIQUE(user_id, message_id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+`
+
+// messageSearchSchema creates the FTS5 index of messages.content. It is an external content table,
+// so it stores only the index; the triggers apply every insert, edit and delete of a message.
+const messageSearchSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+	content,
+	content = 'messages',
+	content_rowid = 'id',
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	INSERT INTO messages_fts (rowid, content) VALUES (new.id, new.content);
+END;
+`
+
+// groupSearchSchema creates the FTS5 index of group names and descriptions for the group
+// directory. Like messages_fts it is an external content table kept in step by triggers.
+const groupSearchSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS groups_fts USING fts5(
+	name,
+	description,
+	content = 'groups',
+	content_rowid = 'id',
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_insert AFTER INSERT ON groups BEGIN
+	INSERT INTO groups_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_delete AFTER DELETE ON groups BEGIN
+	INSERT INTO groups_fts (groups_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_update AFTER UPDATE OF name, description ON groups BEGIN
+	INSERT INTO groups_fts (groups_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+	INSERT INTO groups_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+END;
+`
+
+// messageGroupBackfill sets group_id on the group messages stored before the column existed.
+const messageGroupBackfill = `
+UPDATE messages SET group_id = recipient_id
+WHERE group_id = 0 AND EXISTS (
+	SELECT 1 FROM groups g
+	WHERE g.id = messages.recipient_id AND (
+		messages.type = ?
+		OR g.owner_id = messages.sender_id
+		OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = messages.recipient_id)
+		OR EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = messages.sender_id)
+	)
+);
 `
 
 // Migrate runs all necessary database schema migrations.
@@ -99,5 +364,118 @@ func Migrate(db *sqlx.DB) {
         log.Printf("INFO: Could not run ALTER TABLE (status). This is often normal if column already exists: %v", err)
     }
 
+    // 4. ALTER TABLE for columns added after the initial release (handles existing databases).
+    // As above, "duplicate column name" errors are expected on databases that already have them.
+    columnQueries := []struct{ column, query string }{
+        {"groups.posting_policy", `ALTER TABLE groups ADD COLUMN posting_policy TEXT NOT NULL DEFAULT 'everyone';`},
+        {"groups.slow_mode_seconds", `ALTER TABLE groups ADD COLUMN slow_mode_seconds INTEGER NOT NULL DEFAULT 0;`},
+        {"groups.description", `ALTER TABLE groups ADD COLUMN description TEXT NOT NULL DEFAULT '';`},
+        {"groups.is_public", `ALTER TABLE groups ADD COLUMN is_public BOOLEAN NOT NULL DEFAULT FALSE;`},
+        {"groups.archived_at", `ALTER TABLE groups ADD COLUMN archived_at DATETIME;`},
+        {"groups.deleted_at", `ALTER TABLE groups ADD COLUMN deleted_at DATETIME;`},
+        {"sessions.device_name", `ALTER TABLE sessions ADD COLUMN device_name TEXT NOT NULL DEFAULT '';`},
+        {"sessions.ip_address", `ALTER TABLE sessions ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';`},
+        {"sessions.user_agent", `ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';`},
+        {"users.email_verified_at", `ALTER TABLE users ADD COLUMN email_verified_at DATETIME;`},
+        {"users.is_bot", `ALTER TABLE users ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE;`},
+        {"users.bot_owner_id", `ALTER TABLE users ADD COLUMN bot_owner_id INTEGER;`},
+        {"messages.is_bot", `ALTER TABLE messages ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE;`},
+        {"users.is_admin", `ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;`},
+        {"users.disabled_at", `ALTER TABLE users ADD COLUMN disabled_at DATETIME;`},
+        {"users.deleted_at", `ALTER TABLE users ADD COLUMN deleted_at DATETIME;`},
+        {"messages.media_id", `ALTER TABLE messages ADD COLUMN media_id TEXT NOT NULL DEFAULT '';`},
+        {"messages.image", `ALTER TABLE messages ADD COLUMN image TEXT;`},
+        {"messages.attachment", `ALTER TABLE messages ADD COLUMN attachment TEXT;`},
+        {"messages.forwarded_from", `ALTER TABLE messages ADD COLUMN forwarded_from TEXT;`},
+        {"messages.group_id", `ALTER TABLE messages ADD COLUMN group_id INTEGER NOT NULL DEFAULT 0;`},
+        {"media.image", `ALTER TABLE media ADD COLUMN image TEXT;`},
+        {"media.sha256", `ALTER TABLE media ADD COLUMN sha256 TEXT NOT NULL DEFAULT '';`},
+        {"media.scan_result", `ALTER TABLE media ADD COLUMN scan_result TEXT NOT NULL DEFAULT '';`},
+        {"media.chunk_claimed_until", `ALTER TABLE media ADD COLUMN chunk_claimed_until DATETIME;`},
+        {"users.display_name", `ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';`},
+        {"users.discoverable", `ALTER TABLE users ADD COLUMN discoverable BOOLEAN NOT NULL DEFAULT TRUE;`},
+        {"users.email_discoverable", `ALTER TABLE users ADD COLUMN email_discoverable BOOLEAN NOT NULL DEFAULT FALSE;`},
+    }
+    added := make(map[string]bool)
+    for _, c := range columnQueries {
+        if _, err := db.Exec(c.query); err != nil {
+            log.Printf("INFO: Could not run ALTER TABLE (%s). This is often normal if column already exists: %v", c.column, err)
+            continue
+        }
+        added[c.column] = true
+    }
+
+    // 4b. Messages stored before group_id existed only had recipient_id, which may be a user or a
+    // group. Mark them as group messages when the group exists and the sender belongs (or
+    // belonged, as owner) to it, when no user has that ID, or when they are tombstones left by
+    // deleting the group. Everything else stays P2P; a legacy message from a member to the user
+    // sharing the group's ID cannot be told apart from a group message and is kept in the group.
+    if added["messages.group_id"] {
+        res, err := db.Exec(messageGroupBackfill, domain.DeletedMessage)
+        if err != nil {
+            log.Fatalf("Failed to backfill messages.group_id: %v", err)
+        }
+        if n, _ := res.RowsAffected(); n > 0 {
+            log.Printf("Marked %d existing messages as group messages", n)
+        }
+    }
+
+    // 5. Indexes that depend on columns added in step 4 must be created after the ALTERs.
+    lateIndexQueries := []string{
+        `CREATE INDEX IF NOT EXISTS idx_groups_public_id ON groups (is_public, id);`,
+        `CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members (user_id);`,
+        `CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);`,
+        `CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);`,
+        `CREATE INDEX IF NOT EXISTS idx_totp_recovery_codes_user_id ON totp_recovery_codes (user_id);`,
+        `CREATE INDEX IF NOT EXISTS idx_login_failures_email ON login_failures (email, id);`,
+        `CREATE INDEX IF NOT EXISTS idx_login_failures_created_at ON login_failures (created_at);`,
+        `CREATE INDEX IF NOT EXISTS idx_api_tokens_created_by ON api_tokens (created_by);`,
+        `CREATE INDEX IF NOT EXISTS idx_users_bot_owner_id ON users (bot_owner_id);`,
+        `CREATE INDEX IF NOT EXISTS idx_admin_audit_log_target ON admin_audit_log (target_type, target_id, id);`,
+        `CREATE INDEX IF NOT EXISTS idx_messages_media_id ON messages (media_id);`,
+        `CREATE INDEX IF NOT EXISTS idx_media_owner_id ON media (owner_id);`,
+        `CREATE INDEX IF NOT EXISTS idx_media_status ON media (status, created_at);`,
+        `CREATE INDEX IF NOT EXISTS idx_media_blobs_released ON media_blobs (ref_count, released_at);`,
+        `CREATE INDEX IF NOT EXISTS idx_message_pins_group_id ON message_pins (group_id, pinned_at);`,
+        `CREATE INDEX IF NOT EXISTS idx_message_stars_user_id ON message_stars (user_id, id);`,
+        `CREATE INDEX IF NOT EXISTS idx_messages_group_id ON messages (group_id, id DESC);`,
+        `CREATE INDEX IF NOT EXISTS idx_messages_group_sender_timestamp ON messages (group_id, sender_id, timestamp DESC);`,
+    }
+    for _, q := range lateIndexQueries {
+        if _, err := db.Exec(q); err != nil {
+            log.Printf("INFO: Could not create index. This is often normal if index already exists: %v", err)
+        }
+    }
+
+    // 6. Full-text index of message contents, kept in step with the messages table by triggers.
+    // A newly created index is filled from the messages already stored.
+    var ftsTables int
+    if err := db.Get(&ftsTables, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'messages_fts'`); err != nil {
+        log.Fatalf("Failed to look up the message search index: %v", err)
+    }
+    if _, err := db.Exec(messageSearchSchema); err != nil {
+        log.Fatalf("Failed to create the message search index: %v", err)
+    }
+    if ftsTables == 0 {
+        if _, err := db.Exec(`INSERT INTO messages_fts (messages_fts) VALUES ('rebuild');`); err != nil {
+            log.Fatalf("Failed to build the message search index: %v", err)
+        }
+        log.Println("Built the message search index")
+    }
+
+    // 7. Full-text index of group names and descriptions for the group directory, built the same way.
+    if err := db.Get(&ftsTables, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'groups_fts'`); err != nil {
+        log.Fatalf("Failed to look up the group search index: %v", err)
+    }
+    if _, err := db.Exec(groupSearchSchema); err != nil {
+        log.Fatalf("Failed to create the group search index: %v", err)
+    }
+    if ftsTables == 0 {
+        if _, err := db.Exec(`INSERT INTO groups_fts (groups_fts) VALUES ('rebuild');`); err != nil {
+            log.Fatalf("Failed to build the group search index: %v", err)
+        }
+        log.Println("Built the group search index")
+    }
+
 	log.Println(" Database schema migrated successfully (all core tables created/exists).")
 }
@@ -0,0 +1,160 @@
+package sqlite
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// pinnedMessageQuery selects pins with their messages; callers append the conversation filter.
+const pinnedMessageQuery = `
+	SELECT m.id, m.sender_id, m.recipient_id, m.group_id, m.type, m.content, m.media_url, m.media_id, m.image, m.attachment, m.forwarded_from, m.timestamp, m.status, m.is_bot,
+		p.pinned_by, p.pinned_at
+	FROM message_pins p
+	JOIN messages m ON m.id = p.message_id
+	WHERE m.type != ?
+`
+
+// p2pPinFilter restricts pins to the P2P conversation between two users.
+const p2pPinFilter = ` AND p.group_id IS NULL AND m.group_id = 0 AND ((m.sender_id = ? AND m.recipient_id = ?) OR (m.sender_id = ? AND m.recipient_id = ?))`
+
+// pinRepository implements the domain.PinRepository interface.
+type pinRepository struct {
+	db *sqlx.DB
+}
+
+// NewPinRepository creates a new PinRepository instance.
+func NewPinRepository(db *sqlx.DB) domain.PinRepository {
+	return &pinRepository{db: db}
+}
+
+// Pin records a pin unless the message was already pinned or its conversation has maxPins pins.
+// The pins are counted in the insert so that concurrent pins cannot pass the limit together.
+func (r *pinRepository) Pin(ctx context.Context, message *domain.Message, pinnedBy int64, pinnedAt time.Time, maxPins int) (bool, error) {
+	count := `SELECT COUNT(*) FROM message_pins WHERE group_id = ?`
+	countArgs := []interface{}{message.GroupID}
+	if message.GroupID == 0 {
+		count = `SELECT COUNT(*) FROM message_pins p JOIN messages m ON m.id = p.message_id WHERE 1 = 1` + p2pPinFilter
+		countArgs = []interface{}{message.SenderID, message.RecipientID, message.RecipientID, message.SenderID}
+	}
+	query := `
+		INSERT INTO message_pins (message_id, group_id, pinned_by, pinned_at)
+		SELECT ?, NULLIF(?, 0), ?, ?
+		WHERE (` + count + `) < ?
+		ON CONFLICT(message_id) DO NOTHING;
+	`
+	args := append([]interface{}{message.ID, message.GroupID, pinnedBy, pinnedAt}, countArgs...)
+	res, err := r.db.ExecContext(ctx, query, append(args, maxPins)...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Unpin removes a pin, reporting false if the message was not pinned.
+func (r *pinRepository) Unpin(ctx context.Context, messageID int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM message_pins WHERE message_id = ?`, messageID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CountGroupPins counts the pins of a group.
+func (r *pinRepository) CountGroupPins(ctx context.Context, groupID int64) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM message_pins WHERE group_id = ?`, groupID)
+	return count, err
+}
+
+// CountP2PPins counts the pins of the P2P conversation between two users.
+func (r *pinRepository) CountP2PPins(ctx context.Context, userID1, userID2 int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM message_pins p
+		JOIN messages m ON m.id = p.message_id
+		WHERE 1 = 1` + p2pPinFilter
+	var count int
+	err := r.db.GetContext(ctx, &count, query, userID1, userID2, userID2, userID1)
+	return count, err
+}
+
+// FindGroupPins returns the pins of a group, most recently pinned first.
+func (r *pinRepository) FindGroupPins(ctx context.Context, groupID int64) ([]*domain.PinnedMessage, error) {
+	query := pinnedMessageQuery + ` AND p.group_id = ? ORDER BY p.pinned_at DESC, m.id DESC;`
+	pins := []*domain.PinnedMessage{}
+	if err := r.db.SelectContext(ctx, &pins, query, domain.DeletedMessage, groupID); err != nil {
+		log.Printf("Error retrieving pins of group %d: %v", groupID, err)
+		return nil, err
+	}
+	return pins, nil
+}
+
+// FindP2PPins returns the pins of the P2P conversation between two users, most recently pinned first.
+func (r *pinRepository) FindP2PPins(ctx context.Context, userID1, userID2 int64) ([]*domain.PinnedMessage, error) {
+	query := pinnedMessageQuery + p2pPinFilter + ` ORDER BY p.pinned_at DESC, m.id DESC;`
+	pins := []*domain.PinnedMessage{}
+	if err := r.db.SelectContext(ctx, &pins, query, domain.DeletedMessage, userID1, userID2, userID2, userID1); err != nil {
+		log.Printf("Error retrieving pins between users %d and %d: %v", userID1, userID2, err)
+		return nil, err
+	}
+	return pins, nil
+}
+
+// Star records a star; starring a message twice keeps the first star.
+func (r *pinRepository) Star(ctx context.Context, userID, messageID int64, starredAt time.Time) error {
+	query := `
+		INSERT INTO message_stars (user_id, message_id, starred_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id, message_id) DO NOTHING;
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, messageID, starredAt)
+	return err
+}
+
+// Unstar removes a star if there is one.
+func (r *pinRepository) Unstar(ctx context.Context, userID, messageID int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM message_stars WHERE user_id = ? AND message_id = ?`, userID, messageID)
+	return err
+}
+
+// FindStarred returns a page of a user's starred messages, skipping those they can no longer see:
+// deleted messages and messages of groups they left or that were deleted.
+func (r *pinRepository) FindStarred(ctx context.Context, userID, beforeID int64, limit int) ([]*domain.StarredMessage, error) {
+	query := `
+		SELECT m.id, m.sender_id, m.recipient_id, m.group_id, m.type, m.content, m.media_url, m.media_id, m.image, m.attachment, m.forwarded_from, m.timestamp, m.status, m.is_bot,
+			s.id AS star_id, s.starred_at
+		FROM message_stars s
+		JOIN messages m ON m.id = s.message_id
+		LEFT JOIN groups g ON g.id = m.group_id
+		WHERE s.user_id = ?
+		  AND m.type != ?
+		  AND (
+			(m.group_id != 0 AND g.deleted_at IS NULL
+			  AND EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = m.group_id AND gm.user_id = s.user_id))
+			OR (m.group_id = 0 AND (m.sender_id = s.user_id OR m.recipient_id = s.user_id))
+		  )
+	`
+	args := []interface{}{userID, domain.DeletedMessage}
+	if beforeID > 0 {
+		query += " AND s.id < ?"
+		args = append(args, beforeID)
+	}
+	query += `
+		ORDER BY s.id DESC
+		LIMIT ?;
+	`
+	args = append(args, limit)
+
+	starred := []*domain.StarredMessage{}
+	if err := r.db.SelectContext(ctx, &starred, query, args...); err != nil {
+		log.Printf("Error retrieving starred messages of user %d: %v", userID, err)
+		return nil, err
+	}
+	return starred, nil
+}
@@ -0,0 +1,233 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+func starredIDs(starred []*domain.StarredMessage) []int64 {
+	ids := make([]int64, len(starred))
+	for i, message := range starred {
+		ids[i] = message.ID
+	}
+	return ids
+}
+
+func TestFindStarredOnlyListsVisibleMessages(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	messages := NewMessageRepository(db)
+	groups := NewGroupRepository(db)
+	pins := NewPinRepository(db)
+	users := createUsers(t, db, "tom", "jerry", "alice")
+	tom, jerry, alice := users[0], users[1], users[2]
+	// The group's ID equals tom's user ID, so DMs to tom have the group's ID as recipient_id.
+	group := createGroup(t, db, "g1", tom, alice)
+	left := createGroup(t, db, "left", jerry, alice)
+
+	dm := saveMessage(t, messages, jerry, tom, 0, "a DM to tom")
+	post := saveMessage(t, messages, tom, 0, group, "a group post")
+	own := saveMessage(t, messages, alice, jerry, 0, "a DM from alice")
+	gone := saveMessage(t, messages, jerry, 0, left, "a post in a group alice left")
+
+	// Stars are only checked against visibility when listed, so star everything directly.
+	for _, messageID := range []int64{dm, post, own, gone} {
+		if err := pins.Star(ctx, alice, messageID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := groups.RemoveMember(ctx, left, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	starred, err := pins.FindStarred(ctx, alice, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(starredIDs(starred)), fmt.Sprint([]int64{own, post}); got != want {
+		t.Errorf("alice's stars = %v, want %v", got, want)
+	}
+
+	// Starring twice keeps one star; unstarring removes it.
+	if err := pins.Star(ctx, alice, post, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := pins.Unstar(ctx, alice, own); err != nil {
+		t.Fatal(err)
+	}
+	starred, err = pins.FindStarred(ctx, alice, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(starredIDs(starred)), fmt.Sprint([]int64{post}); got != want {
+		t.Errorf("alice's stars = %v, want %v", got, want)
+	}
+}
+
+func TestFindStarredPagesWithCursor(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	messages := NewMessageRepository(db)
+	pins := NewPinRepository(db)
+	users := createUsers(t, db, "tom", "jerry")
+
+	var want []int64
+	for i := 0; i < 5; i++ {
+		messageID := saveMessage(t, messages, users[0], users[1], 0, fmt.Sprintf("message %d", i))
+		if err := pins.Star(ctx, users[1], messageID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		want = append([]int64{messageID}, want...)
+	}
+
+	var got []int64
+	var beforeID int64
+	for page := 0; ; page++ {
+		if page > 3 {
+			t.Fatal("paging did not stop")
+		}
+		starred, err := pins.FindStarred(ctx, users[1], beforeID, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, starredIDs(starred)...)
+		if len(starred) < 2 {
+			break
+		}
+		beforeID = starred[len(starred)-1].StarID
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("paged through %v, want %v", got, want)
+	}
+}
+
+func findMessage(t *testing.T, repo domain.MessageRepository, id int64) *domain.Message {
+	t.Helper()
+	message, err := repo.FindByID(context.Background(), id)
+	if err != nil || message == nil {
+		t.Fatalf("message %d: %v, %v", id, message, err)
+	}
+	return message
+}
+
+func TestPinsAreKeptPerConversation(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	messages := NewMessageRepository(db)
+	pins := NewPinRepository(db)
+	users := createUsers(t, db, "tom", "jerry", "alice")
+	tom, jerry, alice := users[0], users[1], users[2]
+	group := createGroup(t, db, "g1", tom, jerry, alice)
+
+	dm := saveMessage(t, messages, jerry, tom, 0, "a DM to tom")
+	post := saveMessage(t, messages, jerry, 0, group, "a group post")
+
+	for _, messageID := range []int64{dm, post} {
+		pinned, err := pins.Pin(ctx, findMessage(t, messages, messageID), jerry, time.Now(), domain.MaxPinsPerConversation)
+		if err != nil || !pinned {
+			t.Fatalf("pin %d: pinned = %v, err = %v", messageID, pinned, err)
+		}
+	}
+	if pinned, err := pins.Pin(ctx, findMessage(t, messages, dm), tom, time.Now(), domain.MaxPinsPerConversation); err != nil || pinned {
+		t.Errorf("second pin: pinned = %v, err = %v; want false, nil", pinned, err)
+	}
+
+	groupPins, err := pins.FindGroupPins(ctx, group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groupPins) != 1 || groupPins[0].ID != post || groupPins[0].PinnedBy != jerry {
+		t.Errorf("group pins = %+v, want only message %d pinned by %d", groupPins, post, jerry)
+	}
+
+	p2pPins, err := pins.FindP2PPins(ctx, tom, jerry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p2pPins) != 1 || p2pPins[0].ID != dm {
+		t.Errorf("P2P pins = %+v, want only message %d", p2pPins, dm)
+	}
+
+	for _, count := range []struct {
+		name string
+		get  func() (int, error)
+		want int
+	}{
+		{"group", func() (int, error) { return pins.CountGroupPins(ctx, group) }, 1},
+		{"tom and jerry", func() (int, error) { return pins.CountP2PPins(ctx, jerry, tom) }, 1},
+		{"tom and alice", func() (int, error) { return pins.CountP2PPins(ctx, tom, alice) }, 0},
+	} {
+		if got, err := count.get(); err != nil || got != count.want {
+			t.Errorf("%s pins: got %d, err %v; want %d", count.name, got, err, count.want)
+		}
+	}
+
+	if unpinned, err := pins.Unpin(ctx, dm); err != nil || !unpinned {
+		t.Errorf("unpin: unpinned = %v, err = %v", unpinned, err)
+	}
+	if unpinned, err := pins.Unpin(ctx, dm); err != nil || unpinned {
+		t.Errorf("second unpin: unpinned = %v, err = %v; want false, nil", unpinned, err)
+	}
+}
+
+func TestPinAllowsConcurrentPinsUpToTheLimit(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	messages := NewMessageRepository(db)
+	pins := NewPinRepository(db)
+	users := createUsers(t, db, "tom", "jerry", "alice")
+	tom, jerry, alice := users[0], users[1], users[2]
+	group := createGroup(t, db, "g1", tom, jerry)
+
+	const maxPins = 3
+	for _, conversation := range []struct {
+		name               string
+		from, to, in       int64
+		otherFrom, otherTo int64
+	}{
+		{name: "group", from: jerry, in: group, otherFrom: alice, otherTo: jerry},
+		{name: "P2P", from: jerry, to: tom, otherFrom: alice, otherTo: tom},
+	} {
+		t.Run(conversation.name, func(t *testing.T) {
+			// A pin in another conversation does not count
+			other := saveMessage(t, messages, conversation.otherFrom, conversation.otherTo, 0, "elsewhere")
+			if pinned, err := pins.Pin(ctx, findMessage(t, messages, other), tom, time.Now(), maxPins); err != nil || !pinned {
+				t.Fatalf("pin in another conversation: pinned = %v, err = %v", pinned, err)
+			}
+
+			const attempts = 8
+			candidates := make([]*domain.Message, attempts)
+			for i := range candidates {
+				// Alternate directions: both participants' messages share the P2P limit
+				from, to := conversation.from, conversation.to
+				if i%2 == 1 && to != 0 {
+					from, to = to, from
+				}
+				candidates[i] = findMessage(t, messages, saveMessage(t, messages, from, to, conversation.in, fmt.Sprintf("message %d", i)))
+			}
+			results := make(chan bool, attempts)
+			for _, message := range candidates {
+				go func(message *domain.Message) {
+					pinned, err := pins.Pin(ctx, message, jerry, time.Now(), maxPins)
+					if err != nil {
+						t.Error(err)
+					}
+					results <- pinned
+				}(message)
+			}
+			count := 0
+			for range candidates {
+				if <-results {
+					count++
+				}
+			}
+			if count != maxPins {
+				t.Errorf("%d of %d concurrent pins succeeded, want %d", count, attempts, maxPins)
+			}
+		})
+	}
+}
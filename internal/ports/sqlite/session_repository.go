@@ -0,0 +1,134 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// sessionColumns lists the columns scanned into domain.Session.
+const sessionColumns = "id, user_id, device_name, ip_address, user_agent, created_at, last_used_at, revoked_at"
+
+// SessionRepository implements the domain.SessionRepository interface using SQLite.
+type SessionRepository struct {
+	db *sqlx.DB
+}
+
+// NewSessionRepository creates a new SessionRepository instance.
+func NewSessionRepository(db *sqlx.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// CreateSession persists a new login session.
+func (r *SessionRepository) CreateSession(ctx context.Context, session *domain.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, device_name, ip_address, user_agent, created_at, last_used_at)
+		VALUES (:id, :user_id, :device_name, :ip_address, :user_agent, :created_at, :last_used_at)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, session)
+	return err
+}
+
+// FindSession retrieves a session by ID, or nil if it does not exist.
+func (r *SessionRepository) FindSession(ctx context.Context, sessionID string) (*domain.Session, error) {
+	session := &domain.Session{}
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?`
+
+	err := r.db.GetContext(ctx, session, query, sessionID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// FindSessionsByUser retrieves all sessions of a user (including revoked ones), most recently used first.
+func (r *SessionRepository) FindSessionsByUser(ctx context.Context, userID int64) ([]*domain.Session, error) {
+	sessions := []*domain.Session{}
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE user_id = ? ORDER BY last_used_at DESC`
+
+	if err := r.db.SelectContext(ctx, &sessions, query, userID); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// TouchSession records that a session was just used.
+func (r *SessionRepository) TouchSession(ctx context.Context, sessionID string, lastUsedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE sessions SET last_used_at = ? WHERE id = ?`, lastUsedAt, sessionID)
+	return err
+}
+
+// RevokeSession marks a session as revoked (idempotent: the first revocation time is kept).
+func (r *SessionRepository) RevokeSession(ctx context.Context, sessionID string, revokedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, revokedAt, sessionID)
+	return err
+}
+
+// RevokeUserSessions marks all of a user's active sessions as revoked.
+func (r *SessionRepository) RevokeUserSessions(ctx context.Context, userID int64, revokedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, revokedAt, userID)
+	return err
+}
+
+// SaveRefreshToken persists a hashed refresh token.
+func (r *SessionRepository) SaveRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (token_hash, session_id, user_id, expires_at, created_at)
+		VALUES (:token_hash, :session_id, :user_id, :expires_at, :created_at)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, token)
+	return err
+}
+
+// FindRefreshToken retrieves a refresh token by its hash, or nil if it does not exist.
+func (r *SessionRepository) FindRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	token := &domain.RefreshToken{}
+	query := `SELECT token_hash, session_id, user_id, expires_at, created_at, used_at FROM refresh_tokens WHERE token_hash = ?`
+
+	err := r.db.GetContext(ctx, token, query, tokenHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// MarkRefreshTokenUsed flags a refresh token as used; it reports false if it was already used.
+func (r *SessionRepository) MarkRefreshTokenUsed(ctx context.Context, tokenHash string, usedAt time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL`, usedAt, tokenHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DenyToken adds an access token ID to the denylist.
+func (r *SessionRepository) DenyToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `INSERT OR IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)`, tokenID, expiresAt)
+	return err
+}
+
+// IsTokenDenied reports whether an access token ID is on the denylist.
+func (r *SessionRepository) IsTokenDenied(ctx context.Context, tokenID string) (bool, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?`, tokenID)
+	return count > 0, err
+}
+
+// DeleteExpiredDeniedTokens removes the denylist entries of access tokens that expired before now.
+func (r *SessionRepository) DeleteExpiredDeniedTokens(ctx context.Context, now time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,29 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeleteExpiredDeniedTokens(t *testing.T) {
+	repo := NewSessionRepository(newTestDB(t))
+	ctx := context.Background()
+	now := time.Now()
+	for jti, expiresAt := range map[string]time.Time{"expired": now.Add(-time.Minute), "live": now.Add(time.Minute)} {
+		if err := repo.DenyToken(ctx, jti, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := repo.DeleteExpiredDeniedTokens(ctx, now)
+	if err != nil || removed != 1 {
+		t.Fatalf("removed %d denied tokens (err %v), want 1", removed, err)
+	}
+	if denied, err := repo.IsTokenDenied(ctx, "expired"); err != nil || denied {
+		t.Errorf("expired token denied = %v (err %v), want its entry deleted", denied, err)
+	}
+	if denied, err := repo.IsTokenDenied(ctx, "live"); err != nil || !denied {
+		t.Errorf("live token denied = %v (err %v), want its entry kept", denied, err)
+	}
+}
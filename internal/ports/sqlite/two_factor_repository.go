@@ -0,0 +1,148 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// TwoFactorRepository implements the domain.TwoFactorRepository interface using SQLite.
+type TwoFactorRepository struct {
+	db *sqlx.DB
+}
+
+// NewTwoFactorRepository creates a new TwoFactorRepository instance.
+func NewTwoFactorRepository(db *sqlx.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+// SaveTOTP stores a (pending) TOTP secret, replacing any previous one for the user.
+func (r *TwoFactorRepository) SaveTOTP(ctx context.Context, secret *domain.TOTPSecret) error {
+	query := `
+		INSERT OR REPLACE INTO user_totp (user_id, secret, enabled_at, last_used_step, created_at)
+		VALUES (:user_id, :secret, :enabled_at, :last_used_step, :created_at)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, secret)
+	return err
+}
+
+// FindTOTP retrieves a user's TOTP secret, or nil if they never enrolled.
+func (r *TwoFactorRepository) FindTOTP(ctx context.Context, userID int64) (*domain.TOTPSecret, error) {
+	secret := &domain.TOTPSecret{}
+	query := `SELECT user_id, secret, enabled_at, last_used_step, created_at FROM user_totp WHERE user_id = ?`
+
+	err := r.db.GetContext(ctx, secret, query, userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EnableTOTP enables 2FA and replaces the user's recovery codes in a single transaction.
+func (r *TwoFactorRepository) EnableTOTP(ctx context.Context, userID int64, enabledAt time.Time, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE user_totp SET enabled_at = ? WHERE user_id = ?`, enabledAt, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO totp_recovery_codes (code_hash, user_id) VALUES (?, ?)`, hash, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteTOTP removes the user's secret, recovery codes and pending login challenges.
+func (r *TwoFactorRepository) DeleteTOTP(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM user_totp WHERE user_id = ?`,
+		`DELETE FROM totp_recovery_codes WHERE user_id = ?`,
+		`DELETE FROM login_challenges WHERE user_id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AdvanceTOTPStep atomically moves last_used_step forward; it reports false for a replayed step.
+func (r *TwoFactorRepository) AdvanceTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// UseRecoveryCode marks an unused recovery code as used.
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, usedAt time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE totp_recovery_codes SET used_at = ? WHERE code_hash = ? AND user_id = ? AND used_at IS NULL`, usedAt, codeHash, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// SaveChallenge persists a login challenge.
+func (r *TwoFactorRepository) SaveChallenge(ctx context.Context, challenge *domain.LoginChallenge) error {
+	query := `
+		INSERT INTO login_challenges (token_hash, user_id, expires_at, attempts)
+		VALUES (:token_hash, :user_id, :expires_at, :attempts)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, challenge)
+	return err
+}
+
+// FindChallenge retrieves a login challenge by its hash, or nil if it does not exist.
+func (r *TwoFactorRepository) FindChallenge(ctx context.Context, tokenHash string) (*domain.LoginChallenge, error) {
+	challenge := &domain.LoginChallenge{}
+	query := `SELECT token_hash, user_id, expires_at, attempts FROM login_challenges WHERE token_hash = ?`
+
+	err := r.db.GetContext(ctx, challenge, query, tokenHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// IncrementChallengeAttempts records a wrong code for the challenge.
+func (r *TwoFactorRepository) IncrementChallengeAttempts(ctx context.Context, tokenHash string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ?`, tokenHash)
+	return err
+}
+
+// DeleteChallenge removes a challenge; it reports false if it no longer existed.
+func (r *TwoFactorRepository) DeleteChallenge(ctx context.Context, tokenHash string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM login_challenges WHERE token_hash = ?`, tokenHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/Emmanuel326/chatserver/pkg/totp"
+)
+
+func TestAdvanceTOTPStepRejectsReplays(t *testing.T) {
+	db := newTestDB(t)
+	userIDs := createUsers(t, db, "ann")
+	repo := NewTwoFactorRepository(db)
+	ctx := context.Background()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveTOTP(ctx, &domain.TOTPSecret{UserID: userIDs[0], Secret: secret, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := totp.Code(secret, totp.Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, ok := totp.Validate(secret, code, now, 1)
+	if !ok {
+		t.Fatal("current code rejected")
+	}
+
+	steps := []struct {
+		step int64
+		want bool
+	}{
+		{step, true},
+		{step, false},     // the same code again
+		{step - 1, false}, // an older code still inside the drift window
+		{step + 1, true},  // the next code
+	}
+	for _, s := range steps {
+		advanced, err := repo.AdvanceTOTPStep(ctx, userIDs[0], s.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if advanced != s.want {
+			t.Errorf("AdvanceTOTPStep(%d) = %v, want %v", s.step, advanced, s.want)
+		}
+	}
+}
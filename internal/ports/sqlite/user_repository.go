@@ -3,12 +3,20 @@ package sqlite
 import (
 	"context"
 	"database/sql" // Needed for sql.ErrNoRows, sql.NullString, sql.NullTime, sql.NullInt64
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Emmanuel326/chatserver/internal/domain"
 	"github.com/jmoiron/sqlx"
 )
 
+// userColumns lists the users columns loaded into domain.User, in SELECT order.
+const userColumns = `id, username, email, password, created_at, email_verified_at, is_bot, bot_owner_id, is_admin, disabled_at, deleted_at, display_name, discoverable, email_discoverable`
+
 // UserRepository implements the domain.UserRepository interface.
 type UserRepository struct {
 	db *sqlx.DB
@@ -22,7 +30,7 @@ func NewUserRepository(db *sqlx.DB) domain.UserRepository {
 // GetByEmail retrieves a user by their email address.
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	user := &domain.User{}
-	query := "SELECT id, username, email, password, created_at FROM users WHERE email = ?"
+	query := "SELECT " + userColumns + " FROM users WHERE email = ?"
 	
 	err := r.db.GetContext(ctx, user, query, email)
 	if err != nil {
@@ -37,7 +45,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.
 // GetByID retrieves a user by their unique ID.
 func (r *UserRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
 	user := &domain.User{}
-	query := "SELECT id, username, email, password, created_at FROM users WHERE id = ?"
+	query := "SELECT " + userColumns + " FROM users WHERE id = ?"
 	
 	err := r.db.GetContext(ctx, user, query, id)
 	if err != nil {
@@ -53,7 +61,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id int64) (*domain.User, e
 // This is required by the updated UserRepository interface in domain/user.go
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
 	user := &domain.User{}
-	query := "SELECT id, username, email, password, created_at FROM users WHERE username = ?"
+	query := "SELECT " + userColumns + " FROM users WHERE username = ?"
 	
 	err := r.db.GetContext(ctx, user, query, username)
 	if err != nil {
@@ -67,9 +75,9 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*d
 
 // Create inserts a new user into the database and returns the created user (with ID).
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) (*domain.User, error) {
-	query := "INSERT INTO users (username, email, password, created_at) VALUES (?, ?, ?, ?)"
+	query := "INSERT INTO users (username, email, password, created_at, is_bot, bot_owner_id, display_name, discoverable, email_discoverable) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	
-	result, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.Password, user.CreatedAt)
+	result, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.Password, user.CreatedAt, user.IsBot, user.BotOwnerID, user.DisplayName, user.Discoverable, user.EmailDiscoverable)
 	if err != nil {
 		return nil, err
 	}
@@ -83,14 +91,207 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) (*domain
 	return user, nil
 }
 
-// GetAll retrieves a list of all registered users.
-func (r *UserRepository) GetAll(ctx context.Context) ([]*domain.User, error) {
+// UpdatePassword replaces a user's password hash.
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET password = ? WHERE id = ?", hashedPassword, userID)
+	return err
+}
+
+// MarkEmailVerified records that the user confirmed their email address.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID int64, verifiedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL", verifiedAt, userID)
+	return err
+}
+
+// FindBotsByOwner retrieves the bot users owned by a user.
+func (r *UserRepository) FindBotsByOwner(ctx context.Context, ownerID int64) ([]*domain.User, error) {
 	query := `
-		SELECT id, username, email, created_at
+		SELECT id, username, email, created_at, is_bot, bot_owner_id
 		FROM users
+		WHERE is_bot = TRUE AND bot_owner_id = ?
 		ORDER BY username ASC;
 	`
+	bots := []*domain.User{}
+	if err := r.db.SelectContext(ctx, &bots, query, ownerID); err != nil {
+		log.Printf("Error retrieving bots of user %d: %v", ownerID, err)
+		return nil, err
+	}
+	return bots, nil
+}
+
+// Search lists users whose username or email contains query (case-insensitive), including
+// disabled and deleted accounts. Results are ordered by ID so afterID works as a cursor.
+func (r *UserRepository) Search(ctx context.Context, query string, afterID int64, limit int) ([]*domain.User, error) {
+	sqlQuery := `
+		SELECT id, username, email, created_at, email_verified_at, is_bot, bot_owner_id, is_admin, disabled_at, deleted_at
+		FROM users
+		WHERE id > ?
+	`
+	args := []interface{}{afterID}
+
+	if query != "" {
+		pattern := "%" + escapeLike(query) + "%"
+		sqlQuery += ` AND (username LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\')`
+		args = append(args, pattern, pattern)
+	}
+
+	sqlQuery += `
+		ORDER BY id ASC
+		LIMIT ?;
+	`
+	args = append(args, limit)
+
 	users := []*domain.User{}
+	if err := r.db.SelectContext(ctx, &users, sqlQuery, args...); err != nil {
+		log.Printf("Error searching users: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+// SearchDirectory lists the discoverable users that are neither disabled nor deleted and match
+// search on the enabled fields. Each user is ranked by its best match:
+//   - DirectoryPrefixMatch: the username starts with the query (every user when listing)
+//   - DirectoryNameMatch: a word of the display name starts with the query, or the email is the query
+//   - DirectoryFuzzyMatch: the query's characters appear in order in the username or display name
+//
+// Results are ordered by rank, username and ID, which the cursor resumes from.
+func (r *UserRepository) SearchDirectory(ctx context.Context, search domain.DirectorySearch) ([]*domain.UserDirectoryEntry, error) {
+	rank, rankArgs := directoryRank(search)
+	if rank == "" {
+		return []*domain.UserDirectoryEntry{}, nil
+	}
+
+	query := `
+		SELECT id, username, display_name, is_bot, match_rank FROM (
+			SELECT id, username, display_name, is_bot, ` + rank + ` AS match_rank
+			FROM users
+			WHERE discoverable = TRUE AND disabled_at IS NULL AND deleted_at IS NULL
+		)
+		WHERE match_rank IS NOT NULL
+	`
+	args := rankArgs
+
+	if after := search.After; after != nil {
+		query += ` AND (match_rank, lower(username), id) > (?, (SELECT lower(username) FROM users WHERE id = ?), ?)`
+		args = append(args, after.Rank, after.UserID, after.UserID)
+	}
+
+	query += `
+		ORDER BY match_rank, lower(username), id
+		LIMIT ?;
+	`
+	args = append(args, search.Limit)
+
+	entries := []*domain.UserDirectoryEntry{}
+	if err := r.db.SelectContext(ctx, &entries, query, args...); err != nil {
+		log.Printf("Error searching user directory: %v", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// directoryRank builds the SQL expression ranking a user against a directory search, NULL when
+// the user does not match, or "" when no enabled field can match.
+func directoryRank(search domain.DirectorySearch) (string, []interface{}) {
+	if search.Query == "" {
+		return strconv.Itoa(domain.DirectoryPrefixMatch), nil
+	}
+
+	var fuzzyFields []string
+	var whens []string
+	var args []interface{}
+	prefix := escapeLike(search.Query) + "%"
+
+	if search.Fields.Searches(domain.DirectoryFieldUsername) {
+		whens = append(whens, fmt.Sprintf(`WHEN username LIKE ? ESCAPE '\' THEN %d`, domain.DirectoryPrefixMatch))
+		args = append(args, prefix)
+		fuzzyFields = append(fuzzyFields, "username")
+	}
+	if search.Fields.Searches(domain.DirectoryFieldDisplayName) {
+		whens = append(whens, fmt.Sprintf(`WHEN display_name LIKE ? ESCAPE '\' OR display_name LIKE ? ESCAPE '\' THEN %d`, domain.DirectoryNameMatch))
+		args = append(args, prefix, "% "+prefix)
+		fuzzyFields = append(fuzzyFields, "display_name")
+	}
+	if search.Fields.Searches(domain.DirectoryFieldEmail) && strings.Contains(search.Query, "@") {
+		whens = append(whens, fmt.Sprintf(`WHEN email_discoverable = TRUE AND email = ? COLLATE NOCASE THEN %d`, domain.DirectoryNameMatch))
+		args = append(args, search.Query)
+	}
+	if utf8.RuneCountInString(search.Query) >= domain.MinFuzzyQueryLength {
+		subsequence := "%"
+		for _, c := range search.Query {
+			subsequence += escapeLike(string(c)) + "%"
+		}
+		for _, field := range fuzzyFields {
+			whens = append(whens, fmt.Sprintf(`WHEN %s LIKE ? ESCAPE '\' THEN %d`, field, domain.DirectoryFuzzyMatch))
+			args = append(args, subsequence)
+		}
+	}
+
+	if len(whens) == 0 {
+		return "", nil
+	}
+	return "CASE " + strings.Join(whens, " ") + " END", args
+}
+
+// UpdateProfile stores a user's display name and privacy settings.
+func (r *UserRepository) UpdateProfile(ctx context.Context, userID int64, displayName string, privacy domain.PrivacySettings) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET display_name = ?, discoverable = ?, email_discoverable = ? WHERE id = ?",
+		displayName, privacy.Discoverable, privacy.EmailDiscoverable, userID)
+	return err
+}
+
+// SetAdmin grants or revokes the server administrator flag.
+func (r *UserRepository) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET is_admin = ? WHERE id = ?", isAdmin, userID)
+	return err
+}
+
+// SetDisabledAt disables an account at the given time, or re-enables it when disabledAt is nil.
+func (r *UserRepository) SetDisabledAt(ctx context.Context, userID int64, disabledAt *time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET disabled_at = ? WHERE id = ?", disabledAt, userID)
+	return err
+}
+
+// Scrub anonymizes a deleted account in one transaction: the username, email and password are
+// replaced, and the user's group memberships, second factor, linked SSO identities and stars are removed.
+// Child rows are deleted explicitly because PRAGMA foreign_keys only applies to one connection.
+func (r *UserRepository) Scrub(ctx context.Context, userID int64, deletedAt time.Time) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users
+		SET username = ?, email = ?, password = '', email_verified_at = NULL, is_admin = FALSE,
+			display_name = '', discoverable = FALSE, email_discoverable = FALSE,
+			disabled_at = COALESCE(disabled_at, ?), deleted_at = ?
+		WHERE id = ?`,
+		fmt.Sprintf("deleted-user-%d", userID), fmt.Sprintf("deleted-%d@users.invalid", userID), deletedAt, deletedAt, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"group_members", "user_totp", "totp_recovery_codes", "user_identities", "login_challenges", "message_stars"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAll lists the discoverable users that are neither disabled nor deleted.
+func (r *UserRepository) GetAll(ctx context.Context) ([]*domain.UserDirectoryEntry, error) {
+	query := `
+		SELECT id, username, display_name, is_bot
+		FROM users
+		WHERE discoverable = TRUE AND disabled_at IS NULL AND deleted_at IS NULL
+		ORDER BY username ASC;
+	`
+	users := []*domain.UserDirectoryEntry{}
 	err := r.db.SelectContext(ctx, &users, query)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -102,9 +303,9 @@ func (r *UserRepository) GetAll(ctx context.Context) ([]*domain.User, error) {
 	return users, nil
 }
 
-// GetAllUsersWithLastMessageInfo retrieves all users, and for each user,
-// includes the latest P2P message content and timestamp between that user
-// and the currentUserID.
+// GetAllUsersWithLastMessageInfo retrieves the discoverable, active users and the users
+// currentUserID has exchanged messages with, and for each user includes the latest P2P
+// message content and timestamp between that user and the currentUserID.
 func (r *UserRepository) GetAllUsersWithLastMessageInfo(ctx context.Context, currentUserID int64) ([]*domain.UserWithChatInfo, error) {
 	query := `
 	WITH LastP2PMessages AS (
@@ -129,19 +330,20 @@ func (r *UserRepository) GetAllUsersWithLastMessageInfo(ctx context.Context, cur
 		FROM messages m
 		WHERE
 			m.type IN ('text', 'image') AND -- Only consider actual messages
+			m.group_id = 0 AND -- P2P messages only
 			(m.sender_id = :current_user_id OR m.recipient_id = :current_user_id) -- Messages involving current user
 	)
 	SELECT
 		u.id,
 		u.username,
-		u.email,
 		u.created_at,
 		lpm.content AS last_message_content,
 		lpm.timestamp AS last_message_timestamp,
 		lpm.sender_id AS last_message_sender_id
 	FROM users u
 	LEFT JOIN LastP2PMessages lpm ON u.id = lpm.other_participant_id AND lpm.rn = 1
-	WHERE u.id != :current_user_id
+	WHERE u.id != :current_user_id AND u.deleted_at IS NULL
+		AND (lpm.id IS NOT NULL OR (u.discoverable = TRUE AND u.disabled_at IS NULL))
 	ORDER BY lpm.timestamp DESC, u.username ASC;
 	`
 
@@ -163,7 +365,6 @@ func (r *UserRepository) GetAllUsersWithLastMessageInfo(ctx context.Context, cur
 		err := rows.Scan(
 			&u.ID,
 			&u.Username,
-			&u.Email,
 			&u.CreatedAt,
 			&lastMessageContent,
 			&lastMessageTimestamp,
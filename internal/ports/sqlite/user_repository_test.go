@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Emmanuel326/chatserver/internal/domain"
+)
+
+func TestUserListingsOnlyShowDiscoverableUsersAndChatPartners(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repo := NewUserRepository(db)
+	users := createUsers(t, db, "tom", "jerry", "alice", "bob", "carol")
+	tom, jerry, alice, bob, carol := users[0], users[1], users[2], users[3], users[4]
+
+	// jerry and alice leave the directory, but jerry has a conversation with tom; bob is disabled.
+	for _, userID := range []int64{jerry, alice} {
+		if err := repo.UpdateProfile(ctx, userID, "", domain.PrivacySettings{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	disabledAt := time.Now()
+	if err := repo.SetDisabledAt(ctx, bob, &disabledAt); err != nil {
+		t.Fatal(err)
+	}
+	saveMessage(t, NewMessageRepository(db), jerry, tom, 0, "hi tom")
+
+	listed, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listedIDs []int64
+	for _, user := range listed {
+		listedIDs = append(listedIDs, user.ID)
+	}
+	if got, want := fmt.Sprint(listedIDs), fmt.Sprint([]int64{carol, tom}); got != want {
+		t.Errorf("listed users %v, want %v", got, want)
+	}
+
+	cards, err := repo.GetAllUsersWithLastMessageInfo(ctx, tom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cardIDs []int64
+	for _, card := range cards {
+		cardIDs = append(cardIDs, card.ID)
+	}
+	if got, want := fmt.Sprint(cardIDs), fmt.Sprint([]int64{jerry, carol}); got != want {
+		t.Errorf("tom's chat cards list %v, want %v", got, want)
+	}
+	if cards[0].LastMessageContent == nil || *cards[0].LastMessageContent != "hi tom" {
+		t.Errorf("jerry's card has last message %v, want %q", cards[0].LastMessageContent, "hi tom")
+	}
+}
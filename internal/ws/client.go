@@ -3,6 +3,7 @@ package ws
 import (
 	"encoding/json" // <-- ADDED: For JSON deserialization
 	"log"
+	"sync"
 	"time"
 
 	"github.com/Emmanuel326/chatserver/internal/domain"
@@ -21,10 +22,39 @@ const (
 type Client struct {
 	Hub             *Hub
 	UserID          int64 // The authenticated ID of the user
+	SessionID       string // The login session the connection was authenticated with
 	Conn            *websocket.Conn // The actual websocket connection
 	Send            chan *Message // Buffered channel of outbound messages
 	currentTargetID int64 // ID of the user or group this client is currently talking to
 	isGroupChat     bool  // Flag to distinguish between P2P and group chats
+	targetMu        sync.Mutex // Protects currentTargetID and isGroupChat (the Hub may reset them)
+}
+
+// setTarget sets the user or group this client is currently talking to.
+func (c *Client) setTarget(targetID int64, isGroup bool) {
+	c.targetMu.Lock()
+	defer c.targetMu.Unlock()
+	c.currentTargetID = targetID
+	c.isGroupChat = isGroup
+}
+
+// target returns the user or group this client is currently talking to.
+func (c *Client) target() (int64, bool) {
+	c.targetMu.Lock()
+	defer c.targetMu.Unlock()
+	return c.currentTargetID, c.isGroupChat
+}
+
+// leaveGroup clears the chat context if it points at the given group. It reports whether it did.
+func (c *Client) leaveGroup(groupID int64) bool {
+	c.targetMu.Lock()
+	defer c.targetMu.Unlock()
+	if c.isGroupChat && c.currentTargetID == groupID {
+		c.currentTargetID = 0
+		c.isGroupChat = false
+		return true
+	}
+	return false
 }
 
 // readPump pumps messages from the websocket connection to the Hub.
@@ -78,13 +108,11 @@ func (c *Client) handleJsonPayload(payload []byte) bool {
 		_ = json.Unmarshal(payload, &command) // Error can be ignored, already parsed partially.
 
 		if command.UserID != 0 {
-			c.currentTargetID = command.UserID
-			c.isGroupChat = false
-			log.Printf("User %d set recipient to User %d", c.UserID, c.currentTargetID)
+			c.setTarget(command.UserID, false)
+			log.Printf("User %d set recipient to User %d", c.UserID, command.UserID)
 		} else if command.GroupID != 0 {
-			c.currentTargetID = command.GroupID
-			c.isGroupChat = true
-			log.Printf("User %d set recipient to Group %d", c.UserID, c.currentTargetID)
+			c.setTarget(command.GroupID, true)
+			log.Printf("User %d set recipient to Group %d", c.UserID, command.GroupID)
 		}
 		return true
 	}
@@ -103,13 +131,14 @@ func (c *Client) handleJsonPayload(payload []byte) bool {
 		if message.GroupID != 0 {
 			message.RecipientID = message.GroupID
 		} else if message.RecipientID == 0 {
-			if c.currentTargetID == 0 {
+			targetID, isGroup := c.target()
+			if targetID == 0 {
 				log.Printf("User %d sent structured message with no recipient and no context. Discarding.", c.UserID)
 				return true // Handled by discarding.
 			}
-			message.RecipientID = c.currentTargetID
-			if c.isGroupChat {
-				message.GroupID = c.currentTargetID
+			message.RecipientID = targetID
+			if isGroup {
+				message.GroupID = targetID
 			}
 		}
 
@@ -126,7 +155,8 @@ func (c *Client) handleJsonPayload(payload []byte) bool {
 
 // handleRawTextMessage processes the payload as a plain text message for the current chat context.
 func (c *Client) handleRawTextMessage(payload []byte) {
-	if c.currentTargetID == 0 {
+	targetID, isGroup := c.target()
+	if targetID == 0 {
 		log.Printf("User %d sent raw message without setting a recipient. Discarding.", c.UserID)
 		return
 	}
@@ -136,10 +166,10 @@ func (c *Client) handleRawTextMessage(payload []byte) {
 		Content:     string(payload),
 		Timestamp:   time.Now(),
 		Type:        domain.TextMessage,
-		RecipientID: c.currentTargetID,
+		RecipientID: targetID,
 	}
-	if c.isGroupChat {
-		message.GroupID = c.currentTargetID
+	if isGroup {
+		message.GroupID = targetID
 	}
 	c.Hub.Broadcast <- message
 }
@@ -181,10 +211,11 @@ func (c *Client) writePump() {
 }
 
 // ServeWs handles the websocket request from the peer.
-func ServeWs(hub *Hub, conn *websocket.Conn, userID int64) {
+func ServeWs(hub *Hub, conn *websocket.Conn, userID int64, sessionID string) {
 	client := &Client{
 		Hub:             hub,
 		UserID:          userID,
+		SessionID:       sessionID,
 		Conn:            conn,
 		Send:            make(chan *Message, 256), // Buffered channel for sending
 		currentTargetID: 0, // Initially no target
@@ -2,8 +2,10 @@ package ws
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"sync"
+	"time"
 	
 	"github.com/Emmanuel326/chatserver/internal/domain"
 )
@@ -27,6 +29,7 @@ type Hub struct {
 	MessageService domain.MessageService
 	GroupService domain.GroupService
 	UserService domain.UserService
+	Authorizer domain.Authorizer // Decides who may post to and see typing in a conversation
 
 	// Mutex to protect the clients map
 	mu sync.RWMutex
@@ -35,8 +38,8 @@ type Hub struct {
 	quit chan struct{}
 }
 
-// NewHub creates and returns a new Hub, injected with MessageService, GroupService, and UserService.
-func NewHub(messageService domain.MessageService, groupService domain.GroupService, userService domain.UserService) *Hub {
+// NewHub creates and returns a new Hub, injected with MessageService, GroupService, UserService and the Authorizer.
+func NewHub(messageService domain.MessageService, groupService domain.GroupService, userService domain.UserService, authorizer domain.Authorizer) *Hub {
 	return &Hub{
 		Broadcast:      make(chan *Message),
 		Register:       make(chan *Client),
@@ -46,6 +49,7 @@ func NewHub(messageService domain.MessageService, groupService domain.GroupServi
 		MessageService: messageService,
 		GroupService:   groupService,
 		UserService:    userService,
+		Authorizer:     authorizer,
 		quit:           make(chan struct{}), // Initialize the quit channel
 	}
 }
@@ -166,10 +170,12 @@ func (h *Hub) handleUnregister(client *Client) {
 	userID := client.UserID
 	if connections, ok := h.clients[userID]; ok {
 		// Find and remove the specific client instance
+		found := false
 		for i, conn := range connections {
 			if conn == client {
 				// Efficiently remove client from the slice without preserving order
 				h.clients[userID] = append(connections[:i], connections[i+1:]...)
+				found = true
 				break
 			}
 		}
@@ -179,6 +185,12 @@ func (h *Hub) handleUnregister(client *Client) {
 			delete(h.clients, userID)
 		}
 		
+		// A client that was already force-disconnected (e.g. its session was revoked)
+		// unregisters again when its read pump exits; its channel is already closed.
+		if !found {
+			return
+		}
+
 		// Close the client's send channel to stop its write pump
 		close(client.Send)
 		log.Printf("Client unregistered. UserID: %d. Remaining connections for user: %d", userID, len(h.clients[userID]))
@@ -186,70 +198,94 @@ func (h *Hub) handleUnregister(client *Client) {
 }
 
 // handleTypingNotification broadcasts a typing indicator to relevant users without persisting it.
+// Like messages, it goes to a group only when GroupID says so; otherwise it is for a single user.
 func (h *Hub) handleTypingNotification(message *Message) {
 	// A typing notification is transient and should not be persisted.
-	// We determine if the recipient is a group or a single user and forward accordingly.
-
-	members, err := h.GroupService.GetMembers(context.Background(), message.RecipientID)
+	if message.GroupID == 0 {
+		// P2P Typing Notification: send only to the single recipient.
+		h.sendMessageToUser(message.RecipientID, message)
+		return
+	}
 
-	if err == nil && len(members) > 0 {
-		// Case A: Group Typing Notification.
-		// Broadcast to all group members except the sender.
-		for _, memberID := range members {
-			if memberID != message.SenderID {
-				h.sendMessageToUser(memberID, message)
-			}
+	// Group Typing Notification, only from members of the group.
+	if err := h.Authorizer.Can(context.Background(), domain.UserSubject(message.SenderID), domain.ActionGroupView, domain.GroupResource(message.GroupID)); err != nil {
+		log.Printf("Dropped typing notification from User %d to Group %d: %v", message.SenderID, message.GroupID, err)
+		return
+	}
+	members, err := h.GroupService.GetMembers(context.Background(), message.GroupID)
+	if err != nil {
+		log.Printf("Error getting members for group %d to send a typing notification: %v", message.GroupID, err)
+		return
+	}
+	// Broadcast to all group members except the sender.
+	for _, memberID := range members {
+		if memberID != message.SenderID {
+			h.sendMessageToUser(memberID, message)
 		}
-	} else {
-		// Case B: P2P Typing Notification.
-		// Send only to the single recipient.
-		h.sendMessageToUser(message.RecipientID, message)
 	}
 }
 
-// handleBroadcast determines if a message is P2P or Group and routes it to the appropriate handler.
+// handleBroadcast routes a message by its explicit GroupID: group messages carry it, and
+// everything else is P2P, so a DM is never misrouted to a group with the recipient's ID.
 func (h *Hub) handleBroadcast(message *Message) {
-	// Check if the recipient ID corresponds to a valid group.
-	members, err := h.GroupService.GetMembers(context.Background(), message.RecipientID)
-
-	if err == nil && len(members) > 0 {
-		// Case A: It's a group message.
-		h.handleGroupBroadcast(message, members)
-	} else {
-		// Case B: It's a P2P message.
-		h.handleP2PBroadcast(message)
+	if message.GroupID != 0 {
+		h.handleGroupBroadcast(message)
+		return
 	}
+	h.handleP2PBroadcast(message)
 }
 
 // handleGroupBroadcast persists a group message by calling the message service.
 // The service is then responsible for calling back to the hub to dispatch the message.
-func (h *Hub) handleGroupBroadcast(message *Message, members []int64) {
-	log.Printf("Persisting GROUP message from User %d to Group %d...", message.SenderID, message.RecipientID)
+func (h *Hub) handleGroupBroadcast(message *Message) {
+	// Enforce membership and the group's posting policy before persisting anything.
+	if err := h.Authorizer.Can(context.Background(), domain.UserSubject(message.SenderID), domain.ActionGroupPost, domain.GroupResource(message.GroupID)); err != nil {
+		log.Printf("Refused GROUP message from User %d to Group %d: %v", message.SenderID, message.GroupID, err)
+		if restricted, ok := err.(*domain.PostingRestrictedError); ok {
+			h.sendMessageToUser(message.SenderID, NewErrorMessage(restricted.Code, restricted.Msg, restricted.RetryAfter()))
+		}
+		return
+	}
+
+	log.Printf("Persisting GROUP message from User %d to Group %d...", message.SenderID, message.GroupID)
 
 	domainMsg := &domain.Message{
 		SenderID:    message.SenderID,
-		RecipientID: message.RecipientID,
+		RecipientID: message.GroupID,
 		Type:        message.Type,
 		Content:     message.Content,
 		MediaURL:    message.MediaURL,
+		MediaID:     message.MediaID,
+		Attachment:  message.Attachment,
 		Timestamp:   message.Timestamp,
 		Status:      domain.MessageSent, // Group messages are not queued for offline users
 	}
 
 	// Persist the message. The MessageService will call hub.BroadcastGroupMessage for dispatch.
-	if _, err := h.MessageService.Save(context.Background(), domainMsg); err != nil {
+	if _, err := h.MessageService.SaveGroupMessage(context.Background(), domainMsg); err != nil {
 		log.Printf("Error persisting group message: %v", err)
+		if restricted, ok := err.(*domain.PostingRestrictedError); ok {
+			h.sendMessageToUser(message.SenderID, NewErrorMessage(restricted.Code, restricted.Msg, restricted.RetryAfter()))
+		}
 	}
 }
 
 // handleP2PBroadcast persists a P2P message by calling the message service.
 // The service is then responsible for calling back to the hub to dispatch the message.
 func (h *Hub) handleP2PBroadcast(message *Message) {
+	if err := h.Authorizer.Can(context.Background(), domain.UserSubject(message.SenderID), domain.ActionUserMessage, domain.UserResource(message.RecipientID)); err != nil {
+		log.Printf("Refused P2P message from User %d to User %d: %v", message.SenderID, message.RecipientID, err)
+		if _, ok := err.(*domain.NotFoundError); ok {
+			h.sendMessageToUser(message.SenderID, NewErrorMessage(CodeRecipientNotFound, "Recipient user not found.", 0))
+		}
+		return
+	}
+
 	log.Printf("Persisting P2P message from User %d to User %d...", message.SenderID, message.RecipientID)
 
 	// Determine message status based on recipient's online status.
 	status := domain.MessageSent
-	if !h.isUserOnline(message.RecipientID) {
+	if !h.IsUserOnline(message.RecipientID) {
 		status = domain.MessagePending
 	}
 
@@ -259,6 +295,8 @@ func (h *Hub) handleP2PBroadcast(message *Message) {
 		Type:        message.Type,
 		Content:     message.Content,
 		MediaURL:    message.MediaURL,
+		MediaID:     message.MediaID,
+		Attachment:  message.Attachment,
 		Timestamp:   message.Timestamp,
 		Status:      status,
 	}
@@ -269,14 +307,27 @@ func (h *Hub) handleP2PBroadcast(message *Message) {
 	}
 }
 
-// isUserOnline checks if a user has at least one active WebSocket connection.
-func (h *Hub) isUserOnline(userID int64) bool {
+// IsUserOnline checks if a user has at least one active WebSocket connection.
+// Group member listings use it to mark who is online.
+func (h *Hub) IsUserOnline(userID int64) bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	connections, ok := h.clients[userID]
 	return ok && len(connections) > 0
 }
 
+// ConnectionStats counts the live connections and the distinct users they belong to.
+func (h *Hub) ConnectionStats() domain.ConnectionStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stats := domain.ConnectionStats{OnlineUsers: len(h.clients)}
+	for _, connections := range h.clients {
+		stats.Connections += len(connections)
+	}
+	return stats
+}
+
 // sendMessageToUser sends a message to all active clients of a specific UserID.
 func (h *Hub) sendMessageToUser(userID int64, message *Message) {
 	h.mu.RLock()
@@ -303,11 +354,17 @@ func (h *Hub) domainToWsMessage(dMsg *domain.Message) *Message {
     return &Message{
         SenderID:    dMsg.SenderID,
         RecipientID: dMsg.RecipientID,
+        GroupID:     dMsg.GroupID,
         Type:        dMsg.Type,
         Content:     dMsg.Content,
 	MediaURL:    dMsg.MediaURL,
+	MediaID:     dMsg.MediaID,
+	Image:       dMsg.Image,
+	Attachment:  dMsg.Attachment,
+	ForwardedFrom: dMsg.ForwardedFrom,
         Timestamp:   dMsg.Timestamp,
         ID:          dMsg.ID, 
+        IsBot:       dMsg.IsBot,
     }
 }
 
@@ -327,7 +384,7 @@ func (h *Hub) BroadcastGroupMessage(groupID int64, message *domain.Message) {
 
 	// Dispatch the message only to the ONLINE members of the group.
 	for _, memberID := range members {
-		if h.isUserOnline(memberID) {
+		if h.IsUserOnline(memberID) {
 			h.sendMessageToUser(memberID, wsMsg)
 		}
 	}
@@ -353,3 +410,128 @@ func (h *Hub) BroadcastP2PMessage(senderID int64, recipientID int64, message *do
 
     log.Printf("P2P message (ID %d) from User %d dispatched to User %d.", wsMsg.ID, senderID, recipientID)
 }
+
+// MediaRejected implements domain.UploadNotifier: it tells the uploader's live clients that the
+// malware scan rejected one of their uploads. The notice is also saved as a system message, left
+// pending if the uploader is offline so that it is delivered when they reconnect.
+func (h *Hub) MediaRejected(ownerID int64, media *domain.Media) {
+	notice := NewErrorMessage(domain.CodeMediaRejected, fmt.Sprintf("Your upload %q was rejected by the malware scan (%s).", media.Filename, media.ScanResult), 0)
+	notice.MediaID = media.ID
+
+	status := domain.MessageSent
+	if !h.IsUserOnline(ownerID) {
+		status = domain.MessagePending
+	}
+	saved, err := h.MessageService.SaveSystemNotice(context.Background(), ownerID, notice.Content, media.ID, status)
+	if err != nil {
+		log.Printf("Error saving the rejection notice of upload %s for User %d: %v", media.ID, ownerID, err)
+	} else {
+		notice.ID = saved.ID
+	}
+	h.sendMessageToUser(ownerID, notice)
+}
+
+// MessagePinned implements domain.PinNotifier: it tells the live clients of a group's members, or of
+// both P2P participants, that actorID pinned or unpinned a message. The event's id is the message's,
+// its sender_id the actor's and its group_id or recipient_id identify the conversation.
+func (h *Hub) MessagePinned(actorID, groupID int64, message *domain.Message, pinned bool) {
+	event := &Message{
+		ID:        message.ID,
+		SenderID:  actorID,
+		GroupID:   groupID,
+		Type:      domain.MessageUnpinnedEvent,
+		Timestamp: time.Now(),
+	}
+	if pinned {
+		event.Type = domain.MessagePinnedEvent
+	}
+
+	if groupID != 0 {
+		members, err := h.GroupService.GetMembers(context.Background(), groupID)
+		if err != nil {
+			log.Printf("Error getting members for group %d to announce a pin: %v", groupID, err)
+			return
+		}
+		for _, memberID := range members {
+			h.sendMessageToUser(memberID, event)
+		}
+		return
+	}
+
+	// The actor is one of the participants; the event names the other one.
+	event.RecipientID = message.RecipientID
+	if actorID == message.RecipientID {
+		event.RecipientID = message.SenderID
+	}
+	h.sendMessageToUser(actorID, event)
+	if event.RecipientID != actorID {
+		h.sendMessageToUser(event.RecipientID, event)
+	}
+}
+
+// DisconnectGroup detaches every live client of the given (former) members from a group
+// that has been deleted, and tells them why so they can leave the conversation view.
+func (h *Hub) DisconnectGroup(groupID int64, memberIDs []int64) {
+	h.detachFromGroup(groupID, memberIDs, NewErrorMessage(domain.CodeGroupDeleted, "This group has been deleted.", 0))
+	log.Printf("Group %d deleted: detached live clients of %d members.", groupID, len(memberIDs))
+}
+
+// RemoveFromGroup detaches a user who was banned from a group and tells them why.
+func (h *Hub) RemoveFromGroup(groupID int64, userID int64) {
+	h.detachFromGroup(groupID, []int64{userID}, NewErrorMessage(domain.CodeBanned, "You have been banned from this group.", 0))
+	log.Printf("User %d removed from Group %d: detached live clients.", userID, groupID)
+}
+
+// detachFromGroup clears the group chat context of the users' live clients and sends them a notice.
+func (h *Hub) detachFromGroup(groupID int64, userIDs []int64, notice *Message) {
+	notice.GroupID = groupID
+
+	for _, userID := range userIDs {
+		h.mu.RLock()
+		for _, client := range h.clients[userID] {
+			client.leaveGroup(groupID)
+		}
+		h.mu.RUnlock()
+
+		h.sendMessageToUser(userID, notice)
+	}
+}
+
+// DisconnectSession closes every live connection authenticated with the given session,
+// e.g. after the user logged out or the session was revoked.
+func (h *Hub) DisconnectSession(sessionID string) {
+	var toClose []*Client
+	h.mu.RLock()
+	for _, connections := range h.clients {
+		for _, client := range connections {
+			if client.SessionID == sessionID {
+				toClose = append(toClose, client)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	h.closeClients(toClose)
+	if len(toClose) > 0 {
+		log.Printf("Session %s revoked: closed %d live connection(s).", sessionID, len(toClose))
+	}
+}
+
+// DisconnectUser closes all live connections of a user, e.g. after all their sessions were revoked.
+func (h *Hub) DisconnectUser(userID int64) {
+	h.mu.RLock()
+	toClose := append([]*Client(nil), h.clients[userID]...)
+	h.mu.RUnlock()
+
+	h.closeClients(toClose)
+	if len(toClose) > 0 {
+		log.Printf("User %d signed out everywhere: closed %d live connection(s).", userID, len(toClose))
+	}
+}
+
+// closeClients unregisters clients through the Run loop so each send channel is closed exactly once.
+func (h *Hub) closeClients(clients []*Client) {
+	for _, client := range clients {
+		h.Unregister <- client
+	}
+}
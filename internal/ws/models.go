@@ -16,9 +16,20 @@ type Message struct {
 	GroupID int64 `json:"group_id,omitempty"`
 	Content     string `json:"content"`
 	MediaURL    string     `json:"media_url,omitempty"`
+	MediaID     string     `json:"media_id,omitempty"` // Upload from POST /v1/media; the server fills in media_url
+	Image       *domain.ImageInfo `json:"image,omitempty"` // Set by the server on processed image messages
+	Attachment  *domain.AttachmentInfo `json:"attachment,omitempty"` // Senders supply duration_ms and a voice note's waveform; the server fills in the rest
+	ForwardedFrom *domain.ForwardInfo `json:"forwarded_from,omitempty"` // Set by the server on forwarded copies; ignored from clients
 	Timestamp   time.Time `json:"timestamp"`
+	IsBot       bool      `json:"is_bot,omitempty"` // Sent by a bot account
+	// Code and RetryAfter are only set on system messages reporting a refused send.
+	Code        string `json:"code,omitempty"`
+	RetryAfter  int    `json:"retry_after,omitempty"` // seconds until the client may retry
 }
 
+// CodeRecipientNotFound is sent when a P2P message is addressed to a user that does not exist.
+const CodeRecipientNotFound = "RECIPIENT_NOT_FOUND"
+
 // NewSystemMessage creates a simple system message for feedback.
 func NewSystemMessage(content string) *Message {
 	return &Message{
@@ -29,3 +40,11 @@ func NewSystemMessage(content string) *Message {
 		Timestamp:   time.Now(),
 	}
 }
+
+// NewErrorMessage creates a system message telling the client why a send was refused.
+func NewErrorMessage(code string, content string, retryAfter time.Duration) *Message {
+	msg := NewSystemMessage(content)
+	msg.Code = code
+	msg.RetryAfter = int(retryAfter / time.Second)
+	return msg
+}
@@ -4,11 +4,22 @@ import (
 	"context" // <-- FIX: ADDED MISSING CONTEXT IMPORT
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Emmanuel326/chatserver/internal/api"
 	"github.com/Emmanuel326/chatserver/internal/auth"
+	"github.com/Emmanuel326/chatserver/internal/authz"
 	"github.com/Emmanuel326/chatserver/internal/config"
 	"github.com/Emmanuel326/chatserver/internal/domain"
+	"github.com/Emmanuel326/chatserver/internal/ports/mail"
+	"github.com/Emmanuel326/chatserver/internal/ports/media"
+	"github.com/Emmanuel326/chatserver/internal/ports/scanner"
+	"github.com/Emmanuel326/chatserver/internal/ports/oidc"
 	"github.com/Emmanuel326/chatserver/internal/ports/sqlite"
 	"github.com/Emmanuel326/chatserver/internal/ws"
 	"github.com/Emmanuel326/chatserver/pkg/logger"
@@ -32,11 +43,23 @@ type ApplicationServices struct {
 	UserRepository domain.UserRepository
 	MessageRepository domain.MessageRepository
 	GroupRepository domain.GroupRepository
+	SessionRepository domain.SessionRepository
+	TwoFactorRepository domain.TwoFactorRepository
 
 	// Domain Services (Interfaces) - These are the logic layers
 	UserService domain.UserService
 	MessageService domain.MessageService
 	GroupService domain.GroupService
+	SessionService domain.SessionService
+	TwoFactorService domain.TwoFactorService
+	AccountService domain.AccountService
+	LoginThrottleService domain.LoginThrottleService
+	APITokenService domain.APITokenService
+	OIDCService domain.OIDCService // nil unless OIDC_ISSUER is configured
+	Authorizer domain.Authorizer
+	AdminService domain.AdminService
+	MediaService domain.MediaService
+	PinService domain.PinService
 
 	// Auth Component
 	JWTManager *auth.JWTManager
@@ -46,6 +69,140 @@ type ApplicationServices struct {
 }
 
 
+// splitList splits a comma-separated setting, dropping blank entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// promoteAdmins grants server administrator rights to the accounts listed in ADMIN_EMAILS,
+// so a fresh installation has an operator who can then manage the others through /v1/admin.
+func promoteAdmins(ctx context.Context, userRepo domain.UserRepository, emails string) {
+	for _, email := range strings.Split(emails, ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		user, err := userRepo.GetByEmail(ctx, email)
+		if err != nil {
+			logger.Log().Warn("ADMIN_EMAILS lists an unknown account", zap.String("email", email))
+			continue
+		}
+		if user.IsAdmin {
+			continue
+		}
+		if err := userRepo.SetAdmin(ctx, user.ID, true); err != nil {
+			logger.Log().Error("Failed to promote administrator", zap.String("email", email), zap.Error(err))
+			continue
+		}
+		logger.Log().Info("Promoted server administrator", zap.String("email", email))
+	}
+}
+
+// parseSizes parses a comma-separated list of positive integers, skipping invalid entries.
+func parseSizes(value string) []int {
+	var sizes []int
+	for _, item := range splitList(value) {
+		size, err := strconv.Atoi(item)
+		if err != nil || size <= 0 {
+			logger.Log().Warn("Ignoring invalid size", zap.String("value", item))
+			continue
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes
+}
+
+// parseDirectoryFields parses USER_DIRECTORY_FIELDS, skipping unknown fields.
+func parseDirectoryFields(value string) domain.DirectorySettings {
+	var settings domain.DirectorySettings
+	for _, field := range splitList(value) {
+		switch field {
+		case domain.DirectoryFieldUsername, domain.DirectoryFieldDisplayName, domain.DirectoryFieldEmail:
+			settings.Fields = append(settings.Fields, field)
+		default:
+			logger.Log().Warn("Ignoring unknown user directory field", zap.String("value", field))
+		}
+	}
+	return settings
+}
+
+// Image processing limits: how many images may wait for a worker, and the largest image
+// (in pixels) that is decoded for thumbnails; a 40 megapixel photo needs about 160 MB.
+const (
+	imageQueueSize = 256
+	maxImagePixels = 40_000_000
+)
+
+// orphanSweepInterval is how often abandoned uploads are looked for.
+const orphanSweepInterval = time.Hour
+
+// shutdownTimeout is how long in-flight requests and queued emails get to finish on shutdown.
+const shutdownTimeout = 30 * time.Second
+
+// expirySweepInterval is how often expired rows (login states, revoked tokens...) are deleted.
+const expirySweepInterval = time.Hour
+
+// Malware scanning: how many uploads may wait for a worker, and how often uploads still
+// waiting (after a restart, a full queue or a scanner failure) are queued again.
+const (
+	scanQueueSize     = 256
+	scanSweepInterval = time.Minute
+)
+
+// cleanupOrphanedMedia periodically deletes uploads that were never finished or never sent.
+func cleanupOrphanedMedia(ctx context.Context, mediaService domain.MediaService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		removed, err := mediaService.CleanupOrphans(ctx)
+		if err != nil {
+			logger.Log().Error("Failed to clean up orphaned uploads", zap.Error(err))
+		} else if removed > 0 {
+			logger.Log().Info("Removed orphaned uploads", zap.Int("count", removed))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expiredRecords is a kind of short-lived row that is deleted once it expires.
+type expiredRecords struct {
+	name  string
+	purge func(ctx context.Context, now time.Time) (int64, error)
+}
+
+// purgeExpiredRecords periodically deletes expired rows so their tables do not grow forever.
+func purgeExpiredRecords(ctx context.Context, interval time.Duration, records ...expiredRecords) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, r := range records {
+			removed, err := r.purge(ctx, time.Now())
+			if err != nil {
+				logger.Log().Error("Failed to purge expired records", zap.String("records", r.name), zap.Error(err))
+			} else if removed > 0 {
+				logger.Log().Info("Purged expired records", zap.String("records", r.name), zap.Int64("count", removed))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // createDefaultUsers checks if "tom" and "jerry" exist and creates them if not.
 func createDefaultUsers(ctx context.Context, userService domain.UserService) {
 	defaultUsers := []struct {
@@ -81,6 +238,9 @@ func createDefaultUsers(ctx context.Context, userService domain.UserService) {
 func main() {
 	// --- 1. Load Configuration ---
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		logger.Log().Fatal("Refusing to start with an unsafe configuration", zap.Error(err))
+	}
 
 	// --- 2. Initialize Database Connection and Migration ---
 	db := sqlite.InitDB(cfg)
@@ -94,9 +254,27 @@ func main() {
 	router := setupRouter(app)
 
 	// Use the new logger setup from the team
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: ":" + cfg.SERVER_PORT, Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Log().Fatal("Server failed to start:", zap.Error(err))
+		}
+	}()
 	logger.Log().Info(fmt.Sprintf("🚀 Server running on http://localhost:%s", cfg.SERVER_PORT))
-	if err := router.Run(":" + cfg.SERVER_PORT); err != nil {
-		logger.Log().Fatal("Server failed to start:", zap.Error(err))
+
+	// --- 5. Shut down gracefully on SIGINT/SIGTERM ---
+	<-ctx.Done()
+	logger.Log().Info("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Log().Error("Failed to stop the HTTP server cleanly", zap.Error(err))
+	}
+	// Emails queued by the last requests (password resets, verifications) still go out
+	if err := app.AccountService.Shutdown(shutdownCtx); err != nil {
+		logger.Log().Error("Failed to finish sending emails", zap.Error(err))
 	}
 }
 
@@ -106,24 +284,109 @@ func buildApplicationServices(cfg *config.Config, db *sqlx.DB) *ApplicationServi
 	userRepo := sqlite.NewUserRepository(db)
 	messageRepo := sqlite.NewMessageRepository(db)
 	groupRepo := sqlite.NewGroupRepository(db)
+	sessionRepo := sqlite.NewSessionRepository(db)
+	twoFactorRepo := sqlite.NewTwoFactorRepository(db)
+	actionTokenRepo := sqlite.NewActionTokenRepository(db)
+	mediaRepo := sqlite.NewMediaRepository(db)
 
 	// --- Initialize Core Components and Domain Services ---
-	jwtManager := auth.NewJWTManager(cfg)
-	userService := domain.NewUserService(userRepo)
-	groupService := domain.NewGroupService(groupRepo, userRepo)
+	jwtManager, err := auth.NewJWTManager(cfg)
+	if err != nil {
+		logger.Log().Fatal("Failed to initialize JWT signing", zap.Error(err))
+	}
+	twoFactorService := domain.NewTwoFactorService(twoFactorRepo, userRepo)
+	userService := domain.NewUserService(userRepo, twoFactorService, cfg.REQUIRE_EMAIL_VERIFICATION, parseDirectoryFields(cfg.USER_DIRECTORY_FIELDS))
+	sessionService := domain.NewSessionService(sessionRepo, time.Duration(cfg.REFRESH_TOKEN_EXPIRY)*time.Hour)
+	mailer, err := mail.NewMailer(cfg)
+	if err != nil {
+		logger.Log().Fatal("Failed to initialize mailer", zap.Error(err))
+	}
+	accountService := domain.NewAccountService(userRepo, actionTokenRepo, sessionService, mailer, cfg.EMAIL_TOKEN_SECRET, cfg.APP_BASE_URL)
+	loginThrottleService := domain.NewLoginThrottleService(sqlite.NewLoginThrottleRepository(db), domain.LoginThrottleSettings{
+		FailureWindow:      time.Duration(cfg.LOGIN_FAILURE_WINDOW_MINUTES) * time.Minute,
+		BackoffThreshold:   cfg.LOGIN_BACKOFF_THRESHOLD,
+		IPBackoffThreshold: cfg.LOGIN_IP_BACKOFF_THRESHOLD,
+		BackoffBase:        time.Duration(cfg.LOGIN_BACKOFF_BASE_SECONDS) * time.Second,
+		LockoutThreshold:   cfg.LOGIN_LOCKOUT_THRESHOLD,
+		IPLockoutThreshold: cfg.LOGIN_IP_LOCKOUT_THRESHOLD,
+		LockoutDuration:    time.Duration(cfg.LOGIN_LOCKOUT_MINUTES) * time.Minute,
+		AuditRetention:     time.Duration(cfg.LOGIN_FAILURE_RETENTION_DAYS) * 24 * time.Hour,
+	})
+	apiTokenRepo := sqlite.NewAPITokenRepository(db)
+	apiTokenService := domain.NewAPITokenService(apiTokenRepo, userRepo)
+	identityRepo := sqlite.NewIdentityRepository(db)
+	var oidcService domain.OIDCService
+	if cfg.OIDC_ISSUER != "" {
+		provider := oidc.NewProvider(cfg.OIDC_ISSUER, cfg.OIDC_CLIENT_ID, cfg.OIDC_CLIENT_SECRET, cfg.OIDC_REDIRECT_URL, strings.Fields(cfg.OIDC_SCOPES))
+		oidcService = domain.NewOIDCService(provider, identityRepo, userRepo)
+		logger.Log().Info("OIDC login enabled", zap.String("issuer", cfg.OIDC_ISSUER))
+	}
+	// Every authorization decision (HTTP, services and the hub) goes through this policy
+	authorizer := authz.NewPolicy(groupRepo, userRepo, messageRepo, mediaRepo)
+	groupService := domain.NewGroupService(groupRepo, userRepo, authorizer, domain.MessageRetention(cfg.GROUP_MESSAGE_RETENTION))
 	createDefaultUsers(context.Background(), userService)
+	promoteAdmins(context.Background(), userRepo, cfg.ADMIN_EMAILS)
 
 	// HANDLE CIRCULAR DEPENDENCY & HUB INITIALIZATION:
 	// 1. Initialize the Hub with a nil MessageService initially.
-	chatHub := ws.NewHub(nil, groupService, userService)
+	chatHub := ws.NewHub(nil, groupService, userService, authorizer)
 	go chatHub.Run()
 
+	mediaStore, err := media.NewStore(cfg)
+	if err != nil {
+		logger.Log().Fatal("Failed to initialize media storage", zap.Error(err))
+	}
+	imageProcessor := domain.NewImageProcessor(mediaRepo, messageRepo, mediaStore, domain.ImageSettings{
+		Workers:        cfg.MEDIA_IMAGE_WORKERS,
+		QueueSize:      imageQueueSize,
+		ThumbnailSizes: parseSizes(cfg.MEDIA_THUMBNAIL_SIZES),
+		MaxPixels:      maxImagePixels,
+	})
+	go imageProcessor.Run()
+
+	malwareScanner, err := scanner.New(cfg)
+	if err != nil {
+		logger.Log().Fatal("Failed to initialize malware scanning", zap.Error(err))
+	}
+	uploadScanner := domain.NewUploadScanner(mediaRepo, mediaStore, malwareScanner, chatHub, domain.ScanSettings{
+		Workers:   cfg.MEDIA_SCAN_WORKERS,
+		QueueSize: scanQueueSize,
+		Sweep:     scanSweepInterval,
+		Timeout:   time.Duration(cfg.CLAMD_TIMEOUT_SECONDS) * time.Second,
+	})
+	go uploadScanner.Run()
+
+	storageQuotas := domain.StorageQuotas{
+		UserBytes:  int64(cfg.MEDIA_USER_QUOTA_MB) << 20,
+		GroupBytes: int64(cfg.MEDIA_GROUP_QUOTA_MB) << 20,
+	}
+
 	// 2. Initialize MessageService, passing the hub instance to it.
-	messageService := domain.NewMessageService(messageRepo, userRepo, groupRepo, chatHub)
+	messageService := domain.NewMessageService(messageRepo, userRepo, groupRepo, mediaRepo, imageProcessor, storageQuotas, authorizer, chatHub)
 
 	// 3. Inject the created MessageService back into the Hub.
 	chatHub.MessageService = messageService
 
+	mediaService := domain.NewMediaService(mediaRepo, mediaStore, uploadScanner, authorizer, domain.MediaSettings{
+		MaxUploadBytes: int64(cfg.MEDIA_MAX_UPLOAD_MB) << 20,
+		AllowedTypes:   splitList(cfg.MEDIA_ALLOWED_TYPES),
+		PresignExpiry:  time.Duration(cfg.MEDIA_PRESIGN_MINUTES) * time.Minute,
+		OrphanTTL:      time.Duration(cfg.MEDIA_ORPHAN_TTL_HOURS) * time.Hour,
+		Quotas:         storageQuotas,
+		ScanUploads:    cfg.MEDIA_SCANNER != "none",
+	})
+	go cleanupOrphanedMedia(context.Background(), mediaService, orphanSweepInterval)
+	go purgeExpiredRecords(context.Background(), expirySweepInterval,
+		expiredRecords{"OIDC login states", identityRepo.DeleteExpiredLoginStates},
+		expiredRecords{"revoked access tokens", sessionRepo.DeleteExpiredDeniedTokens},
+		expiredRecords{"login throttles and failures", loginThrottleService.PurgeExpired},
+		expiredRecords{"used password reset and verification tokens", actionTokenRepo.DeleteExpiredTokens},
+	)
+
+	pinService := domain.NewPinService(sqlite.NewPinRepository(db), messageRepo, authorizer, chatHub)
+
+	adminService := domain.NewAdminService(userRepo, groupRepo, apiTokenRepo, sqlite.NewAuditRepository(db), groupService, sessionService, chatHub, authorizer)
+
 	// --- Package Services for Injection ---
 	return &ApplicationServices{
 		Config:            cfg,
@@ -131,9 +394,21 @@ func buildApplicationServices(cfg *config.Config, db *sqlx.DB) *ApplicationServi
 		UserRepository:    userRepo,
 		MessageRepository: messageRepo,
 		GroupRepository:   groupRepo,
+		SessionRepository: sessionRepo,
+		TwoFactorRepository: twoFactorRepo,
 		UserService:       userService,
 		MessageService:    messageService,
 		GroupService:      groupService,
+		SessionService:    sessionService,
+		TwoFactorService:  twoFactorService,
+		AccountService:    accountService,
+		LoginThrottleService: loginThrottleService,
+		APITokenService:   apiTokenService,
+		OIDCService:       oidcService,
+		Authorizer:        authorizer,
+		AdminService:      adminService,
+		MediaService:      mediaService,
+		PinService:        pinService,
 		JWTManager:        jwtManager,
 		ChatHub:           chatHub,
 	}
@@ -157,6 +432,17 @@ func setupRouter(app *ApplicationServices) *gin.Engine {
 		app.ChatHub,
 		app.MessageService,
 		app.GroupService,
+		app.SessionService,
+		app.TwoFactorService,
+		app.AccountService,
+		app.LoginThrottleService,
+		app.APITokenService,
+		app.OIDCService,
+		app.Authorizer,
+		app.AdminService,
+		app.MediaService,
+		app.PinService,
+		int64(app.Config.MEDIA_MAX_UPLOAD_MB)<<20,
 	)
 
 	return router
@@ -0,0 +1,309 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+var (
+	jpegSOI       = []byte{0xFF, 0xD8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	riffHeader    = []byte("RIFF")
+	webpFourCC    = []byte("WEBP")
+	exifHeader    = []byte("Exif\x00\x00")
+	xmpHeader     = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpPNGKeyword = []byte("XML:com.adobe.xmp\x00")
+	gpsMarker     = []byte("GPS")
+)
+
+// EXIF tags used here.
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+// VP8X flag set when a WebP file has an XMP chunk.
+const webpXMPFlag = 0x04
+
+// StripGPS removes location data from a JPEG, PNG or WebP file: the GPS directory of its EXIF
+// metadata and any XMP packet that mentions GPS. The rest of the metadata, such as the
+// orientation, is kept. It reports whether anything was removed; data itself is not modified.
+// Malformed metadata is left as it is.
+func StripGPS(data []byte) ([]byte, bool) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data)
+	case len(data) >= 12 && bytes.HasPrefix(data, riffHeader) && bytes.Equal(data[8:12], webpFourCC):
+		return stripWebP(data)
+	default:
+		return data, false
+	}
+}
+
+// Orientation returns the EXIF orientation (1-8) of a JPEG file, or 1 if it has none.
+func Orientation(data []byte) int {
+	orientation := 1
+	if !bytes.HasPrefix(data, jpegSOI) {
+		return orientation
+	}
+	jpegSegments(data, func(marker byte, start, end int) bool {
+		payload := data[start+4 : end]
+		if marker != 0xE1 || !bytes.HasPrefix(payload, exifHeader) {
+			return true
+		}
+		if o := tiffOrientation(payload[len(exifHeader):]); o >= 1 && o <= 8 {
+			orientation = o
+		}
+		return false
+	})
+	return orientation
+}
+
+func stripJPEG(data []byte) ([]byte, bool) {
+	buf := append([]byte(nil), data...)
+	var out bytes.Buffer
+	last, changed := 0, false
+
+	jpegSegments(buf, func(marker byte, start, end int) bool {
+		if marker != 0xE1 {
+			return true
+		}
+		payload := buf[start+4 : end]
+		switch {
+		case bytes.HasPrefix(payload, exifHeader):
+			if stripTIFFGPS(payload[len(exifHeader):]) {
+				changed = true
+			}
+		case bytes.HasPrefix(payload, xmpHeader) && bytes.Contains(payload, gpsMarker):
+			out.Write(buf[last:start])
+			last = end
+			changed = true
+		}
+		return true
+	})
+	if !changed {
+		return data, false
+	}
+	out.Write(buf[last:])
+	return out.Bytes(), true
+}
+
+// jpegSegments calls fn with the bounds of each marker segment before the image data, until
+// fn returns false. The payload of a segment starts 4 bytes after start.
+func jpegSegments(data []byte, fn func(marker byte, start, end int) bool) {
+	pos := len(jpegSOI)
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			pos++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8): // no payload
+			pos += 2
+			continue
+		case marker == 0xDA || marker == 0xD9: // start of scan, end of image
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return
+		}
+		if !fn(marker, pos, end) {
+			return
+		}
+		pos = end
+	}
+}
+
+func stripPNG(data []byte) ([]byte, bool) {
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	changed := false
+
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			break
+		}
+		chunk := append([]byte(nil), data[pos:end]...)
+		kind, body := chunk[4:8], chunk[8:8+length]
+
+		switch {
+		case string(kind) == "eXIf":
+			if stripTIFFGPS(body) {
+				binary.BigEndian.PutUint32(chunk[8+length:], crc32.ChecksumIEEE(chunk[4:8+length]))
+				changed = true
+			}
+		case string(kind) == "iTXt" && bytes.HasPrefix(body, xmpPNGKeyword) && bytes.Contains(body, gpsMarker):
+			pos = end
+			changed = true
+			continue
+		}
+		out.Write(chunk)
+		pos = end
+	}
+	if !changed {
+		return data, false
+	}
+	out.Write(data[pos:])
+	return out.Bytes(), true
+}
+
+// stripWebP handles the EXIF and XMP chunks of a WebP (RIFF) file. Chunks are padded to an
+// even length; removing one updates the RIFF size and clears the XMP flag of the VP8X header.
+func stripWebP(data []byte) ([]byte, bool) {
+	var out bytes.Buffer
+	out.Write(data[:12])
+	changed, removed := false, 0
+
+	pos := 12
+	for pos+8 <= len(data) {
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + length + length%2
+		if length < 0 || end > len(data) {
+			if pos+8+length != len(data) { // the last chunk may lack its padding byte
+				break
+			}
+			end = len(data)
+		}
+		chunk := append([]byte(nil), data[pos:end]...)
+		kind, body := string(chunk[:4]), chunk[8:8+length]
+
+		switch {
+		case kind == "EXIF":
+			// Some writers keep the JPEG "Exif" prefix; the TIFF structure follows it.
+			if stripTIFFGPS(bytes.TrimPrefix(body, exifHeader)) {
+				changed = true
+			}
+		case kind == "XMP " && bytes.Contains(body, gpsMarker):
+			pos = end
+			changed = true
+			removed += len(chunk)
+			continue
+		}
+		out.Write(chunk)
+		pos = end
+	}
+	if !changed {
+		return data, false
+	}
+	out.Write(data[pos:])
+	stripped := out.Bytes()
+	if removed > 0 {
+		if size := binary.LittleEndian.Uint32(stripped[4:]); size >= uint32(removed) {
+			binary.LittleEndian.PutUint32(stripped[4:], size-uint32(removed))
+		}
+		if len(stripped) >= 21 && string(stripped[12:16]) == "VP8X" {
+			stripped[20] &^= webpXMPFlag
+		}
+	}
+	return stripped, true
+}
+
+// tiffIFD0 returns the byte order of a TIFF structure (the body of EXIF metadata) and the
+// offset and entry count of its first directory.
+func tiffIFD0(tiff []byte) (binary.ByteOrder, int, int, bool) {
+	if len(tiff) < 8 {
+		return nil, 0, 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, 0, false
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return nil, 0, 0, false
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	if ifd+2+12*n+4 > len(tiff) {
+		return nil, 0, 0, false
+	}
+	return order, ifd, n, true
+}
+
+func tiffOrientation(tiff []byte) int {
+	order, ifd, n, ok := tiffIFD0(tiff)
+	if !ok {
+		return 0
+	}
+	for i := 0; i < n; i++ {
+		entry := ifd + 2 + 12*i
+		if order.Uint16(tiff[entry:]) == tagOrientation {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// stripTIFFGPS erases the GPS directory in place and removes the first directory's pointer
+// to it, shifting the entries after it. Offsets elsewhere are absolute, so nothing else moves.
+func stripTIFFGPS(tiff []byte) bool {
+	order, ifd, n, ok := tiffIFD0(tiff)
+	if !ok {
+		return false
+	}
+	entriesEnd := ifd + 2 + 12*n + 4 // including the pointer to the next directory
+	for i := 0; i < n; i++ {
+		entry := ifd + 2 + 12*i
+		if order.Uint16(tiff[entry:]) != tagGPSInfo {
+			continue
+		}
+		eraseIFD(tiff, order, int(order.Uint32(tiff[entry+8:])))
+		copy(tiff[entry:entriesEnd], tiff[entry+12:entriesEnd])
+		clear(tiff[entriesEnd-12 : entriesEnd])
+		order.PutUint16(tiff[ifd:], uint16(n-1))
+		return true
+	}
+	return false
+}
+
+// eraseIFD zeroes a directory and the values it stores outside its entries.
+func eraseIFD(tiff []byte, order binary.ByteOrder, offset int) {
+	if offset < 8 || offset+2 > len(tiff) {
+		return
+	}
+	n := int(order.Uint16(tiff[offset:]))
+	end := min(offset+2+12*n+4, len(tiff))
+	for i := 0; i < n; i++ {
+		entry := offset + 2 + 12*i
+		if entry+12 > len(tiff) {
+			break
+		}
+		size := uint64(tiffTypeSize(order.Uint16(tiff[entry+2:]))) * uint64(order.Uint32(tiff[entry+4:]))
+		if size <= 4 {
+			continue
+		}
+		value := uint64(order.Uint32(tiff[entry+8:]))
+		if value+size <= uint64(len(tiff)) {
+			clear(tiff[value : value+size])
+		}
+	}
+	clear(tiff[offset:end])
+}
+
+// tiffTypeSize is the size in bytes of one value of a TIFF field type.
+func tiffTypeSize(fieldType uint16) int {
+	switch fieldType {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,331 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+// gpsLatitude is the value of the fixtures' GPSLatitude tag, 51° 30' 26.44", stored outside
+// the GPS directory's entries.
+var gpsLatitude = []byte{
+	0, 0, 0, 51, 0, 0, 0, 1,
+	0, 0, 0, 30, 0, 0, 0, 1,
+	0, 0, 0x0A, 0x54, 0, 0, 0, 100,
+}
+
+// byteOrder reads and appends TIFF values, like binary.BigEndian and binary.LittleEndian.
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffFixture builds EXIF metadata with an orientation and, if withGPS, a GPS directory holding
+// a latitude reference (stored in its entry) and a latitude (stored after the directory).
+func tiffFixture(order byteOrder, orientation uint16, withGPS bool) []byte {
+	var tiff []byte
+	if order == binary.LittleEndian {
+		tiff = append(tiff, "II"...)
+	} else {
+		tiff = append(tiff, "MM"...)
+	}
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8)
+
+	n := uint16(1)
+	if withGPS {
+		n = 2
+	}
+	gpsIFD := uint32(8 + 2 + 12*int(n) + 4)
+	entry := func(b []byte, tag, fieldType uint16, count, value uint32) []byte {
+		b = order.AppendUint16(b, tag)
+		b = order.AppendUint16(b, fieldType)
+		b = order.AppendUint32(b, count)
+		return order.AppendUint32(b, value)
+	}
+
+	tiff = order.AppendUint16(tiff, n)
+	// SHORT values are left-justified in the value field.
+	tiff = order.AppendUint16(tiff, tagOrientation)
+	tiff = order.AppendUint16(tiff, 3)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)
+	if withGPS {
+		tiff = entry(tiff, tagGPSInfo, 4, 1, gpsIFD)
+	}
+	tiff = order.AppendUint32(tiff, 0) // no next directory
+
+	if withGPS {
+		tiff = order.AppendUint16(tiff, 2)
+		tiff = order.AppendUint16(tiff, 1) // GPSLatitudeRef, ASCII "N" stored in the entry
+		tiff = order.AppendUint16(tiff, 2)
+		tiff = order.AppendUint32(tiff, 2)
+		tiff = append(tiff, 'N', 0, 0, 0)
+		tiff = entry(tiff, 2, 5, 3, gpsIFD+2+2*12+4) // GPSLatitude, 3 rationals
+		tiff = order.AppendUint32(tiff, 0)
+		tiff = append(tiff, gpsLatitude...)
+	}
+	return tiff
+}
+
+func jpegFixture(app1 ...[]byte) []byte {
+	data := append([]byte(nil), jpegSOI...)
+	for _, payload := range app1 {
+		data = append(data, 0xFF, 0xE1)
+		data = binary.BigEndian.AppendUint16(data, uint16(2+len(payload)))
+		data = append(data, payload...)
+	}
+	// A minimal start of scan, some entropy-coded data and the end of the image.
+	return append(data, 0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9)
+}
+
+func pngChunk(kind string, body []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, body...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func pngFixture(chunks ...[]byte) []byte {
+	data := append([]byte(nil), pngSignature...)
+	data = append(data, pngChunk("IHDR", make([]byte, 13))...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return append(data, pngChunk("IEND", nil)...)
+}
+
+func webpChunk(kind string, body []byte) []byte {
+	chunk := append([]byte(kind), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	chunk = append(chunk, body...)
+	if len(body)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func webpFixture(flags byte, chunks ...[]byte) []byte {
+	vp8x := make([]byte, 10)
+	vp8x[0] = flags
+	body := append([]byte("WEBP"), webpChunk("VP8X", vp8x)...)
+	body = append(body, webpChunk("VP8 ", []byte{1, 2, 3})...)
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+var xmpWithGPS = []byte(`<x:xmpmeta><rdf:Description exif:GPSLatitude="51,30.44N"/></x:xmpmeta>`)
+
+// ifd0Entries returns the entry count of the first directory of tiff.
+func ifd0Entries(t *testing.T, tiff []byte) int {
+	t.Helper()
+	_, _, n, ok := tiffIFD0(tiff)
+	if !ok {
+		t.Fatal("stripped metadata has no readable first directory")
+	}
+	return n
+}
+
+func TestStripGPSFromJPEG(t *testing.T) {
+	for _, order := range []byteOrder{binary.BigEndian, binary.LittleEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			exif := append(append([]byte(nil), exifHeader...), tiffFixture(order, 6, true)...)
+			xmp := append(append([]byte(nil), xmpHeader...), xmpWithGPS...)
+			original := jpegFixture(exif, xmp)
+			snapshot := append([]byte(nil), original...)
+
+			stripped, changed := StripGPS(original)
+			if !changed {
+				t.Fatal("nothing was stripped")
+			}
+			if !bytes.Equal(original, snapshot) {
+				t.Error("the input was modified")
+			}
+			if bytes.Contains(stripped, gpsLatitude) || bytes.Contains(stripped, []byte("GPSLatitude")) {
+				t.Error("location data survived")
+			}
+			if got := Orientation(stripped); got != 6 {
+				t.Errorf("orientation = %d, want 6", got)
+			}
+			// The EXIF segment keeps its length; the XMP segment is dropped.
+			tiff := stripped[len(jpegSOI)+4+len(exifHeader) : len(jpegSOI)+4+len(exif)]
+			if n := ifd0Entries(t, tiff); n != 1 {
+				t.Errorf("first directory has %d entries, want 1", n)
+			}
+			if want := len(original) - 4 - len(xmp); len(stripped) != want {
+				t.Errorf("stripped file is %d bytes, want %d", len(stripped), want)
+			}
+			if !bytes.HasSuffix(stripped, []byte{0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9}) {
+				t.Error("image data was not kept")
+			}
+		})
+	}
+}
+
+func TestStripGPSFromPNG(t *testing.T) {
+	xmp := append(append([]byte(nil), xmpPNGKeyword...), xmpWithGPS...)
+	original := pngFixture(pngChunk("eXIf", tiffFixture(binary.BigEndian, 1, true)), pngChunk("iTXt", xmp))
+
+	stripped, changed := StripGPS(original)
+	if !changed {
+		t.Fatal("nothing was stripped")
+	}
+	if bytes.Contains(stripped, gpsLatitude) || bytes.Contains(stripped, []byte("GPSLatitude")) {
+		t.Error("location data survived")
+	}
+
+	// Every chunk left must still have a valid CRC.
+	var kinds []string
+	for pos := len(pngSignature); pos < len(stripped); {
+		length := int(binary.BigEndian.Uint32(stripped[pos:]))
+		end := pos + 12 + length
+		kinds = append(kinds, string(stripped[pos+4:pos+8]))
+		if crc32.ChecksumIEEE(stripped[pos+4:end-4]) != binary.BigEndian.Uint32(stripped[end-4:]) {
+			t.Errorf("%s chunk has a bad CRC", stripped[pos+4:pos+8])
+		}
+		if string(stripped[pos+4:pos+8]) == "eXIf" {
+			if n := ifd0Entries(t, stripped[pos+8:end-4]); n != 1 {
+				t.Errorf("first directory has %d entries, want 1", n)
+			}
+		}
+		pos = end
+	}
+	if got := strings.Join(kinds, ","); got != "IHDR,eXIf,IEND" {
+		t.Errorf("chunks = %s, want IHDR,eXIf,IEND", got)
+	}
+}
+
+func TestStripGPSFromWebP(t *testing.T) {
+	tests := []struct {
+		name string
+		exif []byte
+	}{
+		{"bare TIFF", tiffFixture(binary.LittleEndian, 1, true)},
+		{"with Exif prefix", append(append([]byte(nil), exifHeader...), tiffFixture(binary.LittleEndian, 1, true)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const exifFlag = 0x08
+			original := webpFixture(exifFlag|webpXMPFlag, webpChunk("EXIF", tt.exif), webpChunk("XMP ", xmpWithGPS))
+
+			stripped, changed := StripGPS(original)
+			if !changed {
+				t.Fatal("nothing was stripped")
+			}
+			if bytes.Contains(stripped, gpsLatitude) || bytes.Contains(stripped, []byte("GPSLatitude")) {
+				t.Error("location data survived")
+			}
+			if size := binary.LittleEndian.Uint32(stripped[4:]); int(size) != len(stripped)-8 {
+				t.Errorf("RIFF size = %d, want %d", size, len(stripped)-8)
+			}
+			if flags := stripped[20]; flags != exifFlag {
+				t.Errorf("VP8X flags = %#x, want only the EXIF flag %#x", flags, exifFlag)
+			}
+			if !bytes.Contains(stripped, []byte("VP8 ")) || !bytes.Contains(stripped, []byte("EXIF")) {
+				t.Error("image data or EXIF chunk was dropped")
+			}
+		})
+	}
+}
+
+func TestStripGPSLeavesCleanFilesAlone(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"JPEG":  jpegFixture(append(append([]byte(nil), exifHeader...), tiffFixture(binary.BigEndian, 3, false)...)),
+		"PNG":   pngFixture(pngChunk("eXIf", tiffFixture(binary.BigEndian, 1, false))),
+		"WebP":  webpFixture(0, webpChunk("EXIF", tiffFixture(binary.BigEndian, 1, false))),
+		"GIF":   []byte("GIF89a\x01\x00\x01\x00GPS"),
+		"empty": nil,
+	} {
+		if stripped, changed := StripGPS(data); changed || !bytes.Equal(stripped, data) {
+			t.Errorf("%s: changed = %v, want the file returned as is", name, changed)
+		}
+	}
+}
+
+// malformedTIFFs corrupts the offsets and counts of the GPS fixture.
+func malformedTIFFs() map[string][]byte {
+	corrupt := func(at int, value uint32) []byte {
+		tiff := tiffFixture(binary.BigEndian, 6, true)
+		binary.BigEndian.PutUint32(tiff[at:], value)
+		return tiff
+	}
+	gpsEntry := 8 + 2 + 12 // second entry of the first directory
+	gpsIFD := 8 + 2 + 2*12 + 4
+	return map[string][]byte{
+		"first directory past the end":      corrupt(4, 0xFFFFFFF0),
+		"first directory inside the header": corrupt(4, 2),
+		"first directory entry count":       corrupt(8, 0xFFFF0000),
+		"GPS directory past the end":        corrupt(gpsEntry+8, 0xFFFFFFF0),
+		"GPS directory is the first":        corrupt(gpsEntry+8, 8),
+		"GPS directory entry count":         corrupt(gpsIFD, 0xFFFF0000),
+		"GPS value past the end":            corrupt(gpsIFD+2+12+8, 0xFFFFFFF0),
+		"GPS value count overflows":         corrupt(gpsIFD+2+12+4, 0xFFFFFFFF),
+		"GPS value wraps around":            corrupt(gpsIFD+2+12+8, 0xFFFFFFFF),
+	}
+}
+
+func TestStripGPSSurvivesMalformedMetadata(t *testing.T) {
+	for name, tiff := range malformedTIFFs() {
+		t.Run(name, func(t *testing.T) {
+			for _, data := range [][]byte{
+				jpegFixture(append(append([]byte(nil), exifHeader...), tiff...)),
+				pngFixture(pngChunk("eXIf", tiff)),
+				webpFixture(0, webpChunk("EXIF", tiff)),
+			} {
+				StripGPS(data)
+				Orientation(data)
+			}
+		})
+	}
+}
+
+func TestStripGPSSurvivesTruncatedFiles(t *testing.T) {
+	exif := append(append([]byte(nil), exifHeader...), tiffFixture(binary.BigEndian, 6, true)...)
+	xmp := append(append([]byte(nil), xmpHeader...), xmpWithGPS...)
+	files := map[string][]byte{
+		"JPEG": jpegFixture(exif, xmp),
+		"PNG":  pngFixture(pngChunk("eXIf", tiffFixture(binary.BigEndian, 1, true)), pngChunk("iTXt", append(append([]byte(nil), xmpPNGKeyword...), xmpWithGPS...))),
+		"WebP": webpFixture(webpXMPFlag, webpChunk("EXIF", tiffFixture(binary.LittleEndian, 1, true)), webpChunk("XMP ", xmpWithGPS)),
+	}
+	for name, data := range files {
+		for n := range data {
+			StripGPS(data[:n])
+			Orientation(data[:n])
+		}
+		// A segment or chunk claiming more bytes than the file holds.
+		grown := append([]byte(nil), data...)
+		switch name {
+		case "JPEG":
+			binary.BigEndian.PutUint16(grown[len(jpegSOI)+2:], 0xFFFF)
+		case "PNG":
+			binary.BigEndian.PutUint32(grown[len(pngSignature)+25:], 0x7FFFFFFF)
+		case "WebP":
+			binary.LittleEndian.PutUint32(grown[16:], 0xFFFFFFFF)
+		}
+		if stripped, changed := StripGPS(grown); changed && bytes.Contains(stripped, gpsLatitude) {
+			t.Errorf("%s: reported a change but kept the location", name)
+		}
+	}
+}
+
+func FuzzStripGPS(f *testing.F) {
+	exif := append(append([]byte(nil), exifHeader...), tiffFixture(binary.BigEndian, 6, true)...)
+	f.Add(jpegFixture(exif))
+	f.Add(pngFixture(pngChunk("eXIf", tiffFixture(binary.LittleEndian, 1, true))))
+	f.Add(webpFixture(webpXMPFlag, webpChunk("EXIF", tiffFixture(binary.BigEndian, 1, true)), webpChunk("XMP ", xmpWithGPS)))
+	for _, tiff := range malformedTIFFs() {
+		f.Add(jpegFixture(append(append([]byte(nil), exifHeader...), tiff...)))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		snapshot := append([]byte(nil), data...)
+		StripGPS(data)
+		Orientation(data)
+		if !bytes.Equal(data, snapshot) {
+			t.Error("the input was modified")
+		}
+	})
+}
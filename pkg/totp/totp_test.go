@@ -0,0 +1,100 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 appendix B test vectors, base32 encoded.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeMatchesRFC6238 checks the SHA-1 vectors of RFC 6238 appendix B. The RFC lists
+// 8-digit codes; with 6 digits the code is their last six.
+func TestCodeMatchesRFC6238(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		got, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d returned %v", v.unix, err)
+		}
+		if want := v.want[len(v.want)-Digits:]; got != want {
+			t.Errorf("Code at %d = %s, want %s", v.unix, got, want)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseSecrets(t *testing.T) {
+	upper, err := Code(rfcSecret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lower, err := Code(strings.ToLower(rfcSecret), 1)
+	if err != nil || lower != upper {
+		t.Errorf("Code with a lowercase secret = %q (err %v), want %q", lower, err, upper)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidateAllowsDriftWithinTheWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code, err := Code(rfcSecret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfcSecret, code, now, 1)
+		if want := offset >= -1 && offset <= 1; ok != want {
+			t.Errorf("code %d steps away accepted = %v, want %v", offset, ok, want)
+		}
+		// The matching step is returned so callers can refuse to accept it twice
+		if ok && step != current+offset {
+			t.Errorf("code %d steps away matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"", code[:Digits-1], code + "0", "0" + code, "abcdef"} {
+		if _, ok := Validate(rfcSecret, bad, now, 1); ok {
+			t.Errorf("Validate accepted %q", bad)
+		}
+	}
+	if _, ok := Validate("not base32!", code, now, 1); ok {
+		t.Error("Validate accepted a code for an invalid secret")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != SecretSize {
+		t.Fatalf("secret %q decodes to %d bytes (err %v), want %d", secret, len(key), err, SecretSize)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+}